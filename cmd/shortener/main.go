@@ -5,22 +5,27 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	_ "net/http/pprof" // подключаем пакет pprof
+	"os"
 	"os/signal"
 	"runtime"
 	"syscall"
 	"time"
 
+	"github.com/divanov-web/shorturl/internal/audit"
 	"github.com/divanov-web/shorturl/internal/config"
 	"github.com/divanov-web/shorturl/internal/handlers"
 	"github.com/divanov-web/shorturl/internal/middleware"
+	"github.com/divanov-web/shorturl/internal/scanner"
 	"github.com/divanov-web/shorturl/internal/service"
 	"github.com/divanov-web/shorturl/internal/storage"
 	"github.com/divanov-web/shorturl/internal/storage/filestorage"
 	"github.com/divanov-web/shorturl/internal/storage/memorystorage"
 	"github.com/divanov-web/shorturl/internal/storage/pgstorage"
-	"github.com/go-chi/chi/v5"
+	"github.com/divanov-web/shorturl/internal/stream"
+	"github.com/divanov-web/shorturl/internal/webhook"
 	"go.uber.org/zap"
 )
 
@@ -86,24 +91,110 @@ func main() {
 	}()
 
 	urlService := service.NewURLService(ctx, cfg.BaseURL, store)
-	h := handlers.NewHandler(urlService)
+	policy, err := service.NewURLPolicy(service.PolicyConfig{
+		Schemes:           config.SplitList(cfg.URLSchemes),
+		BlocklistPath:     cfg.DomainBlocklist,
+		AllowlistPath:     cfg.DomainAllowlist,
+		AllowPrivateHosts: cfg.AllowPrivate,
+		MaxLength:         cfg.MaxURLLength,
+		BaseURL:           cfg.BaseURL,
+		ShortDomains:      config.SplitList(cfg.ShortDomains),
+		LookupIP:          net.DefaultResolver.LookupIPAddr,
+	})
+	if err != nil {
+		sugar.Fatalw("failed to load URL policy", "error", err)
+	}
+	urlService.Policy = policy
+	urlService.Normalizer = service.NewURLNormalizer(cfg.StripTracking, config.SplitList(cfg.TrackingParams))
+
+	//ссылкам из прежних версий нормализованный URL проставляется в фоне, до этого они не дедуплицируются
+	if pg, ok := store.(*pgstorage.Storage); ok {
+		go func() {
+			n, backfillErr := pg.BackfillNormalized(ctx, urlService.Normalizer.Normalize, 1000)
+			if backfillErr != nil {
+				sugar.Errorw("Normalized URL backfill failed", "error", backfillErr, "updated", n)
+				return
+			}
+			if n > 0 {
+				sugar.Infow("Normalized URL backfill finished", "updated", n)
+			}
+		}()
+	}
+
+	if !service.ValidRedirectCode(cfg.RedirectCode) {
+		sugar.Fatalw("invalid redirect code", "code", cfg.RedirectCode)
+	}
+	urlService.RedirectCode = cfg.RedirectCode
+	urlService.RedirectCacheTTL = time.Duration(cfg.RedirectTTL)
+	urlService.Passwords = service.NewPasswordGuard(cfg.AuthSecret)
+	urlService.Domains = config.SplitList(cfg.ShortDomains)
+
+	//Журнал действий пишется в файл, если он задан, иначе хранится в памяти
+	if cfg.AuditLog != "" {
+		auditLog, auditErr := audit.NewFile(cfg.AuditLog)
+		if auditErr != nil {
+			sugar.Fatalw("failed to open audit log", "error", auditErr)
+		}
+		defer auditLog.Close()
+		urlService.Audit = auditLog
+	}
+
+	//События ссылок доставляются подписчикам в фоне
+	webhookCfg := webhook.DefaultConfig()
+	webhookCfg.MaxAttempts = cfg.WebhookAttempts
+	webhookCfg.Timeout = time.Duration(cfg.WebhookTimeout)
+	webhookCfg.AllowPrivateHosts = cfg.AllowPrivate
+	urlService.Webhooks = webhook.NewDispatcher(store, webhookCfg)
+	urlService.Webhooks.Start(ctx)
 
-	r := chi.NewRouter()
+	//События ссылок в реальном времени для открытых потоков /api/user/urls/stream
+	urlService.Stream = stream.NewHub(store, 1000, cfg.StreamBuffer)
+	urlService.Stream.Start(ctx)
 
-	r.Use(middleware.WithDecompress)
-	r.Use(middleware.WithLogging)      //логирование
-	r.Use(middleware.WithGzipBuffered) //сжатие
+	//Сканер угроз включается, только если заданы списки или правила
+	var threatScanner *scanner.Scanner
+	if cfg.ThreatLists != "" || cfg.ThreatRules != "" {
+		threatScanner, err = scanner.New(scanner.Config{
+			HashListPaths: config.SplitList(cfg.ThreatLists),
+			RulesPath:     cfg.ThreatRules,
+		})
+		if err != nil {
+			sugar.Fatalw("failed to load threat lists", "error", err)
+		}
+		urlService.Scanner = threatScanner
+		urlService.StartRescan(ctx, time.Duration(cfg.RescanInterval), func(changed int, rescanErr error) {
+			if rescanErr != nil {
+				sugar.Errorw("Threat rescan failed", "error", rescanErr)
+				return
+			}
+			sugar.Infow("Threat rescan finished", "changed", changed)
+		})
+	}
 
-	auth := middleware.NewAuth(cfg.AuthSecret) //авторизация
-	r.Use(auth.WithAuth)
+	//Перечитываем списки доменов и угроз по SIGHUP
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
+	go func() {
+		for range reloadCh {
+			if reloadErr := policy.Reload(); reloadErr != nil {
+				sugar.Errorw("URL policy reload failed", "error", reloadErr)
+			} else {
+				sugar.Infow("URL policy reloaded")
+			}
+			if threatScanner == nil {
+				continue
+			}
+			if reloadErr := threatScanner.Reload(); reloadErr != nil {
+				sugar.Errorw("Threat lists reload failed", "error", reloadErr)
+				continue
+			}
+			sugar.Infow("Threat lists reloaded")
+		}
+	}()
+
+	h := handlers.NewHandler(urlService)
 
-	r.Post("/", h.MainPage)                         //Сохранение url с request текстовых параметров
-	r.Post("/api/shorten", h.SetShortURL)           //Сохранение url с request json параметров
-	r.Get("/{id}", h.GetRealURL)                    //Вернуть исходных url по его хешу и сделать редирект
-	r.Get("/ping", h.PingDB)                        // пингует БД постгресс
-	r.Post("/api/shorten/batch", h.SetShortenBatch) //Сохранение пачки url
-	r.Get("/api/user/urls", h.GetUserURLs)          //Получить все url пользователя
-	r.Delete("/api/user/urls", h.DeleteUserURL)     //Удалить url пользователя по массиву id
+	r := newRouter(cfg, h)
 
 	sugar.Infow(
 		"Starting server",
@@ -116,6 +207,33 @@ func main() {
 		"DatabaseDSN", cfg.DatabaseDSN,
 		"FileStoragePath", cfg.FileStoragePath,
 		"StorageType", cfg.StorageType,
+		"DedupScope", cfg.DedupScope,
+		"IdempotencyTTL", time.Duration(cfg.IdempotencyTTL),
+		"CompressMinSize", cfg.CompressMinSize,
+		"CompressTypes", cfg.CompressTypes,
+		"MaxBodySize", cfg.MaxBodySize,
+		"MaxUnzipSize", cfg.MaxUnzipSize,
+		"BulkMaxBody", cfg.BulkMaxBody,
+		"BulkMaxUnzip", cfg.BulkMaxUnzip,
+		"URLSchemes", cfg.URLSchemes,
+		"DomainBlocklist", cfg.DomainBlocklist,
+		"DomainAllowlist", cfg.DomainAllowlist,
+		"AllowPrivate", cfg.AllowPrivate,
+		"MaxURLLength", cfg.MaxURLLength,
+		"StripTracking", cfg.StripTracking,
+		"TrackingParams", cfg.TrackingParams,
+		"ThreatLists", cfg.ThreatLists,
+		"ThreatRules", cfg.ThreatRules,
+		"RescanInterval", time.Duration(cfg.RescanInterval),
+		"RedirectCode", cfg.RedirectCode,
+		"RedirectTTL", time.Duration(cfg.RedirectTTL),
+		"ShortDomains", cfg.ShortDomains,
+		"AdminUsers", cfg.AdminUsers,
+		"AdminKeys", len(config.SplitList(cfg.AdminKeys)),
+		"AuditLog", cfg.AuditLog,
+		"WebhookAttempts", cfg.WebhookAttempts,
+		"WebhookTimeout", time.Duration(cfg.WebhookTimeout),
+		"StreamBuffer", cfg.StreamBuffer,
 		"PprofMode", cfg.PprofMode,
 		"EnableHTTPS", cfg.EnableHTTPS,
 	)
@@ -124,6 +242,8 @@ func main() {
 		Addr:    cfg.ServerAddress,
 		Handler: r,
 	}
+	//открытые потоки событий не должны задерживать остановку сервера
+	srv.RegisterOnShutdown(urlService.Stream.Close)
 
 	//запускаем сервер в горутине
 	go func() {
@@ -161,13 +281,18 @@ func main() {
 }
 
 func initStorage(ctx context.Context, cfg *config.Config) (storage.Storage, error) {
+	scope, err := storage.ParseDedupScope(cfg.DedupScope)
+	if err != nil {
+		return nil, err
+	}
+
 	switch cfg.StorageType {
 	case "postgres":
 		pool, err := pgstorage.NewPool(ctx, cfg.DatabaseDSN)
 		if err != nil {
 			return nil, err
 		}
-		store, err := pgstorage.NewStorage(ctx, pool)
+		store, err := pgstorage.NewStorage(ctx, pool, scope)
 		if err != nil {
 			pool.Close()
 			return nil, err
@@ -175,10 +300,10 @@ func initStorage(ctx context.Context, cfg *config.Config) (storage.Storage, erro
 		return store, nil
 
 	case "file":
-		return filestorage.NewStorage(cfg.FileStoragePath)
+		return filestorage.NewStorage(cfg.FileStoragePath, scope)
 
 	default:
-		return memorystorage.NewStorage()
+		return memorystorage.NewStorage(scope)
 	}
 }
 
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"time"
+
+	"github.com/divanov-web/shorturl/internal/config"
+	"github.com/divanov-web/shorturl/internal/handlers"
+	"github.com/divanov-web/shorturl/internal/middleware"
+	"github.com/go-chi/chi/v5"
+)
+
+// newRouter собирает маршруты сервера. Лимиты тела запроса ставятся на группы маршрутов:
+// массовый импорт принимает большие файлы, и у него свои лимиты.
+func newRouter(cfg *config.Config, h *handlers.Handler) chi.Router {
+	r := chi.NewRouter()
+
+	r.Use(middleware.WithLogging) //логирование
+	compressor := middleware.NewCompressor(cfg.CompressMinSize, config.SplitList(cfg.CompressTypes))
+	r.Use(compressor.WithCompression) //сжатие
+
+	auth := middleware.NewAuth(cfg.AuthSecret) //авторизация
+	r.Use(auth.WithAuth)
+
+	idem := middleware.NewIdempotency(time.Duration(cfg.IdempotencyTTL)) //повтор ответов по Idempotency-Key
+
+	bulkDecompressor := middleware.NewDecompressor(int64(cfg.BulkMaxBody), int64(cfg.BulkMaxUnzip))
+	r.With(bulkDecompressor.WithDecompress).Post("/api/shorten/bulk", h.SetShortenBulk) //Потоковый массовый импорт url (NDJSON или CSV)
+
+	decompressor := middleware.NewDecompressor(int64(cfg.MaxBodySize), int64(cfg.MaxUnzipSize))
+	r.Group(func(r chi.Router) {
+		r.Use(decompressor.WithDecompress) //распаковка и лимиты тела запроса
+
+		r.With(idem.WithIdempotency).Post("/", h.MainPage)                              //Сохранение url с request текстовых параметров
+		r.With(idem.WithIdempotency).Post("/api/shorten", h.SetShortURL)                //Сохранение url с request json параметров
+		r.Get("/{id}", h.GetRealURL)                                                    //Вернуть исходных url по его хешу и сделать редирект, /{id}+ — предпросмотр
+		r.Head("/{id}", h.GetRealURL)                                                   //Проверить короткую ссылку без учёта перехода
+		r.Post("/{id}", h.UnlockURL)                                                    //Ввод пароля защищённой ссылки
+		r.Get("/", h.UIRedirect)                                                        //Открыть веб-интерфейс
+		r.Get("/ping", h.PingDB)                                                        // пингует БД постгресс
+		r.With(idem.WithIdempotency).Post("/api/shorten/batch", h.SetShortenBatch)      //Сохранение пачки url
+		r.Get("/api/user/urls", h.GetUserURLs)                                          //Получить все url пользователя
+		r.Delete("/api/user/urls", h.DeleteUserURL)                                     //Удалить url пользователя по массиву id
+		r.Patch("/api/user/urls/{id}", h.UpdateUserURL)                                 //Изменить исходный url ссылки пользователя
+		r.Post("/api/user/urls/{id}/restore", h.RestoreUserURL)                         //Восстановить удалённую ссылку пользователя
+		r.Get("/api/user/urls/stream", h.StreamUserURLs)                                //Поток событий ссылок пользователя (Server-Sent Events)
+		r.Get("/api/user/urls/stream/ws", h.StreamUserURLsWS)                           //Тот же поток событий по WebSocket
+		r.Get("/api/user/urls/{id}/history", h.GetUserURLHistory)                       //История изменений ссылки пользователя
+		r.Put("/api/user/urls/{id}/options", h.SetUserURLOptions)                       //Настройки ссылки пользователя
+		r.Get("/api/user/urls/{id}/stats", h.GetUserURLStats)                           //Счётчики переходов ссылки, в том числе по вариантам A/B-теста
+		r.Get("/api/user/urls/{id}/qr", h.GetUserURLQR)                                 //QR-код ссылки в PNG или SVG
+		r.Get("/api/user/settings", h.GetUserSettings)                                  //Настройки пользователя и доступные короткие домены
+		r.Put("/api/user/settings", h.SetUserSettings)                                  //Изменить короткий домен новых ссылок пользователя
+		r.Post("/api/workspaces", h.CreateWorkspace)                                    //Создать рабочее пространство
+		r.Get("/api/workspaces", h.GetWorkspaces)                                       //Рабочие пространства пользователя
+		r.Get("/api/workspaces/{workspace}/members", h.GetWorkspaceMembers)             //Участники рабочего пространства
+		r.Put("/api/workspaces/{workspace}/members/{user}", h.SetWorkspaceMember)       //Изменить роль участника
+		r.Delete("/api/workspaces/{workspace}/members/{user}", h.RemoveWorkspaceMember) //Убрать участника или выйти самому
+		r.Post("/api/workspaces/{workspace}/invites", h.CreateWorkspaceInvite)          //Приглашение в рабочее пространство
+		r.Post("/api/invites/{token}", h.AcceptWorkspaceInvite)                         //Принять приглашение
+		r.Post("/api/webhooks", h.CreateWebhook)                                        //Подписать адрес на события ссылок
+		r.Get("/api/webhooks", h.GetWebhooks)                                           //Подписки пользователя
+		r.Delete("/api/webhooks/{webhook}", h.DeleteWebhook)                            //Удалить подписку
+		r.Get("/api/webhooks/{webhook}/deliveries", h.GetWebhookDeliveries)             //Журнал доставок подписки
+		r.Get("/api/webhooks/{webhook}/dead", h.GetWebhookDeadLetters)                  //Недоставленные события подписки
+		r.Post("/api/webhooks/{webhook}/dead/{delivery}", h.RedeliverWebhook)           //Повторить доставку недоставленного события
+
+		//Веб-интерфейс: формы отправляются только с CSRF-токеном
+		csrf := middleware.NewCSRF(cfg.AuthSecret)
+		r.Route("/ui", func(r chi.Router) {
+			r.Use(csrf.WithCSRF)
+			r.Get("/", h.UIHome)                       //Форма сокращения и список ссылок пользователя
+			r.Post("/shorten", h.UIShorten)            //Сократить url из формы
+			r.Post("/links/{id}/delete", h.UIDelete)   //Удалить ссылку
+			r.Post("/links/{id}/restore", h.UIRestore) //Восстановить удалённую ссылку
+			r.Handle("/static/*", handlers.UIStatic()) //Стили и скрипты веб-интерфейса
+		})
+
+		admin := middleware.NewAdmin(config.SplitList(cfg.AdminUsers), config.SplitList(cfg.AdminKeys)) //администраторы
+		r.Route("/api/admin", func(r chi.Router) {
+			r.Use(admin.WithAdmin)
+			r.Get("/urls", h.AdminSearchURLs)                     //Поиск ссылок всех пользователей
+			r.Put("/urls/{id}/disabled", h.AdminDisableURL)       //Заблокировать ссылку
+			r.Delete("/urls/{id}/disabled", h.AdminEnableURL)     //Снять блокировку ссылки
+			r.Delete("/urls/{id}", h.AdminDeleteURL)              //Удалить любую ссылку
+			r.Put("/users/{user}/blocked", h.AdminBlockUser)      //Запретить пользователю создавать ссылки
+			r.Delete("/users/{user}/blocked", h.AdminUnblockUser) //Снять запрет
+			r.Get("/audit", h.AdminAudit)                         //Журнал действий
+			r.Get("/audit/export", h.AdminAuditExport)            //Выгрузка журнала действий в JSON lines или CSV
+		})
+	})
+
+	return r
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+
+	"github.com/divanov-web/shorturl/internal/config"
+	"github.com/divanov-web/shorturl/internal/handlers"
+	"github.com/divanov-web/shorturl/internal/middleware"
+	"github.com/divanov-web/shorturl/internal/service"
+	"github.com/divanov-web/shorturl/internal/storage/memorystorage"
+	"github.com/divanov-web/shorturl/internal/stream"
+	"github.com/divanov-web/shorturl/internal/webhook"
+)
+
+func TestNewRouter_BodyLimits(t *testing.T) {
+	middleware.SetLogger(zap.NewNop().Sugar())
+
+	cfg := &config.Config{
+		AuthSecret:   "secret",
+		MaxBodySize:  32 << 20,
+		MaxUnzipSize: 128 << 20,
+		BulkMaxBody:  1 << 30,
+		BulkMaxUnzip: 1 << 30,
+	}
+	svc := service.NewURLService(context.Background(), "http://localhost:8080", memorystorage.NewTestStorage())
+	r := newRouter(cfg, handlers.NewHandler(svc))
+
+	// пустые строки импорт пропускает, поэтому большое тело обрабатывается быстро
+	body := strings.Repeat("\n", 33<<20) + `{"correlation_id":"1","original_url":"https://example.com/a"}` + "\n"
+
+	t.Run("bulk accepts body over the common limit", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten/bulk", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), service.BatchStatusCreated)
+	})
+
+	t.Run("other routes keep the common limit", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", io.NopCloser(strings.NewReader(body)))
+		req.ContentLength = -1
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+}
+
+func TestNewRouter_StreamWS(t *testing.T) {
+	middleware.SetLogger(zap.NewNop().Sugar())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := &config.Config{
+		AuthSecret:   "secret",
+		MaxBodySize:  1 << 20,
+		MaxUnzipSize: 1 << 20,
+		BulkMaxBody:  1 << 20,
+		BulkMaxUnzip: 1 << 20,
+	}
+	store := memorystorage.NewTestStorage()
+	svc := service.NewURLService(ctx, "http://localhost:8080", store)
+	svc.Stream = stream.NewHub(store, 10, 10)
+	svc.Stream.Start(ctx)
+	srv := httptest.NewServer(newRouter(cfg, handlers.NewHandler(svc)))
+	defer srv.Close()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": "alice",
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(cfg.AuthSecret))
+	require.NoError(t, err)
+
+	// рукопожатие проходит через все обёртки ответа: логирование, сжатие и лимиты тела
+	wsCfg, err := websocket.NewConfig("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/user/urls/stream/ws", srv.URL)
+	require.NoError(t, err)
+	wsCfg.Header.Set("Cookie", "auth_token="+token)
+	wsCfg.Header.Set("Accept-Encoding", "gzip")
+	ws, err := websocket.DialConfig(wsCfg)
+	require.NoError(t, err)
+	defer ws.Close()
+
+	short, err := svc.CreateShort(ctx, "alice", "https://example.com/ws")
+	require.NoError(t, err)
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var e webhook.Event
+	require.NoError(t, websocket.JSON.Receive(ws, &e))
+	assert.Equal(t, webhook.EventLinkCreated, e.Type)
+	assert.Equal(t, strings.TrimPrefix(short, "http://localhost:8080/"), e.ShortURL)
+}
@@ -0,0 +1,118 @@
+// Package audit журнал действий над ссылками и пользователями.
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Действия, которые попадают в журнал.
+const (
+	ActionLinkCreate  = "link.create"
+	ActionLinkUpdate  = "link.update"
+	ActionLinkRestore = "link.restore"
+	ActionLinkDisable = "link.disable"
+	ActionLinkEnable  = "link.enable"
+	ActionLinkDelete  = "link.delete"
+	ActionUserBlock   = "user.block"
+	ActionUserUnblock = "user.unblock"
+)
+
+// Event запись журнала.
+type Event struct {
+	Time time.Time `json:"time"`
+	// Actor кто выполнил действие: пользователь или администратор.
+	Actor  string `json:"actor"`
+	Action string `json:"action"`
+	// ShortURL ссылка, над которой выполнено действие.
+	ShortURL string `json:"short_url,omitempty"`
+	// Target пользователь, над которым выполнено действие, или владелец ссылки.
+	Target string `json:"target,omitempty"`
+	// Detail что именно изменено в ссылке: url, options, password или meta.
+	Detail string `json:"detail,omitempty"`
+}
+
+// Filter условия выборки из журнала, пустые условия не проверяются.
+type Filter struct {
+	Actor    string
+	Action   string
+	Target   string
+	ShortURL string
+	// From и To ограничивают время записи: From включительно, To не включительно.
+	From time.Time
+	To   time.Time
+	// Limit сколько последних записей вернуть, 0 — все.
+	Limit int
+}
+
+// Match проверяет запись по условиям.
+func (f Filter) Match(e Event) bool {
+	return (f.Actor == "" || f.Actor == e.Actor) &&
+		(f.Action == "" || f.Action == e.Action) &&
+		(f.Target == "" || f.Target == e.Target) &&
+		(f.ShortURL == "" || f.ShortURL == e.ShortURL) &&
+		(f.From.IsZero() || !e.Time.Before(f.From)) &&
+		(f.To.IsZero() || e.Time.Before(f.To))
+}
+
+// actorKey ключ контекста с автором действий запроса.
+type actorKey struct{}
+
+// WithActor запоминает в контексте, от чьего имени выполняются действия.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom возвращает автора действий из контекста, пустую строку — если он не задан.
+func ActorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// Log журнал действий.
+type Log interface {
+	Record(ctx context.Context, e Event) error
+	// Query возвращает подходящие записи от новых к старым.
+	Query(ctx context.Context, f Filter) ([]Event, error)
+}
+
+// Memory журнал в оперативной памяти, хранит не больше size последних записей.
+type Memory struct {
+	mu     sync.RWMutex
+	events []Event
+	size   int
+}
+
+// NewMemory создаёт журнал в памяти на size записей.
+func NewMemory(size int) *Memory {
+	return &Memory{size: size}
+}
+
+// Record добавляет запись, самые старые записи сверх размера отбрасываются.
+func (m *Memory) Record(ctx context.Context, e Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, e)
+	if extra := len(m.events) - m.size; extra > 0 {
+		m.events = append(m.events[:0], m.events[extra:]...)
+	}
+	return nil
+}
+
+// Query возвращает подходящие записи от новых к старым.
+func (m *Memory) Query(ctx context.Context, f Filter) ([]Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var result []Event
+	for i := len(m.events) - 1; i >= 0; i-- {
+		if !f.Match(m.events[i]) {
+			continue
+		}
+		result = append(result, m.events[i])
+		if f.Limit > 0 && len(result) == f.Limit {
+			break
+		}
+	}
+	return result, nil
+}
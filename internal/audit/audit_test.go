@@ -0,0 +1,73 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile_KeepAfterReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	log, err := NewFile(path)
+	require.NoError(t, err)
+	for i, e := range []Event{
+		{Actor: "alice", Action: ActionLinkCreate, ShortURL: "a", Target: "alice"},
+		{Actor: "alice", Action: ActionLinkUpdate, ShortURL: "a", Target: "alice", Detail: "url"},
+		{Actor: "bob", Action: ActionLinkCreate, ShortURL: "b", Target: "workspace:w1"},
+		{Actor: "alice", Action: ActionLinkDelete, ShortURL: "a", Target: "alice"},
+	} {
+		e.Time = start.Add(time.Duration(i) * time.Hour)
+		require.NoError(t, log.Record(ctx, e))
+	}
+	require.NoError(t, log.Close())
+
+	// повреждённая строка не мешает читать остальные записи
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = file.WriteString("{broken\n")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	log, err = NewFile(path)
+	require.NoError(t, err)
+	defer log.Close()
+	require.NoError(t, log.Record(ctx, Event{Time: start.Add(4 * time.Hour), Actor: "alice", Action: ActionLinkRestore, ShortURL: "a", Target: "alice"}))
+
+	events, err := log.Query(ctx, Filter{Actor: "alice"})
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+	assert.Equal(t, ActionLinkRestore, events[0].Action)
+	assert.Equal(t, ActionLinkCreate, events[3].Action)
+
+	events, err = log.Query(ctx, Filter{From: start.Add(time.Hour), To: start.Add(3 * time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "bob", events[0].Actor)
+	assert.Equal(t, "url", events[1].Detail)
+
+	events, err = log.Query(ctx, Filter{Target: "alice", Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, ActionLinkDelete, events[1].Action)
+}
+
+func TestMemory_DropsOldest(t *testing.T) {
+	ctx := context.Background()
+	log := NewMemory(2)
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(t, log.Record(ctx, Event{Action: ActionLinkCreate, ShortURL: id}))
+	}
+	events, err := log.Query(ctx, Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "c", events[0].ShortURL)
+	assert.Equal(t, "b", events[1].ShortURL)
+}
@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// File журнал в файле JSON lines. Записи только дописываются в конец, файл не переписывается.
+// Query читает файл целиком, поэтому подходит для выборок администратора, а не для горячего пути.
+type File struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFile открывает журнал в файле path, создавая его при необходимости.
+func NewFile(path string) (*File, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &File{file: file}, nil
+}
+
+// Record дописывает запись в конец файла одной строкой.
+func (f *File) Record(ctx context.Context, e Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err = f.file.Write(append(line, '\n'))
+	return err
+}
+
+// Query возвращает подходящие записи от новых к старым. Повреждённые строки пропускаются.
+func (f *File) Query(ctx context.Context, filter Filter) ([]Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := os.Open(f.file.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var matched []Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if filter.Match(e) {
+			matched = append(matched, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]Event, 0, len(matched))
+	for i := len(matched) - 1; i >= 0; i-- {
+		result = append(result, matched[i])
+		if filter.Limit > 0 && len(result) == filter.Limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+// Close закрывает файл журнала.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
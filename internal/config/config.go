@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/caarlos0/env/v6"
 	"github.com/joho/godotenv"
@@ -13,15 +14,55 @@ import (
 
 // Config структура с главным конфигом приложения
 type Config struct {
-	ServerAddress   string `env:"SERVER_ADDRESS" json:"server_address"`
-	BaseURL         string `env:"BASE_URL" json:"base_url"`
-	FileStoragePath string `env:"FILE_STORAGE_PATH" json:"file_storage_path"`
-	DatabaseDSN     string `env:"DATABASE_DSN" json:"database_dsn"`
-	AuthSecret      string `env:"AUTH_SECRET" json:"auth_secret"`
-	StorageType     string //определяется автоматически
-	PprofMode       bool   `env:"PPROF_MODE" json:"pprof_mode"`
-	EnableHTTPS     bool   `env:"ENABLE_HTTPS" json:"enable_https"`
-	ConfigPath      string `env:"CONFIG"`
+	ServerAddress   string   `env:"SERVER_ADDRESS" json:"server_address"`
+	BaseURL         string   `env:"BASE_URL" json:"base_url"`
+	FileStoragePath string   `env:"FILE_STORAGE_PATH" json:"file_storage_path"`
+	DatabaseDSN     string   `env:"DATABASE_DSN" json:"database_dsn"`
+	AuthSecret      string   `env:"AUTH_SECRET" json:"auth_secret"`
+	DedupScope      string   `env:"DEDUP_SCOPE" json:"dedup_scope"` //global, user или none
+	StorageType     string   //определяется автоматически
+	PprofMode       bool     `env:"PPROF_MODE" json:"pprof_mode"`
+	EnableHTTPS     bool     `env:"ENABLE_HTTPS" json:"enable_https"`
+	IdempotencyTTL  Duration `env:"IDEMPOTENCY_TTL" json:"idempotency_ttl"`
+	CompressMinSize int      `env:"COMPRESS_MIN_SIZE" json:"compress_min_size"` //ответы меньше не сжимаются
+	CompressTypes   string   `env:"COMPRESS_TYPES" json:"compress_types"`       //префиксы Content-Type через запятую
+	MaxBodySize     int      `env:"MAX_BODY_SIZE" json:"max_body_size"`         //лимит тела запроса в байтах как пришло
+	MaxUnzipSize    int      `env:"MAX_UNZIP_SIZE" json:"max_unzip_size"`       //лимит тела запроса в байтах после распаковки
+	BulkMaxBody     int      `env:"BULK_MAX_BODY" json:"bulk_max_body"`         //лимит тела массового импорта как пришло
+	BulkMaxUnzip    int      `env:"BULK_MAX_UNZIP" json:"bulk_max_unzip"`       //лимит тела массового импорта после распаковки
+	URLSchemes      string   `env:"URL_SCHEMES" json:"url_schemes"`             //разрешённые схемы исходных URL через запятую
+	DomainBlocklist string   `env:"DOMAIN_BLOCKLIST" json:"domain_blocklist"`   //файл запрещённых доменов
+	DomainAllowlist string   `env:"DOMAIN_ALLOWLIST" json:"domain_allowlist"`   //файл разрешённых доменов
+	AllowPrivate    bool     `env:"ALLOW_PRIVATE_HOSTS" json:"allow_private_hosts"`
+	MaxURLLength    int      `env:"MAX_URL_LENGTH" json:"max_url_length"`
+	StripTracking   bool     `env:"NORMALIZE_STRIP_TRACKING" json:"normalize_strip_tracking"`
+	TrackingParams  string   `env:"TRACKING_PARAMS" json:"tracking_params"`           //параметры отслеживания через запятую, * на конце — префикс; пусто — список по умолчанию
+	ThreatLists     string   `env:"THREAT_LISTS" json:"threat_lists"`                 //файлы списков угроз в формате Safe Browsing через запятую
+	ThreatRules     string   `env:"THREAT_RULES" json:"threat_rules"`                 //файл регулярных правил угроз
+	RescanInterval  Duration `env:"RESCAN_INTERVAL" json:"rescan_interval"`           //период перепроверки ссылок по спискам угроз
+	RedirectCode    int      `env:"REDIRECT_CODE" json:"redirect_code"`               //код редиректа по умолчанию: 301, 302, 307 или 308
+	RedirectTTL     Duration `env:"REDIRECT_CACHE_TTL" json:"redirect_cache_ttl"`     //время кеширования постоянных редиректов
+	ShortDomains    string   `env:"SHORT_DOMAINS" json:"short_domains"`               //дополнительные короткие домены через запятую, домен BASE_URL — по умолчанию
+	AdminUsers      string   `env:"ADMIN_USERS" json:"admin_users"`                   //идентификаторы пользователей-администраторов через запятую
+	AdminKeys       string   `env:"ADMIN_API_KEYS" json:"admin_api_keys"`             //API-ключи администратора через запятую
+	AuditLog        string   `env:"AUDIT_LOG" json:"audit_log"`                       //файл журнала действий в формате JSON lines, пусто — журнал в памяти
+	WebhookAttempts int      `env:"WEBHOOK_MAX_ATTEMPTS" json:"webhook_max_attempts"` //сколько раз пытаться доставить событие подписчику
+	WebhookTimeout  Duration `env:"WEBHOOK_TIMEOUT" json:"webhook_timeout"`           //время ожидания ответа подписчика
+	StreamBuffer    int      `env:"STREAM_BUFFER" json:"stream_buffer"`               //сколько событий копится для медленного клиента потока событий, дальше они пропускаются
+	ConfigPath      string   `env:"CONFIG"`
+}
+
+// Duration длительность, которая читается из env и JSON в виде строки "24h", "15m".
+type Duration time.Duration
+
+// UnmarshalText разбирает длительность в формате time.ParseDuration.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
 }
 
 // NewConfig Создаёт конфиг приложения и возвращает в виде структуры
@@ -35,6 +76,33 @@ func NewConfig() *Config {
 	filePathFlag := flag.String("f", "", "путь к файлу хранения данных")
 	dbDSNFlag := flag.String("d", "", "строка подключения к БД")
 	authSecretFlag := flag.String("auth-secret", "", "секрет для подписи JWT")
+	dedupFlag := flag.String("dedup", "", "область уникальности исходных URL: global, user, none")
+	idempotencyTTLFlag := flag.Duration("idempotency-ttl", 0, "сколько хранить ответы на запросы с Idempotency-Key")
+	compressMinSizeFlag := flag.Int("compress-min-size", 0, "минимальный размер ответа для сжатия в байтах")
+	compressTypesFlag := flag.String("compress-types", "", "сжимаемые Content-Type через запятую")
+	maxBodySizeFlag := flag.Int("max-body-size", 0, "максимальный размер тела запроса в байтах")
+	maxUnzipSizeFlag := flag.Int("max-unzip-size", 0, "максимальный размер тела запроса после распаковки в байтах")
+	bulkMaxBodyFlag := flag.Int("bulk-max-body", 0, "максимальный размер тела массового импорта в байтах")
+	bulkMaxUnzipFlag := flag.Int("bulk-max-unzip", 0, "максимальный размер тела массового импорта после распаковки в байтах")
+	urlSchemesFlag := flag.String("url-schemes", "", "разрешённые схемы исходных URL через запятую")
+	blocklistFlag := flag.String("domain-blocklist", "", "файл запрещённых доменов")
+	allowlistFlag := flag.String("domain-allowlist", "", "файл разрешённых доменов")
+	allowPrivateFlag := flag.Bool("allow-private-hosts", false, "разрешить ссылки и вебхуки на localhost и частные сети")
+	maxURLLengthFlag := flag.Int("max-url-length", 0, "максимальная длина исходного URL")
+	stripTrackingFlag := flag.Bool("strip-tracking", false, "не учитывать параметры отслеживания при дедупликации")
+	trackingParamsFlag := flag.String("tracking-params", "", "параметры отслеживания через запятую")
+	threatListsFlag := flag.String("threat-lists", "", "файлы списков угроз в формате Safe Browsing через запятую")
+	threatRulesFlag := flag.String("threat-rules", "", "файл регулярных правил угроз")
+	rescanIntervalFlag := flag.Duration("rescan-interval", 0, "период перепроверки ссылок по спискам угроз")
+	redirectCodeFlag := flag.Int("redirect-code", 0, "код редиректа по умолчанию: 301, 302, 307 или 308")
+	redirectTTLFlag := flag.Duration("redirect-cache-ttl", 0, "время кеширования постоянных редиректов")
+	shortDomainsFlag := flag.String("short-domains", "", "дополнительные короткие домены через запятую")
+	adminUsersFlag := flag.String("admin-users", "", "идентификаторы пользователей-администраторов через запятую")
+	adminKeysFlag := flag.String("admin-api-keys", "", "API-ключи администратора через запятую")
+	auditLogFlag := flag.String("audit-log", "", "файл журнала действий в формате JSON lines")
+	webhookAttemptsFlag := flag.Int("webhook-max-attempts", 0, "сколько раз пытаться доставить событие подписчику")
+	webhookTimeoutFlag := flag.Duration("webhook-timeout", 0, "время ожидания ответа подписчика")
+	streamBufferFlag := flag.Int("stream-buffer", 0, "буфер событий на клиента потока событий ссылок")
 	pprofFlag := flag.Bool("pprof", false, "включить pprof-сервер")
 	httpsFlag := flag.Bool("s", false, "включить HTTPS-сервер")
 	cfgPathFlag := flag.String("c", "", "путь к JSON-файлу конфигурации")
@@ -69,6 +137,33 @@ func NewConfig() *Config {
 		FileStoragePath: chooseValue(envCfg.FileStoragePath, *filePathFlag, cfgFromFile.FileStoragePath, "shortener_data.json"),
 		DatabaseDSN:     chooseValue(envCfg.DatabaseDSN, *dbDSNFlag, cfgFromFile.DatabaseDSN, ""),
 		AuthSecret:      chooseValue(envCfg.AuthSecret, *authSecretFlag, cfgFromFile.AuthSecret, "dev-secret-key"),
+		DedupScope:      chooseValue(envCfg.DedupScope, *dedupFlag, cfgFromFile.DedupScope, "global"),
+		IdempotencyTTL:  chooseDuration(envCfg.IdempotencyTTL, Duration(*idempotencyTTLFlag), cfgFromFile.IdempotencyTTL, Duration(24*time.Hour)),
+		CompressMinSize: chooseInt(envCfg.CompressMinSize, *compressMinSizeFlag, cfgFromFile.CompressMinSize, 0),
+		CompressTypes:   chooseValue(envCfg.CompressTypes, *compressTypesFlag, cfgFromFile.CompressTypes, "application/json,text/html,application/x-ndjson"),
+		MaxBodySize:     chooseInt(envCfg.MaxBodySize, *maxBodySizeFlag, cfgFromFile.MaxBodySize, 32<<20),
+		MaxUnzipSize:    chooseInt(envCfg.MaxUnzipSize, *maxUnzipSizeFlag, cfgFromFile.MaxUnzipSize, 128<<20),
+		BulkMaxBody:     chooseInt(envCfg.BulkMaxBody, *bulkMaxBodyFlag, cfgFromFile.BulkMaxBody, 1<<30),
+		BulkMaxUnzip:    chooseInt(envCfg.BulkMaxUnzip, *bulkMaxUnzipFlag, cfgFromFile.BulkMaxUnzip, 1<<30),
+		URLSchemes:      chooseValue(envCfg.URLSchemes, *urlSchemesFlag, cfgFromFile.URLSchemes, "http,https"),
+		DomainBlocklist: chooseValue(envCfg.DomainBlocklist, *blocklistFlag, cfgFromFile.DomainBlocklist, ""),
+		DomainAllowlist: chooseValue(envCfg.DomainAllowlist, *allowlistFlag, cfgFromFile.DomainAllowlist, ""),
+		AllowPrivate:    envCfg.AllowPrivate || *allowPrivateFlag || cfgFromFile.AllowPrivate,
+		MaxURLLength:    chooseInt(envCfg.MaxURLLength, *maxURLLengthFlag, cfgFromFile.MaxURLLength, 2048),
+		StripTracking:   envCfg.StripTracking || *stripTrackingFlag || cfgFromFile.StripTracking,
+		TrackingParams:  chooseValue(envCfg.TrackingParams, *trackingParamsFlag, cfgFromFile.TrackingParams, ""),
+		ThreatLists:     chooseValue(envCfg.ThreatLists, *threatListsFlag, cfgFromFile.ThreatLists, ""),
+		ThreatRules:     chooseValue(envCfg.ThreatRules, *threatRulesFlag, cfgFromFile.ThreatRules, ""),
+		RescanInterval:  chooseDuration(envCfg.RescanInterval, Duration(*rescanIntervalFlag), cfgFromFile.RescanInterval, Duration(time.Hour)),
+		RedirectCode:    chooseInt(envCfg.RedirectCode, *redirectCodeFlag, cfgFromFile.RedirectCode, 307),
+		RedirectTTL:     chooseDuration(envCfg.RedirectTTL, Duration(*redirectTTLFlag), cfgFromFile.RedirectTTL, Duration(24*time.Hour)),
+		ShortDomains:    chooseValue(envCfg.ShortDomains, *shortDomainsFlag, cfgFromFile.ShortDomains, ""),
+		AdminUsers:      chooseValue(envCfg.AdminUsers, *adminUsersFlag, cfgFromFile.AdminUsers, ""),
+		AdminKeys:       chooseValue(envCfg.AdminKeys, *adminKeysFlag, cfgFromFile.AdminKeys, ""),
+		AuditLog:        chooseValue(envCfg.AuditLog, *auditLogFlag, cfgFromFile.AuditLog, ""),
+		WebhookAttempts: chooseInt(envCfg.WebhookAttempts, *webhookAttemptsFlag, cfgFromFile.WebhookAttempts, 5),
+		WebhookTimeout:  chooseDuration(envCfg.WebhookTimeout, Duration(*webhookTimeoutFlag), cfgFromFile.WebhookTimeout, Duration(10*time.Second)),
+		StreamBuffer:    chooseInt(envCfg.StreamBuffer, *streamBufferFlag, cfgFromFile.StreamBuffer, 64),
 		PprofMode:       envCfg.PprofMode || *pprofFlag || cfgFromFile.PprofMode,
 		EnableHTTPS:     envCfg.EnableHTTPS || *httpsFlag || cfgFromFile.EnableHTTPS,
 	}
@@ -97,6 +192,45 @@ func chooseValue(envVal, flagVal, fileVal, defaultVal string) string {
 	return defaultVal
 }
 
+// chooseDuration определяет очерёдность длительностей конфига
+func chooseDuration(envVal, flagVal, fileVal, defaultVal Duration) Duration {
+	if envVal != 0 {
+		return envVal
+	}
+	if flagVal != 0 {
+		return flagVal
+	}
+	if fileVal != 0 {
+		return fileVal
+	}
+	return defaultVal
+}
+
+// chooseInt определяет очерёдность числовых параметров конфига
+func chooseInt(envVal, flagVal, fileVal, defaultVal int) int {
+	if envVal != 0 {
+		return envVal
+	}
+	if flagVal != 0 {
+		return flagVal
+	}
+	if fileVal != 0 {
+		return fileVal
+	}
+	return defaultVal
+}
+
+// SplitList разбивает список значений конфига через запятую, отбрасывая пустые.
+func SplitList(raw string) []string {
+	var result []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
 func detectStorageType(dsn, filePath string) string {
 	if dsn != "" {
 		return "postgres"
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/divanov-web/shorturl/internal/audit"
+	"github.com/divanov-web/shorturl/internal/middleware"
+	"github.com/divanov-web/shorturl/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+// AdminSearchURLs хендлер GET /api/admin/urls. Ищет ссылки всех пользователей.
+// Параметры: q — подстрока исходного URL, domain — его домен, user — владелец, after и limit — страница.
+func (h *Handler) AdminSearchURLs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := 0
+	if raw := query.Get("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil || limit <= 0 || limit > service.MaxAdminPageLimit {
+			http.Error(w, "Недопустимый limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	filter := service.AdminFilter{
+		Query:  query.Get("q"),
+		Domain: query.Get("domain"),
+		UserID: query.Get("user"),
+	}
+	links, next, err := h.Service.AdminSearch(r.Context(), filter, query.Get("after"), limit)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := AdminURLsResponse{Items: make([]AdminURLItem, 0, len(links)), Next: next}
+	for _, link := range links {
+		response.Items = append(response.Items, AdminURLItem{
+			ID:          link.ShortURL,
+			ShortURL:    h.Service.ShortURL(link),
+			OriginalURL: link.OriginalURL,
+			UserID:      link.UserID,
+			CreatedAt:   link.CreatedAt,
+			Clicks:      link.Clicks,
+			Threat:      link.Threat,
+			Disabled:    link.Disabled,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// AdminDisableURL хендлер PUT /api/admin/urls/{id}/disabled. Блокирует любую ссылку, она начинает отвечать 410.
+func (h *Handler) AdminDisableURL(w http.ResponseWriter, r *http.Request) {
+	h.adminSetDisabled(w, r, true)
+}
+
+// AdminEnableURL хендлер DELETE /api/admin/urls/{id}/disabled. Снимает блокировку ссылки.
+func (h *Handler) AdminEnableURL(w http.ResponseWriter, r *http.Request) {
+	h.adminSetDisabled(w, r, false)
+}
+
+// adminSetDisabled меняет блокировку ссылки и отвечает 204.
+func (h *Handler) adminSetDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	adminID, ok := middleware.GetAdminID(r.Context())
+	if !ok {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !writeServiceError(w, h.Service.AdminSetDisabled(r.Context(), adminID, chi.URLParam(r, "id"), disabled)) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminDeleteURL хендлер DELETE /api/admin/urls/{id}. Удаляет любую ссылку.
+func (h *Handler) AdminDeleteURL(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := middleware.GetAdminID(r.Context())
+	if !ok {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !writeServiceError(w, h.Service.AdminDeleteLink(r.Context(), adminID, chi.URLParam(r, "id"))) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminBlockUser хендлер PUT /api/admin/users/{user}/blocked. Запрещает пользователю создавать ссылки.
+func (h *Handler) AdminBlockUser(w http.ResponseWriter, r *http.Request) {
+	h.adminSetBlocked(w, r, true)
+}
+
+// AdminUnblockUser хендлер DELETE /api/admin/users/{user}/blocked. Снимает запрет.
+func (h *Handler) AdminUnblockUser(w http.ResponseWriter, r *http.Request) {
+	h.adminSetBlocked(w, r, false)
+}
+
+// adminSetBlocked меняет блокировку пользователя и отвечает 204.
+func (h *Handler) adminSetBlocked(w http.ResponseWriter, r *http.Request, blocked bool) {
+	adminID, ok := middleware.GetAdminID(r.Context())
+	if !ok {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !writeServiceError(w, h.Service.AdminBlockUser(r.Context(), adminID, chi.URLParam(r, "user"), blocked)) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminAudit хендлер GET /api/admin/audit. Возвращает журнал действий от новых записей к старым.
+// Параметры: actor, action, target, short_url, from и to (RFC 3339) и limit (по умолчанию 100).
+func (h *Handler) AdminAudit(w http.ResponseWriter, r *http.Request) {
+	filter, ok := auditFilter(w, r)
+	if !ok {
+		return
+	}
+	filter.Limit = service.DefaultAdminPageLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		var err error
+		if filter.Limit, err = strconv.Atoi(raw); err != nil || filter.Limit <= 0 || filter.Limit > service.MaxAdminPageLimit {
+			http.Error(w, "Недопустимый limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	events, err := h.Service.AuditEvents(r.Context(), filter)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if events == nil {
+		events = []audit.Event{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(events)
+}
+
+// AdminAuditExport хендлер GET /api/admin/audit/export. Выгружает все подходящие записи журнала
+// от старых к новым файлом в формате format=jsonl (по умолчанию) или format=csv. Фильтры те же, что у AdminAudit.
+func (h *Handler) AdminAuditExport(w http.ResponseWriter, r *http.Request) {
+	filter, ok := auditFilter(w, r)
+	if !ok {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "jsonl"
+	}
+	if format != "jsonl" && format != "csv" {
+		http.Error(w, "Недопустимый format", http.StatusBadRequest)
+		return
+	}
+
+	events, err := h.Service.AuditEvents(r.Context(), filter)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	slices.Reverse(events)
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+		w.WriteHeader(http.StatusOK)
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"time", "actor", "action", "short_url", "target", "detail"})
+		for _, e := range events {
+			cw.Write([]string{e.Time.Format(time.RFC3339Nano), e.Actor, e.Action, e.ShortURL, e.Target, e.Detail})
+		}
+		cw.Flush()
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	for _, e := range events {
+		enc.Encode(e)
+	}
+}
+
+// auditFilter читает условия выборки журнала из параметров запроса. При ошибке отвечает 400 и возвращает false.
+func auditFilter(w http.ResponseWriter, r *http.Request) (audit.Filter, bool) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Actor:    query.Get("actor"),
+		Action:   query.Get("action"),
+		Target:   query.Get("target"),
+		ShortURL: query.Get("short_url"),
+	}
+	for _, bound := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		raw := query.Get(bound.name)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			http.Error(w, "Недопустимое время "+bound.name+", нужен формат RFC 3339", http.StatusBadRequest)
+			return audit.Filter{}, false
+		}
+		*bound.dst = t
+	}
+	return filter, true
+}
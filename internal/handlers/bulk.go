@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/divanov-web/shorturl/internal/middleware"
+	"github.com/divanov-web/shorturl/internal/service"
+)
+
+// bulkChunkSize сколько строк импорта сохраняется в хранилище за один раз.
+const bulkChunkSize = 1000
+
+// bulkMaxLineSize максимальная длина строки NDJSON.
+const bulkMaxLineSize = 1 << 20
+
+// bulkStatusAborted статус строки, на которой импорт прерван из-за ошибки чтения или хранилища.
+const bulkStatusAborted = "aborted"
+
+// errBulkBadLine строку не удалось разобрать, импорт продолжается со следующей.
+var errBulkBadLine = errors.New("malformed bulk line")
+
+// BulkResultItem итог обработки одной строки массового импорта.
+type BulkResultItem struct {
+	Line int `json:"line"`
+	service.ShortenBatchResult
+}
+
+// bulkReader читает элементы массового импорта по одному.
+// Next возвращает io.EOF в конце потока и errBulkBadLine для строки, которую не удалось разобрать.
+type bulkReader interface {
+	Next() (service.BatchRequestItem, int, error)
+}
+
+// ndjsonReader читает строки вида {"correlation_id": "...", "original_url": "..."}.
+type ndjsonReader struct {
+	reader *bufio.Reader
+	buf    []byte
+	line   int
+}
+
+func newNDJSONReader(r io.Reader) *ndjsonReader {
+	return &ndjsonReader{reader: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// Next возвращает очередной элемент NDJSON, пропуская пустые строки.
+// Строка длиннее bulkMaxLineSize считается неразобранной, импорт продолжается со следующей.
+func (n *ndjsonReader) Next() (service.BatchRequestItem, int, error) {
+	for {
+		b, tooLong, err := n.readLine()
+		if err != nil && err != io.EOF {
+			return service.BatchRequestItem{}, n.line + 1, err
+		}
+		if err == io.EOF && len(b) == 0 && !tooLong {
+			return service.BatchRequestItem{}, n.line, io.EOF
+		}
+		n.line++
+		var item service.BatchRequestItem
+		if tooLong {
+			return item, n.line, errBulkBadLine
+		}
+		if len(bytes.TrimSpace(b)) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(b, &item); err != nil {
+			return item, n.line, errBulkBadLine
+		}
+		return item, n.line, nil
+	}
+}
+
+// readLine читает строку вместе с переводом строки. Строка длиннее bulkMaxLineSize
+// дочитывается до конца без сохранения, тогда tooLong равен true.
+func (n *ndjsonReader) readLine() (line []byte, tooLong bool, err error) {
+	n.buf = n.buf[:0]
+	for {
+		chunk, err := n.reader.ReadSlice('\n')
+		if !tooLong {
+			if len(n.buf)+len(bytes.TrimRight(chunk, "\r\n")) > bulkMaxLineSize {
+				tooLong = true
+				n.buf = n.buf[:0]
+			} else {
+				n.buf = append(n.buf, chunk...)
+			}
+		}
+		if err != bufio.ErrBufferFull {
+			return n.buf, tooLong, err
+		}
+	}
+}
+
+// csvReader читает строки вида correlation_id,original_url или original_url.
+// Необязательная первая строка с заголовками пропускается.
+type csvReader struct {
+	reader *csv.Reader
+	first  bool
+}
+
+func newCSVReader(r io.Reader) *csvReader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	return &csvReader{reader: reader, first: true}
+}
+
+// Next возвращает очередной элемент CSV.
+func (c *csvReader) Next() (service.BatchRequestItem, int, error) {
+	for {
+		record, err := c.reader.Read()
+		if err == io.EOF {
+			return service.BatchRequestItem{}, 0, io.EOF
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return service.BatchRequestItem{}, parseErr.StartLine, errBulkBadLine
+		}
+		if err != nil {
+			return service.BatchRequestItem{}, 0, err
+		}
+		line, _ := c.reader.FieldPos(0)
+
+		if c.first {
+			c.first = false
+			if isCSVHeader(record) {
+				continue
+			}
+		}
+
+		switch len(record) {
+		case 1:
+			return service.BatchRequestItem{OriginalURL: record[0]}, line, nil
+		case 2:
+			return service.BatchRequestItem{CorrelationID: record[0], OriginalURL: record[1]}, line, nil
+		}
+		return service.BatchRequestItem{}, line, errBulkBadLine
+	}
+}
+
+func isCSVHeader(record []string) bool {
+	for _, field := range record {
+		switch strings.ToLower(strings.TrimSpace(field)) {
+		case "correlation_id", "original_url":
+			return true
+		}
+	}
+	return false
+}
+
+// newBulkReader выбирает формат импорта по Content-Type.
+func newBulkReader(r *http.Request) (bulkReader, bool) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return newNDJSONReader(r.Body), true
+	case "text/csv":
+		return newCSVReader(r.Body), true
+	}
+	return nil, false
+}
+
+// SetShortenBulk обрабатывает POST /api/shorten/bulk — потоковый массовый импорт ссылок.
+// Принимает NDJSON или CSV, проверяет строки по одной, сохраняет порциями по bulkChunkSize
+// и отдаёт NDJSON с итогом по каждой строке по мере обработки. Параметр workspace импортирует ссылки в рабочее пространство.
+func (h *Handler) SetShortenBulk(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	owner, ok := h.createOwner(w, r, userID, r.URL.Query().Get("workspace"))
+	if !ok {
+		return
+	}
+
+	reader, ok := newBulkReader(r)
+	if !ok {
+		http.Error(w, "Ожидается application/x-ndjson или text/csv", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// итоги отправляются, пока тело ещё читается; без этого HTTP/1.1-сервер закрывает тело после первого Flush.
+	// HTTP/2 и так работает в обе стороны, там ошибку можно не учитывать
+	rc := http.NewResponseController(w)
+	_ = rc.EnableFullDuplex()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+
+	chunk := make([]service.BatchRequestItem, 0, bulkChunkSize)
+	lines := make([]int, 0, bulkChunkSize)
+	badLines := make(map[int]bool)
+
+	abort := func(line int, msg string) {
+		_ = enc.Encode(BulkResultItem{
+			Line:               line,
+			ShortenBatchResult: service.ShortenBatchResult{Status: bulkStatusAborted, Error: msg},
+		})
+	}
+
+	flush := func() bool {
+		if len(chunk) == 0 {
+			return true
+		}
+		results, err := h.Service.CreateShortBulk(r.Context(), owner, chunk)
+		if err != nil {
+			abort(lines[0], "Ошибка при сохранении ссылок")
+			return false
+		}
+		for i, res := range results {
+			if badLines[i] {
+				res.Error = "Невозможно разобрать строку"
+			}
+			if err := enc.Encode(BulkResultItem{Line: lines[i], ShortenBatchResult: res}); err != nil {
+				return false
+			}
+		}
+		_ = rc.Flush()
+		chunk = chunk[:0]
+		lines = lines[:0]
+		clear(badLines)
+		return true
+	}
+
+	for {
+		item, line, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, errBulkBadLine) {
+			// пустой URL не пройдёт валидацию и попадёт в ответ как invalid
+			badLines[len(chunk)] = true
+			item = service.BatchRequestItem{CorrelationID: item.CorrelationID}
+		} else if err != nil {
+			if flush() {
+				abort(line, "Ошибка чтения тела запроса")
+			}
+			return
+		}
+
+		chunk = append(chunk, item)
+		lines = append(lines, line)
+		if len(chunk) == bulkChunkSize && !flush() {
+			return
+		}
+	}
+	flush()
+}
@@ -2,10 +2,12 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
-	"net/url"
+	"time"
 
 	"github.com/divanov-web/shorturl/internal/service"
+	"github.com/divanov-web/shorturl/internal/storage"
 )
 
 // Handler набор HTTP-хендлеров сервиса.
@@ -19,19 +21,167 @@ type DBPinger interface {
 }
 
 // DataRequest представляет входящие данные для создания короткой ссылки (JSON: поле "url").
+// Password необязателен: с ним ссылка открывается только после ввода пароля.
+// MaxClicks ограничивает число переходов, 1 — одноразовая ссылка. QR добавляет в ответ QR-код ссылки.
+// Tags, Folder, Title и Note помогают владельцу упорядочить ссылки.
+// Domain выбирает короткий домен ссылки, без него используется домен пользователя по умолчанию.
+// Workspace создаёт ссылку в рабочем пространстве, для этого нужна роль не ниже editor.
 type DataRequest struct {
-	URL string `json:"url"`
+	URL       string   `json:"url"`
+	Password  string   `json:"password,omitempty"`
+	MaxClicks int64    `json:"max_clicks,omitempty"`
+	QR        bool     `json:"qr,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Folder    string   `json:"folder,omitempty"`
+	Title     string   `json:"title,omitempty"`
+	Note      string   `json:"note,omitempty"`
+	Domain    string   `json:"domain,omitempty"`
+	Workspace string   `json:"workspace,omitempty"`
 }
 
-// DataResponse Исходящие данные
+// UpdateURLRequest описывает изменение ссылки владельца. Отсутствующие поля не меняются,
+// пустые строки и пустой список тегов очищают значение.
+type UpdateURLRequest struct {
+	URL    string    `json:"url,omitempty"`
+	Tags   *[]string `json:"tags,omitempty"`
+	Folder *string   `json:"folder,omitempty"`
+	Title  *string   `json:"title,omitempty"`
+	Note   *string   `json:"note,omitempty"`
+}
+
+// DataResponse Исходящие данные. QR — PNG QR-кода в виде data URI, если он запрошен.
 type DataResponse struct {
 	Result string `json:"result"`
+	QR     string `json:"qr,omitempty"`
 }
 
 // UserURLItem описывает пару короткий/исходный URL для ответа списка ссылок пользователя.
+// Threat заполняется, если исходный URL найден в списках угроз, ClicksLeft — только для ссылок с лимитом переходов.
+// Disabled — ссылка заблокирована администратором.
 type UserURLItem struct {
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
+	ShortURL    string   `json:"short_url"`
+	OriginalURL string   `json:"original_url"`
+	Threat      string   `json:"threat,omitempty"`
+	Disabled    bool     `json:"disabled,omitempty"`
+	ClicksLeft  *int64   `json:"clicks_left,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Folder      string   `json:"folder,omitempty"`
+	Title       string   `json:"title,omitempty"`
+	Note        string   `json:"note,omitempty"`
+}
+
+// URLRevisionItem описывает прежнее значение оригинального URL в ответе истории изменений.
+type URLRevisionItem struct {
+	OriginalURL string    `json:"original_url"`
+	ChangedAt   time.Time `json:"changed_at"`
+}
+
+// LinkOptionsItem описывает настройки ссылки в запросе и ответе.
+// Password в запросе задаёт пароль ссылки, пустая строка снимает защиту, отсутствие поля оставляет как есть.
+// В ответе пароль не возвращается, вместо него Protected. Rules и Variants заменяют правила таргетинга
+// и варианты A/B-теста целиком.
+type LinkOptionsItem struct {
+	Interstitial bool                   `json:"interstitial"`
+	RedirectCode int                    `json:"redirect_code,omitempty"`
+	Password     *string                `json:"password,omitempty"`
+	Protected    bool                   `json:"protected"`
+	Rules        []storage.RedirectRule `json:"rules,omitempty"`
+	Variants     []storage.Variant      `json:"variants,omitempty"`
+}
+
+// LinkStatsItem описывает счётчики переходов ссылки. ClicksLeft только для ссылок с лимитом переходов.
+type LinkStatsItem struct {
+	ShortURL   string             `json:"short_url"`
+	Clicks     int64              `json:"clicks"`
+	ClicksLeft *int64             `json:"clicks_left,omitempty"`
+	Variants   []VariantStatsItem `json:"variants,omitempty"`
+}
+
+// VariantStatsItem описывает переходы по одному варианту A/B-теста.
+type VariantStatsItem struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+	Clicks int64  `json:"clicks"`
+}
+
+// UserSettingsItem описывает настройки пользователя. Domains в ответе — доступные короткие домены.
+type UserSettingsItem struct {
+	DefaultDomain string   `json:"default_domain"`
+	Domains       []string `json:"domains,omitempty"`
+}
+
+// WorkspaceItem описывает рабочее пространство и роль в нём текущего пользователя.
+type WorkspaceItem struct {
+	ID        string                `json:"id"`
+	Name      string                `json:"name"`
+	Role      storage.WorkspaceRole `json:"role"`
+	CreatedAt time.Time             `json:"created_at"`
+}
+
+// WorkspaceRequest описывает создание рабочего пространства.
+type WorkspaceRequest struct {
+	Name string `json:"name"`
+}
+
+// WorkspaceMemberItem описывает участника рабочего пространства, в запросе — только Role.
+type WorkspaceMemberItem struct {
+	UserID string                `json:"user_id,omitempty"`
+	Role   storage.WorkspaceRole `json:"role"`
+}
+
+// WorkspaceInviteItem описывает приглашение, в запросе — только Role.
+// Token передаётся приглашённому, он принимает приглашение запросом POST /api/invites/{token}.
+type WorkspaceInviteItem struct {
+	Token     string                `json:"token,omitempty"`
+	Role      storage.WorkspaceRole `json:"role"`
+	ExpiresAt time.Time             `json:"expires_at,omitzero"`
+}
+
+// WebhookRequest запрос на подписку: адрес и события link.created, link.deleted, link.clicked. Пустой Events — все события.
+type WebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// WebhookItem описывает подписку. Secret возвращается только при создании, им подписываются доставки.
+type WebhookItem struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events,omitempty"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// StreamDroppedItem сообщение потока событий о том, что Count событий пропущено, потому что клиент не успевал их читать.
+type StreamDroppedItem struct {
+	Type  string `json:"type"`
+	Count int64  `json:"count"`
+}
+
+// AdminURLItem описывает ссылку в результатах поиска администратора.
+// UserID — владелец ссылки, для ссылок рабочего пространства workspace:<id>.
+type AdminURLItem struct {
+	ID          string    `json:"id"`
+	ShortURL    string    `json:"short_url"`
+	OriginalURL string    `json:"original_url"`
+	UserID      string    `json:"user_id"`
+	CreatedAt   time.Time `json:"created_at,omitzero"`
+	Clicks      int64     `json:"clicks"`
+	Threat      string    `json:"threat,omitempty"`
+	Disabled    bool      `json:"disabled,omitempty"`
+}
+
+// AdminURLsResponse страница результатов поиска. Next передаётся в параметре after за следующей страницей.
+type AdminURLsResponse struct {
+	Items []AdminURLItem `json:"items"`
+	Next  string         `json:"next,omitempty"`
+}
+
+// ErrorResponse описывает ошибку с машинно-читаемой причиной.
+type ErrorResponse struct {
+	Error  string `json:"error"`
+	Reason string `json:"reason,omitempty"`
 }
 
 // NewHandler создаёт Handler с переданным сервисом бизнес-логики.
@@ -48,7 +198,10 @@ func (h *Handler) PingDB(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func isValidURL(raw string) bool {
-	u, err := url.ParseRequestURI(raw)
-	return err == nil && u.Scheme != "" && u.Host != ""
+// writeURLError отвечает 400 с причиной отказа политики URL в JSON.
+func writeURLError(w http.ResponseWriter, err error) {
+	reason, message := service.PolicyReason(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: message, Reason: reason})
 }
@@ -1,23 +1,35 @@
 package handlers
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/divanov-web/shorturl/internal/audit"
 	"github.com/divanov-web/shorturl/internal/config"
 	"github.com/divanov-web/shorturl/internal/middleware"
 	"github.com/divanov-web/shorturl/internal/service"
+	"github.com/divanov-web/shorturl/internal/storage"
 	"github.com/divanov-web/shorturl/internal/storage/filestorage"
+	"github.com/divanov-web/shorturl/internal/stream"
+	"github.com/divanov-web/shorturl/internal/webhook"
 	"github.com/go-chi/chi/v5"
 	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -56,6 +68,15 @@ func TestHandlePost(t *testing.T) {
 				statusCode: http.StatusBadRequest,
 			},
 		},
+		{
+			name:   "rejected by policy",
+			method: http.MethodPost,
+			body:   "http://127.0.0.1/admin",
+			want: want{
+				statusCode: http.StatusBadRequest,
+				bodyPrefix: service.ReasonPrivateHost,
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -90,8 +111,10 @@ func TestHandlePost(t *testing.T) {
 
 func TestHandleGet(t *testing.T) {
 	type want struct {
-		statusCode int
-		location   string
+		statusCode   int
+		location     string
+		body         string
+		cacheControl string
 	}
 
 	tests := []struct {
@@ -118,10 +141,99 @@ func TestHandleGet(t *testing.T) {
 			method: http.MethodGet,
 			path:   "/doesnotexist",
 			setup:  func(s *filestorage.Storage) {},
+			want: want{
+				statusCode: http.StatusNotFound,
+			},
+		},
+		{
+			name:   "deleted ID",
+			method: http.MethodGet,
+			path:   "/del123",
+			setup: func(s *filestorage.Storage) {
+				s.ForceSet("del123", "https://example.com")
+				_, _ = s.MarkAsDeleted(context.Background(), "", []string{"del123"})
+			},
 			want: want{
 				statusCode: http.StatusGone,
 			},
 		},
+		{
+			name:   "permanent redirect option",
+			method: http.MethodGet,
+			path:   "/perm123",
+			setup: func(s *filestorage.Storage) {
+				s.ForceSet("perm123", "https://example.com/new")
+				_ = s.SetOptions(context.Background(), "", "perm123", storage.LinkOptions{RedirectCode: http.StatusPermanentRedirect})
+			},
+			want: want{
+				statusCode:   http.StatusPermanentRedirect,
+				location:     "https://example.com/new",
+				cacheControl: "public, max-age=86400",
+			},
+		},
+		{
+			name:   "HEAD",
+			method: http.MethodHead,
+			path:   "/abc123",
+			setup: func(s *filestorage.Storage) {
+				s.ForceSet("abc123", "https://example.com")
+			},
+			want: want{
+				statusCode:   http.StatusTemporaryRedirect,
+				location:     "https://example.com",
+				cacheControl: "private, no-cache",
+			},
+		},
+		{
+			name:   "preview suffix",
+			method: http.MethodGet,
+			path:   "/abc123+",
+			setup: func(s *filestorage.Storage) {
+				s.ForceSet("abc123", "https://example.com/page")
+			},
+			want: want{
+				statusCode: http.StatusOK,
+				body:       "https://example.com/page",
+			},
+		},
+		{
+			name:   "preview query",
+			method: http.MethodGet,
+			path:   "/abc123?preview=1",
+			setup: func(s *filestorage.Storage) {
+				s.ForceSet("abc123", "https://example.com/page")
+			},
+			want: want{
+				statusCode: http.StatusOK,
+				body:       "https://example.com/page",
+			},
+		},
+		{
+			name:   "interstitial option",
+			method: http.MethodGet,
+			path:   "/int123",
+			setup: func(s *filestorage.Storage) {
+				s.ForceSet("int123", "https://example.com/away")
+				_ = s.SetOptions(context.Background(), "", "int123", storage.LinkOptions{Interstitial: true})
+			},
+			want: want{
+				statusCode: http.StatusOK,
+				body:       "Вы покидаете сайт",
+			},
+		},
+		{
+			name:   "flagged by scanner",
+			method: http.MethodGet,
+			path:   "/bad123",
+			setup: func(s *filestorage.Storage) {
+				s.ForceSet("bad123", "https://malware.example/")
+				_ = s.SetThreat(context.Background(), "bad123", "MALWARE")
+			},
+			want: want{
+				statusCode: http.StatusOK,
+				body:       "MALWARE",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -137,18 +249,853 @@ func TestHandleGet(t *testing.T) {
 
 			r := chi.NewRouter()
 			r.Get("/{id}", h.GetRealURL)
+			r.Head("/{id}", h.GetRealURL)
 			r.ServeHTTP(w, req)
 
 			result := w.Result()
 			defer result.Body.Close()
 
 			assert.Equal(t, tt.want.statusCode, result.StatusCode)
+			if tt.want.cacheControl != "" {
+				assert.Equal(t, tt.want.cacheControl, result.Header.Get("Cache-Control"))
+			}
 
 			if tt.want.location != "" {
 				assert.Equal(t, tt.want.location, result.Header.Get("Location"))
 			}
+			if tt.want.body != "" {
+				body, _ := io.ReadAll(result.Body)
+				assert.Contains(t, string(body), tt.want.body)
+				assert.Empty(t, result.Header.Get("Location"))
+			}
+		})
+	}
+}
+
+func TestPreviewPage_Gzip(t *testing.T) {
+	store := filestorage.NewTestStorage()
+	store.ForceSet("abc123", "https://example.com/?a=1&b=<2>")
+	svc := service.NewURLService(context.Background(), "http://localhost:8080", store)
+	h := NewHandler(svc)
+
+	r := chi.NewRouter()
+	r.Use(middleware.NewCompressor(0, []string{"text/html"}).WithCompression)
+	r.Get("/{id}", h.GetRealURL)
+
+	// переход учитывается, предпросмотр — нет
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abc123", nil))
+	require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/abc123+", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	zr, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "https://example.com/?a=1&amp;b=%3c2%3e")
+	assert.Contains(t, string(body), "<dt>Переходов</dt><dd>1</dd>")
+}
+
+func TestProtectedURL(t *testing.T) {
+	store := filestorage.NewTestStorage()
+	svc := service.NewURLService(context.Background(), "http://localhost:8080", store)
+	shortURL, err := svc.CreateShortWithParams(context.Background(), "owner", "https://example.com/doc", service.CreateParams{Password: "pa55"})
+	require.NoError(t, err)
+	id := strings.TrimPrefix(shortURL, "http://localhost:8080/")
+	h := NewHandler(svc)
+
+	r := chi.NewRouter()
+	r.Get("/{id}", h.GetRealURL)
+	r.Post("/{id}", h.UnlockURL)
+
+	do := func(req *http.Request) *http.Response {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	// без пароля — форма, адрес назначения не раскрывается
+	res := do(httptest.NewRequest(http.MethodGet, "/"+id, nil))
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	assert.Contains(t, string(body), `type="password"`)
+	assert.NotContains(t, string(body), "example.com")
+
+	// предпросмотр тоже защищён
+	res = do(httptest.NewRequest(http.MethodGet, "/"+id+"+", nil))
+	res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	// пароль в заголовке для API-клиентов
+	req := httptest.NewRequest(http.MethodGet, "/"+id, nil)
+	req.Header.Set(LinkPasswordHeader, "pa55")
+	res = do(req)
+	res.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+	assert.Equal(t, "https://example.com/doc", res.Header.Get("Location"))
+
+	// форма ставит cookie, с которой пароль больше не нужен
+	req = httptest.NewRequest(http.MethodPost, "/"+id, strings.NewReader("password=pa55"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res = do(req)
+	res.Body.Close()
+	require.Equal(t, http.StatusSeeOther, res.StatusCode)
+	cookies := res.Cookies()
+	require.Len(t, cookies, 1)
+
+	req = httptest.NewRequest(http.MethodGet, "/"+id, nil)
+	req.AddCookie(cookies[0])
+	res = do(req)
+	res.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+
+	// подбор блокируется
+	for i := 0; i < svc.Passwords.MaxAttempts; i++ {
+		req = httptest.NewRequest(http.MethodGet, "/"+id, nil)
+		req.Header.Set(LinkPasswordHeader, "wrong")
+		res = do(req)
+		res.Body.Close()
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/"+id, nil)
+	req.Header.Set(LinkPasswordHeader, "pa55")
+	res = do(req)
+	res.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.NotEmpty(t, res.Header.Get("Retry-After"))
+
+	// другой клиент ссылкой по-прежнему пользуется
+	req = httptest.NewRequest(http.MethodGet, "/"+id, nil)
+	req.RemoteAddr = "198.51.100.7:4321"
+	req.Header.Set(LinkPasswordHeader, "pa55")
+	res = do(req)
+	res.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+}
+
+func TestClickLimitedURL(t *testing.T) {
+	store := filestorage.NewTestStorage()
+	svc := service.NewURLService(context.Background(), "http://localhost:8080", store)
+	shortURL, err := svc.CreateShortWithParams(context.Background(), "owner", "https://example.com/once", service.CreateParams{MaxClicks: 2})
+	require.NoError(t, err)
+	id := strings.TrimPrefix(shortURL, "http://localhost:8080/")
+	h := NewHandler(svc)
+
+	r := chi.NewRouter()
+	r.Get("/{id}", h.GetRealURL)
+	r.Head("/{id}", h.GetRealURL)
+	r.Get("/api/user/urls", h.GetUserURLs)
+
+	do := func(method, target string) *http.Response {
+		req := httptest.NewRequest(method, target, nil)
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "owner"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Result()
+	}
+	clicksLeft := func() int64 {
+		res := do(http.MethodGet, "/api/user/urls")
+		defer res.Body.Close()
+		var items []UserURLItem
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&items))
+		require.Len(t, items, 1)
+		require.NotNil(t, items[0].ClicksLeft)
+		return *items[0].ClicksLeft
+	}
+
+	assert.Equal(t, int64(2), clicksLeft())
+
+	// HEAD не списывает переход
+	res := do(http.MethodHead, "/"+id)
+	res.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+	assert.Equal(t, int64(2), clicksLeft())
+
+	for i := 0; i < 2; i++ {
+		res = do(http.MethodGet, "/"+id)
+		res.Body.Close()
+		assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+		assert.Equal(t, "no-store", res.Header.Get("Cache-Control"))
+	}
+	assert.Equal(t, int64(0), clicksLeft())
+
+	res = do(http.MethodGet, "/"+id)
+	res.Body.Close()
+	assert.Equal(t, http.StatusGone, res.StatusCode)
+}
+
+func TestSplitURL(t *testing.T) {
+	ctx := context.Background()
+	store := filestorage.NewTestStorage()
+	svc := service.NewURLService(ctx, "http://localhost:8080", store)
+	shortURL, err := svc.CreateShort(ctx, "owner", "https://example.com/")
+	require.NoError(t, err)
+	id := strings.TrimPrefix(shortURL, "http://localhost:8080/")
+	require.NoError(t, svc.SetLinkOptions(ctx, "owner", id, storage.LinkOptions{Variants: []storage.Variant{
+		{Name: "a", URL: "https://example.com/a", Weight: 1},
+		{Name: "b", URL: "https://example.com/b", Weight: 1},
+	}}))
+	h := NewHandler(svc)
+
+	r := chi.NewRouter()
+	r.Get("/{id}", h.GetRealURL)
+	r.Get("/api/user/urls/{id}/stats", h.GetUserURLStats)
+
+	do := func(userID string, target string, cookie *http.Cookie) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, userID))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	res := do("visitor", "/"+id, nil)
+	res.Body.Close()
+	require.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+	location := res.Header.Get("Location")
+	assert.Contains(t, []string{"https://example.com/a", "https://example.com/b"}, location)
+	assert.Equal(t, "private, no-cache", res.Header.Get("Cache-Control"))
+	cookies := res.Cookies()
+	require.Len(t, cookies, 1)
+
+	// с cookie варианта посетитель остаётся на нём, даже если его ключ другой
+	for i := 0; i < 3; i++ {
+		res = do("other-"+strconv.Itoa(i), "/"+id, cookies[0])
+		res.Body.Close()
+		assert.Equal(t, location, res.Header.Get("Location"))
+	}
+
+	res = do("owner", "/api/user/urls/"+id+"/stats", nil)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var stats LinkStatsItem
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&stats))
+	assert.Equal(t, int64(4), stats.Clicks)
+	require.Len(t, stats.Variants, 2)
+	var total int64
+	for _, v := range stats.Variants {
+		if v.URL == location {
+			assert.Equal(t, int64(4), v.Clicks)
+		}
+		total += v.Clicks
+	}
+	assert.Equal(t, int64(4), total)
+
+	res = do("stranger", "/api/user/urls/"+id+"/stats", nil)
+	res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+}
+
+func TestGetUserURLQR(t *testing.T) {
+	ctx := context.Background()
+	store := filestorage.NewTestStorage()
+	svc := service.NewURLService(ctx, "http://localhost:8080", store)
+	shortURL, err := svc.CreateShort(ctx, "owner", "https://example.com/qr")
+	require.NoError(t, err)
+	id := strings.TrimPrefix(shortURL, "http://localhost:8080/")
+	h := NewHandler(svc)
+
+	r := chi.NewRouter()
+	r.Get("/api/user/urls/{id}/qr", h.GetUserURLQR)
+	r.Post("/api/shorten", h.SetShortURL)
+
+	tests := []struct {
+		name        string
+		userID      string
+		query       string
+		status      int
+		contentType string
+	}{
+		{name: "png", userID: "owner", status: http.StatusOK, contentType: "image/png"},
+		{name: "svg", userID: "owner", query: "?format=svg&size=300&margin=2&level=H&fg=112233&bg=ffffff", status: http.StatusOK, contentType: "image/svg+xml"},
+		{name: "unknown format", userID: "owner", query: "?format=gif", status: http.StatusBadRequest},
+		{name: "bad size", userID: "owner", query: "?size=10", status: http.StatusBadRequest},
+		{name: "bad colour", userID: "owner", query: "?fg=red", status: http.StatusBadRequest},
+		{name: "not owner", userID: "stranger", status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls/"+id+"/qr"+tt.query, nil)
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, tt.userID))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.status, res.StatusCode)
+			if tt.contentType != "" {
+				assert.Equal(t, tt.contentType, res.Header.Get("Content-Type"))
+			}
 		})
 	}
+
+	// QR-код в ответе /api/shorten по запросу
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"https://example.com/new","qr":true}`))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "owner"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	var resp DataResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&resp))
+	assert.True(t, strings.HasPrefix(resp.QR, "data:image/png;base64,"))
+}
+
+func TestUserURLMeta(t *testing.T) {
+	store := filestorage.NewTestStorage()
+	svc := service.NewURLService(context.Background(), "http://localhost:8080", store)
+	h := NewHandler(svc)
+
+	r := chi.NewRouter()
+	r.Post("/api/shorten", h.SetShortURL)
+	r.Get("/api/user/urls", h.GetUserURLs)
+	r.Patch("/api/user/urls/{id}", h.UpdateUserURL)
+
+	do := func(method, target, body string) *http.Response {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "owner"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Result()
+	}
+	list := func(target string) []UserURLItem {
+		res := do(http.MethodGet, target, "")
+		defer res.Body.Close()
+		if res.StatusCode == http.StatusNoContent {
+			return nil
+		}
+		var items []UserURLItem
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&items))
+		return items
+	}
+
+	res := do(http.MethodPost, "/api/shorten", `{"url":"https://example.com/a","tags":["promo","q3"],"folder":"ads","title":"A"}`)
+	res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	res = do(http.MethodPost, "/api/shorten", `{"url":"https://example.com/b","tags":["docs"]}`)
+	var created DataResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&created))
+	res.Body.Close()
+	id := strings.TrimPrefix(created.Result, "http://localhost:8080/")
+
+	items := list("/api/user/urls?tag=promo")
+	require.Len(t, items, 1)
+	assert.Equal(t, "https://example.com/a", items[0].OriginalURL)
+	assert.Equal(t, []string{"promo", "q3"}, items[0].Tags)
+	assert.Equal(t, "ads", items[0].Folder)
+	assert.Equal(t, "A", items[0].Title)
+	assert.Empty(t, list("/api/user/urls?tag=unknown"))
+
+	// PATCH меняет только переданные поля, URL остаётся прежним
+	res = do(http.MethodPatch, "/api/user/urls/"+id, `{"tags":["promo"],"note":"вторая"}`)
+	var updated UserURLItem
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&updated))
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "https://example.com/b", updated.OriginalURL)
+	assert.Equal(t, []string{"promo"}, updated.Tags)
+	assert.Equal(t, "вторая", updated.Note)
+	assert.Len(t, list("/api/user/urls?tag=PROMO"), 2)
+
+	res = do(http.MethodPatch, "/api/user/urls/"+id, `{"title":"`+strings.Repeat("x", 201)+`"}`)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestShortDomains(t *testing.T) {
+	store := filestorage.NewTestStorage()
+	svc := service.NewURLService(context.Background(), "http://localhost:8080", store)
+	svc.Domains = []string{"go.example"}
+	h := NewHandler(svc)
+
+	r := chi.NewRouter()
+	r.Post("/api/shorten", h.SetShortURL)
+	r.Get("/api/user/settings", h.GetUserSettings)
+	r.Put("/api/user/settings", h.SetUserSettings)
+	r.Get("/{id}", h.GetRealURL)
+
+	do := func(method, target, host, body string) *http.Response {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Host = host
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "owner"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	res := do(http.MethodPost, "/api/shorten", "localhost:8080", `{"url":"https://example.com/a","domain":"go.example"}`)
+	var created DataResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&created))
+	res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	require.True(t, strings.HasPrefix(created.Result, "http://go.example/"), created.Result)
+	id := strings.TrimPrefix(created.Result, "http://go.example/")
+
+	res = do(http.MethodGet, "/"+id, "go.example", "")
+	res.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+	assert.Equal(t, "https://example.com/a", res.Header.Get("Location"))
+
+	res = do(http.MethodGet, "/"+id, "localhost:8080", "")
+	res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res = do(http.MethodPost, "/api/shorten", "localhost:8080", `{"url":"https://example.com/b","domain":"evil.example"}`)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res = do(http.MethodPut, "/api/user/settings", "localhost:8080", `{"default_domain":"evil.example"}`)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res = do(http.MethodPut, "/api/user/settings", "localhost:8080", `{"default_domain":"go.example"}`)
+	var settings UserSettingsItem
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&settings))
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, UserSettingsItem{DefaultDomain: "go.example", Domains: []string{"localhost:8080", "go.example"}}, settings)
+
+	res = do(http.MethodPost, "/api/shorten", "localhost:8080", `{"url":"https://example.com/c"}`)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&created))
+	res.Body.Close()
+	assert.True(t, strings.HasPrefix(created.Result, "http://go.example/"), created.Result)
+}
+
+func TestWorkspaces(t *testing.T) {
+	store := filestorage.NewTestStorage()
+	svc := service.NewURLService(context.Background(), "http://localhost:8080", store)
+	h := NewHandler(svc)
+
+	r := chi.NewRouter()
+	r.Post("/api/shorten", h.SetShortURL)
+	r.Get("/api/user/urls", h.GetUserURLs)
+	r.Patch("/api/user/urls/{id}", h.UpdateUserURL)
+	r.Post("/api/workspaces", h.CreateWorkspace)
+	r.Get("/api/workspaces", h.GetWorkspaces)
+	r.Get("/api/workspaces/{workspace}/members", h.GetWorkspaceMembers)
+	r.Post("/api/workspaces/{workspace}/invites", h.CreateWorkspaceInvite)
+	r.Post("/api/invites/{token}", h.AcceptWorkspaceInvite)
+
+	do := func(userID, method, target, body string, out any) int {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, userID))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		if out != nil && res.StatusCode < 300 && res.StatusCode != http.StatusNoContent {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(out))
+		}
+		return res.StatusCode
+	}
+
+	var ws WorkspaceItem
+	require.Equal(t, http.StatusCreated, do("alice", http.MethodPost, "/api/workspaces", `{"name":"Маркетинг"}`, &ws))
+	assert.Equal(t, storage.RoleOwner, ws.Role)
+
+	var invite WorkspaceInviteItem
+	assert.Equal(t, http.StatusForbidden, do("bob", http.MethodPost, "/api/workspaces/"+ws.ID+"/invites", `{"role":"viewer"}`, nil))
+	require.Equal(t, http.StatusCreated, do("alice", http.MethodPost, "/api/workspaces/"+ws.ID+"/invites", `{"role":"viewer"}`, &invite))
+	require.NotEmpty(t, invite.Token)
+
+	var joined WorkspaceItem
+	require.Equal(t, http.StatusOK, do("bob", http.MethodPost, "/api/invites/"+invite.Token, "", &joined))
+	assert.Equal(t, WorkspaceItem{ID: ws.ID, Name: "Маркетинг", Role: storage.RoleViewer, CreatedAt: ws.CreatedAt}, joined)
+	assert.Equal(t, http.StatusNotFound, do("carol", http.MethodPost, "/api/invites/"+invite.Token, "", nil))
+
+	var members []WorkspaceMemberItem
+	require.Equal(t, http.StatusOK, do("bob", http.MethodGet, "/api/workspaces/"+ws.ID+"/members", "", &members))
+	assert.Equal(t, []WorkspaceMemberItem{{UserID: "alice", Role: storage.RoleOwner}, {UserID: "bob", Role: storage.RoleViewer}}, members)
+
+	// зритель не создаёт и не меняет ссылки рабочего пространства, но видит их
+	assert.Equal(t, http.StatusForbidden, do("bob", http.MethodPost, "/api/shorten", `{"url":"https://example.com/a","workspace":"`+ws.ID+`"}`, nil))
+	var created DataResponse
+	require.Equal(t, http.StatusCreated, do("alice", http.MethodPost, "/api/shorten", `{"url":"https://example.com/a","workspace":"`+ws.ID+`"}`, &created))
+	id := strings.TrimPrefix(created.Result, "http://localhost:8080/")
+
+	var items []UserURLItem
+	require.Equal(t, http.StatusOK, do("bob", http.MethodGet, "/api/user/urls?workspace="+ws.ID, "", &items))
+	require.Len(t, items, 1)
+	assert.Equal(t, "https://example.com/a", items[0].OriginalURL)
+	assert.Equal(t, http.StatusNoContent, do("alice", http.MethodGet, "/api/user/urls", "", nil))
+	assert.Equal(t, http.StatusForbidden, do("carol", http.MethodGet, "/api/user/urls?workspace="+ws.ID, "", nil))
+	assert.Equal(t, http.StatusForbidden, do("bob", http.MethodPatch, "/api/user/urls/"+id, `{"url":"https://example.com/b"}`, nil))
+	assert.Equal(t, http.StatusOK, do("alice", http.MethodPatch, "/api/user/urls/"+id, `{"url":"https://example.com/b"}`, nil))
+
+	var list []WorkspaceItem
+	require.Equal(t, http.StatusOK, do("bob", http.MethodGet, "/api/workspaces", "", &list))
+	assert.Len(t, list, 1)
+	assert.Equal(t, http.StatusNoContent, do("carol", http.MethodGet, "/api/workspaces", "", nil))
+}
+
+func TestAdmin(t *testing.T) {
+	store := filestorage.NewTestStorage()
+	svc := service.NewURLService(context.Background(), "http://localhost:8080", store)
+	h := NewHandler(svc)
+	admin := middleware.NewAdmin([]string{"root"}, []string{"secret-key"})
+
+	r := chi.NewRouter()
+	r.Post("/api/shorten", h.SetShortURL)
+	r.Get("/{id}", h.GetRealURL)
+	r.Route("/api/admin", func(r chi.Router) {
+		r.Use(admin.WithAdmin)
+		r.Get("/urls", h.AdminSearchURLs)
+		r.Put("/urls/{id}/disabled", h.AdminDisableURL)
+		r.Delete("/urls/{id}", h.AdminDeleteURL)
+		r.Put("/users/{user}/blocked", h.AdminBlockUser)
+		r.Get("/audit", h.AdminAudit)
+		r.Get("/audit/export", h.AdminAuditExport)
+	})
+
+	do := func(userID, key, method, target, body string, out any) int {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, userID))
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		if out != nil && res.StatusCode < 300 && res.StatusCode != http.StatusNoContent {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(out))
+		}
+		return res.StatusCode
+	}
+
+	var created DataResponse
+	require.Equal(t, http.StatusCreated, do("alice", "", http.MethodPost, "/api/shorten", `{"url":"https://example.com/a"}`, &created))
+	id := strings.TrimPrefix(created.Result, "http://localhost:8080/")
+
+	// обычный пользователь и неверный ключ не проходят
+	assert.Equal(t, http.StatusForbidden, do("alice", "", http.MethodGet, "/api/admin/urls", "", nil))
+	assert.Equal(t, http.StatusUnauthorized, do("root", "wrong", http.MethodGet, "/api/admin/urls", "", nil))
+	assert.Equal(t, http.StatusBadRequest, do("root", "", http.MethodGet, "/api/admin/urls?limit=0", "", nil))
+
+	var found AdminURLsResponse
+	require.Equal(t, http.StatusOK, do("", "secret-key", http.MethodGet, "/api/admin/urls?domain=example.com&user=alice", "", &found))
+	require.Len(t, found.Items, 1)
+	assert.Equal(t, id, found.Items[0].ID)
+	assert.Equal(t, created.Result, found.Items[0].ShortURL)
+	assert.Empty(t, found.Next)
+
+	// заблокированная ссылка отвечает 410
+	require.Equal(t, http.StatusNoContent, do("root", "", http.MethodPut, "/api/admin/urls/"+id+"/disabled", "", nil))
+	assert.Equal(t, http.StatusGone, do("", "", http.MethodGet, "/"+id, "", nil))
+	assert.Equal(t, http.StatusNotFound, do("root", "", http.MethodPut, "/api/admin/urls/missing/disabled", "", nil))
+
+	// заблокированный пользователь не создаёт ссылки
+	require.Equal(t, http.StatusNoContent, do("root", "", http.MethodPut, "/api/admin/users/alice/blocked", "", nil))
+	assert.Equal(t, http.StatusForbidden, do("alice", "", http.MethodPost, "/api/shorten", `{"url":"https://example.com/b"}`, nil))
+	assert.Equal(t, http.StatusCreated, do("bob", "", http.MethodPost, "/api/shorten", `{"url":"https://example.com/b"}`, nil))
+
+	require.Equal(t, http.StatusNoContent, do("", "secret-key", http.MethodDelete, "/api/admin/urls/"+id, "", nil))
+
+	var events []audit.Event
+	require.Equal(t, http.StatusOK, do("root", "", http.MethodGet, "/api/admin/audit?short_url="+id, "", &events))
+	require.Len(t, events, 3)
+	assert.Equal(t, audit.ActionLinkDelete, events[0].Action)
+	assert.Equal(t, "api-key:1", events[0].Actor)
+	assert.Equal(t, audit.ActionLinkDisable, events[1].Action)
+	assert.Equal(t, "user:root", events[1].Actor)
+	assert.Equal(t, audit.ActionLinkCreate, events[2].Action)
+	assert.Equal(t, "alice", events[2].Actor)
+	assert.Equal(t, http.StatusBadRequest, do("root", "", http.MethodGet, "/api/admin/audit?from=yesterday", "", nil))
+
+	// выгрузка идёт от старых записей к новым
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/audit/export?format=csv&short_url="+id, nil)
+	req.Header.Set("Authorization", "Bearer secret-key")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `attachment; filename="audit.csv"`, w.Header().Get("Content-Disposition"))
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 4)
+	assert.Equal(t, []string{"time", "actor", "action", "short_url", "target", "detail"}, rows[0])
+	assert.Equal(t, []string{"alice", audit.ActionLinkCreate, id, "alice", ""}, rows[1][1:])
+	assert.Equal(t, audit.ActionLinkDelete, rows[3][2])
+}
+
+func TestRestoreUserURL(t *testing.T) {
+	store := filestorage.NewTestStorage()
+	svc := service.NewURLService(context.Background(), "http://localhost:8080", store)
+	h := NewHandler(svc)
+
+	r := chi.NewRouter()
+	r.Post("/api/shorten", h.SetShortURL)
+	r.Get("/{id}", h.GetRealURL)
+	r.Post("/api/user/urls/{id}/restore", h.RestoreUserURL)
+
+	do := func(userID, method, target, body string, out any) int {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, userID))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		if out != nil && res.StatusCode < 300 {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(out))
+		}
+		return res.StatusCode
+	}
+
+	var created DataResponse
+	require.Equal(t, http.StatusCreated, do("alice", http.MethodPost, "/api/shorten", `{"url":"https://example.com/a"}`, &created))
+	id := strings.TrimPrefix(created.Result, "http://localhost:8080/")
+	require.NoError(t, svc.DeleteUserURLs(context.Background(), "alice", []string{id}))
+	assert.Equal(t, http.StatusGone, do("", http.MethodGet, "/"+id, "", nil))
+
+	assert.Equal(t, http.StatusForbidden, do("bob", http.MethodPost, "/api/user/urls/"+id+"/restore", "", nil))
+	assert.Equal(t, http.StatusNotFound, do("alice", http.MethodPost, "/api/user/urls/missing/restore", "", nil))
+	var item UserURLItem
+	require.Equal(t, http.StatusOK, do("alice", http.MethodPost, "/api/user/urls/"+id+"/restore", "", &item))
+	assert.Equal(t, created.Result, item.ShortURL)
+	assert.Equal(t, http.StatusTemporaryRedirect, do("", http.MethodGet, "/"+id, "", nil))
+}
+
+func TestWebhooks(t *testing.T) {
+	store := filestorage.NewTestStorage()
+	svc := service.NewURLService(context.Background(), "http://localhost:8080", store)
+	h := NewHandler(svc)
+
+	r := chi.NewRouter()
+	r.Post("/api/webhooks", h.CreateWebhook)
+	r.Get("/api/webhooks", h.GetWebhooks)
+	r.Delete("/api/webhooks/{webhook}", h.DeleteWebhook)
+	r.Get("/api/webhooks/{webhook}/deliveries", h.GetWebhookDeliveries)
+	r.Post("/api/webhooks/{webhook}/dead/{delivery}", h.RedeliverWebhook)
+
+	do := func(userID, method, target, body string, out any) int {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, userID))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		if out != nil && res.StatusCode < 300 && res.StatusCode != http.StatusNoContent {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(out))
+		}
+		return res.StatusCode
+	}
+
+	assert.Equal(t, http.StatusBadRequest, do("alice", http.MethodPost, "/api/webhooks", `{"url":"http://localhost/hook"}`, nil))
+	assert.Equal(t, http.StatusBadRequest, do("alice", http.MethodPost, "/api/webhooks", `{"url":"https://hooks.example.com/","events":["link.renamed"]}`, nil))
+
+	// секрет подписи отдаётся только при создании
+	var created WebhookItem
+	require.Equal(t, http.StatusCreated, do("alice", http.MethodPost, "/api/webhooks", `{"url":"https://hooks.example.com/","events":["link.created"]}`, &created))
+	assert.NotEmpty(t, created.Secret)
+	assert.Equal(t, []string{"link.created"}, created.Events)
+
+	var list []WebhookItem
+	require.Equal(t, http.StatusOK, do("alice", http.MethodGet, "/api/webhooks", "", &list))
+	require.Len(t, list, 1)
+	assert.Equal(t, created.ID, list[0].ID)
+	assert.Empty(t, list[0].Secret)
+	assert.Equal(t, http.StatusNoContent, do("bob", http.MethodGet, "/api/webhooks", "", nil))
+
+	assert.Equal(t, http.StatusNotFound, do("bob", http.MethodGet, "/api/webhooks/"+created.ID+"/deliveries", "", nil))
+	assert.Equal(t, http.StatusNotFound, do("alice", http.MethodPost, "/api/webhooks/"+created.ID+"/dead/missing", "", nil))
+	assert.Equal(t, http.StatusNotFound, do("bob", http.MethodDelete, "/api/webhooks/"+created.ID, "", nil))
+	assert.Equal(t, http.StatusNoContent, do("alice", http.MethodDelete, "/api/webhooks/"+created.ID, "", nil))
+	assert.Equal(t, http.StatusNotFound, do("alice", http.MethodDelete, "/api/webhooks/"+created.ID, "", nil))
+}
+
+func TestStreamUserURLs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := filestorage.NewTestStorage()
+	svc := service.NewURLService(ctx, "http://localhost:8080", store)
+	h := NewHandler(svc)
+
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), middleware.UserIDKey, r.Header.Get("X-User"))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+	r.Get("/api/user/urls/stream", h.StreamUserURLs)
+	r.Get("/api/user/urls/stream/ws", h.StreamUserURLsWS)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	open := func(user string) *http.Response {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/user/urls/stream", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-User", user)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	res := open("alice")
+	res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+
+	svc.Stream = stream.NewHub(store, 10, 10)
+	svc.Stream.Start(ctx)
+
+	res = open("alice")
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	lines := bufio.NewReader(res.Body)
+	line, err := lines.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "retry: 3000\n", line)
+
+	// события чужих ссылок в поток не попадают
+	_, err = svc.CreateShort(ctx, "bob", "https://b.com/")
+	require.NoError(t, err)
+	short, err := svc.CreateShort(ctx, "alice", "https://a.com/")
+	require.NoError(t, err)
+	id := strings.TrimPrefix(short, "http://localhost:8080/")
+
+	var event string
+	var e webhook.Event
+	for e.ShortURL == "" {
+		line, err = lines.ReadString('\n')
+		require.NoError(t, err)
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			event = strings.TrimSpace(name)
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			require.NoError(t, json.Unmarshal([]byte(data), &e))
+		}
+	}
+	assert.Equal(t, webhook.EventLinkCreated, event)
+	assert.Equal(t, id, e.ShortURL)
+	assert.Equal(t, "alice", e.Owner)
+
+	// по WebSocket подключаются только со своего сайта
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/user/urls/stream/ws"
+	wsCfg, err := websocket.NewConfig(wsURL, "http://evil.example")
+	require.NoError(t, err)
+	wsCfg.Header.Set("X-User", "alice")
+	_, err = websocket.DialConfig(wsCfg)
+	require.Error(t, err)
+
+	wsCfg, err = websocket.NewConfig(wsURL, srv.URL)
+	require.NoError(t, err)
+	wsCfg.Header.Set("X-User", "alice")
+	ws, err := websocket.DialConfig(wsCfg)
+	require.NoError(t, err)
+	defer ws.Close()
+	// подписка оформляется до рукопожатия, поэтому переход уже попадёт в поток
+	require.NoError(t, svc.RegisterClick(ctx, id, ""))
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var clicked webhook.Event
+	require.NoError(t, websocket.JSON.Receive(ws, &clicked))
+	assert.Equal(t, webhook.EventLinkClicked, clicked.Type)
+	assert.Equal(t, id, clicked.ShortURL)
+}
+
+func TestUI(t *testing.T) {
+	store := filestorage.NewTestStorage()
+	svc := service.NewURLService(context.Background(), "http://localhost:8080", store)
+	h := NewHandler(svc)
+	csrf := middleware.NewCSRF(testAuthSecret)
+
+	r := chi.NewRouter()
+	r.Get("/", h.UIRedirect)
+	r.Route("/ui", func(r chi.Router) {
+		r.Use(csrf.WithCSRF)
+		r.Get("/", h.UIHome)
+		r.Post("/shorten", h.UIShorten)
+		r.Post("/links/{id}/delete", h.UIDelete)
+		r.Post("/links/{id}/restore", h.UIRestore)
+		r.Handle("/static/*", UIStatic())
+	})
+
+	do := func(method, target string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "alice"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, "/ui", do(http.MethodGet, "/", nil).Header().Get("Location"))
+	home := do(http.MethodGet, "/ui", nil)
+	require.Equal(t, http.StatusOK, home.Code)
+	assert.Equal(t, "DENY", home.Header().Get("X-Frame-Options"))
+	assert.Contains(t, home.Body.String(), "Ссылок пока нет")
+	match := regexp.MustCompile(`name="csrf_token" value="([^"]+)"`).FindStringSubmatch(home.Body.String())
+	require.Len(t, match, 2)
+	token := match[1]
+
+	// без токена форма не принимается
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/ui/shorten", url.Values{"url": {"https://example.com/a"}}).Code)
+
+	res := do(http.MethodPost, "/ui/shorten", url.Values{"csrf_token": {token}, "url": {"https://example.com/a"}})
+	require.Equal(t, http.StatusSeeOther, res.Code)
+	location := res.Header().Get("Location")
+	require.True(t, strings.HasPrefix(location, "/ui?created="), location)
+	id := strings.TrimPrefix(location, "/ui?created=")
+	page := do(http.MethodGet, location, nil).Body.String()
+	assert.Contains(t, page, "Ссылка создана")
+	assert.Contains(t, page, `data-copy="http://localhost:8080/`+id+`"`)
+	assert.Contains(t, page, `src="/api/user/urls/`+id+`/qr?size=200"`)
+
+	res = do(http.MethodPost, "/ui/shorten", url.Values{"csrf_token": {token}, "url": {"https://example.com/a"}})
+	assert.Equal(t, "/ui?exists="+id, res.Header().Get("Location"))
+	res = do(http.MethodPost, "/ui/shorten", url.Values{"csrf_token": {token}, "url": {"javascript:alert(1)"}})
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Contains(t, res.Body.String(), `class="error"`)
+	assert.Contains(t, res.Body.String(), `value="javascript:alert(1)"`)
+
+	// список разбит на страницы по 20 ссылок, новые сверху
+	for i := range 21 {
+		_, err := svc.CreateShort(context.Background(), "alice", "https://example.com/page/"+strconv.Itoa(i))
+		require.NoError(t, err)
+	}
+	first := do(http.MethodGet, "/ui", nil).Body.String()
+	assert.Equal(t, 20, strings.Count(first, "/delete\""))
+	assert.Contains(t, first, "Страница 1 из 2")
+	second := do(http.MethodGet, "/ui?page=2", nil).Body.String()
+	assert.Equal(t, 2, strings.Count(second, "/delete\""))
+	assert.Contains(t, second, `href="/ui?page=1"`)
+
+	res = do(http.MethodPost, "/ui/links/"+id+"/delete", url.Values{"csrf_token": {token}, "page": {"2"}})
+	require.Equal(t, http.StatusSeeOther, res.Code)
+	location = res.Header().Get("Location")
+	assert.Equal(t, "/ui?deleted="+id+"&page=2", location)
+	page = do(http.MethodGet, location, nil).Body.String()
+	assert.Contains(t, page, `action="/ui/links/`+id+`/restore"`)
+	assert.Equal(t, 1, strings.Count(page, "/delete\""))
+
+	res = do(http.MethodPost, "/ui/links/"+id+"/restore", url.Values{"csrf_token": {token}})
+	require.Equal(t, http.StatusSeeOther, res.Code)
+	assert.Contains(t, do(http.MethodGet, res.Header().Get("Location"), nil).Body.String(), "Ссылка восстановлена")
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/ui/links/missing/restore", url.Values{"csrf_token": {token}}).Code)
+
+	// чужая или несуществующая ссылка не удаляется, вместо сообщения об удалении — ошибка
+	foreign, err := svc.CreateShort(context.Background(), "bob", "https://example.com/bob")
+	require.NoError(t, err)
+	foreignID := strings.TrimPrefix(foreign, "http://localhost:8080/")
+	res = do(http.MethodPost, "/ui/links/"+foreignID+"/delete", url.Values{"csrf_token": {token}})
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	assert.Contains(t, res.Body.String(), "Нет доступа к ссылке")
+	_, err = svc.ResolveLink(context.Background(), foreignID)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/ui/links/missing/delete", url.Values{"csrf_token": {token}}).Code)
+
+	static := do(http.MethodGet, "/ui/static/ui.css", nil)
+	assert.Equal(t, http.StatusOK, static.Code)
+	assert.True(t, strings.HasPrefix(static.Header().Get("Content-Type"), "text/css"))
 }
 
 func TestSetShortURL(t *testing.T) {
@@ -205,3 +1152,215 @@ func generateTestJWT(userID string) string {
 	signed, _ := token.SignedString([]byte(testAuthSecret))
 	return signed
 }
+
+func TestUpdateUserURL(t *testing.T) {
+	store := filestorage.NewTestStorage()
+	ctx := context.Background()
+	svc := service.NewURLService(ctx, "http://localhost:8080", store)
+	h := NewHandler(svc)
+
+	id, err := store.SaveURL(ctx, "owner", storage.NewLink{OriginalURL: "https://example.com/typo"})
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Patch("/api/user/urls/{id}", h.UpdateUserURL)
+	r.Get("/api/user/urls/{id}/history", h.GetUserURLHistory)
+
+	tests := []struct {
+		name       string
+		userID     string
+		body       string
+		statusCode int
+	}{
+		{name: "invalid URL", userID: "owner", body: `{"url":"not a url"}`, statusCode: http.StatusBadRequest},
+		{name: "not owner", userID: "stranger", body: `{"url":"https://example.com/fixed"}`, statusCode: http.StatusForbidden},
+		{name: "owner", userID: "owner", body: `{"url":"https://example.com/fixed"}`, statusCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/api/user/urls/"+id, strings.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, tt.userID))
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			assert.Equal(t, tt.statusCode, rec.Code)
+		})
+	}
+
+	got, ok := store.GetURL(ctx, id)
+	require.True(t, ok)
+	assert.Equal(t, "https://example.com/fixed", got)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls/"+id+"/history", nil)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "owner"))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var history []URLRevisionItem
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &history))
+	require.Len(t, history, 1)
+	assert.Equal(t, "https://example.com/typo", history[0].OriginalURL)
+}
+
+func TestSetShortenBatch(t *testing.T) {
+	body := `[
+		{"correlation_id":"1","original_url":"https://example.com/a"},
+		{"correlation_id":"2","original_url":"not a url"}
+	]`
+
+	tests := []struct {
+		name       string
+		query      string
+		statusCode int
+		statuses   []string
+	}{
+		{
+			name:       "atomic rejects batch",
+			query:      "",
+			statusCode: http.StatusBadRequest,
+			statuses:   []string{service.BatchStatusSkipped, service.BatchStatusInvalid},
+		},
+		{
+			name:       "best effort saves valid items",
+			query:      "?mode=best_effort",
+			statusCode: http.StatusCreated,
+			statuses:   []string{service.BatchStatusCreated, service.BatchStatusInvalid},
+		},
+		{
+			name:       "unknown mode",
+			query:      "?mode=maybe",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := filestorage.NewTestStorage()
+			svc := service.NewURLService(context.Background(), "http://localhost:8080", store)
+			h := NewHandler(svc)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten/batch"+tt.query, strings.NewReader(body))
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "test-user-id"))
+			rec := httptest.NewRecorder()
+			h.SetShortenBatch(rec, req)
+
+			assert.Equal(t, tt.statusCode, rec.Code)
+			if tt.statuses == nil {
+				return
+			}
+
+			var results []service.ShortenBatchResult
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+			require.Len(t, results, len(tt.statuses))
+			for i, status := range tt.statuses {
+				assert.Equal(t, status, results[i].Status)
+				assert.Equal(t, status == service.BatchStatusCreated, results[i].ShortURL != "")
+			}
+		})
+	}
+}
+
+// TestSetShortenBulk_Server проверяет импорт через настоящий сервер: итоги первых порций отправляются,
+// пока тело ещё читается, и это не должно обрывать чтение.
+func TestSetShortenBulk_Server(t *testing.T) {
+	store := filestorage.NewTestStorage()
+	svc := service.NewURLService(context.Background(), "http://localhost:8080", store)
+	h := NewHandler(svc)
+	compressor := middleware.NewCompressor(1024, []string{"application/x-ndjson"})
+	srv := httptest.NewServer(compressor.WithCompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), middleware.UserIDKey, "test-user-id"))
+		h.SetShortenBulk(w, r)
+	})))
+	defer srv.Close()
+
+	const total = 5 * bulkChunkSize
+	var body strings.Builder
+	for i := range total {
+		fmt.Fprintf(&body, "{\"correlation_id\":\"%d\",\"original_url\":\"https://example.com/%d\"}\n", i, i)
+	}
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/shorten/bulk", strings.NewReader(body.String()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	dec := json.NewDecoder(res.Body)
+	created := 0
+	for dec.More() {
+		var item BulkResultItem
+		require.NoError(t, dec.Decode(&item))
+		require.Equal(t, service.BatchStatusCreated, item.Status, "line %d: %s", item.Line, item.Error)
+		created++
+	}
+	assert.Equal(t, total, created)
+}
+
+func TestSetShortenBulk(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		statusCode  int
+		statuses    []string
+	}{
+		{
+			name:        "ndjson",
+			contentType: "application/x-ndjson",
+			body:        "{\"correlation_id\":\"1\",\"original_url\":\"https://example.com/a\"}\n\n{broken\n{\"correlation_id\":\"3\",\"original_url\":\"https://example.com/a\"}\n",
+			statusCode:  http.StatusOK,
+			statuses:    []string{service.BatchStatusCreated, service.BatchStatusInvalid, service.BatchStatusExisting},
+		},
+		{
+			name:        "ndjson with overlong line",
+			contentType: "application/x-ndjson",
+			body: "{\"correlation_id\":\"1\",\"original_url\":\"https://example.com/long?q=" + strings.Repeat("a", bulkMaxLineSize) + "\"}\n" +
+				"{\"correlation_id\":\"2\",\"original_url\":\"https://example.com/after\"}",
+			statusCode: http.StatusOK,
+			statuses:   []string{service.BatchStatusInvalid, service.BatchStatusCreated},
+		},
+		{
+			name:        "csv with header",
+			contentType: "text/csv",
+			body:        "correlation_id,original_url\n1,https://example.com/b\n2,not a url\n",
+			statusCode:  http.StatusOK,
+			statuses:    []string{service.BatchStatusCreated, service.BatchStatusInvalid},
+		},
+		{
+			name:        "unsupported content type",
+			contentType: "application/json",
+			body:        "[]",
+			statusCode:  http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := filestorage.NewTestStorage()
+			svc := service.NewURLService(context.Background(), "http://localhost:8080", store)
+			h := NewHandler(svc)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten/bulk", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "test-user-id"))
+			rec := httptest.NewRecorder()
+			h.SetShortenBulk(rec, req)
+
+			require.Equal(t, tt.statusCode, rec.Code)
+			if tt.statuses == nil {
+				return
+			}
+
+			dec := json.NewDecoder(rec.Body)
+			var got []string
+			for dec.More() {
+				var item BulkResultItem
+				require.NoError(t, dec.Decode(&item))
+				got = append(got, item.Status)
+			}
+			assert.Equal(t, tt.statuses, got)
+		})
+	}
+}
@@ -36,18 +36,26 @@ func (h *Handler) MainPage(w http.ResponseWriter, r *http.Request) {
 		originalURL = string(b)
 	}
 
-	if originalURL == "" || !isValidURL(originalURL) {
-		http.Error(w, "Некорректный URL", http.StatusBadRequest)
-		return
-	}
-
 	userID, ok := middleware.GetUserID(r.Context())
 	if !ok {
 		http.Error(w, "Ошибка определения userID из кук", http.StatusBadRequest)
 		return
 	}
+	owner, ok := h.createOwner(w, r, userID, "")
+	if !ok {
+		return
+	}
 
-	shortURL, err := h.Service.CreateShort(r.Context(), userID, originalURL)
+	shortURL, err := h.Service.CreateShort(r.Context(), owner, originalURL)
+	if errors.Is(err, service.ErrInvalidURL) {
+		reason, message := service.PolicyReason(err)
+		http.Error(w, reason+": "+message, http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, service.ErrAlreadyExists) && shortURL == "" {
+		http.Error(w, "URL уже сокращён другим пользователем", http.StatusConflict)
+		return
+	}
 	if errors.Is(err, service.ErrAlreadyExists) {
 		w.Header().Set("Content-Type", "text/plain")
 		w.WriteHeader(http.StatusConflict) // 409
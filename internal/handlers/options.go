@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/divanov-web/shorturl/internal/middleware"
+	"github.com/divanov-web/shorturl/internal/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+// SetUserURLOptions хендлер PUT /api/user/urls/{id}/options. Меняет настройки ссылки владельца.
+func (h *Handler) SetUserURLOptions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var data LinkOptionsItem
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "Невозможно прочитать JSON", http.StatusBadRequest)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	opts := storage.LinkOptions{
+		Interstitial: data.Interstitial,
+		RedirectCode: data.RedirectCode,
+		Rules:        data.Rules,
+		Variants:     data.Variants,
+	}
+	err := h.Service.SetLinkOptions(r.Context(), userID, id, opts)
+	if err == nil && data.Password != nil {
+		err = h.Service.SetLinkPassword(r.Context(), userID, id, *data.Password)
+	}
+	if !writeServiceError(w, err) {
+		return
+	}
+
+	link, err := h.Service.ResolveLink(r.Context(), id)
+	if !writeServiceError(w, err) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(LinkOptionsItem{
+		Interstitial: link.Options.Interstitial,
+		RedirectCode: link.Options.RedirectCode,
+		Protected:    link.Options.PasswordHash != "",
+		Rules:        link.Options.Rules,
+		Variants:     link.Options.Variants,
+	})
+}
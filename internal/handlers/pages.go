@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+
+	"github.com/divanov-web/shorturl/internal/storage"
+)
+
+// warningTemplate страница-предупреждение для ссылок, найденных в списках угроз.
+var warningTemplate = template.Must(template.New("warning").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Небезопасная ссылка</title>
+</head>
+<body>
+<h1>Ссылка может быть опасной</h1>
+<p>Адрес назначения найден в списке угроз ({{.Threat}}). Переход по нему может навредить вашему устройству или данным.</p>
+<p><code>{{.OriginalURL}}</code></p>
+<p><a href="{{.OriginalURL}}" rel="noopener noreferrer nofollow">Всё равно перейти</a></p>
+</body>
+</html>
+`))
+
+// previewTemplate страница предпросмотра короткой ссылки.
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Предпросмотр {{.ShortURL}}</title>
+</head>
+<body>
+<h1>Куда ведёт ссылка</h1>
+{{if .Threat}}<p><strong>Внимание: адрес найден в списке угроз ({{.Threat}}).</strong></p>
+{{end}}<dl>
+<dt>Короткая ссылка</dt><dd><code>{{.ShortURL}}</code></dd>
+<dt>Адрес назначения</dt><dd><code>{{.OriginalURL}}</code></dd>
+{{if .CreatedAt}}<dt>Создана</dt><dd>{{.CreatedAt}}</dd>
+{{end}}<dt>Переходов</dt><dd>{{.Clicks}}</dd>
+</dl>
+<p><a href="{{.OriginalURL}}" rel="noopener noreferrer nofollow">Перейти</a></p>
+</body>
+</html>
+`))
+
+// interstitialTemplate страница «вы покидаете сайт», которую владелец ссылки включил в её настройках.
+var interstitialTemplate = template.Must(template.New("interstitial").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Вы покидаете сайт</title>
+</head>
+<body>
+<h1>Вы покидаете сайт</h1>
+<p>Ссылка ведёт на внешний адрес:</p>
+<p><code>{{.OriginalURL}}</code></p>
+<p><a href="{{.OriginalURL}}" rel="noopener noreferrer nofollow">Продолжить</a></p>
+</body>
+</html>
+`))
+
+// passwordTemplate форма ввода пароля защищённой ссылки.
+var passwordTemplate = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Ссылка защищена паролем</title>
+</head>
+<body>
+<h1>Ссылка защищена паролем</h1>
+{{if .Error}}<p><strong>{{.Error}}</strong></p>
+{{end}}<form method="post" action="{{.Action}}">
+<input type="password" name="password" autocomplete="current-password" required autofocus>
+<button type="submit">Открыть</button>
+</form>
+</body>
+</html>
+`))
+
+// renderPasswordForm отвечает формой пароля, которая отправляется на тот же адрес.
+func renderPasswordForm(w http.ResponseWriter, action string, status int, errMsg string) {
+	renderPage(w, passwordTemplate, status, struct {
+		Action string
+		Error  string
+	}{action, errMsg})
+}
+
+// previewData данные страницы предпросмотра.
+type previewData struct {
+	ShortURL    string
+	OriginalURL string
+	CreatedAt   string
+	Clicks      int64
+	Threat      string
+}
+
+// renderPreview отвечает страницей предпросмотра ссылки.
+func renderPreview(w http.ResponseWriter, baseURL string, link storage.UserURL) {
+	data := previewData{
+		ShortURL:    baseURL + "/" + link.ShortURL,
+		OriginalURL: link.OriginalURL,
+		Clicks:      link.Clicks,
+		Threat:      link.Threat,
+	}
+	if !link.CreatedAt.IsZero() {
+		data.CreatedAt = link.CreatedAt.UTC().Format("02.01.2006 15:04 MST")
+	}
+	renderPage(w, previewTemplate, http.StatusOK, data)
+}
+
+// renderInterstitial отвечает страницей «вы покидаете сайт» вместо редиректа.
+func renderInterstitial(w http.ResponseWriter, link storage.UserURL) {
+	renderPage(w, interstitialTemplate, http.StatusOK, link)
+}
+
+// renderWarning отвечает страницей-предупреждением вместо редиректа.
+func renderWarning(w http.ResponseWriter, link storage.UserURL) {
+	renderPage(w, warningTemplate, http.StatusOK, link)
+}
+
+// renderPage отрисовывает шаблон в буфер, чтобы при ошибке не отдать клиенту половину страницы.
+func renderPage(w http.ResponseWriter, tmpl *template.Template, status int, data any) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/divanov-web/shorturl/internal/service"
+	"github.com/divanov-web/shorturl/internal/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+// LinkPasswordHeader заголовок с паролем ссылки для API-клиентов.
+const LinkPasswordHeader = "X-Link-Password"
+
+// linkAccessCookie имя cookie с токеном доступа к защищённой ссылке.
+func linkAccessCookie(id string) string {
+	return "link_access_" + id
+}
+
+// unlocked проверяет доступ к защищённой ссылке по cookie или заголовку X-Link-Password.
+// Если доступа нет, сам отвечает формой пароля, 403 или 429 и возвращает false.
+func (h *Handler) unlocked(w http.ResponseWriter, r *http.Request, link storage.UserURL) bool {
+	guard := h.Service.Passwords
+	if cookie, err := r.Cookie(linkAccessCookie(link.ShortURL)); err == nil &&
+		guard.ValidToken(link.ShortURL, link.Options.PasswordHash, cookie.Value) {
+		return true
+	}
+
+	password, ok := r.Header[http.CanonicalHeaderKey(LinkPasswordHeader)]
+	if !ok {
+		renderPasswordForm(w, r.URL.RequestURI(), http.StatusForbidden, "")
+		return false
+	}
+	wait, err := guard.Verify(link.ShortURL, passwordClient(r), link.Options.PasswordHash, strings.Join(password, ""))
+	switch {
+	case errors.Is(err, service.ErrLinkLocked):
+		writeLocked(w, wait)
+		return false
+	case err != nil:
+		http.Error(w, "Неверный пароль", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// UnlockURL хэндлер POST /{id} — отправка формы пароля защищённой ссылки.
+// При верном пароле ставит cookie доступа и перенаправляет на исходный адрес запроса.
+func (h *Handler) UnlockURL(w http.ResponseWriter, r *http.Request) {
+	id, _ := strings.CutSuffix(chi.URLParam(r, "id"), "+")
+	link, err := h.Service.ResolveLinkOnHost(r.Context(), id, r.Host)
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case errors.Is(err, service.ErrGone):
+		w.WriteHeader(http.StatusGone)
+		return
+	case err != nil:
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if link.Options.PasswordHash == "" {
+		http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+		return
+	}
+
+	if err = r.ParseForm(); err != nil {
+		http.Error(w, "Ошибка парсинга формы", http.StatusBadRequest)
+		return
+	}
+	wait, err := h.Service.Passwords.Verify(id, passwordClient(r), link.Options.PasswordHash, r.PostFormValue("password"))
+	switch {
+	case errors.Is(err, service.ErrLinkLocked):
+		writeLocked(w, wait)
+		return
+	case err != nil:
+		renderPasswordForm(w, r.URL.RequestURI(), http.StatusForbidden, "Неверный пароль")
+		return
+	}
+
+	token, expires := h.Service.Passwords.IssueToken(id, link.Options.PasswordHash)
+	http.SetCookie(w, &http.Cookie{
+		Name:     linkAccessCookie(id),
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+}
+
+// passwordClient клиент, для которого считаются попытки ввода пароля, — IP без порта.
+func passwordClient(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// writeLocked отвечает 429 с Retry-After, пока ввод пароля ссылки заблокирован.
+func writeLocked(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Слишком много неверных попыток, попробуйте позже", http.StatusTooManyRequests)
+}
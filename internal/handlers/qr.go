@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/divanov-web/shorturl/internal/middleware"
+	"github.com/divanov-web/shorturl/internal/qrcode"
+	"github.com/go-chi/chi/v5"
+)
+
+// GetUserURLQR хендлер GET /api/user/urls/{id}/qr. Возвращает QR-код короткой ссылки владельца.
+// Параметры: format (png, svg), size (пиксели), margin (модули), level (L, M, Q, H), fg и bg (RRGGBB).
+func (h *Handler) GetUserURLQR(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	opts, err := parseQROptions(query)
+	if err != nil {
+		http.Error(w, "Недопустимые параметры QR-кода", http.StatusBadRequest)
+		return
+	}
+
+	link, err := h.Service.GetUserLink(r.Context(), userID, chi.URLParam(r, "id"))
+	if !writeServiceError(w, err) {
+		return
+	}
+
+	shortURL := h.Service.ShortURL(link)
+	var (
+		image       []byte
+		contentType string
+	)
+	switch query.Get("format") {
+	case "", "png":
+		image, err = qrcode.PNG(shortURL, opts)
+		contentType = "image/png"
+	case "svg":
+		image, err = qrcode.SVG(shortURL, opts)
+		contentType = "image/svg+xml"
+	default:
+		http.Error(w, "Неизвестный формат QR-кода", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Ошибка построения QR-кода", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.WriteHeader(http.StatusOK)
+	w.Write(image)
+}
+
+// parseQROptions разбирает параметры QR-кода из запроса, отсутствующие берутся по умолчанию.
+func parseQROptions(query url.Values) (qrcode.Options, error) {
+	opts := qrcode.DefaultOptions()
+	var err error
+	if v := query.Get("size"); v != "" {
+		if opts.Size, err = strconv.Atoi(v); err != nil {
+			return opts, qrcode.ErrInvalidOptions
+		}
+	}
+	if v := query.Get("margin"); v != "" {
+		if opts.Margin, err = strconv.Atoi(v); err != nil {
+			return opts, qrcode.ErrInvalidOptions
+		}
+	}
+	if v := query.Get("level"); v != "" {
+		if opts.Level, err = qrcode.ParseLevel(v); err != nil {
+			return opts, err
+		}
+	}
+	if v := query.Get("fg"); v != "" {
+		if opts.Foreground, err = qrcode.ParseColor(v); err != nil {
+			return opts, err
+		}
+	}
+	if v := query.Get("bg"); v != "" {
+		if opts.Background, err = qrcode.ParseColor(v); err != nil {
+			return opts, err
+		}
+	}
+	return opts, opts.Validate()
+}
+
+// qrDataURI возвращает QR-код короткой ссылки с параметрами по умолчанию в виде data URI PNG.
+func qrDataURI(shortURL string) string {
+	image, err := qrcode.PNG(shortURL, qrcode.DefaultOptions())
+	if err != nil {
+		return ""
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(image)
+}
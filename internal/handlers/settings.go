@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/divanov-web/shorturl/internal/middleware"
+)
+
+// GetUserSettings хендлер GET /api/user/settings. Возвращает настройки пользователя и доступные короткие домены.
+func (h *Handler) GetUserSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.writeUserSettings(w, r, userID)
+}
+
+// SetUserSettings хендлер PUT /api/user/settings. Меняет короткий домен новых ссылок пользователя.
+// json: {"default_domain": "..."}, пустая строка — домен по умолчанию сервиса.
+func (h *Handler) SetUserSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var data UserSettingsItem
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "Невозможно прочитать JSON", http.StatusBadRequest)
+		return
+	}
+	if !writeServiceError(w, h.Service.SetUserDefaultDomain(r.Context(), userID, data.DefaultDomain)) {
+		return
+	}
+	h.writeUserSettings(w, r, userID)
+}
+
+// writeUserSettings отвечает настройками пользователя.
+func (h *Handler) writeUserSettings(w http.ResponseWriter, r *http.Request, userID string) {
+	settings, err := h.Service.GetUserSettings(r.Context(), userID)
+	if !writeServiceError(w, err) {
+		return
+	}
+	domains := h.Service.AvailableDomains()
+	defaultDomain := settings.DefaultDomain
+	if defaultDomain == "" {
+		defaultDomain = domains[0]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(UserSettingsItem{
+		DefaultDomain: defaultDomain,
+		Domains:       domains,
+	})
+}
@@ -3,11 +3,14 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/divanov-web/shorturl/internal/middleware"
 	"github.com/divanov-web/shorturl/internal/service"
+	"github.com/divanov-web/shorturl/internal/storage"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -23,20 +26,45 @@ func (h *Handler) SetShortURL(w http.ResponseWriter, r *http.Request) {
 	}
 
 	originalURL := strings.TrimSpace(data.URL)
-	if originalURL == "" || !isValidURL(originalURL) {
-		http.Error(w, "Некорректный URL", http.StatusBadRequest)
-		return
-	}
 
 	userID, ok := middleware.GetUserID(r.Context())
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	owner, ok := h.createOwner(w, r, userID, data.Workspace)
+	if !ok {
+		return
+	}
 
-	shortURL, err := h.Service.CreateShort(r.Context(), userID, originalURL)
+	shortURL, err := h.Service.CreateShortWithParams(r.Context(), owner, originalURL, service.CreateParams{
+		Password:  data.Password,
+		MaxClicks: data.MaxClicks,
+		Domain:    data.Domain,
+		Meta: storage.LinkMeta{
+			Tags:   data.Tags,
+			Folder: data.Folder,
+			Title:  data.Title,
+			Note:   data.Note,
+		},
+	})
+	if errors.Is(err, service.ErrInvalidURL) {
+		writeURLError(w, err)
+		return
+	}
+	if errors.Is(err, service.ErrInvalidOptions) {
+		http.Error(w, "Недопустимые параметры ссылки", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, service.ErrAlreadyExists) && shortURL == "" {
+		http.Error(w, "URL уже сокращён другим пользователем", http.StatusConflict)
+		return
+	}
 	if errors.Is(err, service.ErrAlreadyExists) {
 		result := DataResponse{Result: shortURL}
+		if data.QR {
+			result.QR = qrDataURI(shortURL)
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusConflict) // 409
 		_ = json.NewEncoder(w).Encode(result)
@@ -47,6 +75,9 @@ func (h *Handler) SetShortURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	result := DataResponse{Result: shortURL}
+	if data.QR {
+		result.QR = qrDataURI(shortURL)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -56,18 +87,95 @@ func (h *Handler) SetShortURL(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// GetRealURL хэндлер Get запрос на получение ссылки из хеша
+// GetRealURL хэндлер Get и Head запрос на получение ссылки из хеша
+// /{id}+ или ?preview=1 показывают страницу предпросмотра вместо редиректа.
+// Для несуществующей ссылки отвечает 404, для удалённой и исчерпавшей лимит переходов — 410.
+// HEAD не считается переходом.
 func (h *Handler) GetRealURL(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	realURL, ok := h.Service.ResolveShort(r.Context(), id)
-	if !ok {
+	preview := r.URL.Query().Get("preview") == "1"
+	if trimmed, ok := strings.CutSuffix(id, "+"); ok {
+		id, preview = trimmed, true
+	}
+
+	link, err := h.Service.ResolveLinkOnHost(r.Context(), id, r.Host)
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case errors.Is(err, service.ErrGone):
 		w.WriteHeader(http.StatusGone)
 		return
+	case err != nil:
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if link.Options.PasswordHash != "" && !h.unlocked(w, r, link) {
+		return
+	}
+
+	click := r.Method != http.MethodHead
+	switch {
+	case preview:
+		renderPreview(w, h.Service.LinkBaseURL(link.Domain), link)
+	case link.Threat != "":
+		// вместо редиректа показываем предупреждение об опасной ссылке
+		renderWarning(w, link)
+	default:
+		target := h.Service.RedirectTarget(link, requestInfo(r, id))
+		if target.Variant != "" {
+			setVariantCookie(w, id, target.Variant)
+		}
+		// переход списывается до ответа, чтобы лимит не превысили параллельные запросы
+		if click && !h.registerClick(w, r, id, target.Variant) {
+			return
+		}
+		link.OriginalURL = target.URL
+		if link.Options.Interstitial {
+			renderInterstitial(w, link)
+			return
+		}
+		h.redirect(w, r, link)
+	}
+}
+
+// registerClick учитывает переход. Возвращает false, если ссылка исчерпала лимит и ответ уже отправлен.
+// Прочие ошибки учёта не мешают переходу.
+func (h *Handler) registerClick(w http.ResponseWriter, r *http.Request, id string, variant string) bool {
+	if err := h.Service.RegisterClick(r.Context(), id, variant); errors.Is(err, service.ErrGone) {
+		w.WriteHeader(http.StatusGone)
+		return false
+	}
+	return true
+}
+
+// redirect отправляет редирект с кодом ссылки. Постоянные редиректы разрешено кешировать
+// RedirectCacheTTL, временные — нет, чтобы учитывались переходы и изменения ссылки.
+// Редиректы ссылок с лимитом переходов не кешируются совсем, а с правилами таргетинга и A/B-тестом —
+// только в браузере с повторной проверкой, так как адрес зависит от запроса.
+func (h *Handler) redirect(w http.ResponseWriter, r *http.Request, link storage.UserURL) {
+	code := h.Service.RedirectStatus(link)
+	switch {
+	case link.MaxClicks > 0:
+		w.Header().Set("Cache-Control", "no-store")
+	case len(link.Options.Rules) > 0, len(link.Options.Variants) > 0:
+		w.Header().Set("Cache-Control", "private, no-cache")
+		w.Header().Set("Vary", "User-Agent, Accept-Language, Cookie")
+	case code == http.StatusMovedPermanently, code == http.StatusPermanentRedirect:
+		ttl := h.Service.RedirectCacheTTL
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(ttl.Seconds())))
+		w.Header().Set("Expires", time.Now().Add(ttl).UTC().Format(http.TimeFormat))
+	default:
+		w.Header().Set("Cache-Control", "private, no-cache")
 	}
-	http.Redirect(w, r, realURL, http.StatusTemporaryRedirect)
+	http.Redirect(w, r, link.OriginalURL, code)
 }
 
 // SetShortenBatch обрабатывает POST /api/shorten/batch
+// Параметр mode=atomic (по умолчанию) сохраняет батч целиком или отклоняет его,
+// mode=best_effort сохраняет все корректные элементы. В ответе итог по каждому correlation_id.
+// Параметр workspace сохраняет ссылки в рабочее пространство, для этого нужна роль не ниже editor.
 func (h *Handler) SetShortenBatch(w http.ResponseWriter, r *http.Request) {
 	var batch []service.BatchRequestItem
 
@@ -81,12 +189,14 @@ func (h *Handler) SetShortenBatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Валидация URL
-	for _, item := range batch {
-		if !isValidURL(item.OriginalURL) {
-			http.Error(w, "Некорректный URL", http.StatusBadRequest)
-			return
-		}
+	mode := service.BatchMode(r.URL.Query().Get("mode"))
+	switch mode {
+	case "":
+		mode = service.BatchAtomic
+	case service.BatchAtomic, service.BatchBestEffort:
+	default:
+		http.Error(w, "Неизвестный режим батча", http.StatusBadRequest)
+		return
 	}
 
 	userID, ok := middleware.GetUserID(r.Context())
@@ -94,22 +204,47 @@ func (h *Handler) SetShortenBatch(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	owner, ok := h.createOwner(w, r, userID, r.URL.Query().Get("workspace"))
+	if !ok {
+		return
+	}
 
-	results, err := h.Service.CreateShortBatch(r.Context(), userID, batch)
-	if err != nil {
+	results, err := h.Service.CreateShortBatch(r.Context(), owner, batch, mode)
+	if err != nil && !errors.Is(err, service.ErrBatchRejected) {
 		http.Error(w, "Ошибка при сохранении ссылок", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(batchStatusCode(results, err))
 
 	if err := json.NewEncoder(w).Encode(results); err != nil {
 		http.Error(w, "Ошибка сериализации ответа", http.StatusInternalServerError)
 	}
 }
 
-// GetUserURLs хэндлер Get запрос на получение списка url текущего юзера
+// batchStatusCode подбирает код ответа батча: 201, если хоть одна ссылка получена,
+// 400 при некорректных элементах и 409 при конфликтах.
+func batchStatusCode(results []service.ShortenBatchResult, err error) int {
+	invalid := false
+	for _, res := range results {
+		switch res.Status {
+		case service.BatchStatusCreated, service.BatchStatusExisting:
+			if err == nil {
+				return http.StatusCreated
+			}
+		case service.BatchStatusInvalid:
+			invalid = true
+		}
+	}
+	if invalid {
+		return http.StatusBadRequest
+	}
+	return http.StatusConflict
+}
+
+// GetUserURLs хэндлер Get запрос на получение списка url текущего юзера.
+// С параметром workspace возвращает ссылки рабочего пространства, в котором состоит пользователь.
 func (h *Handler) GetUserURLs(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserID(r.Context())
 	if !ok || userID == "" {
@@ -117,7 +252,16 @@ func (h *Handler) GetUserURLs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	urls, err := h.Service.GetUserURLs(r.Context(), userID)
+	owner, ok := h.linkOwner(w, r, userID, r.URL.Query().Get("workspace"), storage.RoleViewer)
+	if !ok {
+		return
+	}
+
+	filter := service.URLFilter{
+		Tag:    r.URL.Query().Get("tag"),
+		Folder: r.URL.Query().Get("folder"),
+	}
+	urls, err := h.Service.GetUserURLs(r.Context(), owner, filter)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -130,10 +274,7 @@ func (h *Handler) GetUserURLs(w http.ResponseWriter, r *http.Request) {
 
 	response := make([]UserURLItem, 0, len(urls))
 	for _, item := range urls {
-		response = append(response, UserURLItem{
-			ShortURL:    h.Service.BaseURL + "/" + item.ShortURL,
-			OriginalURL: item.OriginalURL,
-		})
+		response = append(response, h.userURLItem(item))
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -142,6 +283,7 @@ func (h *Handler) GetUserURLs(w http.ResponseWriter, r *http.Request) {
 }
 
 // DeleteUserURL хендлер удаления url пользователя. json: ["6qxTVvsy", "RTfd56hn", "Jlfd67ds"]
+// С параметром workspace удаляет ссылки рабочего пространства, для этого нужна роль не ниже editor.
 func (h *Handler) DeleteUserURL(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserID(r.Context())
 	if !ok || userID == "" {
@@ -159,9 +301,167 @@ func (h *Handler) DeleteUserURL(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Список идентификаторов пуст", http.StatusBadRequest)
 		return
 	}
+	owner, ok := h.linkOwner(w, r, userID, r.URL.Query().Get("workspace"), storage.RoleEditor)
+	if !ok {
+		return
+	}
 
 	// Отправляем задачу на асинхронное удаление
-	h.Service.DeleteShortURLsAsync(userID, ids)
+	h.Service.DeleteShortURLsAsync(r.Context(), owner, ids)
 
 	w.WriteHeader(http.StatusAccepted) // 202 — принято к выполнению
 }
+
+// RestoreUserURL хендлер POST /api/user/urls/{id}/restore. Восстанавливает удалённую ссылку пользователя
+// и возвращает её. С параметром workspace восстанавливает ссылку рабочего пространства, нужна роль не ниже editor.
+// Если тот же URL уже сокращён заново, отвечает 409.
+func (h *Handler) RestoreUserURL(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	owner, ok := h.linkOwner(w, r, userID, r.URL.Query().Get("workspace"), storage.RoleEditor)
+	if !ok {
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if !writeServiceError(w, h.Service.RestoreUserURL(r.Context(), owner, id)) {
+		return
+	}
+	link, err := h.Service.GetUserLink(r.Context(), userID, id)
+	if !writeServiceError(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.userURLItem(link))
+}
+
+// userURLItem переводит ссылку в элемент ответа списка ссылок пользователя.
+func (h *Handler) userURLItem(link storage.UserURL) UserURLItem {
+	item := UserURLItem{
+		ShortURL:    h.Service.ShortURL(link),
+		OriginalURL: link.OriginalURL,
+		Threat:      link.Threat,
+		Disabled:    link.Disabled,
+		Tags:        link.Tags,
+		Folder:      link.Folder,
+		Title:       link.Title,
+		Note:        link.Note,
+	}
+	if link.MaxClicks > 0 {
+		left := link.ClicksLeft
+		item.ClicksLeft = &left
+	}
+	return item
+}
+
+// UpdateUserURL хендлер PATCH /api/user/urls/{id}. Меняет оригинальный URL, теги, папку, заголовок
+// и заметку ссылки владельца. json: {"url": "...", "tags": ["..."], "folder": "...", "title": "...", "note": "..."}
+func (h *Handler) UpdateUserURL(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var data UpdateURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "Невозможно прочитать JSON", http.StatusBadRequest)
+		return
+	}
+
+	originalURL := strings.TrimSpace(data.URL)
+	id := chi.URLParam(r, "id")
+	metaChanged := data.Tags != nil || data.Folder != nil || data.Title != nil || data.Note != nil
+	if originalURL != "" || !metaChanged {
+		err := h.Service.UpdateShort(r.Context(), userID, id, originalURL)
+		if !writeServiceError(w, err) {
+			return
+		}
+	}
+
+	link, err := h.Service.GetUserLink(r.Context(), userID, id)
+	if !writeServiceError(w, err) {
+		return
+	}
+	if metaChanged {
+		meta := link.LinkMeta
+		if data.Tags != nil {
+			meta.Tags = *data.Tags
+		}
+		if data.Folder != nil {
+			meta.Folder = *data.Folder
+		}
+		if data.Title != nil {
+			meta.Title = *data.Title
+		}
+		if data.Note != nil {
+			meta.Note = *data.Note
+		}
+		if !writeServiceError(w, h.Service.SetLinkMeta(r.Context(), userID, id, meta)) {
+			return
+		}
+		if link, err = h.Service.GetUserLink(r.Context(), userID, id); !writeServiceError(w, err) {
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.userURLItem(link))
+}
+
+// GetUserURLHistory хендлер GET /api/user/urls/{id}/history. Возвращает прежние значения оригинального URL.
+func (h *Handler) GetUserURLHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	history, err := h.Service.GetShortHistory(r.Context(), userID, chi.URLParam(r, "id"))
+	if !writeServiceError(w, err) {
+		return
+	}
+
+	response := make([]URLRevisionItem, 0, len(history))
+	for _, rev := range history {
+		response = append(response, URLRevisionItem{
+			OriginalURL: rev.OriginalURL,
+			ChangedAt:   rev.ChangedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeServiceError отвечает клиенту по ошибке сервиса. Возвращает true, если ошибки не было.
+func writeServiceError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, service.ErrInvalidURL):
+		writeURLError(w, err)
+	case errors.Is(err, service.ErrNotFound):
+		http.Error(w, "Ссылка не найдена", http.StatusNotFound)
+	case errors.Is(err, service.ErrGone):
+		http.Error(w, "Ссылка удалена", http.StatusGone)
+	case errors.Is(err, service.ErrUserBlocked):
+		http.Error(w, "Пользователь заблокирован", http.StatusForbidden)
+	case errors.Is(err, service.ErrForbidden):
+		http.Error(w, "Нет доступа к ссылке", http.StatusForbidden)
+	case errors.Is(err, service.ErrAlreadyExists):
+		http.Error(w, "URL уже сокращён", http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidOptions):
+		http.Error(w, "Недопустимые настройки ссылки", http.StatusBadRequest)
+	default:
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/divanov-web/shorturl/internal/middleware"
+	"github.com/divanov-web/shorturl/internal/service"
+	"github.com/divanov-web/shorturl/internal/storage"
+	"github.com/divanov-web/shorturl/internal/stream"
+)
+
+// streamKeepAlive как часто в пустой поток отправляется комментарий, чтобы прокси не закрывали соединение.
+const streamKeepAlive = 15 * time.Second
+
+// streamWriteTimeout сколько ждать отправки сообщения в WebSocket, прежде чем отключить клиента.
+const streamWriteTimeout = 10 * time.Second
+
+// streamEventDropped тип сообщения о событиях, потерянных из-за медленного клиента.
+const streamEventDropped = "dropped"
+
+// StreamUserURLs хендлер GET /api/user/urls/stream. Отправляет события ссылок пользователя
+// (link.created, link.deleted, link.clicked) в формате Server-Sent Events, с параметром workspace —
+// ссылок рабочего пространства. Если клиент не успевает читать, часть событий пропускается,
+// и перед следующим событием приходит событие dropped с их числом.
+func (h *Handler) StreamUserURLs(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.subscribeLinkEvents(w, r)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	// поток живёт дольше обычного ответа, общий таймаут записи сервера к нему не относится
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if n := sub.Dropped(); n > 0 {
+				writeSSE(w, "", streamEventDropped, StreamDroppedItem{Type: streamEventDropped, Count: n})
+			} else {
+				fmt.Fprint(w, ": ping\n\n")
+			}
+		case e, open := <-sub.Events():
+			if !open {
+				return
+			}
+			if n := sub.Dropped(); n > 0 {
+				writeSSE(w, "", streamEventDropped, StreamDroppedItem{Type: streamEventDropped, Count: n})
+			}
+			writeSSE(w, e.ID, e.Type, e)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// StreamUserURLsWS хендлер GET /api/user/urls/stream/ws. Те же события, что у StreamUserURLs,
+// но по WebSocket: каждое сообщение — JSON события, потерянные события — сообщение {"type":"dropped"}.
+// Подключения со страниц чужих сайтов отклоняются, иначе они получили бы события по cookie пользователя.
+func (h *Handler) StreamUserURLsWS(w http.ResponseWriter, r *http.Request) {
+	if !middleware.SameOrigin(r) {
+		http.Error(w, "Недопустимый Origin", http.StatusForbidden)
+		return
+	}
+	sub, ok := h.subscribeLinkEvents(w, r)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	srv := websocket.Server{
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			// входящие сообщения не нужны, чтение только замечает отключение клиента
+			closed := make(chan struct{})
+			go func() {
+				io.Copy(io.Discard, ws)
+				close(closed)
+			}()
+			send := func(v any) bool {
+				ws.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+				return websocket.JSON.Send(ws, v) == nil
+			}
+			for {
+				select {
+				case <-closed:
+					return
+				case <-r.Context().Done():
+					return
+				case e, open := <-sub.Events():
+					if !open {
+						return
+					}
+					if n := sub.Dropped(); n > 0 && !send(StreamDroppedItem{Type: streamEventDropped, Count: n}) {
+						return
+					}
+					if !send(e) {
+						return
+					}
+				}
+			}
+		},
+	}
+	srv.ServeHTTP(w, r)
+}
+
+// subscribeLinkEvents подписывает на события ссылок владельца запроса (нужна роль не ниже viewer).
+// Возвращает false, если ответ уже отправлен.
+func (h *Handler) subscribeLinkEvents(w http.ResponseWriter, r *http.Request) (*stream.Subscription, bool) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	owner, ok := h.linkOwner(w, r, userID, r.URL.Query().Get("workspace"), storage.RoleViewer)
+	if !ok {
+		return nil, false
+	}
+	sub, err := h.Service.SubscribeLinkEvents(owner)
+	if errors.Is(err, service.ErrStreamDisabled) {
+		http.Error(w, "Поток событий отключён", http.StatusServiceUnavailable)
+		return nil, false
+	}
+	return sub, true
+}
+
+// writeSSE пишет одно событие Server-Sent Events с данными в JSON.
+func writeSSE(w io.Writer, id string, event string, data any) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, body)
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"embed"
+	"errors"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/divanov-web/shorturl/internal/middleware"
+	"github.com/divanov-web/shorturl/internal/service"
+	"github.com/divanov-web/shorturl/internal/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+// uiPageSize сколько ссылок на одной странице списка.
+const uiPageSize = 20
+
+//go:embed web
+var webFS embed.FS
+
+// uiTemplate главная страница веб-интерфейса: форма сокращения и список ссылок пользователя.
+var uiTemplate = template.Must(template.ParseFS(webFS, "web/ui.html"))
+
+// uiPage данные главной страницы веб-интерфейса.
+type uiPage struct {
+	CSRFToken string
+	URL       string
+	Error     string
+	Notice    *uiNotice
+	Links     []uiLink
+	Page      int
+	Pages     int
+	PrevPage  int
+	NextPage  int
+}
+
+// uiNotice сообщение о результате действия. Link показывается с кнопкой копирования и QR-кодом,
+// RestoreID — с кнопкой восстановления удалённой ссылки.
+type uiNotice struct {
+	Text      string
+	Link      *uiLink
+	RestoreID string
+}
+
+// uiLink строка списка ссылок.
+type uiLink struct {
+	ID          string
+	ShortURL    string
+	OriginalURL string
+	Title       string
+	CreatedAt   string
+	Clicks      int64
+	Threat      string
+	Disabled    bool
+}
+
+// UIStatic отдаёт стили и скрипты веб-интерфейса по адресам /ui/static/*.
+func UIStatic() http.Handler {
+	static, _ := fs.Sub(webFS, "web/static") // каталог встроен при сборке, ошибки быть не может
+	return http.StripPrefix("/ui/static/", http.FileServerFS(static))
+}
+
+// UIRedirect хендлер GET /. Открывает веб-интерфейс.
+func (h *Handler) UIRedirect(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/ui", http.StatusFound)
+}
+
+// UIHome хендлер GET /ui. Страница с формой сокращения и списком ссылок пользователя по страницам (параметр page).
+// Параметры created, exists, deleted и restored показывают результат предыдущего действия с ссылкой.
+func (h *Handler) UIHome(w http.ResponseWriter, r *http.Request) {
+	userID, ok := uiUser(w, r)
+	if !ok {
+		return
+	}
+
+	var data uiPage
+	query := r.URL.Query()
+	switch {
+	case query.Get("created") != "":
+		data.Notice = h.uiLinkNotice(r, userID, query.Get("created"), "Ссылка создана")
+	case query.Get("exists") != "":
+		data.Notice = h.uiLinkNotice(r, userID, query.Get("exists"), "Этот URL уже сокращён")
+	case query.Get("deleted") != "":
+		data.Notice = &uiNotice{Text: "Ссылка удалена", RestoreID: query.Get("deleted")}
+	case query.Get("restored") != "":
+		data.Notice = h.uiLinkNotice(r, userID, query.Get("restored"), "Ссылка восстановлена")
+	}
+	h.renderUI(w, r, userID, http.StatusOK, data)
+}
+
+// UIShorten хендлер POST /ui/shorten. Сокращает URL из формы и возвращает на главную страницу.
+func (h *Handler) UIShorten(w http.ResponseWriter, r *http.Request) {
+	userID, ok := uiUser(w, r)
+	if !ok {
+		return
+	}
+	original := strings.TrimSpace(r.PostFormValue("url"))
+
+	owner, err := h.Service.CreateOwner(r.Context(), userID, "")
+	if err != nil {
+		h.renderUIError(w, r, userID, original, err)
+		return
+	}
+	shortURL, err := h.Service.CreateShort(r.Context(), owner, original)
+	switch {
+	case errors.Is(err, service.ErrAlreadyExists) && shortURL != "":
+		http.Redirect(w, r, "/ui?exists="+url.QueryEscape(shortID(shortURL)), http.StatusSeeOther)
+	case err != nil:
+		h.renderUIError(w, r, userID, original, err)
+	default:
+		http.Redirect(w, r, "/ui?created="+url.QueryEscape(shortID(shortURL)), http.StatusSeeOther)
+	}
+}
+
+// UIDelete хендлер POST /ui/links/{id}/delete. Удаляет ссылку пользователя, на странице остаётся кнопка восстановления.
+// Для чужой или несуществующей ссылки показывается ошибка, а не сообщение об удалении.
+func (h *Handler) UIDelete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := uiUser(w, r)
+	if !ok {
+		return
+	}
+	id := chi.URLParam(r, "id")
+	link, err := h.Service.GetUserLink(r.Context(), userID, id)
+	if err == nil && link.UserID != userID {
+		err = service.ErrForbidden // ссылки рабочих пространств на этой странице не удаляются
+	}
+	if err == nil {
+		err = h.Service.DeleteUserURLs(r.Context(), userID, []string{id})
+	}
+	if err != nil {
+		h.renderUIError(w, r, userID, "", err)
+		return
+	}
+	http.Redirect(w, r, uiURL(r, "deleted", id), http.StatusSeeOther)
+}
+
+// UIRestore хендлер POST /ui/links/{id}/restore. Восстанавливает удалённую ссылку пользователя.
+func (h *Handler) UIRestore(w http.ResponseWriter, r *http.Request) {
+	userID, ok := uiUser(w, r)
+	if !ok {
+		return
+	}
+	id := chi.URLParam(r, "id")
+	if err := h.Service.RestoreUserURL(r.Context(), userID, id); err != nil {
+		h.renderUIError(w, r, userID, "", err)
+		return
+	}
+	http.Redirect(w, r, uiURL(r, "restored", id), http.StatusSeeOther)
+}
+
+// renderUI дополняет данные страницы списком ссылок и CSRF-токеном и отрисовывает её.
+// Страницы нельзя встраивать в чужие сайты, иначе кнопки можно нажать обманом.
+func (h *Handler) renderUI(w http.ResponseWriter, r *http.Request, userID string, status int, data uiPage) {
+	links, err := h.Service.GetUserURLs(r.Context(), userID, service.URLFilter{})
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	slices.SortFunc(links, func(a, b storage.UserURL) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ShortURL, b.ShortURL)
+	})
+
+	data.CSRFToken = middleware.GetCSRFToken(r.Context())
+	data.Pages = max(1, (len(links)+uiPageSize-1)/uiPageSize)
+	data.Page, _ = strconv.Atoi(r.FormValue("page"))
+	data.Page = min(max(data.Page, 1), data.Pages)
+	if data.Page > 1 {
+		data.PrevPage = data.Page - 1
+	}
+	if data.Page < data.Pages {
+		data.NextPage = data.Page + 1
+	}
+	start := (data.Page - 1) * uiPageSize
+	for _, link := range links[start:min(start+uiPageSize, len(links))] {
+		data.Links = append(data.Links, h.uiLink(link))
+	}
+
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+	renderPage(w, uiTemplate, status, data)
+}
+
+// renderUIError показывает главную страницу с сообщением об ошибке действия. original возвращается в форму.
+func (h *Handler) renderUIError(w http.ResponseWriter, r *http.Request, userID string, original string, err error) {
+	data := uiPage{URL: original}
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, service.ErrInvalidURL):
+		_, data.Error = service.PolicyReason(err)
+	case errors.Is(err, service.ErrAlreadyExists) && original != "":
+		data.Error, status = "URL уже сокращён другим пользователем", http.StatusConflict
+	case errors.Is(err, service.ErrAlreadyExists):
+		data.Error, status = "Этот URL уже сокращён заново, восстановить ссылку нельзя", http.StatusConflict
+	case errors.Is(err, service.ErrUserBlocked):
+		data.Error, status = "Пользователь заблокирован", http.StatusForbidden
+	case errors.Is(err, service.ErrForbidden):
+		data.Error, status = "Нет доступа к ссылке", http.StatusForbidden
+	case errors.Is(err, service.ErrNotFound):
+		data.Error, status = "Ссылка не найдена", http.StatusNotFound
+	default:
+		data.Error, status = "Не удалось выполнить действие, попробуйте позже", http.StatusInternalServerError
+	}
+	h.renderUI(w, r, userID, status, data)
+}
+
+// uiLinkNotice сообщение со ссылкой пользователя. Чужие и удалённые ссылки не показываются.
+func (h *Handler) uiLinkNotice(r *http.Request, userID string, id string, text string) *uiNotice {
+	link, err := h.Service.GetUserLink(r.Context(), userID, id)
+	if err != nil || link.UserID != userID {
+		return nil
+	}
+	item := h.uiLink(link)
+	return &uiNotice{Text: text, Link: &item}
+}
+
+// uiLink переводит ссылку в строку списка.
+func (h *Handler) uiLink(link storage.UserURL) uiLink {
+	item := uiLink{
+		ID:          link.ShortURL,
+		ShortURL:    h.Service.ShortURL(link),
+		OriginalURL: link.OriginalURL,
+		Title:       link.Title,
+		Clicks:      link.Clicks,
+		Threat:      link.Threat,
+		Disabled:    link.Disabled,
+	}
+	if !link.CreatedAt.IsZero() {
+		item.CreatedAt = link.CreatedAt.UTC().Format("02.01.2006 15:04")
+	}
+	return item
+}
+
+// uiUser возвращает пользователя запроса из cookie авторизации.
+func uiUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	return userID, true
+}
+
+// uiURL адрес главной страницы с результатом действия, на той же странице списка.
+func uiURL(r *http.Request, param string, id string) string {
+	query := url.Values{param: {id}}
+	if page := r.PostFormValue("page"); page != "" {
+		query.Set("page", page)
+	}
+	return "/ui?" + query.Encode()
+}
+
+// shortID выделяет идентификатор из короткой ссылки.
+func shortID(shortURL string) string {
+	return shortURL[strings.LastIndex(shortURL, "/")+1:]
+}
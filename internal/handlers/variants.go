@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/divanov-web/shorturl/internal/middleware"
+	"github.com/divanov-web/shorturl/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+// variantCookieTTL сколько посетитель остаётся на назначенном варианте A/B-теста.
+const variantCookieTTL = 30 * 24 * time.Hour
+
+// linkVariantCookie имя cookie с вариантом A/B-теста, назначенным посетителю.
+func linkVariantCookie(id string) string {
+	return "link_variant_" + id
+}
+
+// requestInfo собирает сведения о запросе для выбора адреса редиректа.
+// Посетитель определяется по идентификатору из cookie авторизации, без него — по адресу клиента.
+func requestInfo(r *http.Request, id string) service.RequestInfo {
+	info := service.RequestInfo{
+		UserAgent:      r.UserAgent(),
+		AcceptLanguage: r.Header.Get("Accept-Language"),
+		Query:          r.URL.Query(),
+		Time:           time.Now(),
+		VisitorKey:     r.RemoteAddr,
+	}
+	if userID, ok := middleware.GetUserID(r.Context()); ok && userID != "" {
+		info.VisitorKey = userID
+	}
+	if cookie, err := r.Cookie(linkVariantCookie(id)); err == nil {
+		info.Variant = cookie.Value
+	}
+	return info
+}
+
+// setVariantCookie закрепляет за посетителем вариант A/B-теста.
+func setVariantCookie(w http.ResponseWriter, id string, variant string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     linkVariantCookie(id),
+		Value:    variant,
+		Path:     "/" + id,
+		MaxAge:   int(variantCookieTTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// GetUserURLStats хендлер GET /api/user/urls/{id}/stats. Возвращает счётчики переходов ссылки владельца.
+func (h *Handler) GetUserURLStats(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	link, err := h.Service.GetUserLink(r.Context(), userID, id)
+	if !writeServiceError(w, err) {
+		return
+	}
+
+	response := LinkStatsItem{
+		ShortURL: h.Service.ShortURL(link),
+		Clicks:   link.Clicks,
+		Variants: make([]VariantStatsItem, 0, len(link.Options.Variants)),
+	}
+	if link.MaxClicks > 0 {
+		left := link.ClicksLeft
+		response.ClicksLeft = &left
+	}
+	for _, v := range link.Options.Variants {
+		response.Variants = append(response.Variants, VariantStatsItem{
+			Name:   v.Name,
+			URL:    v.URL,
+			Weight: v.Weight,
+			Clicks: link.VariantClicks[v.Name],
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,21 @@
+// Копирование коротких ссылок в буфер обмена по кнопкам с атрибутом data-copy.
+document.addEventListener("click", (event) => {
+  const button = event.target.closest("[data-copy]");
+  if (!button || !navigator.clipboard) {
+    return;
+  }
+  navigator.clipboard.writeText(button.dataset.copy).then(() => {
+    const label = button.textContent;
+    button.textContent = "Скопировано";
+    setTimeout(() => {
+      button.textContent = label;
+    }, 1500);
+  });
+});
+
+// Удаление ссылки подтверждается, восстановить её можно сразу после удаления.
+document.addEventListener("submit", (event) => {
+  if (event.target.action.endsWith("/delete") && !confirm("Удалить ссылку?")) {
+    event.preventDefault();
+  }
+});
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/divanov-web/shorturl/internal/middleware"
+	"github.com/divanov-web/shorturl/internal/service"
+	"github.com/divanov-web/shorturl/internal/storage"
+	"github.com/divanov-web/shorturl/internal/webhook"
+	"github.com/go-chi/chi/v5"
+)
+
+// defaultDeliveriesLimit сколько попыток доставки возвращается, если limit не задан.
+const defaultDeliveriesLimit = 100
+
+// CreateWebhook хендлер POST /api/webhooks. Подписывает адрес на события ссылок пользователя,
+// с параметром workspace — ссылок рабочего пространства (нужна роль не ниже editor).
+// json: {"url": "https://...", "events": ["link.created", "link.deleted", "link.clicked"]}
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.webhookOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var data WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "Невозможно прочитать JSON", http.StatusBadRequest)
+		return
+	}
+	hook, err := h.Service.CreateWebhook(r.Context(), owner, data.URL, data.Events)
+	if !writeWebhookError(w, err) {
+		return
+	}
+
+	item := webhookItem(hook)
+	item.Secret = hook.Secret
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(item)
+}
+
+// GetWebhooks хендлер GET /api/webhooks. Возвращает подписки без секретов.
+func (h *Handler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.webhookOwner(w, r)
+	if !ok {
+		return
+	}
+
+	hooks, err := h.Service.GetWebhooks(r.Context(), owner)
+	if !writeWebhookError(w, err) {
+		return
+	}
+	if len(hooks) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	response := make([]WebhookItem, 0, len(hooks))
+	for _, hook := range hooks {
+		response = append(response, webhookItem(hook))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeleteWebhook хендлер DELETE /api/webhooks/{webhook}. Удаляет подписку.
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.webhookOwner(w, r)
+	if !ok {
+		return
+	}
+	if !writeWebhookError(w, h.Service.DeleteWebhook(r.Context(), owner, chi.URLParam(r, "webhook"))) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries хендлер GET /api/webhooks/{webhook}/deliveries. Журнал попыток доставки
+// от новых к старым, параметр limit — сколько записей вернуть (по умолчанию 100).
+func (h *Handler) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.webhookOwner(w, r)
+	if !ok {
+		return
+	}
+	limit := defaultDeliveriesLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil || limit <= 0 {
+			http.Error(w, "Недопустимый limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	deliveries, err := h.Service.GetWebhookDeliveries(r.Context(), owner, chi.URLParam(r, "webhook"), limit)
+	if !writeWebhookError(w, err) {
+		return
+	}
+	if deliveries == nil {
+		deliveries = []webhook.Delivery{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// GetWebhookDeadLetters хендлер GET /api/webhooks/{webhook}/dead. События, которые не удалось доставить.
+func (h *Handler) GetWebhookDeadLetters(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.webhookOwner(w, r)
+	if !ok {
+		return
+	}
+
+	dead, err := h.Service.GetWebhookDeadLetters(r.Context(), owner, chi.URLParam(r, "webhook"))
+	if !writeWebhookError(w, err) {
+		return
+	}
+	if dead == nil {
+		dead = []webhook.DeadLetter{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dead)
+}
+
+// RedeliverWebhook хендлер POST /api/webhooks/{webhook}/dead/{delivery}. Снова отправляет недоставленное событие.
+func (h *Handler) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.webhookOwner(w, r)
+	if !ok {
+		return
+	}
+	err := h.Service.RedeliverWebhook(r.Context(), owner, chi.URLParam(r, "webhook"), chi.URLParam(r, "delivery"))
+	if !writeWebhookError(w, err) {
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// webhookOwner возвращает владельца подписок запроса: пользователя или рабочее пространство из параметра workspace.
+func (h *Handler) webhookOwner(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	return h.linkOwner(w, r, userID, r.URL.Query().Get("workspace"), storage.RoleEditor)
+}
+
+// webhookItem переводит подписку в элемент ответа без секрета.
+func webhookItem(hook storage.Webhook) WebhookItem {
+	return WebhookItem{ID: hook.ID, URL: hook.URL, Events: hook.Events, CreatedAt: hook.CreatedAt}
+}
+
+// writeWebhookError отвечает на ошибки операций с подписками, остальные передаёт writeServiceError.
+// Возвращает true, если ошибки нет.
+func writeWebhookError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, service.ErrWebhookNotFound):
+		http.Error(w, "Подписка не найдена", http.StatusNotFound)
+	case errors.Is(err, service.ErrWebhookLimit):
+		http.Error(w, "Слишком много подписок", http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidOptions):
+		http.Error(w, "Неизвестное событие", http.StatusBadRequest)
+	default:
+		return writeServiceError(w, err)
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/divanov-web/shorturl/internal/middleware"
+	"github.com/divanov-web/shorturl/internal/service"
+	"github.com/divanov-web/shorturl/internal/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+// CreateWorkspace хендлер POST /api/workspaces. Создаёт рабочее пространство, текущий пользователь становится владельцем.
+// json: {"name": "..."}
+func (h *Handler) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var data WorkspaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "Невозможно прочитать JSON", http.StatusBadRequest)
+		return
+	}
+	ws, err := h.Service.CreateWorkspace(r.Context(), userID, data.Name)
+	if !writeWorkspaceError(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(workspaceItem(ws))
+}
+
+// GetWorkspaces хендлер GET /api/workspaces. Возвращает рабочие пространства пользователя с его ролями.
+func (h *Handler) GetWorkspaces(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	workspaces, err := h.Service.GetUserWorkspaces(r.Context(), userID)
+	if !writeWorkspaceError(w, err) {
+		return
+	}
+	if len(workspaces) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	response := make([]WorkspaceItem, 0, len(workspaces))
+	for _, ws := range workspaces {
+		response = append(response, workspaceItem(ws))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetWorkspaceMembers хендлер GET /api/workspaces/{workspace}/members. Возвращает участников рабочего пространства.
+func (h *Handler) GetWorkspaceMembers(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	members, err := h.Service.GetWorkspaceMembers(r.Context(), userID, chi.URLParam(r, "workspace"))
+	if !writeWorkspaceError(w, err) {
+		return
+	}
+
+	response := make([]WorkspaceMemberItem, 0, len(members))
+	for _, m := range members {
+		response = append(response, WorkspaceMemberItem{UserID: m.UserID, Role: m.Role})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// SetWorkspaceMember хендлер PUT /api/workspaces/{workspace}/members/{user}. Меняет роль участника, доступно владельцу.
+// json: {"role": "owner|editor|viewer"}
+func (h *Handler) SetWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var data WorkspaceMemberItem
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "Невозможно прочитать JSON", http.StatusBadRequest)
+		return
+	}
+	memberID := chi.URLParam(r, "user")
+	err := h.Service.SetWorkspaceMemberRole(r.Context(), userID, chi.URLParam(r, "workspace"), memberID, data.Role)
+	if !writeWorkspaceError(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(WorkspaceMemberItem{UserID: memberID, Role: data.Role})
+}
+
+// RemoveWorkspaceMember хендлер DELETE /api/workspaces/{workspace}/members/{user}.
+// Владелец убирает участника, участник может убрать только себя.
+func (h *Handler) RemoveWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err := h.Service.RemoveWorkspaceMember(r.Context(), userID, chi.URLParam(r, "workspace"), chi.URLParam(r, "user"))
+	if !writeWorkspaceError(w, err) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateWorkspaceInvite хендлер POST /api/workspaces/{workspace}/invites. Создаёт одноразовое приглашение, доступно владельцу.
+// json: {"role": "owner|editor|viewer"}
+func (h *Handler) CreateWorkspaceInvite(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var data WorkspaceInviteItem
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "Невозможно прочитать JSON", http.StatusBadRequest)
+		return
+	}
+	invite, err := h.Service.CreateWorkspaceInvite(r.Context(), userID, chi.URLParam(r, "workspace"), data.Role)
+	if !writeWorkspaceError(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(WorkspaceInviteItem{Token: invite.Token, Role: invite.Role, ExpiresAt: invite.ExpiresAt})
+}
+
+// AcceptWorkspaceInvite хендлер POST /api/invites/{token}. Добавляет текущего пользователя в рабочее пространство.
+func (h *Handler) AcceptWorkspaceInvite(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ws, err := h.Service.AcceptWorkspaceInvite(r.Context(), userID, chi.URLParam(r, "token"))
+	if !writeWorkspaceError(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(workspaceItem(ws))
+}
+
+// linkOwner возвращает владельца ссылок запроса: рабочее пространство workspaceID, если оно задано и роль
+// пользователя в нём не ниже need, иначе самого пользователя. При ошибке отвечает клиенту и возвращает false.
+func (h *Handler) linkOwner(w http.ResponseWriter, r *http.Request, userID string, workspaceID string, need storage.WorkspaceRole) (string, bool) {
+	owner, err := h.Service.LinkOwner(r.Context(), userID, workspaceID, need)
+	if !writeWorkspaceError(w, err) {
+		return "", false
+	}
+	return owner, true
+}
+
+// createOwner возвращает владельца новых ссылок запроса, как linkOwner с ролью editor.
+// Заблокированный пользователь получает 403.
+func (h *Handler) createOwner(w http.ResponseWriter, r *http.Request, userID string, workspaceID string) (string, bool) {
+	owner, err := h.Service.CreateOwner(r.Context(), userID, workspaceID)
+	if !writeWorkspaceError(w, err) {
+		return "", false
+	}
+	return owner, true
+}
+
+// workspaceItem переводит рабочее пространство в элемент ответа.
+func workspaceItem(ws service.UserWorkspace) WorkspaceItem {
+	return WorkspaceItem{ID: ws.ID, Name: ws.Name, Role: ws.Role, CreatedAt: ws.CreatedAt}
+}
+
+// writeWorkspaceError отвечает на ошибки операций с рабочими пространствами, остальные передаёт writeServiceError.
+// Возвращает true, если ошибки нет.
+func writeWorkspaceError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, service.ErrForbidden):
+		http.Error(w, "Нет доступа к рабочему пространству", http.StatusForbidden)
+	case errors.Is(err, service.ErrInviteInvalid):
+		http.Error(w, "Приглашение не найдено или истекло", http.StatusNotFound)
+	case errors.Is(err, service.ErrLastOwner):
+		http.Error(w, "В рабочем пространстве должен остаться владелец", http.StatusConflict)
+	case errors.Is(err, service.ErrNotFound):
+		http.Error(w, "Участник не найден", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidOptions):
+		http.Error(w, "Недопустимые параметры рабочего пространства", http.StatusBadRequest)
+	default:
+		return writeServiceError(w, err)
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AdminIDKey Имя переменной в контексте, которая хранит идентификатор администратора для журнала действий
+const AdminIDKey contextKey = "admin_id"
+
+// Admin пропускает к маршрутам администратора пользователей из списка и запросы с API-ключом
+// в заголовке Authorization: Bearer <ключ>.
+type Admin struct {
+	users map[string]bool
+	keys  [][]byte
+}
+
+// NewAdmin конструктор проверки администратора для middleware. Пустые значения списков пропускаются.
+func NewAdmin(userIDs []string, keys []string) *Admin {
+	a := &Admin{users: make(map[string]bool, len(userIDs))}
+	for _, id := range userIDs {
+		if id != "" {
+			a.users[id] = true
+		}
+	}
+	for _, key := range keys {
+		if key != "" {
+			a.keys = append(a.keys, []byte(key))
+		}
+	}
+	return a
+}
+
+// WithAdmin middleware администратора. Неверный API-ключ получает 401, остальные не администраторы — 403.
+// Администратор по ключу записывается в контекст как api-key:<номер ключа в списке>, ключ в журнал не попадает.
+func (a *Admin) WithAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var adminID string
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			adminID = a.keyID([]byte(token))
+			if adminID == "" {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		} else if userID, ok := GetUserID(r.Context()); ok && a.users[userID] {
+			adminID = "user:" + userID
+		}
+		if adminID == "" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), AdminIDKey, adminID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// keyID ищет API-ключ, сравнивая со всеми ключами за постоянное время.
+func (a *Admin) keyID(token []byte) string {
+	var id string
+	for i, key := range a.keys {
+		if subtle.ConstantTimeCompare(token, key) == 1 {
+			id = "api-key:" + strconv.Itoa(i+1)
+		}
+	}
+	return id
+}
+
+// GetAdminID извлекает идентификатор администратора из context
+func GetAdminID(ctx context.Context) (string, bool) {
+	adminID, ok := ctx.Value(AdminIDKey).(string)
+	return adminID, ok
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithAdmin(t *testing.T) {
+	h := NewAdmin([]string{"root", ""}, []string{"", "secret-key"}).WithAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminID, _ := GetAdminID(r.Context())
+		w.Write([]byte(adminID))
+	}))
+
+	send := func(userID, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/urls", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), UserIDKey, userID))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send("root", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "user:root", rec.Body.String())
+
+	rec = send("guest", "Bearer secret-key")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "api-key:1", rec.Body.String())
+
+	assert.Equal(t, http.StatusUnauthorized, send("root", "Bearer wrong").Code)
+	assert.Equal(t, http.StatusUnauthorized, send("guest", "Bearer ").Code)
+	assert.Equal(t, http.StatusForbidden, send("guest", "").Code)
+	assert.Equal(t, http.StatusForbidden, send("", "").Code)
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/divanov-web/shorturl/internal/audit"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
@@ -66,6 +67,7 @@ func (a *Auth) WithAuth(next http.Handler) http.Handler {
 		}
 
 		ctx := context.WithValue(r.Context(), UserIDKey, userID)
+		ctx = audit.WithActor(ctx, userID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
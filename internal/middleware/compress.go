@@ -0,0 +1,339 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressEncoder общий интерфейс потоковых кодировщиков, которые можно переиспользовать через Reset.
+type compressEncoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// zstdEncoder приводит Reset у zstd.Encoder к сигнатуре без ошибки.
+type zstdEncoder struct {
+	*zstd.Encoder
+}
+
+// Reset переключает кодировщик на новый writer.
+func (z zstdEncoder) Reset(w io.Writer) {
+	z.Encoder.Reset(w)
+}
+
+// encoderPools пулы кодировщиков по имени кодировки.
+var encoderPools = map[string]*sync.Pool{
+	"br": {New: func() any {
+		return brotli.NewWriterLevel(nil, brotli.BestSpeed)
+	}},
+	"zstd": {New: func() any {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		return zstdEncoder{enc}
+	}},
+	"gzip": {New: func() any {
+		gz, _ := gzip.NewWriterLevel(nil, gzip.BestSpeed)
+		return gz
+	}},
+	"deflate": {New: func() any {
+		fl, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return fl
+	}},
+}
+
+// encodingPreference порядок выбора кодировки при одинаковом q.
+var encodingPreference = []string{"br", "zstd", "gzip", "deflate"}
+
+// Compressor настройки потокового сжатия ответов.
+type Compressor struct {
+	// MinSize ответы меньше этого размера отдаются без сжатия.
+	MinSize int
+	// ContentTypes префиксы Content-Type, которые разрешено сжимать.
+	ContentTypes []string
+}
+
+// NewCompressor конструктор сжатия ответов для middleware
+func NewCompressor(minSize int, contentTypes []string) *Compressor {
+	return &Compressor{MinSize: minSize, ContentTypes: contentTypes}
+}
+
+// WithCompression сжимает ответ кодировкой, выбранной по Accept-Encoding (br, zstd, gzip, deflate).
+// Ответ не буферизуется целиком: копится только до MinSize байт, чтобы решить, стоит ли сжимать.
+func (c *Compressor) WithCompression(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			// ответ не сжимается, но кэши должны знать, что он зависит от Accept-Encoding
+			h.ServeHTTP(&varyWriter{ResponseWriter: w, compressor: c}, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, compressor: c, encoding: encoding}
+		defer cw.close()
+		h.ServeHTTP(cw, r)
+	})
+}
+
+// allowed проверяет, разрешено ли сжимать ответ с таким Content-Type.
+func (c *Compressor) allowed(contentType string) bool {
+	for _, prefix := range c.ContentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// varyWriter добавляет Vary: Accept-Encoding к несжатому ответу, если его тип разрешено сжимать.
+type varyWriter struct {
+	http.ResponseWriter
+	compressor *Compressor
+	wrote      bool
+}
+
+// WriteHeader добавляет Vary перед отправкой заголовков.
+func (vw *varyWriter) WriteHeader(statusCode int) {
+	vw.addVary(nil)
+	vw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write добавляет Vary перед первой записью тела.
+func (vw *varyWriter) Write(b []byte) (int, error) {
+	vw.addVary(b)
+	return vw.ResponseWriter.Write(b)
+}
+
+// Flush отправляет заголовки и записанные данные клиенту.
+func (vw *varyWriter) Flush() {
+	vw.addVary(nil)
+	if f, ok := vw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack поддерживает захват соединения, если его поддерживает исходный writer.
+func (vw *varyWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := vw.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Unwrap возвращает исходный writer для http.ResponseController.
+func (vw *varyWriter) Unwrap() http.ResponseWriter {
+	return vw.ResponseWriter
+}
+
+// addVary один раз, до отправки заголовков, проверяет тип ответа. Без Content-Type тип
+// определяется по началу тела так же, как это сделает net/http.
+func (vw *varyWriter) addVary(b []byte) {
+	if vw.wrote {
+		return
+	}
+	vw.wrote = true
+	header := vw.Header()
+	contentType := header.Get("Content-Type")
+	if contentType == "" && len(b) > 0 {
+		contentType = http.DetectContentType(b)
+	}
+	if vw.compressor.allowed(contentType) {
+		header.Add("Vary", "Accept-Encoding")
+	}
+}
+
+// compressWriter решает о сжатии по первым MinSize байтам и дальше пишет потоком.
+type compressWriter struct {
+	http.ResponseWriter
+	compressor *Compressor
+	encoding   string
+	status     int
+	buf        []byte
+	decided    bool
+	enc        compressEncoder
+}
+
+// WriteHeader запоминает код статуса до решения о сжатии.
+func (cw *compressWriter) WriteHeader(statusCode int) {
+	if cw.status == 0 {
+		cw.status = statusCode
+	}
+}
+
+// Write копит данные до MinSize, затем пишет в кодировщик или напрямую.
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.compressor.MinSize {
+			return len(b), nil
+		}
+		if err := cw.decide(false); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if cw.enc != nil {
+		return cw.enc.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush принудительно отправляет накопленные данные клиенту.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		_ = cw.decide(false)
+	}
+	if cw.enc != nil {
+		_ = cw.enc.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack поддерживает захват соединения, если его поддерживает исходный writer.
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := cw.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Unwrap возвращает исходный writer для http.ResponseController.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// decide выбирает, сжимать ли ответ, отправляет заголовки и накопленные данные.
+// final == true, когда обработчик уже закончил и данных больше не будет.
+func (cw *compressWriter) decide(final bool) error {
+	cw.decided = true
+	header := cw.Header()
+
+	contentType := header.Get("Content-Type")
+	if contentType == "" && len(cw.buf) > 0 {
+		contentType = http.DetectContentType(cw.buf)
+		header.Set("Content-Type", contentType)
+	}
+
+	compress := cw.compressor.allowed(contentType) &&
+		header.Get("Content-Encoding") == "" &&
+		bodyAllowed(cw.status) &&
+		!(final && len(cw.buf) < cw.compressor.MinSize) &&
+		!(final && len(cw.buf) == 0)
+
+	if cw.compressor.allowed(contentType) {
+		header.Add("Vary", "Accept-Encoding")
+	}
+
+	if compress {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		cw.enc = encoderPools[cw.encoding].Get().(compressEncoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(cw.buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+	return err
+}
+
+// close завершает ответ: досылает буфер, закрывает кодировщик и возвращает его в пул.
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.status == 0 && len(cw.buf) == 0 {
+			// обработчик ничего не написал, net/http сам ответит 200
+			return
+		}
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		_ = cw.decide(true)
+	}
+	if cw.enc != nil {
+		_ = cw.enc.Close()
+		cw.enc.Reset(nil)
+		encoderPools[cw.encoding].Put(cw.enc)
+		cw.enc = nil
+	}
+}
+
+// bodyAllowed проверяет, может ли ответ с таким статусом иметь тело.
+func bodyAllowed(status int) bool {
+	return status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// negotiateEncoding выбирает поддерживаемую кодировку с наибольшим q из Accept-Encoding.
+// Пустая строка означает отдачу без сжатия.
+func negotiateEncoding(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	weights := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		weights[name] = q
+	}
+
+	candidates := make([]string, 0, len(encodingPreference))
+	for _, enc := range encodingPreference {
+		q, ok := weights[enc]
+		if !ok {
+			q = wildcard
+		}
+		if q > 0 {
+			weights[enc] = q
+			candidates = append(candidates, enc)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	// стабильная сортировка сохраняет порядок предпочтения при равных q
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return weights[candidates[i]] > weights[candidates[j]]
+	})
+	return candidates[0]
+}
@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: ""},
+		{header: "gzip", want: "gzip"},
+		{header: "gzip, deflate, br, zstd", want: "br"},
+		{header: "gzip;q=1, br;q=0.5", want: "gzip"},
+		{header: "br;q=0, *", want: "zstd"},
+		{header: "identity", want: ""},
+		{header: "*;q=0", want: ""},
+		{header: "deflate;q=0.9, gzip;q=0.8", want: "deflate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			assert.Equal(t, tt.want, negotiateEncoding(tt.header))
+		})
+	}
+}
+
+func TestWithCompression(t *testing.T) {
+	body := strings.Repeat(`{"result":"http://localhost:8080/abc"}`, 20)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		writeHeader    bool
+		wantEncoding   string
+	}{
+		{name: "gzip json", acceptEncoding: "gzip", contentType: "application/json", body: body, writeHeader: true, wantEncoding: "gzip"},
+		{name: "brotli json", acceptEncoding: "br", contentType: "application/json", body: body, wantEncoding: "br"},
+		{name: "not allowed type", acceptEncoding: "gzip", contentType: "image/png", body: body, wantEncoding: ""},
+		{name: "below min size", acceptEncoding: "gzip", contentType: "application/json", body: `{}`, wantEncoding: ""},
+		{name: "status without WriteHeader", acceptEncoding: "gzip", contentType: "application/json", body: body, writeHeader: false, wantEncoding: "gzip"},
+		{name: "no Accept-Encoding", acceptEncoding: "", contentType: "application/json", body: body, writeHeader: true, wantEncoding: ""},
+		{name: "no Accept-Encoding not allowed type", acceptEncoding: "", contentType: "image/png", body: body, wantEncoding: ""},
+	}
+
+	c := NewCompressor(64, []string{"application/json"})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := c.WithCompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Header().Set("Content-Length", "123")
+				if tt.writeHeader {
+					w.WriteHeader(http.StatusCreated)
+				}
+				io.WriteString(w, tt.body)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			wantStatus := http.StatusOK
+			if tt.writeHeader {
+				wantStatus = http.StatusCreated
+			}
+			assert.Equal(t, wantStatus, rec.Code)
+			assert.Equal(t, tt.wantEncoding, rec.Header().Get("Content-Encoding"))
+
+			var reader io.Reader = rec.Body
+			switch tt.wantEncoding {
+			case "gzip":
+				gz, err := gzip.NewReader(rec.Body)
+				require.NoError(t, err)
+				reader = gz
+				assert.Empty(t, rec.Header().Get("Content-Length"))
+			case "br":
+				reader = brotli.NewReader(rec.Body)
+			}
+			got, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, tt.body, string(got))
+
+			if tt.contentType == "application/json" {
+				assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+			} else {
+				assert.Empty(t, rec.Header().Get("Vary"))
+			}
+		})
+	}
+}
+
+func TestWithCompression_Flush(t *testing.T) {
+	c := NewCompressor(1024, []string{"application/x-ndjson"})
+	flushed := make(chan struct{})
+	release := make(chan struct{})
+
+	h := c.WithCompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		io.WriteString(w, "{\"line\":1}\n")
+		w.(http.Flusher).Flush()
+		close(flushed)
+		<-release
+		io.WriteString(w, "{\"line\":2}\n")
+	}))
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	<-flushed
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	gz, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	first := make([]byte, len("{\"line\":1}\n"))
+	_, err = io.ReadFull(gz, first)
+	require.NoError(t, err)
+	assert.Equal(t, "{\"line\":1}\n", string(first))
+
+	close(release)
+	rest, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, "{\"line\":2}\n", string(rest))
+}
+
+func TestWithCompression_HeadVary(t *testing.T) {
+	c := NewCompressor(64, []string{"text/html"})
+	h := c.WithCompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// без Content-Type тип определяется по телу
+		io.WriteString(w, "<!DOCTYPE html><html></html>")
+	}))
+
+	req := httptest.NewRequest(http.MethodHead, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+)
+
+// CSRFTokenKey Имя переменной в контексте, которая хранит CSRF-токен текущего пользователя для форм
+const CSRFTokenKey contextKey = "csrf_token"
+
+// CSRFField имя поля формы с CSRF-токеном. Вместо поля токен можно передать в заголовке X-CSRF-Token.
+const CSRFField = "csrf_token"
+
+// CSRF защищает формы от отправки со сторонних сайтов. Токен вычисляется из идентификатора пользователя,
+// поэтому его не нужно хранить на сервере, а чужой токен не подходит к cookie пользователя.
+type CSRF struct {
+	secret []byte
+}
+
+// NewCSRF конструктор CSRF-защиты для middleware. Секрет должен быть тем же, что у авторизации, или не менее стойким.
+func NewCSRF(secret string) *CSRF {
+	return &CSRF{secret: []byte(secret)}
+}
+
+// WithCSRF middleware CSRF-защиты, ставится после авторизации. Кладёт токен в контекст для шаблонов,
+// а запросы кроме GET, HEAD и OPTIONS без верного токена или с Origin чужого сайта получают 403.
+func (c *CSRF) WithCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := GetUserID(r.Context())
+		token := c.token(userID)
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			got := r.Header.Get("X-CSRF-Token")
+			if got == "" {
+				got = r.PostFormValue(CSRFField)
+			}
+			if userID == "" || !hmac.Equal([]byte(got), []byte(token)) || !SameOrigin(r) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), CSRFTokenKey, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// token подписывает идентификатор пользователя секретом.
+func (c *CSRF) token(userID string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte("csrf:" + userID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SameOrigin проверяет, что запрос пришёл без Origin (не из браузера) или со страницы этого же хоста.
+func SameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// GetCSRFToken извлекает CSRF-токен из context
+func GetCSRFToken(ctx context.Context) string {
+	token, _ := ctx.Value(CSRFTokenKey).(string)
+	return token
+}
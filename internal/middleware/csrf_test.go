@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithCSRF(t *testing.T) {
+	csrf := NewCSRF("secret")
+	h := csrf.WithCSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetCSRFToken(r.Context())))
+	}))
+
+	send := func(method, userID, token, origin string) *httptest.ResponseRecorder {
+		form := url.Values{}
+		if token != "" {
+			form.Set(CSRFField, token)
+		}
+		req := httptest.NewRequest(method, "http://sho.rt/ui/shorten", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), UserIDKey, userID))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send(http.MethodGet, "alice", "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	token := rec.Body.String()
+	assert.NotEmpty(t, token)
+	assert.NotEqual(t, token, send(http.MethodGet, "bob", "", "").Body.String())
+
+	assert.Equal(t, http.StatusOK, send(http.MethodPost, "alice", token, "").Code)
+	assert.Equal(t, http.StatusOK, send(http.MethodPost, "alice", token, "http://sho.rt").Code)
+	assert.Equal(t, http.StatusForbidden, send(http.MethodPost, "alice", "", "").Code)
+	assert.Equal(t, http.StatusForbidden, send(http.MethodPost, "bob", token, "").Code)
+	assert.Equal(t, http.StatusForbidden, send(http.MethodPost, "alice", token, "https://evil.example").Code)
+	assert.Equal(t, http.StatusForbidden, send(http.MethodPost, "", NewCSRF("secret").token(""), "").Code)
+
+	// токен из другого секрета не подходит
+	assert.Equal(t, http.StatusForbidden, send(http.MethodPost, "alice", NewCSRF("other").token("alice"), "").Code)
+}
@@ -1,24 +1,228 @@
 package middleware
 
 import (
+	"bufio"
+	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
+	"errors"
 	"io"
+	"net"
 	"net/http"
 	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 )
 
-// WithDecompress распаковывает запрос, если он пришёл сжатым
-func WithDecompress(h http.Handler) http.Handler {
+// zstdMaxWindow ограничение окна zstd, чтобы один запрос не занимал сотни мегабайт памяти.
+const zstdMaxWindow = 8 << 20
+
+// Decompressor распаковывает тело запроса и ограничивает его размер до и после распаковки.
+type Decompressor struct {
+	// MaxRawSize максимальный размер тела запроса в том виде, в каком он пришёл.
+	MaxRawSize int64
+	// MaxDecompressedSize максимальный размер тела после распаковки.
+	MaxDecompressedSize int64
+}
+
+// NewDecompressor конструктор распаковки запросов для middleware
+func NewDecompressor(maxRawSize, maxDecompressedSize int64) *Decompressor {
+	return &Decompressor{MaxRawSize: maxRawSize, MaxDecompressedSize: maxDecompressedSize}
+}
+
+// bodyLimitState общий для тела и ответа признак превышения лимита.
+type bodyLimitState struct {
+	exceeded bool
+}
+
+// limitedBody читает не больше limit байт и отмечает превышение.
+type limitedBody struct {
+	r         io.Reader
+	limit     int64
+	remaining int64
+	state     *bodyLimitState
+}
+
+// Read читает из исходного тела, возвращая *http.MaxBytesError при превышении лимита.
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.state.exceeded {
+		return 0, &http.MaxBytesError{Limit: l.limit}
+	}
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) <= l.remaining {
+		l.remaining -= int64(n)
+		return n, err
+	}
+	n = int(l.remaining)
+	l.remaining = 0
+	l.state.exceeded = true
+	return n, &http.MaxBytesError{Limit: l.limit}
+}
+
+// bodyLimitWriter подменяет ответ обработчика на 413, если при чтении тела был превышен лимит.
+type bodyLimitWriter struct {
+	http.ResponseWriter
+	state       *bodyLimitState
+	wroteHeader bool
+	replaced    bool
+}
+
+// WriteHeader отправляет код обработчика или 413 при превышении лимита.
+func (w *bodyLimitWriter) WriteHeader(statusCode int) {
+	if w.replace() {
+		return
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write отправляет тело обработчика или отбрасывает его при превышении лимита.
+func (w *bodyLimitWriter) Write(b []byte) (int, error) {
+	if w.replace() {
+		return len(b), nil
+	}
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush передаёт Flush исходному http.ResponseWriter, если он его поддерживает
+func (w *bodyLimitWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack передаёт захват соединения исходному writer, он нужен WebSocket.
+func (w *bodyLimitWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap возвращает исходный writer для http.ResponseController.
+func (w *bodyLimitWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// replace отвечает 413 вместо обработчика, если лимит превышен до начала ответа.
+func (w *bodyLimitWriter) replace() bool {
+	if w.wroteHeader || !w.state.exceeded {
+		return false
+	}
+	if !w.replaced {
+		w.replaced = true
+		http.Error(w.ResponseWriter, "Слишком большое тело запроса", http.StatusRequestEntityTooLarge)
+	}
+	return true
+}
+
+// WithDecompress распаковывает запрос по Content-Encoding (gzip, deflate, br, zstd, в том числе
+// несколько кодировок подряд) и отвечает 413, если тело до или после распаковки больше лимита.
+func (d *Decompressor) WithDecompress(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
-			gz, err := gzip.NewReader(r.Body)
+		if d.MaxRawSize > 0 && r.ContentLength > d.MaxRawSize {
+			http.Error(w, "Слишком большое тело запроса", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		state := &bodyLimitState{}
+		var body io.Reader = r.Body
+		if d.MaxRawSize > 0 {
+			body = &limitedBody{r: body, limit: d.MaxRawSize, remaining: d.MaxRawSize, state: state}
+		}
+
+		encodings := contentEncodings(r.Header)
+		// кодировки применялись в порядке перечисления, снимаем их в обратном
+		for i := len(encodings) - 1; i >= 0; i-- {
+			decoded, closeFn, err := decodeBody(encodings[i], body)
+			if err == errUnsupportedEncoding {
+				http.Error(w, "unsupported content encoding", http.StatusUnsupportedMediaType)
+				return
+			}
 			if err != nil {
+				if state.exceeded {
+					http.Error(w, "Слишком большое тело запроса", http.StatusRequestEntityTooLarge)
+					return
+				}
 				http.Error(w, "failed to decompress request body", http.StatusBadRequest)
 				return
 			}
-			defer gz.Close()
-			r.Body = io.NopCloser(gz) // подменяем тело запроса на распакованное
+			if closeFn != nil {
+				defer closeFn()
+			}
+			body = decoded
 		}
-		h.ServeHTTP(w, r)
+
+		if len(encodings) > 0 {
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+			if d.MaxDecompressedSize > 0 {
+				body = &limitedBody{r: body, limit: d.MaxDecompressedSize, remaining: d.MaxDecompressedSize, state: state}
+			}
+		}
+
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{body, r.Body} // подменяем тело запроса на распакованное
+		h.ServeHTTP(&bodyLimitWriter{ResponseWriter: w, state: state}, r)
 	})
 }
+
+// errUnsupportedEncoding кодировка тела запроса не поддерживается.
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// contentEncodings возвращает список кодировок тела без identity.
+func contentEncodings(header http.Header) []string {
+	var result []string
+	for _, value := range header.Values("Content-Encoding") {
+		for _, enc := range strings.Split(value, ",") {
+			enc = strings.ToLower(strings.TrimSpace(enc))
+			if enc != "" && enc != "identity" {
+				result = append(result, enc)
+			}
+		}
+	}
+	return result
+}
+
+// decodeBody оборачивает тело распаковщиком указанной кодировки.
+func decodeBody(encoding string, body io.Reader) (io.Reader, func(), error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, nil, err
+		}
+		return gz, func() { gz.Close() }, nil
+	case "deflate":
+		// по RFC deflate обёрнут в zlib, но многие клиенты шлют «сырой» deflate
+		br := bufio.NewReader(body)
+		if header, err := br.Peek(2); err == nil && isZlibHeader(header) {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, nil, err
+			}
+			return zr, func() { zr.Close() }, nil
+		}
+		fr := flate.NewReader(br)
+		return fr, func() { fr.Close() }, nil
+	case "br":
+		return brotli.NewReader(body), nil, nil
+	case "zstd":
+		zr, err := zstd.NewReader(body, zstd.WithDecoderMaxWindow(zstdMaxWindow), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr.Close, nil
+	}
+	return nil, nil, errUnsupportedEncoding
+}
+
+// isZlibHeader проверяет двухбайтовый заголовок zlib (RFC 1950).
+func isZlibHeader(b []byte) bool {
+	return b[0]&0x0f == 8 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compressBody(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		fw, err := flate.NewWriter(&buf, flate.BestSpeed)
+		require.NoError(t, err)
+		w = fw
+	case "br":
+		w = brotli.NewWriter(&buf)
+	case "zstd":
+		zw, err := zstd.NewWriter(&buf)
+		require.NoError(t, err)
+		w = zw
+	}
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestWithDecompress(t *testing.T) {
+	payload := []byte("https://example.com/" + strings.Repeat("a", 100))
+	bomb := bytes.Repeat([]byte("0"), 10_000)
+
+	tests := []struct {
+		name       string
+		encoding   string
+		body       []byte
+		statusCode int
+		want       []byte
+	}{
+		{name: "plain", body: payload, statusCode: http.StatusOK, want: payload},
+		{name: "gzip", encoding: "gzip", body: compressBody(t, "gzip", payload), statusCode: http.StatusOK, want: payload},
+		{name: "deflate zlib", encoding: "deflate", body: compressBody(t, "deflate", payload), statusCode: http.StatusOK, want: payload},
+		{name: "deflate raw", encoding: "deflate", body: compressBody(t, "raw-deflate", payload), statusCode: http.StatusOK, want: payload},
+		{name: "brotli", encoding: "br", body: compressBody(t, "br", payload), statusCode: http.StatusOK, want: payload},
+		{name: "zstd", encoding: "zstd", body: compressBody(t, "zstd", payload), statusCode: http.StatusOK, want: payload},
+		{
+			name:       "stacked gzip then br",
+			encoding:   "gzip, br",
+			body:       compressBody(t, "br", compressBody(t, "gzip", payload)),
+			statusCode: http.StatusOK,
+			want:       payload,
+		},
+		{name: "unsupported", encoding: "compress", body: payload, statusCode: http.StatusUnsupportedMediaType},
+		{name: "raw too large", body: bytes.Repeat([]byte("a"), 2048), statusCode: http.StatusRequestEntityTooLarge},
+		{name: "gzip bomb", encoding: "gzip", body: compressBody(t, "gzip", bomb), statusCode: http.StatusRequestEntityTooLarge},
+	}
+
+	d := NewDecompressor(1024, 4096)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []byte
+			h := d.WithDecompress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, err := io.ReadAll(r.Body)
+				if err != nil {
+					http.Error(w, "bad body", http.StatusBadRequest)
+					return
+				}
+				got = b
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.statusCode, rec.Code)
+			if tt.want != nil {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
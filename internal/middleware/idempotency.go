@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IdempotencyHeader заголовок с ключом идемпотентности запроса.
+const IdempotencyHeader = "Idempotency-Key"
+
+// idempotentReplayedHeader выставляется в ответе, повторённом из сохранённого.
+const idempotentReplayedHeader = "Idempotent-Replayed"
+
+// idempotencyRecord сохранённый ответ на запрос с ключом идемпотентности.
+type idempotencyRecord struct {
+	fingerprint [sha256.Size]byte
+	done        bool // false, пока первый запрос ещё обрабатывается
+	status      int
+	contentType string
+	body        []byte
+	expiresAt   time.Time
+}
+
+// Idempotency хранит первые ответы на запросы с Idempotency-Key для каждого пользователя
+// и повторяет их при ретраях в течение TTL.
+type Idempotency struct {
+	TTL       time.Duration
+	mu        sync.Mutex
+	records   map[string]*idempotencyRecord // userID + ключ -> ответ
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewIdempotency конструктор хранилища ключей идемпотентности для middleware
+func NewIdempotency(ttl time.Duration) *Idempotency {
+	return &Idempotency{
+		TTL:     ttl,
+		records: make(map[string]*idempotencyRecord),
+		now:     time.Now,
+	}
+}
+
+// idempotencyWriter пропускает ответ клиенту и копирует его для сохранения.
+type idempotencyWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader запоминает код статуса и передаёт его дальше.
+func (w *idempotencyWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write копирует тело ответа и передаёт его дальше.
+func (w *idempotencyWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// WithIdempotency middleware ключей идемпотентности. Должен стоять после WithAuth.
+// Повтор с тем же ключом и телом получает сохранённый ответ, с другим телом — 422,
+// пока первый запрос не завершён — 409. Ответы 5xx, паники и запросы, прерванные клиентом до ответа,
+// не сохраняются, чтобы запрос можно было повторить.
+func (i *Idempotency) WithIdempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyHeader)
+		userID, _ := GetUserID(r.Context())
+		if key == "" || userID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Ошибка чтения тела", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := sha256.Sum256(append([]byte(r.Method+" "+r.URL.RequestURI()+"\n"), body...))
+		recordKey := userID + "\x00" + key
+
+		rec, fresh := i.begin(recordKey, fingerprint)
+		switch {
+		case fresh:
+		case rec.fingerprint != fingerprint:
+			http.Error(w, "Idempotency-Key уже использован с другим запросом", http.StatusUnprocessableEntity)
+			return
+		case !rec.done:
+			http.Error(w, "Запрос с этим Idempotency-Key ещё выполняется", http.StatusConflict)
+			return
+		default:
+			if rec.contentType != "" {
+				w.Header().Set("Content-Type", rec.contentType)
+			}
+			w.Header().Set(idempotentReplayedHeader, "true")
+			w.WriteHeader(rec.status)
+			w.Write(rec.body)
+			return
+		}
+
+		iw := &idempotencyWriter{ResponseWriter: w}
+		finished := false
+		defer func() {
+			// при панике хендлера ключ освобождается, а паника идёт дальше
+			if !finished {
+				i.abandon(recordKey)
+			}
+		}()
+		next.ServeHTTP(iw, r)
+		finished = true
+		if iw.status == 0 && r.Context().Err() != nil {
+			// клиент отключился, а хендлер ничего не ответил: сохранять нечего, повтор выполнится заново
+			i.abandon(recordKey)
+			return
+		}
+		if iw.status == 0 {
+			iw.status = http.StatusOK
+		}
+		i.finish(recordKey, iw.status, w.Header().Get("Content-Type"), iw.body.Bytes())
+	})
+}
+
+// begin возвращает запись по ключу или резервирует новую. fresh == true, если запрос первый.
+func (i *Idempotency) begin(recordKey string, fingerprint [sha256.Size]byte) (idempotencyRecord, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := i.now()
+	i.sweep(now)
+
+	if rec, ok := i.records[recordKey]; ok && now.Before(rec.expiresAt) {
+		return *rec, false
+	}
+	i.records[recordKey] = &idempotencyRecord{fingerprint: fingerprint, expiresAt: now.Add(i.TTL)}
+	return idempotencyRecord{}, true
+}
+
+// finish сохраняет ответ первого запроса. Ошибки сервера не сохраняются.
+func (i *Idempotency) finish(recordKey string, status int, contentType string, body []byte) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if status >= http.StatusInternalServerError {
+		delete(i.records, recordKey)
+		return
+	}
+	if rec, ok := i.records[recordKey]; ok {
+		rec.done = true
+		rec.status = status
+		rec.contentType = contentType
+		rec.body = append([]byte(nil), body...)
+	}
+}
+
+// abandon освобождает ключ незавершённого запроса, чтобы повтор не получал 409 до конца TTL.
+func (i *Idempotency) abandon(recordKey string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if rec, ok := i.records[recordKey]; ok && !rec.done {
+		delete(i.records, recordKey)
+	}
+}
+
+// sweep удаляет просроченные записи не чаще одного раза за TTL. Вызывать под блокировкой.
+func (i *Idempotency) sweep(now time.Time) {
+	if now.Sub(i.lastSweep) < i.TTL {
+		return
+	}
+	i.lastSweep = now
+	for k, rec := range i.records {
+		if !now.Before(rec.expiresAt) {
+			delete(i.records, k)
+		}
+	}
+}
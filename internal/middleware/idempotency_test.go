@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithIdempotency(t *testing.T) {
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "short-%d", calls)
+	})
+
+	now := time.Now()
+	idem := NewIdempotency(time.Hour)
+	idem.now = func() time.Time { return now }
+	h := idem.WithIdempotency(next)
+
+	send := func(userID, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(IdempotencyHeader, key)
+		req = req.WithContext(context.WithValue(req.Context(), UserIDKey, userID))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := send("user1", "k1", "https://example.com")
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, "short-1", first.Body.String())
+
+	replay := send("user1", "k1", "https://example.com")
+	assert.Equal(t, http.StatusCreated, replay.Code)
+	assert.Equal(t, "short-1", replay.Body.String())
+	assert.Equal(t, "true", replay.Header().Get(idempotentReplayedHeader))
+
+	mismatch := send("user1", "k1", "https://other.com")
+	assert.Equal(t, http.StatusUnprocessableEntity, mismatch.Code)
+
+	otherUser := send("user2", "k1", "https://example.com")
+	assert.Equal(t, "short-2", otherUser.Body.String())
+
+	now = now.Add(2 * time.Hour)
+	expired := send("user1", "k1", "https://example.com")
+	assert.Equal(t, "short-3", expired.Body.String())
+	assert.Equal(t, 3, calls)
+}
+
+func TestWithIdempotency_Unfinished(t *testing.T) {
+	panicking, silent := true, true
+	h := NewIdempotency(time.Hour).WithIdempotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/panic" && panicking:
+			panic("boom")
+		case r.URL.Path == "/silent" && silent:
+			// клиент ушёл раньше, чем хендлер успел ответить
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	send := func(target string, ctx context.Context) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader("https://example.com"))
+		req.Header.Set(IdempotencyHeader, "key"+target)
+		req = req.WithContext(context.WithValue(ctx, UserIDKey, "user1"))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.PanicsWithValue(t, "boom", func() { send("/panic", context.Background()) })
+	panicking = false
+	assert.Equal(t, http.StatusCreated, send("/panic", context.Background()).Code)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, http.StatusOK, send("/silent", canceled).Code)
+	silent = false
+	retry := send("/silent", context.Background())
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Empty(t, retry.Header().Get(idempotentReplayedHeader))
+}
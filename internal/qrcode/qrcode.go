@@ -0,0 +1,157 @@
+// Package qrcode рисует QR-коды коротких ссылок в PNG и SVG.
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+// Ограничения параметров изображения.
+const (
+	MinSize   = 64
+	MaxSize   = 2048
+	MaxMargin = 16
+)
+
+// ErrInvalidOptions Ошибка недопустимые параметры QR-кода.
+var ErrInvalidOptions = errors.New("invalid qr code options")
+
+// Options параметры изображения QR-кода.
+type Options struct {
+	// Size наибольшая ширина и высота изображения в пикселях. PNG получается кратным числу модулей и может быть чуть меньше.
+	Size int
+	// Margin ширина белого поля в модулях, стандарт рекомендует 4.
+	Margin int
+	// Level уровень коррекции ошибок.
+	Level qr.Level
+	// Foreground и Background цвета модулей и фона.
+	Foreground color.RGBA
+	Background color.RGBA
+}
+
+// DefaultOptions параметры по умолчанию: 256 пикселей, поле 4 модуля, уровень M, чёрное на белом.
+func DefaultOptions() Options {
+	return Options{
+		Size:       256,
+		Margin:     4,
+		Level:      qr.M,
+		Foreground: color.RGBA{A: 0xff},
+		Background: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+	}
+}
+
+// Validate проверяет параметры.
+func (o Options) Validate() error {
+	if o.Size < MinSize || o.Size > MaxSize || o.Margin < 0 || o.Margin > MaxMargin ||
+		o.Level < qr.L || o.Level > qr.H {
+		return ErrInvalidOptions
+	}
+	return nil
+}
+
+// ParseLevel разбирает уровень коррекции ошибок: L, M, Q или H.
+func ParseLevel(s string) (qr.Level, error) {
+	switch strings.ToUpper(s) {
+	case "L":
+		return qr.L, nil
+	case "M":
+		return qr.M, nil
+	case "Q":
+		return qr.Q, nil
+	case "H":
+		return qr.H, nil
+	}
+	return 0, ErrInvalidOptions
+}
+
+// ParseColor разбирает цвет в виде RRGGBB, с # или без.
+func ParseColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return color.RGBA{}, ErrInvalidOptions
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.RGBA{}, ErrInvalidOptions
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+// PNG рисует QR-код текста в PNG.
+func PNG(text string, opts Options) ([]byte, error) {
+	code, err := encode(text, opts)
+	if err != nil {
+		return nil, err
+	}
+	modules := code.Size + 2*opts.Margin
+	scale := max(1, opts.Size/modules)
+
+	// двухцветная палитра даёт самый компактный PNG
+	img := image.NewPaletted(image.Rect(0, 0, modules*scale, modules*scale),
+		color.Palette{opts.Background, opts.Foreground})
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if !code.Black(x, y) {
+				continue
+			}
+			px, py := (x+opts.Margin)*scale, (y+opts.Margin)*scale
+			for dy := 0; dy < scale; dy++ {
+				row := img.Pix[(py+dy)*img.Stride+px:]
+				for dx := 0; dx < scale; dx++ {
+					row[dx] = 1
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG рисует QR-код текста в SVG. Изображение масштабируется без потерь, Size задаёт только его размер по умолчанию.
+func SVG(text string, opts Options) ([]byte, error) {
+	code, err := encode(text, opts)
+	if err != nil {
+		return nil, err
+	}
+	modules := code.Size + 2*opts.Margin
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="%s"/>`, hexColor(opts.Background))
+	fmt.Fprintf(&buf, `<path fill="%s" d="`, hexColor(opts.Foreground))
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Black(x, y) {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x+opts.Margin, y+opts.Margin)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes(), nil
+}
+
+// encode проверяет параметры и кодирует текст.
+func encode(text string, opts Options) (*qr.Code, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return qr.Encode(text, opts.Level)
+}
+
+// hexColor записывает цвет в виде #rrggbb.
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
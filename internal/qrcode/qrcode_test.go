@@ -0,0 +1,76 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"rsc.io/qr"
+)
+
+func TestPNG(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Foreground = color.RGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xff}
+	data, err := PNG("http://localhost:8080/abc", opts)
+	require.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	code, err := qr.Encode("http://localhost:8080/abc", qr.M)
+	require.NoError(t, err)
+
+	modules := code.Size + 2*opts.Margin
+	scale := opts.Size / modules
+	bounds := img.Bounds()
+	assert.Equal(t, modules*scale, bounds.Dx())
+	assert.LessOrEqual(t, bounds.Dx(), opts.Size)
+
+	// угол поля — фон, первый модуль поискового узора — передний цвет
+	r, g, b, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, [3]uint32{0xffff, 0xffff, 0xffff}, [3]uint32{r, g, b})
+	r, g, b, _ = img.At(opts.Margin*scale, opts.Margin*scale).RGBA()
+	assert.Equal(t, [3]uint32{0x1111, 0x2222, 0x3333}, [3]uint32{r, g, b})
+}
+
+func TestSVG(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Size = 128
+	opts.Background, _ = ParseColor("#ffee00")
+	data, err := SVG("http://localhost:8080/abc", opts)
+	require.NoError(t, err)
+
+	svg := string(data)
+	assert.True(t, strings.HasPrefix(svg, "<svg "))
+	assert.Contains(t, svg, `width="128"`)
+	assert.Contains(t, svg, `fill="#ffee00"`)
+	assert.Contains(t, svg, `fill="#000000"`)
+	assert.Contains(t, svg, "M4 4h1v1h-1z")
+}
+
+func TestOptions(t *testing.T) {
+	level, err := ParseLevel("h")
+	require.NoError(t, err)
+	assert.Equal(t, qr.H, level)
+	_, err = ParseLevel("X")
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+
+	c, err := ParseColor("0a0B0c")
+	require.NoError(t, err)
+	assert.Equal(t, color.RGBA{R: 0x0a, G: 0x0b, B: 0x0c, A: 0xff}, c)
+	for _, bad := range []string{"", "fff", "#gggggg", "1234567"} {
+		_, err = ParseColor(bad)
+		assert.ErrorIs(t, err, ErrInvalidOptions, bad)
+	}
+
+	opts := DefaultOptions()
+	opts.Size = MaxSize + 1
+	assert.ErrorIs(t, opts.Validate(), ErrInvalidOptions)
+	opts = DefaultOptions()
+	opts.Margin = -1
+	_, err = PNG("x", opts)
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+}
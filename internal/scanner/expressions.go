@@ -0,0 +1,139 @@
+package scanner
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// maxHostSuffixes и maxPathPrefixes ограничения числа выражений по правилам Safe Browsing.
+const (
+	maxHostSuffixes = 4
+	maxPathPrefixes = 4
+)
+
+// urlExpressions возвращает выражения host/path, хеши которых ищутся в списках Safe Browsing.
+// Например, для http://a.b.c/1/2.html?p=1 это b.c/ , a.b.c/1/2.html?p=1, a.b.c/1/ и т.д.
+func urlExpressions(raw string) []string {
+	host, path, query, ok := canonicalize(raw)
+	if !ok {
+		return nil
+	}
+
+	hosts := []string{host}
+	if net.ParseIP(host) == nil {
+		parts := strings.Split(host, ".")
+		// начиная с последних пяти компонентов, без домена верхнего уровня
+		for i := max(1, len(parts)-5); i < len(parts)-1 && len(hosts) <= maxHostSuffixes; i++ {
+			hosts = append(hosts, strings.Join(parts[i:], "."))
+		}
+	}
+
+	var paths []string
+	if query != "" {
+		paths = append(paths, path+"?"+query)
+	}
+	paths = append(paths, path)
+	// каталоги пути от корня, последний компонент — сам ресурс
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	dirs := segments[:len(segments)-1]
+	prefix := "/"
+	for i := 0; i < maxPathPrefixes; i++ {
+		if prefix != path {
+			paths = append(paths, prefix)
+		}
+		if i == len(dirs) {
+			break
+		}
+		prefix += dirs[i] + "/"
+	}
+
+	result := make([]string, 0, len(hosts)*len(paths))
+	seen := make(map[string]bool)
+	for _, h := range hosts {
+		for _, p := range paths {
+			if expr := h + p; !seen[expr] {
+				seen[expr] = true
+				result = append(result, expr)
+			}
+		}
+	}
+	return result
+}
+
+// canonicalize приводит URL к виду, который используется при расчёте хешей Safe Browsing:
+// без фрагмента, многократно раскодированный, хост в нижнем регистре без лишних точек,
+// путь без . и .. и повторных слешей, с экранированием управляющих символов, # и %.
+func canonicalize(raw string) (host, path, query string, ok bool) {
+	raw = strings.NewReplacer("\t", "", "\r", "", "\n", "").Replace(strings.TrimSpace(raw))
+	raw, _, _ = strings.Cut(raw, "#")
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "", "", "", false
+	}
+
+	host = strings.ToLower(fullUnescape(u.Hostname()))
+	host = strings.Trim(host, ".")
+	for strings.Contains(host, "..") {
+		host = strings.ReplaceAll(host, "..", ".")
+	}
+	if host == "" {
+		return "", "", "", false
+	}
+
+	path = fullUnescape(u.EscapedPath())
+	if path == "" {
+		path = "/"
+	}
+	trailing := strings.HasSuffix(path, "/")
+	var segments []string
+	for _, seg := range strings.Split(path, "/") {
+		switch seg {
+		case "", ".":
+		case "..":
+			if len(segments) > 0 {
+				segments = segments[:len(segments)-1]
+			}
+		default:
+			segments = append(segments, seg)
+		}
+	}
+	path = "/" + strings.Join(segments, "/")
+	if trailing && path != "/" {
+		path += "/"
+	}
+
+	return escape(host), escape(path), escape(fullUnescape(u.RawQuery)), true
+}
+
+// fullUnescape раскодирует %XX, пока строка меняется.
+func fullUnescape(s string) string {
+	for i := 0; i < 1024; i++ {
+		unescaped, err := url.PathUnescape(s)
+		if err != nil || unescaped == s {
+			return s
+		}
+		s = unescaped
+	}
+	return s
+}
+
+// escape экранирует символы <= 0x20, >= 0x7f, # и %.
+func escape(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= 0x20 || c >= 0x7f || c == '#' || c == '%' {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0x0f])
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
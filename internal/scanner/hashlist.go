@@ -0,0 +1,167 @@
+package scanner
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Типы ответа обновления списка в формате Safe Browsing v4.
+const (
+	responseFullUpdate    = "FULL_UPDATE"
+	responsePartialUpdate = "PARTIAL_UPDATE"
+	compressionRaw        = "RAW"
+)
+
+// errUnsupportedCompression сжатие Rice не поддерживается, нужны списки с compressionType RAW.
+var errUnsupportedCompression = errors.New("only RAW compression is supported")
+
+// listUpdateFile файл обновления в формате ответа threatListUpdates:fetch.
+type listUpdateFile struct {
+	ListUpdateResponses []listUpdateResponse `json:"listUpdateResponses"`
+}
+
+// listUpdateResponse обновление одного списка угроз.
+type listUpdateResponse struct {
+	ThreatType   string          `json:"threatType"`
+	ResponseType string          `json:"responseType"`
+	Additions    []threatEntries `json:"additions"`
+	Removals     []threatEntries `json:"removals"`
+	Checksum     *struct {
+		SHA256 []byte `json:"sha256"`
+	} `json:"checksum"`
+}
+
+// threatEntries набор добавляемых префиксов или удаляемых индексов.
+type threatEntries struct {
+	CompressionType string `json:"compressionType"`
+	RawHashes       *struct {
+		PrefixSize int    `json:"prefixSize"`
+		RawHashes  []byte `json:"rawHashes"`
+	} `json:"rawHashes"`
+	RawIndices *struct {
+		Indices []int `json:"indices"`
+	} `json:"rawIndices"`
+}
+
+// hashList отсортированные префиксы хешей одного типа угрозы.
+type hashList struct {
+	prefixes []string
+	sizes    []int // встречающиеся длины префиксов
+}
+
+// loadHashLists применяет файлы обновлений по порядку и возвращает списки по типу угрозы.
+func loadHashLists(paths []string) (map[string]*hashList, error) {
+	lists := make(map[string]*hashList)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var file listUpdateFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, update := range file.ListUpdateResponses {
+			if err := applyUpdate(lists, update); err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", path, update.ThreatType, err)
+			}
+		}
+	}
+	for _, list := range lists {
+		list.collectSizes()
+	}
+	return lists, nil
+}
+
+// applyUpdate применяет одно обновление: полное заменяет список, частичное удаляет индексы и добавляет префиксы.
+func applyUpdate(lists map[string]*hashList, update listUpdateResponse) error {
+	list, ok := lists[update.ThreatType]
+	if !ok || update.ResponseType == responseFullUpdate {
+		list = &hashList{}
+		lists[update.ThreatType] = list
+	}
+
+	if update.ResponseType == responsePartialUpdate {
+		// индексы удаления относятся к отсортированному списку до применения добавлений
+		removed := make(map[int]bool)
+		for _, removal := range update.Removals {
+			if removal.CompressionType != "" && removal.CompressionType != compressionRaw {
+				return errUnsupportedCompression
+			}
+			if removal.RawIndices == nil {
+				continue
+			}
+			for _, idx := range removal.RawIndices.Indices {
+				if idx < 0 || idx >= len(list.prefixes) {
+					return fmt.Errorf("removal index %d out of range", idx)
+				}
+				removed[idx] = true
+			}
+		}
+		kept := list.prefixes[:0]
+		for i, prefix := range list.prefixes {
+			if !removed[i] {
+				kept = append(kept, prefix)
+			}
+		}
+		list.prefixes = kept
+	}
+
+	for _, addition := range update.Additions {
+		if addition.CompressionType != "" && addition.CompressionType != compressionRaw {
+			return errUnsupportedCompression
+		}
+		if addition.RawHashes == nil {
+			continue
+		}
+		size, raw := addition.RawHashes.PrefixSize, addition.RawHashes.RawHashes
+		if size < 4 || size > sha256.Size || len(raw)%size != 0 {
+			return fmt.Errorf("invalid prefix size %d", size)
+		}
+		for i := 0; i < len(raw); i += size {
+			list.prefixes = append(list.prefixes, string(raw[i:i+size]))
+		}
+	}
+	sort.Strings(list.prefixes)
+
+	if update.Checksum != nil && len(update.Checksum.SHA256) > 0 {
+		sum := sha256.New()
+		for _, prefix := range list.prefixes {
+			sum.Write([]byte(prefix))
+		}
+		if !bytes.Equal(sum.Sum(nil), update.Checksum.SHA256) {
+			return errors.New("checksum mismatch")
+		}
+	}
+	return nil
+}
+
+// collectSizes запоминает длины префиксов, чтобы при поиске перебирать только их.
+func (l *hashList) collectSizes() {
+	seen := make(map[int]bool)
+	l.sizes = l.sizes[:0]
+	for _, prefix := range l.prefixes {
+		if !seen[len(prefix)] {
+			seen[len(prefix)] = true
+			l.sizes = append(l.sizes, len(prefix))
+		}
+	}
+	sort.Ints(l.sizes)
+}
+
+// contains проверяет, начинается ли полный хеш с одного из префиксов списка.
+func (l *hashList) contains(hash [sha256.Size]byte) bool {
+	for _, size := range l.sizes {
+		prefix := string(hash[:size])
+		i := sort.SearchStrings(l.prefixes, prefix)
+		if i < len(l.prefixes) && l.prefixes[i] == prefix {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+// Package scanner проверяет исходные URL по локальным спискам угроз без обращения к внешним сервисам.
+package scanner
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ThreatPattern тип угрозы для ссылок, совпавших с регулярным правилом.
+const ThreatPattern = "SUSPICIOUS_PATTERN"
+
+// Config пути к локальным спискам угроз.
+type Config struct {
+	// HashListPaths файлы обновлений в формате ответа Safe Browsing v4 threatListUpdates:fetch
+	// (только compressionType RAW). Применяются по порядку, так что за полным обновлением могут идти частичные.
+	HashListPaths []string
+	// RulesPath файл регулярных выражений, по одному в строке, # — комментарий.
+	RulesPath string
+}
+
+// Scanner проверяет URL по спискам префиксов хешей и регулярным правилам. Списки можно перечитать через Reload.
+// Без доступа к API полных хешей совпадение префикса считается угрозой.
+type Scanner struct {
+	cfg   Config
+	mu    sync.RWMutex
+	lists map[string]*hashList
+	rules []*regexp.Regexp
+}
+
+// New создаёт сканер и загружает списки угроз.
+func New(cfg Config) (*Scanner, error) {
+	s := &Scanner{cfg: cfg}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload перечитывает файлы списков и правил. При ошибке остаются прежние списки.
+func (s *Scanner) Reload() error {
+	lists, err := loadHashLists(s.cfg.HashListPaths)
+	if err != nil {
+		return fmt.Errorf("load threat lists: %w", err)
+	}
+	rules, err := loadRules(s.cfg.RulesPath)
+	if err != nil {
+		return fmt.Errorf("load threat rules: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lists = lists
+	s.rules = rules
+	return nil
+}
+
+// Check возвращает тип угрозы для URL или пустую строку, если URL не найден в списках.
+func (s *Scanner) Check(raw string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.lists) > 0 {
+		// типы угроз перебираются в одном порядке, чтобы результат был стабильным
+		types := make([]string, 0, len(s.lists))
+		for threatType := range s.lists {
+			types = append(types, threatType)
+		}
+		sort.Strings(types)
+
+		for _, expr := range urlExpressions(raw) {
+			hash := sha256.Sum256([]byte(expr))
+			for _, threatType := range types {
+				if s.lists[threatType].contains(hash) {
+					return threatType
+				}
+			}
+		}
+	}
+
+	for _, rule := range s.rules {
+		if rule.MatchString(raw) {
+			return ThreatPattern
+		}
+	}
+	return ""
+}
+
+// loadRules читает регулярные выражения из файла. Для пустого пути возвращает nil.
+func loadRules(path string) ([]*regexp.Regexp, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []*regexp.Regexp
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		rule, err := regexp.Compile(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
@@ -0,0 +1,90 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeUpdate сохраняет файл обновления с 4-байтовыми префиксами хешей выражений.
+func writeUpdate(t *testing.T, dir, name, responseType, threatType string, exprs []string, removals []int) string {
+	t.Helper()
+	var raw []byte
+	for _, expr := range exprs {
+		sum := sha256.Sum256([]byte(expr))
+		raw = append(raw, sum[:4]...)
+	}
+	update := map[string]any{
+		"threatType":   threatType,
+		"responseType": responseType,
+		"additions": []any{map[string]any{
+			"compressionType": "RAW",
+			"rawHashes":       map[string]any{"prefixSize": 4, "rawHashes": raw},
+		}},
+	}
+	if removals != nil {
+		update["removals"] = []any{map[string]any{
+			"compressionType": "RAW",
+			"rawIndices":      map[string]any{"indices": removals},
+		}}
+	}
+	data, err := json.Marshal(map[string]any{"listUpdateResponses": []any{update}})
+	require.NoError(t, err)
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	return path
+}
+
+func TestScanner_Check(t *testing.T) {
+	dir := t.TempDir()
+	full := writeUpdate(t, dir, "full.json", "FULL_UPDATE", "MALWARE", []string{"evil.example/", "phish.example/login/"}, nil)
+	rules := filepath.Join(dir, "rules.txt")
+	require.NoError(t, os.WriteFile(rules, []byte("# подозрительные шаблоны\n(?i)free-?bitcoin\n"), 0644))
+
+	s, err := New(Config{HashListPaths: []string{full}, RulesPath: rules})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{name: "host match", url: "https://evil.example/some/page?x=1", want: "MALWARE"},
+		{name: "subdomain match", url: "http://cdn.evil.example/", want: "MALWARE"},
+		{name: "path prefix match", url: "http://PHISH.example/login/form.html", want: "MALWARE"},
+		{name: "other path", url: "http://phish.example/about", want: ""},
+		{name: "regex rule", url: "https://example.com/Free-Bitcoin", want: ThreatPattern},
+		{name: "clean", url: "https://example.com/", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, s.Check(tt.url))
+		})
+	}
+}
+
+func TestScanner_PartialUpdate(t *testing.T) {
+	dir := t.TempDir()
+	full := writeUpdate(t, dir, "full.json", "FULL_UPDATE", "SOCIAL_ENGINEERING", []string{"a.example/"}, nil)
+	// единственный префикс списка имеет индекс 0 и удаляется частичным обновлением
+	partial := writeUpdate(t, dir, "partial.json", "PARTIAL_UPDATE", "SOCIAL_ENGINEERING", []string{"b.example/"}, []int{0})
+
+	s, err := New(Config{HashListPaths: []string{full, partial}})
+	require.NoError(t, err)
+
+	assert.Equal(t, "", s.Check("http://a.example/"))
+	assert.Equal(t, "SOCIAL_ENGINEERING", s.Check("http://b.example/"))
+}
+
+func TestURLExpressions(t *testing.T) {
+	got := urlExpressions("http://a.b.c/1/2.html?param=1")
+	assert.ElementsMatch(t, []string{
+		"a.b.c/1/2.html?param=1", "a.b.c/1/2.html", "a.b.c/", "a.b.c/1/",
+		"b.c/1/2.html?param=1", "b.c/1/2.html", "b.c/", "b.c/1/",
+	}, got)
+}
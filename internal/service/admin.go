@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/divanov-web/shorturl/internal/audit"
+	"github.com/divanov-web/shorturl/internal/storage"
+	"github.com/divanov-web/shorturl/internal/webhook"
+)
+
+// Ограничения поиска ссылок администратором.
+const (
+	adminScanPage         = 1000
+	DefaultAdminPageLimit = 100
+	MaxAdminPageLimit     = 1000
+	auditMemorySize       = 10000
+)
+
+// ErrUserBlocked Ошибка пользователь заблокирован администратором (от уровня сервиса)
+var ErrUserBlocked = errors.New("user is blocked (service)")
+
+// AdminFilter условия поиска ссылок администратором, пустые условия не проверяются.
+type AdminFilter struct {
+	// Query подстрока исходного URL без учёта регистра.
+	Query string
+	// Domain хост исходного URL, совпадают и его поддомены.
+	Domain string
+	// UserID владелец ссылки: пользователь или рабочее пространство (workspace:<id>).
+	UserID string
+}
+
+// match проверяет ссылку по условиям.
+func (f AdminFilter) match(link storage.UserURL) bool {
+	if f.UserID != "" && f.UserID != link.UserID {
+		return false
+	}
+	if f.Query != "" && !strings.Contains(strings.ToLower(link.OriginalURL), strings.ToLower(f.Query)) {
+		return false
+	}
+	if f.Domain == "" {
+		return true
+	}
+	u, err := url.Parse(link.OriginalURL)
+	if err != nil {
+		return false
+	}
+	host, domain := strings.ToLower(u.Hostname()), strings.ToLower(f.Domain)
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// AdminSearch ищет ссылки всех пользователей в порядке идентификаторов, начиная после after.
+// Возвращает до limit ссылок и курсор следующей страницы, пустой — если ссылок больше нет.
+func (s *URLService) AdminSearch(ctx context.Context, filter AdminFilter, after string, limit int) ([]storage.UserURL, string, error) {
+	if limit <= 0 || limit > MaxAdminPageLimit {
+		limit = DefaultAdminPageLimit
+	}
+	var result []storage.UserURL
+	cursor := after
+	for {
+		page, err := s.Repo.ListURLs(ctx, cursor, adminScanPage)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, link := range page {
+			cursor = link.ShortURL
+			if !filter.match(link) {
+				continue
+			}
+			result = append(result, link)
+			if len(result) == limit {
+				return result, cursor, nil
+			}
+		}
+		if len(page) < adminScanPage {
+			return result, "", nil
+		}
+	}
+}
+
+// AdminSetDisabled блокирует любую ссылку или снимает блокировку. Заблокированная ссылка отвечает 410.
+func (s *URLService) AdminSetDisabled(ctx context.Context, actor string, id string, disabled bool) error {
+	link, err := s.Repo.GetLink(ctx, id)
+	if err != nil {
+		return mapStorageError(err)
+	}
+	if err = s.Repo.SetDisabled(ctx, id, disabled); err != nil {
+		return mapStorageError(err)
+	}
+	action := audit.ActionLinkEnable
+	if disabled {
+		action = audit.ActionLinkDisable
+	}
+	s.audit(ctx, audit.Event{Actor: actor, Action: action, ShortURL: id, Target: link.UserID})
+	return nil
+}
+
+// AdminDeleteLink удаляет любую ссылку.
+func (s *URLService) AdminDeleteLink(ctx context.Context, actor string, id string) error {
+	link, err := s.Repo.GetLink(ctx, id)
+	if err != nil {
+		return mapStorageError(err)
+	}
+	if _, err = s.Repo.MarkAsDeleted(ctx, link.UserID, []string{id}); err != nil {
+		return err
+	}
+	s.audit(ctx, audit.Event{Actor: actor, Action: audit.ActionLinkDelete, ShortURL: id, Target: link.UserID})
+	s.publish(webhook.Event{Type: webhook.EventLinkDeleted, Owner: link.UserID, ShortURL: id, OriginalURL: link.OriginalURL})
+	return nil
+}
+
+// AdminBlockUser запрещает пользователю создавать ссылки или снимает запрет. Уже созданные ссылки продолжают работать.
+func (s *URLService) AdminBlockUser(ctx context.Context, actor string, userID string, blocked bool) error {
+	settings, err := s.Repo.GetUserSettings(ctx, userID)
+	if err != nil {
+		return err
+	}
+	settings.Blocked = blocked
+	if err = s.Repo.SetUserSettings(ctx, userID, settings); err != nil {
+		return err
+	}
+	action := audit.ActionUserUnblock
+	if blocked {
+		action = audit.ActionUserBlock
+	}
+	s.audit(ctx, audit.Event{Actor: actor, Action: action, Target: userID})
+	return nil
+}
+
+// AuditEvents возвращает записи журнала действий от новых к старым.
+func (s *URLService) AuditEvents(ctx context.Context, filter audit.Filter) ([]audit.Event, error) {
+	return s.Audit.Query(ctx, filter)
+}
+
+// CreateOwner возвращает владельца новых ссылок пользователя так же, как LinkOwner с ролью editor.
+// Заблокированному пользователю возвращает ErrUserBlocked.
+func (s *URLService) CreateOwner(ctx context.Context, userID string, workspaceID string) (string, error) {
+	if err := s.checkNotBlocked(ctx, userID); err != nil {
+		return "", err
+	}
+	return s.LinkOwner(ctx, userID, workspaceID, storage.RoleEditor)
+}
+
+// checkNotBlocked возвращает ErrUserBlocked, если пользователь заблокирован администратором.
+// Заблокированный пользователь не создаёт ссылки и не меняет, куда ведут существующие.
+func (s *URLService) checkNotBlocked(ctx context.Context, userID string) error {
+	settings, err := s.Repo.GetUserSettings(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if settings.Blocked {
+		return ErrUserBlocked
+	}
+	return nil
+}
+
+// recordCreated записывает в журнал ссылки, созданные батчем, и сообщает о них подписчикам.
+func (s *URLService) recordCreated(ctx context.Context, userID string, entries []storage.BatchEntry, saved []storage.BatchResult) {
+	author := actor(ctx, userID)
+	for j, res := range saved {
+		if res.Status == storage.BatchCreated {
+			s.audit(ctx, audit.Event{Actor: author, Action: audit.ActionLinkCreate, ShortURL: res.ShortURL, Target: userID})
+			s.publish(webhook.Event{Type: webhook.EventLinkCreated, Owner: userID, ShortURL: res.ShortURL, OriginalURL: entries[j].OriginalURL})
+		}
+	}
+}
+
+// actor возвращает автора действий запроса из контекста, а если он не задан — fallback.
+// Для ссылок рабочего пространства владелец и автор различаются, поэтому автора берём из контекста.
+func actor(ctx context.Context, fallback string) string {
+	if a := audit.ActorFrom(ctx); a != "" {
+		return a
+	}
+	return fallback
+}
+
+// audit записывает действие в журнал. Ошибка журнала не отменяет уже выполненное действие.
+func (s *URLService) audit(ctx context.Context, e audit.Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	_ = s.Audit.Record(ctx, e)
+}
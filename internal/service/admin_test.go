@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/divanov-web/shorturl/internal/audit"
+	"github.com/divanov-web/shorturl/internal/storage"
+	"github.com/divanov-web/shorturl/internal/storage/memorystorage"
+)
+
+func TestURLService_Admin(t *testing.T) {
+	ctx := context.Background()
+	store := memorystorage.NewTestStorage()
+	svc := NewURLService(ctx, "http://sho.rt", store)
+
+	var ids []string
+	for _, c := range []struct{ user, url string }{
+		{"alice", "https://example.com/a"},
+		{"alice", "https://shop.example.com/b"},
+		{"bob", "https://other.org/Example"},
+		{"bob", "https://notexample.com/"},
+	} {
+		short, err := svc.CreateShort(ctx, c.user, c.url)
+		require.NoError(t, err)
+		ids = append(ids, short[len("http://sho.rt/"):])
+	}
+
+	// поиск по домену учитывает поддомены, но не совпадение хвоста имени
+	links, next, err := svc.AdminSearch(ctx, AdminFilter{Domain: "example.com"}, "", 0)
+	require.NoError(t, err)
+	assert.Empty(t, next)
+	assert.Len(t, links, 2)
+
+	links, _, err = svc.AdminSearch(ctx, AdminFilter{Query: "example", UserID: "bob"}, "", 0)
+	require.NoError(t, err)
+	assert.Len(t, links, 2)
+
+	// постраничный обход возвращает все ссылки ровно один раз
+	seen := map[string]bool{}
+	after := ""
+	for {
+		page, next, err := svc.AdminSearch(ctx, AdminFilter{}, after, 3)
+		require.NoError(t, err)
+		for _, link := range page {
+			assert.False(t, seen[link.ShortURL])
+			seen[link.ShortURL] = true
+		}
+		if next == "" {
+			break
+		}
+		after = next
+	}
+	assert.Len(t, seen, len(ids))
+
+	// заблокированная ссылка отвечает ErrGone, после снятия блокировки снова работает
+	require.NoError(t, svc.AdminSetDisabled(ctx, "user:root", ids[0], true))
+	_, err = svc.ResolveLink(ctx, ids[0])
+	assert.ErrorIs(t, err, ErrGone)
+	require.NoError(t, svc.AdminSetDisabled(ctx, "user:root", ids[0], false))
+	_, err = svc.ResolveLink(ctx, ids[0])
+	assert.NoError(t, err)
+	assert.ErrorIs(t, svc.AdminSetDisabled(ctx, "user:root", "missing", true), ErrNotFound)
+
+	require.NoError(t, svc.AdminDeleteLink(ctx, "api-key:1", ids[2]))
+	_, err = svc.ResolveLink(ctx, ids[2])
+	assert.ErrorIs(t, err, ErrGone)
+
+	// заблокированный пользователь не создаёт ссылки, созданные продолжают работать
+	require.NoError(t, svc.AdminBlockUser(ctx, "user:root", "alice", true))
+	_, err = svc.CreateOwner(ctx, "alice", "")
+	assert.ErrorIs(t, err, ErrUserBlocked)
+	_, err = svc.ResolveLink(ctx, ids[1])
+	assert.NoError(t, err)
+	// но и не меняет, куда они ведут
+	assert.ErrorIs(t, svc.UpdateShort(ctx, "alice", ids[1], "https://evil.example/"), ErrUserBlocked)
+	assert.ErrorIs(t, svc.SetLinkOptions(ctx, "alice", ids[1], storage.LinkOptions{
+		Variants: []storage.Variant{{Name: "a", URL: "https://evil.example/a", Weight: 1}, {Name: "b", URL: "https://evil.example/b", Weight: 1}},
+	}), ErrUserBlocked)
+	owner, err := svc.CreateOwner(ctx, "bob", "")
+	require.NoError(t, err)
+	assert.Equal(t, "bob", owner)
+	require.NoError(t, svc.AdminBlockUser(ctx, "user:root", "alice", false))
+	_, err = svc.CreateOwner(ctx, "alice", "")
+	assert.NoError(t, err)
+
+	events, err := svc.AuditEvents(ctx, audit.Filter{Actor: "user:root"})
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+	assert.Equal(t, audit.ActionUserUnblock, events[0].Action)
+	assert.Equal(t, "alice", events[0].Target)
+	assert.Equal(t, audit.ActionLinkDisable, events[3].Action)
+	assert.Equal(t, ids[0], events[3].ShortURL)
+
+	events, err = svc.AuditEvents(ctx, audit.Filter{ShortURL: ids[2], Action: audit.ActionLinkDelete})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, audit.Event{Time: events[0].Time, Actor: "api-key:1", Action: audit.ActionLinkDelete, ShortURL: ids[2], Target: "bob"}, events[0])
+}
+
+func TestURLService_Audit(t *testing.T) {
+	ctx := context.Background()
+	store := memorystorage.NewTestStorage()
+	svc := NewURLService(ctx, "http://sho.rt", store)
+	actions := func(f audit.Filter) []string {
+		events, err := svc.AuditEvents(ctx, f)
+		require.NoError(t, err)
+		var result []string
+		for _, e := range events {
+			result = append(result, e.Action+" "+e.Detail)
+		}
+		return result
+	}
+
+	short, err := svc.CreateShort(ctx, "alice", "https://a.com/")
+	require.NoError(t, err)
+	id := short[len("http://sho.rt/"):]
+	_, err = svc.CreateShort(ctx, "alice", "https://a.com/")
+	require.ErrorIs(t, err, ErrAlreadyExists)
+
+	require.NoError(t, svc.UpdateShort(ctx, "alice", id, "https://b.com/"))
+	require.NoError(t, svc.SetLinkOptions(ctx, "alice", id, storage.LinkOptions{RedirectCode: 301}))
+	require.NoError(t, svc.SetLinkPassword(ctx, "alice", id, "secret"))
+	require.NoError(t, svc.SetLinkMeta(ctx, "alice", id, storage.LinkMeta{Title: "B"}))
+	assert.ErrorIs(t, svc.UpdateShort(ctx, "bob", id, "https://c.com/"), ErrForbidden)
+
+	// чужие ссылки не удаляются и в журнал не попадают, повторное удаление не записывается
+	require.NoError(t, svc.DeleteUserURLs(ctx, "bob", []string{id}))
+	require.NoError(t, svc.DeleteUserURLs(ctx, "alice", []string{id, "missing"}))
+	require.NoError(t, svc.DeleteUserURLs(ctx, "alice", []string{id}))
+	require.NoError(t, svc.RestoreUserURL(ctx, "alice", id))
+	require.NoError(t, svc.RestoreUserURL(ctx, "alice", id))
+	_, err = svc.ResolveLink(ctx, id)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"link.restore ",
+		"link.delete ",
+		"link.update meta",
+		"link.update password",
+		"link.update options",
+		"link.update url",
+		"link.create ",
+	}, actions(audit.Filter{ShortURL: id}))
+	assert.Empty(t, actions(audit.Filter{Actor: "bob"}))
+
+	// автор ссылки рабочего пространства берётся из контекста, владелец — рабочее пространство
+	ws, err := svc.CreateWorkspace(ctx, "alice", "Команда")
+	require.NoError(t, err)
+	owner, err := svc.CreateOwner(ctx, "alice", ws.ID)
+	require.NoError(t, err)
+	results, err := svc.CreateShortBatch(audit.WithActor(ctx, "alice"), owner, []BatchRequestItem{
+		{CorrelationID: "1", OriginalURL: "https://w.com/1"},
+		{CorrelationID: "2", OriginalURL: "https://w.com/2"},
+	}, BatchAtomic)
+	require.NoError(t, err)
+	events, err := svc.AuditEvents(ctx, audit.Filter{Target: owner})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "alice", events[0].Actor)
+
+	// асинхронное удаление тоже попадает в журнал с автором запроса
+	wsID := results[0].ShortURL[len("http://sho.rt/"):]
+	svc.DeleteShortURLsAsync(audit.WithActor(ctx, "alice"), owner, []string{wsID})
+	require.Eventually(t, func() bool {
+		events, err := svc.AuditEvents(ctx, audit.Filter{Action: audit.ActionLinkDelete, Target: owner})
+		return err == nil && len(events) == 1 && events[0].Actor == "alice" && events[0].ShortURL == wsID
+	}, 3*time.Second, 50*time.Millisecond)
+
+	// восстановление не проходит, если тот же URL сокращён заново
+	require.NoError(t, svc.DeleteUserURLs(ctx, "alice", []string{id}))
+	_, err = svc.CreateShort(ctx, "alice", "https://b.com/")
+	require.NoError(t, err)
+	assert.ErrorIs(t, svc.RestoreUserURL(ctx, "alice", id), ErrAlreadyExists)
+	assert.ErrorIs(t, svc.RestoreUserURL(ctx, "bob", id), ErrForbidden)
+}
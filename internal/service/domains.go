@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/divanov-web/shorturl/internal/storage"
+)
+
+// defaultDomain короткий домен BaseURL, используется для ссылок без собственного домена.
+func (s *URLService) defaultDomain() string {
+	if base, err := url.Parse(s.BaseURL); err == nil {
+		return strings.ToLower(base.Host)
+	}
+	return ""
+}
+
+// AvailableDomains возвращает короткие домены сервиса, первым — домен по умолчанию.
+func (s *URLService) AvailableDomains() []string {
+	def := s.defaultDomain()
+	domains := []string{def}
+	for _, d := range s.Domains {
+		if d = strings.ToLower(d); d != def {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+// LinkBaseURL возвращает адрес сервиса на коротком домене, пустой домен — BaseURL.
+func (s *URLService) LinkBaseURL(domain string) string {
+	if domain == "" || domain == s.defaultDomain() {
+		return s.BaseURL
+	}
+	scheme := "http"
+	if base, err := url.Parse(s.BaseURL); err == nil && base.Scheme != "" {
+		scheme = base.Scheme
+	}
+	return scheme + "://" + domain
+}
+
+// ShortURL возвращает полную короткую ссылку на её домене.
+func (s *URLService) ShortURL(link storage.UserURL) string {
+	return s.LinkBaseURL(link.Domain) + "/" + link.ShortURL
+}
+
+// canonicalDomain проверяет, что домен входит в список коротких доменов, и приводит его к виду,
+// в котором он хранится у ссылки: домен по умолчанию хранится пустой строкой.
+func (s *URLService) canonicalDomain(domain string) (string, bool) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if domain == "" || domain == s.defaultDomain() {
+		return "", true
+	}
+	for _, d := range s.Domains {
+		if strings.ToLower(d) == domain {
+			return domain, true
+		}
+	}
+	return "", false
+}
+
+// domainForHost возвращает короткий домен, на который пришёл запрос. Запросы на неизвестные адреса
+// (например, по IP) относятся к домену по умолчанию. Домен без порта совпадает с Host на любом порту.
+func (s *URLService) domainForHost(host string) string {
+	host = strings.ToLower(host)
+	hostname := host
+	if h, _, ok := strings.Cut(host, ":"); ok && !strings.HasPrefix(host, "[") {
+		hostname = h
+	}
+	for _, d := range s.Domains {
+		d = strings.ToLower(d)
+		if d == host || (!strings.Contains(d, ":") && d == hostname) {
+			if d == s.defaultDomain() {
+				return ""
+			}
+			return d
+		}
+	}
+	return ""
+}
+
+// ResolveLinkOnHost возвращает ссылку как ResolveLink, но только если она привязана к домену запроса.
+// Ссылка другого домена считается несуществующей.
+func (s *URLService) ResolveLinkOnHost(ctx context.Context, id string, host string) (storage.UserURL, error) {
+	link, err := s.ResolveLink(ctx, id)
+	if err == nil && link.Domain != s.domainForHost(host) {
+		return storage.UserURL{}, ErrNotFound
+	}
+	return link, err
+}
+
+// GetUserSettings возвращает настройки пользователя.
+func (s *URLService) GetUserSettings(ctx context.Context, userID string) (storage.UserSettings, error) {
+	return s.Repo.GetUserSettings(ctx, userID)
+}
+
+// SetUserDefaultDomain задаёт короткий домен новых ссылок пользователя.
+// Для домена не из списка коротких доменов возвращает ErrInvalidOptions.
+func (s *URLService) SetUserDefaultDomain(ctx context.Context, userID string, domain string) error {
+	domain, ok := s.canonicalDomain(domain)
+	if !ok {
+		return ErrInvalidOptions
+	}
+	settings, err := s.Repo.GetUserSettings(ctx, userID)
+	if err != nil {
+		return err
+	}
+	settings.DefaultDomain = domain
+	return s.Repo.SetUserSettings(ctx, userID, settings)
+}
+
+// linkDomain выбирает домен новой ссылки: переданный явно или домен пользователя по умолчанию.
+// Домен по умолчанию, убранный из конфигурации, заменяется доменом BaseURL.
+func (s *URLService) linkDomain(ctx context.Context, userID string, requested string) (string, error) {
+	if requested != "" {
+		domain, ok := s.canonicalDomain(requested)
+		if !ok {
+			return "", ErrInvalidOptions
+		}
+		return domain, nil
+	}
+	settings, err := s.Repo.GetUserSettings(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	domain, _ := s.canonicalDomain(settings.DefaultDomain)
+	return domain, nil
+}
+
+// existingShortURL возвращает полную короткую ссылку уже сохранённой ссылки на её домене.
+func (s *URLService) existingShortURL(ctx context.Context, id string) string {
+	if link, err := s.Repo.GetLink(ctx, id); err == nil {
+		return s.ShortURL(link)
+	}
+	return s.BaseURL + "/" + id
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/divanov-web/shorturl/internal/storage/memorystorage"
+)
+
+func TestURLService_Domains(t *testing.T) {
+	ctx := context.Background()
+	svc := NewURLService(ctx, "https://sho.rt", memorystorage.NewTestStorage())
+	svc.Domains = []string{"go.example", "Promo.Example"}
+
+	assert.Equal(t, []string{"sho.rt", "go.example", "promo.example"}, svc.AvailableDomains())
+
+	short, err := svc.CreateShortWithParams(ctx, "u1", "https://a.com/", CreateParams{})
+	require.NoError(t, err)
+	assert.Regexp(t, `^https://sho\.rt/`, short)
+
+	short, err = svc.CreateShortWithParams(ctx, "u1", "https://b.com/", CreateParams{Domain: "GO.example"})
+	require.NoError(t, err)
+	assert.Regexp(t, `^https://go\.example/`, short)
+	id := short[len("https://go.example/"):]
+
+	_, err = svc.CreateShortWithParams(ctx, "u1", "https://c.com/", CreateParams{Domain: "evil.example"})
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+
+	// ссылка открывается только на своём домене, порт в Host не мешает
+	_, err = svc.ResolveLinkOnHost(ctx, id, "go.example:443")
+	require.NoError(t, err)
+	_, err = svc.ResolveLinkOnHost(ctx, id, "sho.rt")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = svc.ResolveLinkOnHost(ctx, id, "127.0.0.1:8080")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// домен пользователя по умолчанию применяется к новым ссылкам и пачкам
+	assert.ErrorIs(t, svc.SetUserDefaultDomain(ctx, "u1", "evil.example"), ErrInvalidOptions)
+	require.NoError(t, svc.SetUserDefaultDomain(ctx, "u1", "promo.example"))
+	short, err = svc.CreateShortWithParams(ctx, "u1", "https://d.com/", CreateParams{})
+	require.NoError(t, err)
+	assert.Regexp(t, `^https://promo\.example/`, short)
+
+	results, err := svc.CreateShortBatch(ctx, "u1", []BatchRequestItem{{CorrelationID: "1", OriginalURL: "https://e.com/"}}, BatchAtomic)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Regexp(t, `^https://promo\.example/`, results[0].ShortURL)
+
+	// существующая ссылка возвращается на своём домене
+	short, err = svc.CreateShortWithParams(ctx, "u1", "https://b.com/", CreateParams{})
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+	assert.Equal(t, "https://go.example/"+id, short)
+}
+
+func TestCreateShortWithParams_DomainStored(t *testing.T) {
+	ctx := context.Background()
+	store := memorystorage.NewTestStorage()
+	svc := NewURLService(ctx, "https://sho.rt", store)
+	svc.Domains = []string{"go.example"}
+
+	// домен сохраняется вместе со ссылкой, без отдельного обновления
+	short, err := svc.CreateShortWithParams(ctx, "u1", "https://a.com/", CreateParams{Domain: "go.example"})
+	require.NoError(t, err)
+	link, err := store.GetLink(ctx, short[len("https://go.example/"):])
+	require.NoError(t, err)
+	assert.Equal(t, "go.example", link.Domain)
+
+	require.NoError(t, svc.SetUserDefaultDomain(ctx, "u1", "go.example"))
+	results, err := svc.CreateShortBatch(ctx, "u1", []BatchRequestItem{{CorrelationID: "1", OriginalURL: "https://b.com/"}}, BatchAtomic)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	link, err = store.GetLink(ctx, results[0].ShortURL[len("https://go.example/"):])
+	require.NoError(t, err)
+	assert.Equal(t, "go.example", link.Domain)
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/divanov-web/shorturl/internal/audit"
+	"github.com/divanov-web/shorturl/internal/storage"
+)
+
+// Ограничения тегов, папки, заголовка и заметки ссылки.
+const (
+	maxTags         = 20
+	maxTagLength    = 50
+	maxFolderLength = 100
+	maxTitleLength  = 200
+	maxNoteLength   = 2000
+)
+
+// URLFilter условия отбора ссылок пользователя, пустые условия не проверяются.
+type URLFilter struct {
+	Tag    string
+	Folder string
+}
+
+// match проверяет ссылку по условиям. Теги и папка сравниваются без учёта регистра.
+func (f URLFilter) match(link storage.UserURL) bool {
+	if f.Folder != "" && !strings.EqualFold(f.Folder, link.Folder) {
+		return false
+	}
+	if f.Tag == "" {
+		return true
+	}
+	for _, tag := range link.Tags {
+		if strings.EqualFold(f.Tag, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetLinkMeta заменяет теги, папку, заголовок и заметку ссылки владельца.
+func (s *URLService) SetLinkMeta(ctx context.Context, userID string, id string, meta storage.LinkMeta) error {
+	meta, err := prepareMeta(meta)
+	if err != nil {
+		return err
+	}
+	_, owner, err := s.linkAccess(ctx, userID, id, storage.RoleEditor)
+	if err != nil {
+		return err
+	}
+	if err = s.Repo.SetMeta(ctx, owner, id, meta); err != nil {
+		return mapStorageError(err)
+	}
+	s.audit(ctx, audit.Event{Actor: userID, Action: audit.ActionLinkUpdate, ShortURL: id, Target: owner, Detail: "meta"})
+	return nil
+}
+
+// prepareMeta обрезает пробелы, убирает пустые и повторные теги и проверяет длины.
+func prepareMeta(meta storage.LinkMeta) (storage.LinkMeta, error) {
+	var tags []string
+	seen := make(map[string]bool, len(meta.Tags))
+	for _, tag := range meta.Tags {
+		tag = strings.TrimSpace(tag)
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return storage.LinkMeta{}, ErrInvalidOptions
+		}
+		seen[key] = true
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxTags {
+		return storage.LinkMeta{}, ErrInvalidOptions
+	}
+
+	result := storage.LinkMeta{
+		Tags:   tags,
+		Folder: strings.TrimSpace(meta.Folder),
+		Title:  strings.TrimSpace(meta.Title),
+		Note:   strings.TrimSpace(meta.Note),
+	}
+	if utf8.RuneCountInString(result.Folder) > maxFolderLength ||
+		utf8.RuneCountInString(result.Title) > maxTitleLength ||
+		utf8.RuneCountInString(result.Note) > maxNoteLength {
+		return storage.LinkMeta{}, ErrInvalidOptions
+	}
+	return result, nil
+}
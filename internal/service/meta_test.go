@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/divanov-web/shorturl/internal/storage"
+	"github.com/divanov-web/shorturl/internal/storage/memorystorage"
+)
+
+func TestPrepareMeta(t *testing.T) {
+	meta, err := prepareMeta(storage.LinkMeta{
+		Tags:   []string{" promo ", "", "Promo", "q3"},
+		Folder: " campaigns ",
+		Title:  "Лендинг",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, storage.LinkMeta{Tags: []string{"promo", "q3"}, Folder: "campaigns", Title: "Лендинг"}, meta)
+
+	_, err = prepareMeta(storage.LinkMeta{Tags: []string{strings.Repeat("x", maxTagLength+1)}})
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+	_, err = prepareMeta(storage.LinkMeta{Note: strings.Repeat("я", maxNoteLength+1)})
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+	tags := make([]string, maxTags+1)
+	for i := range tags {
+		tags[i] = strings.Repeat("t", i+1)
+	}
+	_, err = prepareMeta(storage.LinkMeta{Tags: tags})
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+}
+
+func TestURLService_GetUserURLsFilter(t *testing.T) {
+	ctx := context.Background()
+	svc := NewURLService(ctx, "http://sho.rt", memorystorage.NewTestStorage())
+	_, err := svc.CreateShortWithParams(ctx, "u1", "https://a.com/", CreateParams{Meta: storage.LinkMeta{Tags: []string{"Promo"}, Folder: "ads"}})
+	require.NoError(t, err)
+	_, err = svc.CreateShortWithParams(ctx, "u1", "https://b.com/", CreateParams{Meta: storage.LinkMeta{Tags: []string{"docs"}}})
+	require.NoError(t, err)
+	_, err = svc.CreateShort(ctx, "u1", "https://c.com/")
+	require.NoError(t, err)
+
+	all, err := svc.GetUserURLs(ctx, "u1", URLFilter{})
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	promo, err := svc.GetUserURLs(ctx, "u1", URLFilter{Tag: "promo"})
+	require.NoError(t, err)
+	require.Len(t, promo, 1)
+	assert.Equal(t, "https://a.com/", promo[0].OriginalURL)
+
+	docs, err := svc.GetUserURLs(ctx, "u1", URLFilter{Tag: "docs", Folder: "ads"})
+	require.NoError(t, err)
+	assert.Empty(t, docs)
+}
+
+func TestCreateShortWithParams_Meta(t *testing.T) {
+	ctx := context.Background()
+	store := memorystorage.NewTestStorage()
+	svc := NewURLService(ctx, "http://sho.rt", store)
+
+	short, err := svc.CreateShortWithParams(ctx, "u1", "https://a.com/", CreateParams{Meta: storage.LinkMeta{Tags: []string{"Promo"}, Title: "A"}})
+	require.NoError(t, err)
+	link, err := store.GetLink(ctx, short[len("http://sho.rt/"):])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Promo"}, link.Tags)
+	assert.Equal(t, "A", link.Title)
+
+	// сведения не меняют уже существующую ссылку на тот же URL
+	again, err := svc.CreateShortWithParams(ctx, "u1", "https://a.com/", CreateParams{Meta: storage.LinkMeta{Title: "B"}})
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+	assert.Equal(t, short, again)
+	link, err = store.GetLink(ctx, short[len("http://sho.rt/"):])
+	require.NoError(t, err)
+	assert.Equal(t, "A", link.Title)
+}
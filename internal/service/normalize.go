@@ -0,0 +1,173 @@
+package service
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// DefaultTrackingParams параметры запроса, которые удаляются при StripTracking.
+// Значение с * на конце задаёт префикс.
+var DefaultTrackingParams = []string{"utm_*", "fbclid", "gclid", "yclid", "mc_cid", "mc_eid", "_openstat"}
+
+// defaultPorts порты, которые не влияют на адрес и отбрасываются.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+}
+
+// URLNormalizer приводит URL к каноническому виду для дедупликации.
+// Исходный URL при этом не меняется: он хранится и используется для редиректа как есть.
+type URLNormalizer struct {
+	// StripTracking удалять параметры отслеживания из запроса.
+	StripTracking bool
+	// TrackingParams список параметров отслеживания, по умолчанию DefaultTrackingParams.
+	TrackingParams []string
+}
+
+// NewURLNormalizer конструктор нормализатора URL.
+func NewURLNormalizer(stripTracking bool, trackingParams []string) *URLNormalizer {
+	if len(trackingParams) == 0 {
+		trackingParams = DefaultTrackingParams
+	}
+	params := make([]string, len(trackingParams))
+	for i, param := range trackingParams {
+		params[i] = strings.ToLower(param)
+	}
+	return &URLNormalizer{StripTracking: stripTracking, TrackingParams: params}
+}
+
+// Normalize возвращает канонический вид URL: схема и хост в нижнем регистре,
+// хост в punycode, без порта по умолчанию, путь без . и .., параметры запроса отсортированы.
+func (n *URLNormalizer) Normalize(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	host := strings.TrimSuffix(u.Hostname(), ".")
+	if net.ParseIP(host) == nil {
+		ascii, err := idna.Lookup.ToASCII(host)
+		if err != nil {
+			return "", err
+		}
+		host = ascii
+	}
+	host = strings.ToLower(host)
+	port := u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+
+	path := removeDotSegments(u.EscapedPath())
+	if path == "" && u.Host != "" {
+		path = "/"
+	}
+	if u.RawPath != "" || path != u.EscapedPath() {
+		unescaped, err := url.PathUnescape(path)
+		if err != nil {
+			return "", err
+		}
+		u.Path, u.RawPath = unescaped, path
+	}
+
+	u.RawQuery = n.normalizeQuery(u.RawQuery)
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+// normalizeQuery сортирует параметры запроса и при необходимости удаляет параметры отслеживания.
+// Значения не перекодируются, чтобы не менять смысл запроса.
+func (n *URLNormalizer) normalizeQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	pairs := strings.Split(rawQuery, "&")
+	kept := pairs[:0]
+	for _, pair := range pairs {
+		if pair == "" {
+			continue
+		}
+		if n.StripTracking {
+			key, _, _ := strings.Cut(pair, "=")
+			if name, err := url.QueryUnescape(key); err == nil && n.isTracking(name) {
+				continue
+			}
+		}
+		kept = append(kept, pair)
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		ki, _, _ := strings.Cut(kept[i], "=")
+		kj, _, _ := strings.Cut(kept[j], "=")
+		if ki != kj {
+			return ki < kj
+		}
+		return kept[i] < kept[j]
+	})
+	return strings.Join(kept, "&")
+}
+
+// isTracking проверяет, является ли параметр параметром отслеживания.
+func (n *URLNormalizer) isTracking(name string) bool {
+	name = strings.ToLower(name)
+	for _, param := range n.TrackingParams {
+		if prefix, ok := strings.CutSuffix(param, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+			continue
+		}
+		if name == param {
+			return true
+		}
+	}
+	return false
+}
+
+// removeDotSegments удаляет сегменты . и .. из пути (RFC 3986, раздел 5.2.4).
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+	in := strings.Split(path, "/")
+	out := make([]string, 0, len(in))
+	for i, seg := range in {
+		last := i == len(in)-1
+		switch seg {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			// первый элемент — пустой префикс абсолютного пути, его не удаляем
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, seg)
+		}
+	}
+	result := strings.Join(out, "/")
+	if strings.HasPrefix(path, "/") && !strings.HasPrefix(result, "/") {
+		result = "/" + result
+	}
+	return result
+}
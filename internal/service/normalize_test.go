@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/divanov-web/shorturl/internal/storage/memorystorage"
+)
+
+func TestURLNormalizer_Normalize(t *testing.T) {
+	n := NewURLNormalizer(true, nil)
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{name: "case", url: "HTTP://Example.COM/Path", want: "http://example.com/Path"},
+		{name: "default port", url: "https://example.com:443/a", want: "https://example.com/a"},
+		{name: "custom port", url: "http://example.com:8080/a", want: "http://example.com:8080/a"},
+		{name: "empty path", url: "http://example.com", want: "http://example.com/"},
+		{name: "dot segments", url: "http://example.com/a/./b/../c", want: "http://example.com/a/c"},
+		{name: "dot segments above root", url: "http://example.com/../a", want: "http://example.com/a"},
+		{name: "idn", url: "http://пример.рф/", want: "http://xn--e1afmkfd.xn--p1ai/"},
+		{name: "query order", url: "http://example.com/?b=2&a=1&a=0", want: "http://example.com/?a=0&a=1&b=2"},
+		{name: "tracking", url: "http://example.com/?utm_source=x&id=5&fbclid=y", want: "http://example.com/?id=5"},
+		{name: "fragment kept", url: "http://example.com/p#top", want: "http://example.com/p#top"},
+		{name: "escaped path kept", url: "http://example.com/a%2Fb", want: "http://example.com/a%2Fb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := n.Normalize(tt.url)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCreateShort_DedupByNormalizedURL(t *testing.T) {
+	ctx := context.Background()
+	svc := NewURLService(ctx, "http://sho.rt", memorystorage.NewTestStorage())
+
+	first, err := svc.CreateShort(ctx, "user1", "https://Example.com:443/a/./b?y=2&x=1")
+	require.NoError(t, err)
+
+	second, err := svc.CreateShort(ctx, "user1", "https://example.com/a/b?x=1&y=2")
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+	assert.Equal(t, first, second)
+
+	// для редиректа используется URL в том виде, в каком его прислали
+	original, ok := svc.ResolveShort(ctx, first[len("http://sho.rt/"):])
+	require.True(t, ok)
+	assert.Equal(t, "https://Example.com:443/a/./b?y=2&x=1", original)
+}
+
+func TestCreateShortWithParams_MaxClicksNoDedup(t *testing.T) {
+	ctx := context.Background()
+	store := memorystorage.NewTestStorage()
+	svc := NewURLService(ctx, "http://sho.rt", store)
+
+	plain, err := svc.CreateShort(ctx, "user1", "https://example.com/once")
+	require.NoError(t, err)
+
+	// ссылка с лимитом создаётся заново и сохраняется сразу с лимитом
+	limited, err := svc.CreateShortWithParams(ctx, "user1", "https://example.com/once", CreateParams{MaxClicks: 1})
+	require.NoError(t, err)
+	assert.NotEqual(t, plain, limited)
+	link, err := store.GetLink(ctx, limited[len("http://sho.rt/"):])
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), link.MaxClicks)
+	assert.Equal(t, int64(1), link.ClicksLeft)
+	assert.True(t, link.NoDedup)
+
+	existing, err := svc.CreateShort(ctx, "user1", "https://example.com/once")
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+	assert.Equal(t, plain, existing)
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrWrongPassword Ошибка неверный пароль ссылки (от уровня сервиса)
+var ErrWrongPassword = errors.New("wrong link password (service)")
+
+// ErrLinkLocked Ошибка ввод пароля ссылки временно заблокирован после неудачных попыток (от уровня сервиса)
+var ErrLinkLocked = errors.New("link password attempts locked (service)")
+
+// maxPasswordLength ограничение bcrypt: байты после 72-го не учитываются.
+const maxPasswordLength = 72
+
+// HashPassword возвращает bcrypt-хеш пароля ссылки.
+func HashPassword(password string) (string, error) {
+	if password == "" || len(password) > maxPasswordLength {
+		return "", ErrInvalidOptions
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// maxTrackedAttempts сколько пар ссылка-клиент отслеживается, прежде чем освобождать место под новые.
+const maxTrackedAttempts = 10000
+
+// passwordAttempts неудачные попытки ввода пароля одного клиента для одной ссылки.
+type passwordAttempts struct {
+	failures    int
+	lockedUntil time.Time
+	lastAttempt time.Time
+}
+
+// PasswordGuard проверяет пароли защищённых ссылок, блокирует подбор и выдаёт
+// подписанные токены доступа, чтобы не вводить пароль повторно.
+type PasswordGuard struct {
+	// MaxAttempts число неудачных попыток подряд до блокировки клиента на ссылке.
+	MaxAttempts int
+	// Lockout длительность блокировки.
+	Lockout time.Duration
+	// TokenTTL время жизни токена доступа.
+	TokenTTL time.Duration
+	secret   []byte
+	mu       sync.Mutex
+	attempts map[string]*passwordAttempts // id ссылки и клиент -> попытки
+	// maxTracked предел размера attempts, см. evict
+	maxTracked int
+	now        func() time.Time
+}
+
+// NewPasswordGuard создаёт проверку паролей ссылок. Пустой secret заменяется случайным,
+// тогда токены доступа перестают действовать после перезапуска.
+func NewPasswordGuard(secret string) *PasswordGuard {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		_, _ = rand.Read(key)
+	}
+	return &PasswordGuard{
+		MaxAttempts: 5,
+		Lockout:     15 * time.Minute,
+		TokenTTL:    time.Hour,
+		secret:      key,
+		attempts:    make(map[string]*passwordAttempts),
+		maxTracked:  maxTrackedAttempts,
+		now:         time.Now,
+	}
+}
+
+// Verify сверяет пароль с хешем ссылки. Попытки считаются отдельно для каждого клиента (обычно IP),
+// чтобы подбор с одного адреса не закрывал ссылку остальным. После MaxAttempts неудач подряд
+// клиент блокируется на ссылке на Lockout и возвращается ErrLinkLocked вместе со временем до разблокировки.
+func (g *PasswordGuard) Verify(id, client, hash, password string) (time.Duration, error) {
+	key := id + "\x00" + client
+	g.mu.Lock()
+	now := g.now()
+	state, ok := g.attempts[key]
+	if !ok {
+		if len(g.attempts) >= g.maxTracked {
+			g.evict(now)
+		}
+		state = &passwordAttempts{}
+		g.attempts[key] = state
+	}
+	if wait := state.lockedUntil.Sub(now); wait > 0 {
+		g.mu.Unlock()
+		return wait, ErrLinkLocked
+	}
+	// попытка засчитывается до сравнения: иначе параллельные запросы успевают пройти проверку блокировки
+	// раньше, чем учтётся хотя бы одна неудача, и получают больше MaxAttempts попыток
+	state.failures++
+	state.lastAttempt = now
+	if state.failures >= g.MaxAttempts {
+		state.failures = 0
+		state.lockedUntil = now.Add(g.Lockout)
+	}
+	g.mu.Unlock()
+
+	// bcrypt медленный, сравниваем вне блокировки
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return 0, ErrWrongPassword
+	}
+	// верный пароль возвращает засчитанную попытку и сбрасывает счётчик клиента
+	g.mu.Lock()
+	delete(g.attempts, key)
+	g.mu.Unlock()
+	return 0, nil
+}
+
+// evict освобождает место в attempts. Удаляются записи без блокировки, по которым не было попыток
+// дольше Lockout, а если таких нет — самая давняя из них. Действующие блокировки не сбрасываются,
+// а чтобы вытеснить свой счётчик, нужно сделать попытки с maxTracked других ключей.
+func (g *PasswordGuard) evict(now time.Time) {
+	oldestKey, oldest := "", time.Time{}
+	for key, state := range g.attempts {
+		if state.lockedUntil.After(now) {
+			continue
+		}
+		if now.Sub(state.lastAttempt) >= g.Lockout {
+			delete(g.attempts, key)
+			continue
+		}
+		if oldestKey == "" || state.lastAttempt.Before(oldest) {
+			oldestKey, oldest = key, state.lastAttempt
+		}
+	}
+	if len(g.attempts) >= g.maxTracked && oldestKey != "" {
+		delete(g.attempts, oldestKey)
+	}
+}
+
+// IssueToken выдаёт токен доступа к ссылке. Токен привязан к текущему хешу пароля,
+// поэтому смена пароля отзывает выданные токены.
+func (g *PasswordGuard) IssueToken(id, hash string) (string, time.Time) {
+	expires := g.now().Add(g.TokenTTL)
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return exp + "." + g.sign(id, hash, exp), expires
+}
+
+// ValidToken проверяет подпись и срок действия токена доступа.
+func (g *PasswordGuard) ValidToken(id, hash, token string) bool {
+	exp, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || g.now().Unix() >= unix {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(g.sign(id, hash, exp)))
+}
+
+// sign подписывает идентификатор ссылки, хеш её пароля и срок действия.
+func (g *PasswordGuard) sign(id, hash, exp string) string {
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write([]byte(id + "\x00" + hash + "\x00" + exp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/divanov-web/shorturl/internal/storage/memorystorage"
+)
+
+func TestPasswordGuard_Lockout(t *testing.T) {
+	hash, err := HashPassword("secret")
+	require.NoError(t, err)
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	g := NewPasswordGuard("key")
+	g.MaxAttempts = 3
+	g.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		_, err = g.Verify("abc", "10.0.0.1", hash, "wrong")
+		assert.ErrorIs(t, err, ErrWrongPassword)
+	}
+
+	// после блокировки не принимается даже верный пароль
+	wait, err := g.Verify("abc", "10.0.0.1", hash, "secret")
+	assert.ErrorIs(t, err, ErrLinkLocked)
+	assert.Equal(t, g.Lockout, wait)
+
+	// блокировка действует только на свою ссылку
+	_, err = g.Verify("other", "10.0.0.1", hash, "secret")
+	assert.NoError(t, err)
+
+	// и только на клиента, который подбирал пароль
+	_, err = g.Verify("abc", "10.0.0.2", hash, "secret")
+	assert.NoError(t, err)
+
+	now = now.Add(g.Lockout)
+	_, err = g.Verify("abc", "10.0.0.1", hash, "secret")
+	assert.NoError(t, err)
+}
+
+func TestPasswordGuard_Parallel(t *testing.T) {
+	hash, err := HashPassword("secret")
+	require.NoError(t, err)
+	g := NewPasswordGuard("key")
+	g.MaxAttempts = 3
+
+	// одновременные запросы не получают больше MaxAttempts попыток
+	const n = 10
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, verifyErr := g.Verify("abc", "10.0.0.1", hash, "wrong")
+			errs <- verifyErr
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	var wrong, locked int
+	for verifyErr := range errs {
+		switch {
+		case errors.Is(verifyErr, ErrWrongPassword):
+			wrong++
+		case errors.Is(verifyErr, ErrLinkLocked):
+			locked++
+		}
+	}
+	assert.Equal(t, 3, wrong)
+	assert.Equal(t, n-3, locked)
+}
+
+func TestPasswordGuard_Evict(t *testing.T) {
+	hash, err := HashPassword("secret")
+	require.NoError(t, err)
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	g := NewPasswordGuard("key")
+	g.MaxAttempts = 3
+	g.maxTracked = 3
+	g.now = func() time.Time { return now }
+	fail := func(client string, times int) {
+		for range times {
+			_, verifyErr := g.Verify("abc", client, hash, "wrong")
+			require.ErrorIs(t, verifyErr, ErrWrongPassword)
+		}
+	}
+
+	fail("old", 2)
+	now = now.Add(time.Second)
+	fail("recent", 2)
+	fail("locked", 3)
+
+	// новый ключ вытесняет только самую давнюю запись без блокировки
+	now = now.Add(time.Second)
+	fail("new", 1)
+	assert.NotContains(t, g.attempts, "abc\x00old")
+	_, err = g.Verify("abc", "locked", hash, "secret")
+	assert.ErrorIs(t, err, ErrLinkLocked)
+	fail("recent", 1)
+	_, err = g.Verify("abc", "recent", hash, "secret")
+	assert.ErrorIs(t, err, ErrLinkLocked, "счётчик клиента не сброшен")
+
+	// записи, по которым не было попыток дольше Lockout, и истёкшие блокировки удаляются все сразу
+	now = now.Add(g.Lockout)
+	fail("fresh", 1)
+	assert.Len(t, g.attempts, 1)
+	assert.Contains(t, g.attempts, "abc\x00fresh")
+}
+
+func TestPasswordGuard_Token(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	g := NewPasswordGuard("key")
+	g.now = func() time.Time { return now }
+
+	token, _ := g.IssueToken("abc", "hash1")
+	assert.True(t, g.ValidToken("abc", "hash1", token))
+	assert.False(t, g.ValidToken("xyz", "hash1", token), "токен другой ссылки")
+	assert.False(t, g.ValidToken("abc", "hash2", token), "пароль сменился")
+	assert.False(t, g.ValidToken("abc", "hash1", token+"0"), "подпись изменена")
+
+	now = now.Add(g.TokenTTL)
+	assert.False(t, g.ValidToken("abc", "hash1", token), "срок истёк")
+}
+
+func TestCreateShortWithParams_Password(t *testing.T) {
+	ctx := context.Background()
+	store := memorystorage.NewTestStorage()
+	svc := NewURLService(ctx, "http://sho.rt", store)
+	id := func(short string) string { return short[strings.LastIndex(short, "/")+1:] }
+
+	plain, err := svc.CreateShort(ctx, "alice", "https://a.com/")
+	require.NoError(t, err)
+
+	// ссылка с паролем не подменяется существующей и сохраняется сразу с паролем
+	protected, err := svc.CreateShortWithParams(ctx, "alice", "https://a.com/", CreateParams{Password: "secret"})
+	require.NoError(t, err)
+	assert.NotEqual(t, plain, protected)
+	link, err := store.GetLink(ctx, id(protected))
+	require.NoError(t, err)
+	assert.NotEmpty(t, link.Options.PasswordHash)
+
+	again, err := svc.CreateShortWithParams(ctx, "alice", "https://a.com/", CreateParams{Password: "secret"})
+	require.NoError(t, err)
+	assert.NotEqual(t, protected, again)
+
+	// обычное сокращение возвращает ссылку без пароля
+	existing, err := svc.CreateShort(ctx, "alice", "https://a.com/")
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+	assert.Equal(t, plain, existing)
+
+	// удалённую ссылку с паролем можно восстановить, даже если URL сокращён заново
+	require.NoError(t, svc.DeleteUserURLs(ctx, "alice", []string{id(protected)}))
+	require.Eventually(t, func() bool {
+		_, err := store.GetLink(ctx, id(protected))
+		return err != nil
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.NoError(t, svc.RestoreUserURL(ctx, "alice", id(protected)))
+}
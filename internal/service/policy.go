@@ -0,0 +1,255 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/divanov-web/shorturl/internal/utils/netguard"
+)
+
+// policyResolveTimeout сколько ждать DNS при проверке, не ведёт ли имя на частный адрес.
+const policyResolveTimeout = 2 * time.Second
+
+// Причины отказа политики URL, которые возвращаются клиенту.
+const (
+	ReasonMalformed        = "malformed"
+	ReasonTooLong          = "too_long"
+	ReasonSchemeNotAllowed = "scheme_not_allowed"
+	ReasonDomainBlocked    = "domain_blocked"
+	ReasonDomainNotAllowed = "domain_not_allowed"
+	ReasonPrivateHost      = "private_host"
+	ReasonSelfReference    = "self_reference"
+)
+
+// PolicyError нарушение политики URL с машинно-читаемой причиной.
+// errors.Is(err, ErrInvalidURL) для него истинно.
+type PolicyError struct {
+	Reason  string
+	Message string
+}
+
+// Error возвращает текст ошибки.
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("url rejected: %s", e.Reason)
+}
+
+// Is позволяет проверять нарушение политики через errors.Is(err, ErrInvalidURL).
+func (e *PolicyError) Is(target error) bool {
+	return target == ErrInvalidURL
+}
+
+// PolicyConfig настройки политики URL.
+type PolicyConfig struct {
+	// Schemes разрешённые схемы, пустой список разрешает любые.
+	Schemes []string
+	// BlocklistPath файл с запрещёнными доменами, по одному в строке.
+	BlocklistPath string
+	// AllowlistPath файл с разрешёнными доменами; если задан, остальные домены запрещены.
+	AllowlistPath string
+	// AllowPrivateHosts разрешает localhost, loopback и адреса частных сетей.
+	AllowPrivateHosts bool
+	// LookupIP резолвит имена при проверке частных адресов, nil — имена не резолвятся.
+	LookupIP func(ctx context.Context, host string) ([]net.IPAddr, error)
+	// MaxLength максимальная длина URL, 0 — без ограничения.
+	MaxLength int
+	// BaseURL собственный адрес сервиса, ссылки на него запрещены, чтобы не было циклов редиректа.
+	BaseURL string
+	// ShortDomains остальные короткие домены сервиса, ссылки на них запрещены так же, как на BaseURL.
+	ShortDomains []string
+}
+
+// URLPolicy проверяет отправленные пользователями URL. Списки доменов можно перечитать через Reload.
+type URLPolicy struct {
+	cfg       PolicyConfig
+	schemes   map[string]bool
+	selfHosts map[string]bool
+	mu        sync.RWMutex
+	blocked   map[string]bool
+	allowed   map[string]bool
+}
+
+// NewURLPolicy создаёт политику и загружает списки доменов.
+func NewURLPolicy(cfg PolicyConfig) (*URLPolicy, error) {
+	p := &URLPolicy{
+		cfg:       cfg,
+		schemes:   make(map[string]bool),
+		selfHosts: make(map[string]bool),
+	}
+	for _, scheme := range cfg.Schemes {
+		p.schemes[strings.ToLower(scheme)] = true
+	}
+	if base, err := url.Parse(cfg.BaseURL); err == nil && base.Host != "" {
+		p.selfHosts[hostKey(base)] = true
+		for _, domain := range cfg.ShortDomains {
+			p.selfHosts[hostKey(&url.URL{Scheme: base.Scheme, Host: domain})] = true
+		}
+	}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// DefaultPolicyConfig политика по умолчанию: http/https, без частных адресов, до 2048 символов.
+func DefaultPolicyConfig(baseURL string) PolicyConfig {
+	return PolicyConfig{
+		Schemes:   []string{"http", "https"},
+		MaxLength: 2048,
+		BaseURL:   baseURL,
+	}
+}
+
+// Reload перечитывает файлы списков доменов.
+func (p *URLPolicy) Reload() error {
+	blocked, err := loadDomainList(p.cfg.BlocklistPath)
+	if err != nil {
+		return fmt.Errorf("load domain blocklist: %w", err)
+	}
+	allowed, err := loadDomainList(p.cfg.AllowlistPath)
+	if err != nil {
+		return fmt.Errorf("load domain allowlist: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.blocked = blocked
+	p.allowed = allowed
+	return nil
+}
+
+// Check проверяет URL и возвращает *PolicyError, если он не проходит политику.
+func (p *URLPolicy) Check(raw string) error {
+	if p.cfg.MaxLength > 0 && len(raw) > p.cfg.MaxLength {
+		return &PolicyError{Reason: ReasonTooLong, Message: fmt.Sprintf("URL длиннее %d символов", p.cfg.MaxLength)}
+	}
+	if ValidateURL(raw) != nil {
+		return &PolicyError{Reason: ReasonMalformed, Message: "Некорректный URL"}
+	}
+	u, _ := url.Parse(raw)
+
+	if len(p.schemes) > 0 && !p.schemes[strings.ToLower(u.Scheme)] {
+		return &PolicyError{Reason: ReasonSchemeNotAllowed, Message: fmt.Sprintf("Схема %q не разрешена", u.Scheme)}
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "" {
+		return &PolicyError{Reason: ReasonMalformed, Message: "Некорректный URL"}
+	}
+	if p.selfHosts[hostKey(u)] {
+		return &PolicyError{Reason: ReasonSelfReference, Message: "Нельзя сокращать ссылки на сам сервис"}
+	}
+	if !p.cfg.AllowPrivateHosts && p.isPrivateHost(host) {
+		return &PolicyError{Reason: ReasonPrivateHost, Message: "Ссылки на локальные и частные адреса запрещены"}
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if matchDomain(p.blocked, host) {
+		return &PolicyError{Reason: ReasonDomainBlocked, Message: fmt.Sprintf("Домен %s запрещён", host)}
+	}
+	if p.allowed != nil && !matchDomain(p.allowed, host) {
+		return &PolicyError{Reason: ReasonDomainNotAllowed, Message: fmt.Sprintf("Домен %s не входит в список разрешённых", host)}
+	}
+	return nil
+}
+
+// hostKey хост с явным портом для сравнения адресов.
+func hostKey(u *url.URL) string {
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	port := u.Port()
+	if port == "" {
+		switch strings.ToLower(u.Scheme) {
+		case "https":
+			port = "443"
+		default:
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// isPrivateHost проверяет localhost, IP-адреса loopback, частных и служебных сетей, в том числе
+// числовые формы IPv4, и все адреса, в которые резолвится имя. Если имя не резолвится,
+// запрещать нечего: ошибка DNS нарушением не считается.
+func (p *URLPolicy) isPrivateHost(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	if ip := netguard.ParseIP(host); ip != nil {
+		return netguard.IsPrivateIP(ip)
+	}
+
+	if p.cfg.LookupIP == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), policyResolveTimeout)
+	defer cancel()
+	addrs, err := p.cfg.LookupIP(ctx, host)
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if netguard.IsPrivateIP(addr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDomain проверяет домен и все его родительские домены по списку.
+func matchDomain(list map[string]bool, host string) bool {
+	if len(list) == 0 {
+		return false
+	}
+	for {
+		if list[host] {
+			return true
+		}
+		_, parent, ok := strings.Cut(host, ".")
+		if !ok {
+			return false
+		}
+		host = parent
+	}
+}
+
+// loadDomainList читает файл доменов: по одному в строке, # — комментарий.
+// Для пустого пути возвращает nil.
+func loadDomainList(path string) (map[string]bool, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	list := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(line), "."))
+		if line != "" {
+			list[line] = true
+		}
+	}
+	return list, scanner.Err()
+}
+
+// PolicyReason возвращает причину и сообщение отказа политики или ReasonMalformed для прочих ошибок валидации.
+func PolicyReason(err error) (string, string) {
+	var pe *PolicyError
+	if errors.As(err, &pe) {
+		return pe.Reason, pe.Message
+	}
+	return ReasonMalformed, "Некорректный URL"
+}
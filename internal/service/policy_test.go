@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLPolicy_Check(t *testing.T) {
+	dir := t.TempDir()
+	blocklist := filepath.Join(dir, "blocklist.txt")
+	require.NoError(t, os.WriteFile(blocklist, []byte("# спам\nevil.com\n"), 0644))
+
+	cfg := DefaultPolicyConfig("http://sho.rt")
+	cfg.BlocklistPath = blocklist
+	cfg.MaxLength = 64
+	cfg.LookupIP = func(_ context.Context, host string) ([]net.IPAddr, error) {
+		switch host {
+		case "intranet.example.com":
+			return []net.IPAddr{{IP: net.ParseIP("10.0.0.5")}}, nil
+		case "mixed.example.com":
+			return []net.IPAddr{{IP: net.ParseIP("93.184.216.34")}, {IP: net.ParseIP("127.0.0.1")}}, nil
+		case "public.example.com":
+			return []net.IPAddr{{IP: net.ParseIP("93.184.216.34")}}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	policy, err := NewURLPolicy(cfg)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		url    string
+		reason string
+	}{
+		{name: "valid", url: "https://example.com/page", reason: ""},
+		{name: "malformed", url: "example.com", reason: ReasonMalformed},
+		{name: "javascript", url: "javascript://alert(1)", reason: ReasonSchemeNotAllowed},
+		{name: "file", url: "file://etc/passwd", reason: ReasonSchemeNotAllowed},
+		{name: "too long", url: "https://example.com/" + strings.Repeat("a", 64), reason: ReasonTooLong},
+		{name: "localhost", url: "http://localhost:8080/admin", reason: ReasonPrivateHost},
+		{name: "loopback ip", url: "http://127.0.0.1/", reason: ReasonPrivateHost},
+		{name: "private ip", url: "http://192.168.1.10/", reason: ReasonPrivateHost},
+		{name: "ipv6 loopback", url: "http://[::1]/", reason: ReasonPrivateHost},
+		{name: "ipv4-mapped loopback", url: "http://[::ffff:127.0.0.1]/", reason: ReasonPrivateHost},
+		{name: "decimal ip", url: "http://2130706433/", reason: ReasonPrivateHost},
+		{name: "hex ip", url: "http://0x7f.1/", reason: ReasonPrivateHost},
+		{name: "short ip", url: "http://127.1/", reason: ReasonPrivateHost},
+		{name: "octal ip", url: "http://0177.0.0.1/", reason: ReasonPrivateHost},
+		{name: "cgnat ip", url: "http://100.64.1.1/", reason: ReasonPrivateHost},
+		{name: "link-local ip", url: "http://169.254.169.254/latest/meta-data", reason: ReasonPrivateHost},
+		{name: "unspecified ip", url: "http://0.0.0.0/", reason: ReasonPrivateHost},
+		{name: "name resolves to private", url: "http://intranet.example.com/", reason: ReasonPrivateHost},
+		{name: "one of addresses private", url: "http://mixed.example.com/", reason: ReasonPrivateHost},
+		{name: "name resolves to public", url: "http://public.example.com/", reason: ""},
+		{name: "public ip", url: "http://93.184.216.34/", reason: ""},
+		{name: "self reference", url: "http://SHO.RT/abc", reason: ReasonSelfReference},
+		{name: "blocked subdomain", url: "https://www.evil.com/", reason: ReasonDomainBlocked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.url)
+			if tt.reason == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrInvalidURL)
+			reason, _ := PolicyReason(err)
+			assert.Equal(t, tt.reason, reason)
+		})
+	}
+}
+
+func TestURLPolicy_ReloadAllowlist(t *testing.T) {
+	dir := t.TempDir()
+	allowlist := filepath.Join(dir, "allowlist.txt")
+	require.NoError(t, os.WriteFile(allowlist, []byte("example.com\n"), 0644))
+
+	cfg := DefaultPolicyConfig("http://sho.rt")
+	cfg.AllowlistPath = allowlist
+	policy, err := NewURLPolicy(cfg)
+	require.NoError(t, err)
+
+	assert.NoError(t, policy.Check("https://docs.example.com/"))
+	assert.ErrorIs(t, policy.Check("https://other.org/"), ErrInvalidURL)
+
+	require.NoError(t, os.WriteFile(allowlist, []byte("example.com\nother.org\n"), 0644))
+	require.NoError(t, policy.Reload())
+	assert.NoError(t, policy.Check("https://other.org/"))
+}
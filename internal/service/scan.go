@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/divanov-web/shorturl/internal/storage"
+)
+
+// rescanPageSize сколько ссылок читается из хранилища за раз при перепроверке.
+const rescanPageSize = 500
+
+// scanLink проверяет только что созданную ссылку и отмечает её, если URL найден в списках угроз.
+func (s *URLService) scanLink(ctx context.Context, id string, original string) {
+	if s.Scanner == nil {
+		return
+	}
+	if threat := s.Scanner.Check(original); threat != "" {
+		_ = s.Repo.SetThreat(ctx, id, threat)
+	}
+}
+
+// scanCreated проверяет созданные записи батча.
+func (s *URLService) scanCreated(ctx context.Context, entries []storage.BatchEntry, saved []storage.BatchResult) {
+	for j, res := range saved {
+		if res.Status == storage.BatchCreated {
+			s.scanLink(ctx, res.ShortURL, entries[j].OriginalURL)
+		}
+	}
+}
+
+// RescanLinks перепроверяет все ссылки по текущим спискам угроз и обновляет отметки.
+// Возвращает число ссылок, у которых отметка изменилась.
+func (s *URLService) RescanLinks(ctx context.Context) (int, error) {
+	if s.Scanner == nil {
+		return 0, nil
+	}
+
+	changed := 0
+	after := ""
+	for {
+		links, err := s.Repo.ListURLs(ctx, after, rescanPageSize)
+		if err != nil {
+			return changed, err
+		}
+		for _, link := range links {
+			threat := s.Scanner.Check(link.OriginalURL)
+			if threat == link.Threat {
+				continue
+			}
+			if err := s.Repo.SetThreat(ctx, link.ShortURL, threat); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return changed, err
+			}
+			changed++
+		}
+		if len(links) < rescanPageSize {
+			return changed, nil
+		}
+		after = links[len(links)-1].ShortURL
+	}
+}
+
+// StartRescan периодически перепроверяет ссылки, пока не завершится ctx.
+// onDone вызывается после каждого прохода, например для логирования.
+func (s *URLService) StartRescan(ctx context.Context, interval time.Duration, onDone func(changed int, err error)) {
+	if s.Scanner == nil || interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				changed, err := s.RescanLinks(ctx)
+				if onDone != nil {
+					onDone(changed, err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -5,11 +5,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
+	"github.com/divanov-web/shorturl/internal/audit"
+	"github.com/divanov-web/shorturl/internal/scanner"
 	"github.com/divanov-web/shorturl/internal/storage"
+	"github.com/divanov-web/shorturl/internal/stream"
 	"github.com/divanov-web/shorturl/internal/utils/idgen"
+	"github.com/divanov-web/shorturl/internal/webhook"
 )
 
 // BatchRequestItem описывает входные данные для пакетного создания коротких ссылок.
@@ -18,33 +23,113 @@ type BatchRequestItem struct {
 	OriginalURL   string `json:"original_url"`
 }
 
-// ShortenBatchResult описывает результат пакетного сокращения ссылок.
+// ShortenBatchResult описывает результат пакетного сокращения одной ссылки.
 type ShortenBatchResult struct {
 	CorrelationID string `json:"correlation_id"`
-	ShortURL      string `json:"short_url"`
+	ShortURL      string `json:"short_url,omitempty"`
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
+	Reason        string `json:"reason,omitempty"`
 }
 
+// BatchMode режим пакетного сокращения.
+type BatchMode string
+
+const (
+	// BatchAtomic батч сохраняется целиком или не сохраняется вовсе.
+	BatchAtomic BatchMode = "atomic"
+	// BatchBestEffort сохраняются все корректные элементы батча.
+	BatchBestEffort BatchMode = "best_effort"
+)
+
+// Статусы элементов батча в ответе.
+const (
+	BatchStatusCreated  = "created"
+	BatchStatusExisting = "existing"
+	BatchStatusInvalid  = "invalid"
+	BatchStatusConflict = "conflict"
+	BatchStatusSkipped  = "skipped" // корректный элемент не сохранён, так как атомарный батч отклонён
+)
+
 type deleteTask struct {
 	UserID string
+	Actor  string
 	IDs    []string
 }
 
+// deleteKey группа задач удаления с общим владельцем ссылок и автором для журнала.
+type deleteKey struct {
+	UserID string
+	Actor  string
+}
+
+// CreateParams необязательные параметры создания короткой ссылки.
+type CreateParams struct {
+	// Password пароль, без которого ссылка не открывается.
+	Password string
+	// MaxClicks число переходов, после которого ссылка перестаёт открываться, 0 — без ограничения.
+	MaxClicks int64
+	// Meta теги, папка, заголовок и заметка ссылки.
+	Meta storage.LinkMeta
+	// Domain короткий домен ссылки, пустой — домен пользователя по умолчанию.
+	Domain string
+}
+
 // URLService описывает бизнес-логику сервиса коротких ссылок.
 type URLService struct {
 	BaseURL    string
 	Repo       storage.Storage
-	deleteChan chan deleteTask
+	Policy     *URLPolicy
+	Normalizer *URLNormalizer
+	Scanner    *scanner.Scanner // nil — проверка по спискам угроз отключена
+	Passwords  *PasswordGuard
+	Audit      audit.Log
+	Webhooks   *webhook.Dispatcher // nil — события ссылок подписчикам не отправляются
+	Stream     *stream.Hub         // nil — поток событий ссылок отключён
+	// Domains дополнительные короткие домены (host или host:port), домен BaseURL используется по умолчанию.
+	Domains []string
+	// RedirectCode код редиректа для ссылок без собственной настройки.
+	RedirectCode int
+	// RedirectCacheTTL сколько клиентам разрешено кешировать постоянные редиректы (301, 308).
+	RedirectCacheTTL time.Duration
+	deleteChan       chan deleteTask
 }
 
 // ErrAlreadyExists Ошибка url уже существует (от уровня сервиса)
 var ErrAlreadyExists = errors.New("url already exists (service)")
 
+// ErrBatchRejected Ошибка атомарный батч отклонён из-за некорректных элементов
+var ErrBatchRejected = errors.New("batch rejected (service)")
+
+// ErrNotFound Ошибка ссылка не найдена (от уровня сервиса)
+var ErrNotFound = errors.New("url not found (service)")
+
+// ErrGone Ошибка ссылка удалена (от уровня сервиса)
+var ErrGone = errors.New("url deleted (service)")
+
+// ErrInvalidOptions Ошибка недопустимые настройки ссылки (от уровня сервиса)
+var ErrInvalidOptions = errors.New("invalid link options (service)")
+
+// ErrForbidden Ошибка нет прав на ссылку (от уровня сервиса)
+var ErrForbidden = errors.New("access to url denied (service)")
+
 // NewURLService создаёт новый сервис для работы с короткими ссылками и запускает воркер удаления.
+// Политика URL по умолчанию — DefaultPolicyConfig, её можно заменить через поле Policy.
+// Нормализатор по умолчанию не удаляет параметры отслеживания, его можно заменить через поле Normalizer.
+// Журнал действий по умолчанию хранится в памяти, его можно заменить через поле Audit.
 func NewURLService(ctx context.Context, baseURL string, repo storage.Storage) *URLService {
+	policy, _ := NewURLPolicy(DefaultPolicyConfig(baseURL)) // без файлов списков ошибки быть не может
 	svc := &URLService{
 		BaseURL:    baseURL,
 		Repo:       repo,
-		deleteChan: make(chan deleteTask, 5),
+		Policy:     policy,
+		Normalizer: NewURLNormalizer(false, nil),
+		Passwords:  NewPasswordGuard(""),
+		Audit:      audit.NewMemory(auditMemorySize),
+		// по умолчанию 307, как было до появления настройки
+		RedirectCode:     http.StatusTemporaryRedirect,
+		RedirectCacheTTL: 24 * time.Hour,
+		deleteChan:       make(chan deleteTask, 5),
 	}
 
 	go svc.startDeleteWorker(ctx)
@@ -52,43 +137,172 @@ func NewURLService(ctx context.Context, baseURL string, repo storage.Storage) *U
 }
 
 // CreateShort создаёт короткую ссылку для переданного оригинального URL.
+// При ErrAlreadyExists возвращает короткую ссылку, только если она принадлежит userID.
+// URL, не прошедший политику, отклоняется с *PolicyError.
+// Уникальность проверяется по нормализованному URL, сохраняется и используется для редиректа исходный.
 func (s *URLService) CreateShort(ctx context.Context, userID string, original string) (string, error) {
-	original = strings.TrimSpace(original)
-	if original == "" {
-		return "", fmt.Errorf("empty original URL")
+	return s.CreateShortWithParams(ctx, userID, original, CreateParams{})
+}
+
+// CreateShortWithParams создаёт короткую ссылку как CreateShort и применяет к новой ссылке параметры.
+// Параметры не меняют уже существующую ссылку на тот же URL.
+func (s *URLService) CreateShortWithParams(ctx context.Context, userID string, original string, params CreateParams) (string, error) {
+	original, normalized, err := s.prepareURL(original)
+	if err != nil {
+		return "", err
+	}
+	if params.MaxClicks < 0 {
+		return "", ErrInvalidOptions
+	}
+	meta, err := prepareMeta(params.Meta)
+	if err != nil {
+		return "", err
+	}
+	domain, err := s.linkDomain(ctx, userID, params.Domain)
+	if err != nil {
+		return "", err
+	}
+	var opts storage.LinkOptions
+	if params.Password != "" {
+		if opts.PasswordHash, err = HashPassword(params.Password); err != nil {
+			return "", err
+		}
 	}
 
-	id, err := s.Repo.SaveURL(ctx, userID, original)
+	id, err := s.Repo.SaveURL(ctx, userID, storage.NewLink{
+		OriginalURL:   original,
+		NormalizedURL: normalized,
+		Options:       opts,
+		MaxClicks:     params.MaxClicks,
+		Meta:          meta,
+		Domain:        domain,
+	})
+	if err == nil {
+		// о ссылке сообщается, только когда она сохранена со всеми параметрами
+		s.audit(ctx, audit.Event{Actor: actor(ctx, userID), Action: audit.ActionLinkCreate, ShortURL: id, Target: userID})
+		s.publish(webhook.Event{Type: webhook.EventLinkCreated, Owner: userID, ShortURL: id, OriginalURL: original})
+		s.scanLink(ctx, id, original)
+	}
 	if errors.Is(err, storage.ErrConflict) {
-		return fmt.Sprintf("%s/%s", s.BaseURL, id), ErrAlreadyExists
+		// ссылка другого пользователя не раскрывается
+		if id == "" {
+			return "", ErrAlreadyExists
+		}
+		return s.existingShortURL(ctx, id), ErrAlreadyExists
+	}
+
+	return fmt.Sprintf("%s/%s", s.LinkBaseURL(domain), id), err
+}
+
+// CreateShortBatch создаёт несколько коротких ссылок за один запрос и возвращает итог по каждому элементу.
+// В режиме BatchAtomic при любом некорректном или конфликтующем элементе ничего не сохраняется
+// и вместе с результатами возвращается ErrBatchRejected.
+func (s *URLService) CreateShortBatch(ctx context.Context, userID string, input []BatchRequestItem, mode BatchMode) ([]ShortenBatchResult, error) {
+	domain, err := s.linkDomain(ctx, userID, "")
+	if err != nil {
+		return nil, err
+	}
+	entries, positions, results := s.prepareBatch(input, domain)
+
+	atomic := mode != BatchBestEffort
+	if atomic && len(entries) != len(input) {
+		for _, i := range positions {
+			results[i].Status = BatchStatusSkipped
+		}
+		return results, ErrBatchRejected
+	}
+
+	saved, err := s.Repo.BatchSave(ctx, userID, entries, atomic)
+	if err != nil && !errors.Is(err, storage.ErrConflict) {
+		return nil, err
+	}
+	s.fillBatchResults(ctx, results, positions, saved, domain)
+
+	if err == nil {
+		s.recordCreated(ctx, userID, entries, saved)
+		s.scanCreated(ctx, entries, saved)
+	} else {
+		// атомарный батч откатан, созданных ссылок нет
+		for i := range results {
+			if results[i].Status == BatchStatusCreated {
+				results[i].Status = BatchStatusSkipped
+				results[i].ShortURL = ""
+			}
+		}
+		return results, ErrBatchRejected
 	}
 
-	return fmt.Sprintf("%s/%s", s.BaseURL, id), err
+	return results, nil
 }
 
-// CreateShortBatch создаёт несколько коротких ссылок за один запрос.
-func (s *URLService) CreateShortBatch(ctx context.Context, userID string, input []BatchRequestItem) ([]ShortenBatchResult, error) {
+// CreateShortBulk сохраняет очередную порцию массового импорта без атомарности,
+// используя быстрый путь хранилища. Возвращает итог по каждому элементу порции.
+func (s *URLService) CreateShortBulk(ctx context.Context, userID string, input []BatchRequestItem) ([]ShortenBatchResult, error) {
+	domain, err := s.linkDomain(ctx, userID, "")
+	if err != nil {
+		return nil, err
+	}
+	entries, positions, results := s.prepareBatch(input, domain)
+	if len(entries) == 0 {
+		return results, nil
+	}
+
+	saved, err := s.Repo.BulkSave(ctx, userID, entries)
+	if err != nil {
+		return nil, err
+	}
+	s.fillBatchResults(ctx, results, positions, saved, domain)
+	s.recordCreated(ctx, userID, entries, saved)
+	s.scanCreated(ctx, entries, saved)
+
+	return results, nil
+}
+
+// prepareBatch проверяет элементы батча политикой URL и готовит записи для хранилища на домене domain.
+// positions хранит индекс элемента входа для каждой записи.
+func (s *URLService) prepareBatch(input []BatchRequestItem, domain string) ([]storage.BatchEntry, []int, []ShortenBatchResult) {
 	entries := make([]storage.BatchEntry, 0, len(input))
-	results := make([]ShortenBatchResult, 0, len(input))
+	positions := make([]int, 0, len(input))
+	results := make([]ShortenBatchResult, len(input))
 
-	for _, item := range input {
-		short := idgen.Generate(8)
+	for i, item := range input {
+		results[i].CorrelationID = item.CorrelationID
+		original, normalized, err := s.prepareURL(item.OriginalURL)
+		if err != nil {
+			results[i].Status = BatchStatusInvalid
+			results[i].Reason, results[i].Error = PolicyReason(err)
+			continue
+		}
 		entries = append(entries, storage.BatchEntry{
-			ShortURL:      short,
-			OriginalURL:   item.OriginalURL,
+			ShortURL:      idgen.Generate(8),
+			OriginalURL:   original,
+			NormalizedURL: normalized,
 			CorrelationID: item.CorrelationID,
+			Domain:        domain,
 		})
-		results = append(results, ShortenBatchResult{
-			CorrelationID: item.CorrelationID,
-			ShortURL:      fmt.Sprintf("%s/%s", s.BaseURL, short),
-		})
+		positions = append(positions, i)
 	}
 
-	if err := s.Repo.BatchSave(ctx, userID, entries); err != nil {
-		return nil, err
-	}
+	return entries, positions, results
+}
 
-	return results, nil
+// fillBatchResults переносит итоги хранилища в результаты ответа. Новые ссылки получают домен domain,
+// уже существующие возвращаются на своём домене.
+func (s *URLService) fillBatchResults(ctx context.Context, results []ShortenBatchResult, positions []int, saved []storage.BatchResult, domain string) {
+	for j, res := range saved {
+		i := positions[j]
+		switch res.Status {
+		case storage.BatchCreated:
+			results[i].Status = BatchStatusCreated
+			results[i].ShortURL = fmt.Sprintf("%s/%s", s.LinkBaseURL(domain), res.ShortURL)
+		case storage.BatchExisting:
+			results[i].Status = BatchStatusExisting
+			results[i].ShortURL = s.existingShortURL(ctx, res.ShortURL)
+		case storage.BatchConflict:
+			results[i].Status = BatchStatusConflict
+			results[i].Error = "URL уже сокращён другим пользователем"
+		}
+	}
 }
 
 // ResolveShort возвращает оригинальный URL по идентификатору короткой ссылки.
@@ -96,6 +310,106 @@ func (s *URLService) ResolveShort(ctx context.Context, id string) (string, bool)
 	return s.Repo.GetURL(ctx, id)
 }
 
+// ResolveLink возвращает ссылку целиком, включая отметку сканера угроз.
+// Для удалённой, заблокированной и исчерпавшей лимит переходов ссылки возвращает ErrGone, для несуществующей — ErrNotFound.
+func (s *URLService) ResolveLink(ctx context.Context, id string) (storage.UserURL, error) {
+	link, err := s.Repo.GetLink(ctx, id)
+	if err != nil {
+		return storage.UserURL{}, mapStorageError(err)
+	}
+	if link.Exhausted() || link.Disabled {
+		return storage.UserURL{}, ErrGone
+	}
+	return link, nil
+}
+
+// RedirectStatus возвращает код редиректа для ссылки: её собственный или общий по умолчанию.
+func (s *URLService) RedirectStatus(link storage.UserURL) int {
+	if link.Options.RedirectCode != 0 {
+		return link.Options.RedirectCode
+	}
+	return s.RedirectCode
+}
+
+// ValidRedirectCode проверяет, что код подходит для редиректа короткой ссылки.
+func ValidRedirectCode(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// RegisterClick учитывает переход по короткой ссылке, непустой variant — переход на вариант A/B-теста.
+// Если лимит переходов исчерпан (в том числе параллельным запросом), возвращает ErrGone.
+func (s *URLService) RegisterClick(ctx context.Context, id string, variant string) error {
+	if err := s.Repo.RecordClick(ctx, id, variant); err != nil {
+		return mapStorageError(err)
+	}
+	// владельца ссылки получатели событий найдут сами, чтобы не замедлять редирект
+	s.publish(webhook.Event{Type: webhook.EventLinkClicked, ShortURL: id})
+	return nil
+}
+
+// GetUserLink возвращает ссылку владельца целиком, включая счётчики переходов.
+// Ссылку рабочего пространства может получить любой его участник.
+func (s *URLService) GetUserLink(ctx context.Context, userID string, id string) (storage.UserURL, error) {
+	link, _, err := s.linkAccess(ctx, userID, id, storage.RoleViewer)
+	return link, err
+}
+
+// SetLinkOptions меняет настройки ссылки владельца. Пароль ссылки при этом сохраняется,
+// для его смены есть SetLinkPassword. Адреса правил таргетинга и вариантов A/B-теста проходят ту же проверку, что и сокращаемые URL.
+func (s *URLService) SetLinkOptions(ctx context.Context, userID string, id string, opts storage.LinkOptions) error {
+	if opts.RedirectCode != 0 && !ValidRedirectCode(opts.RedirectCode) {
+		return ErrInvalidOptions
+	}
+	rules, err := s.prepareRules(opts.Rules)
+	if err != nil {
+		return err
+	}
+	opts.Rules = rules
+	variants, err := s.prepareVariants(opts.Variants)
+	if err != nil {
+		return err
+	}
+	opts.Variants = variants
+	// правила таргетинга и варианты тоже меняют адрес перехода
+	if err = s.checkNotBlocked(ctx, userID); err != nil {
+		return err
+	}
+	current, owner, err := s.linkAccess(ctx, userID, id, storage.RoleEditor)
+	if err != nil {
+		return err
+	}
+	opts.PasswordHash = current.Options.PasswordHash
+	if err = s.Repo.SetOptions(ctx, owner, id, opts); err != nil {
+		return mapStorageError(err)
+	}
+	s.audit(ctx, audit.Event{Actor: userID, Action: audit.ActionLinkUpdate, ShortURL: id, Target: owner, Detail: "options"})
+	return nil
+}
+
+// SetLinkPassword устанавливает пароль ссылки владельца, пустой пароль снимает защиту.
+func (s *URLService) SetLinkPassword(ctx context.Context, userID string, id string, password string) error {
+	current, owner, err := s.linkAccess(ctx, userID, id, storage.RoleEditor)
+	if err != nil {
+		return err
+	}
+	opts := current.Options
+	opts.PasswordHash = ""
+	if password != "" {
+		if opts.PasswordHash, err = HashPassword(password); err != nil {
+			return err
+		}
+	}
+	if err = s.Repo.SetOptions(ctx, owner, id, opts); err != nil {
+		return mapStorageError(err)
+	}
+	s.audit(ctx, audit.Event{Actor: userID, Action: audit.ActionLinkUpdate, ShortURL: id, Target: owner, Detail: "password"})
+	return nil
+}
+
 // Ping проверяет доступность хранилища, если оно поддерживает метод Ping.
 func (s *URLService) Ping() error {
 	if pinger, ok := s.Repo.(interface{ Ping() error }); ok {
@@ -104,21 +418,124 @@ func (s *URLService) Ping() error {
 	return nil
 }
 
-// GetUserURLs возвращает список коротких ссылок пользователя.
-func (s *URLService) GetUserURLs(ctx context.Context, userID string) ([]storage.UserURL, error) {
-	return s.Repo.GetUserURLs(ctx, userID)
+// GetUserURLs возвращает список коротких ссылок пользователя, отобранных по filter.
+func (s *URLService) GetUserURLs(ctx context.Context, userID string, filter URLFilter) ([]storage.UserURL, error) {
+	urls, err := s.Repo.GetUserURLs(ctx, userID)
+	if err != nil || filter == (URLFilter{}) {
+		return urls, err
+	}
+	result := urls[:0]
+	for _, link := range urls {
+		if filter.match(link) {
+			result = append(result, link)
+		}
+	}
+	return result, nil
 }
 
 // DeleteUserURLs помечает ссылки пользователя как удалённые.
 func (s *URLService) DeleteUserURLs(ctx context.Context, userID string, ids []string) error {
-	return s.Repo.MarkAsDeleted(ctx, userID, ids)
+	return s.deleteLinks(ctx, userID, actor(ctx, userID), ids)
+}
+
+// RestoreUserURL снимает отметку удаления со ссылки пользователя.
+// Если тот же URL уже сокращён заново, возвращает ErrAlreadyExists.
+func (s *URLService) RestoreUserURL(ctx context.Context, userID string, id string) error {
+	link, err := s.Repo.GetLink(ctx, id)
+	if err == nil && link.UserID == userID {
+		// ссылка не удалена, восстанавливать нечего
+		return nil
+	}
+	if err = s.Repo.RestoreURL(ctx, userID, id); err != nil {
+		return mapStorageError(err)
+	}
+	s.audit(ctx, audit.Event{Actor: actor(ctx, userID), Action: audit.ActionLinkRestore, ShortURL: id, Target: userID})
+	return nil
+}
+
+// deleteLinks помечает удалёнными ссылки владельца userID, записывает в журнал каждую удалённую
+// и сообщает о ней подписчикам. Чужие, несуществующие и уже удалённые идентификаторы пропускаются.
+func (s *URLService) deleteLinks(ctx context.Context, userID string, actor string, ids []string) error {
+	deleted, err := s.Repo.MarkAsDeleted(ctx, userID, ids)
+	for _, link := range deleted {
+		s.audit(ctx, audit.Event{Actor: actor, Action: audit.ActionLinkDelete, ShortURL: link.ShortURL, Target: userID})
+		s.publish(webhook.Event{Type: webhook.EventLinkDeleted, Owner: userID, ShortURL: link.ShortURL, OriginalURL: link.OriginalURL})
+	}
+	return err
+}
+
+// UpdateShort меняет оригинальный URL существующей короткой ссылки владельца.
+// Заблокированному пользователю возвращает ErrUserBlocked.
+func (s *URLService) UpdateShort(ctx context.Context, userID string, id string, original string) error {
+	original, normalized, err := s.prepareURL(original)
+	if err != nil {
+		return err
+	}
+	if err = s.checkNotBlocked(ctx, userID); err != nil {
+		return err
+	}
+	_, owner, err := s.linkAccess(ctx, userID, id, storage.RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	if err = s.Repo.UpdateURL(ctx, owner, id, original, normalized); err != nil {
+		return mapStorageError(err)
+	}
+	s.audit(ctx, audit.Event{Actor: userID, Action: audit.ActionLinkUpdate, ShortURL: id, Target: owner, Detail: "url"})
+	if s.Scanner != nil {
+		// новый адрес проверяется заново, отметка старого снимается
+		_ = s.Repo.SetThreat(ctx, id, s.Scanner.Check(original))
+	}
+	return nil
+}
+
+// prepareURL проверяет присланный URL политикой и возвращает его вместе с нормализованным видом.
+func (s *URLService) prepareURL(raw string) (string, string, error) {
+	original := strings.TrimSpace(raw)
+	if err := s.Policy.Check(original); err != nil {
+		return "", "", err
+	}
+	normalized, err := s.Normalizer.Normalize(original)
+	if err != nil {
+		return "", "", &PolicyError{Reason: ReasonMalformed, Message: "Некорректный URL"}
+	}
+	return original, normalized, nil
+}
+
+// GetShortHistory возвращает прежние значения оригинального URL короткой ссылки владельца.
+func (s *URLService) GetShortHistory(ctx context.Context, userID string, id string) ([]storage.URLRevision, error) {
+	_, owner, err := s.linkAccess(ctx, userID, id, storage.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	history, err := s.Repo.GetURLHistory(ctx, owner, id)
+	if err != nil {
+		return nil, mapStorageError(err)
+	}
+	return history, nil
+}
+
+// mapStorageError переводит ошибки хранилища в ошибки сервиса.
+func mapStorageError(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrConflict):
+		return ErrAlreadyExists
+	case errors.Is(err, storage.ErrNotFound):
+		return ErrNotFound
+	case errors.Is(err, storage.ErrDeleted), errors.Is(err, storage.ErrExhausted):
+		return ErrGone
+	case errors.Is(err, storage.ErrForbidden):
+		return ErrForbidden
+	}
+	return err
 }
 
 // startDeleteWorker запускает фоновую обработку задач на удаление ссылок.
 func (s *URLService) startDeleteWorker(ctx context.Context) {
 	const maxBatchSize = 100
 
-	buffer := make(map[string][]string)
+	buffer := make(map[deleteKey][]string)
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
@@ -130,10 +547,11 @@ func (s *URLService) startDeleteWorker(ctx context.Context) {
 				s.flushBuffer(ctx, buffer)
 				return
 			}
-			buffer[task.UserID] = append(buffer[task.UserID], task.IDs...)
-			if len(buffer[task.UserID]) >= maxBatchSize {
-				_ = s.Repo.MarkAsDeleted(ctx, task.UserID, buffer[task.UserID])
-				buffer[task.UserID] = buffer[task.UserID][:0]
+			key := deleteKey{UserID: task.UserID, Actor: task.Actor}
+			buffer[key] = append(buffer[key], task.IDs...)
+			if len(buffer[key]) >= maxBatchSize {
+				_ = s.deleteLinks(ctx, key.UserID, key.Actor, buffer[key])
+				buffer[key] = buffer[key][:0]
 			}
 		case <-ticker.C:
 			// периодический сброс буфера
@@ -148,18 +566,21 @@ func (s *URLService) startDeleteWorker(ctx context.Context) {
 
 // flushBuffer - сейчас перед удалением накапливается буфер из задач на удаление.
 // Если буфер не накопился, его нужно сбрасывать вручную
-func (s *URLService) flushBuffer(ctx context.Context, buffer map[string][]string) {
-	for userID, ids := range buffer {
+func (s *URLService) flushBuffer(ctx context.Context, buffer map[deleteKey][]string) {
+	for key, ids := range buffer {
 		if len(ids) > 0 {
-			_ = s.Repo.MarkAsDeleted(ctx, userID, ids)
+			_ = s.deleteLinks(ctx, key.UserID, key.Actor, ids)
+			buffer[key] = ids[:0]
 		}
 	}
 }
 
 // DeleteShortURLsAsync добавляет задачу на асинхронное удаление ссылок.
-func (s *URLService) DeleteShortURLsAsync(userID string, ids []string) {
+// Из ctx берётся только автор удаления для журнала, сама задача выполняется после завершения запроса.
+func (s *URLService) DeleteShortURLsAsync(ctx context.Context, userID string, ids []string) {
 	s.deleteChan <- deleteTask{
 		UserID: userID,
+		Actor:  actor(ctx, userID),
 		IDs:    ids,
 	}
 }
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/divanov-web/shorturl/internal/stream"
+	"github.com/divanov-web/shorturl/internal/webhook"
+)
+
+// ErrStreamDisabled Ошибка поток событий ссылок отключён (от уровня сервиса)
+var ErrStreamDisabled = errors.New("link event stream disabled (service)")
+
+// SubscribeLinkEvents подписывает на события ссылок владельца owner в реальном времени.
+// Подписку нужно закрыть, когда клиент отключится.
+func (s *URLService) SubscribeLinkEvents(owner string) (*stream.Subscription, error) {
+	if s.Stream == nil {
+		return nil, ErrStreamDisabled
+	}
+	return s.Stream.Subscribe(owner), nil
+}
+
+// publish передаёт событие ссылки подписчикам вебхуков и потоку событий, если они включены.
+// Ни один получатель не блокирует вызывающего.
+func (s *URLService) publish(e webhook.Event) {
+	e = webhook.Stamp(e)
+	if s.Webhooks != nil {
+		s.Webhooks.Publish(e)
+	}
+	if s.Stream != nil {
+		s.Stream.Publish(e)
+	}
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"hash/fnv"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/divanov-web/shorturl/internal/storage"
+)
+
+// Классы устройств для правил таргетинга.
+const (
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+	DeviceBot     = "bot"
+)
+
+// Операционные системы для правил таргетинга.
+const (
+	OSIOS     = "ios"
+	OSAndroid = "android"
+	OSWindows = "windows"
+	OSMacOS   = "macos"
+	OSLinux   = "linux"
+)
+
+// Ограничения числа правил и вариантов A/B-теста одной ссылки.
+const (
+	maxRedirectRules = 20
+	maxVariants      = 10
+	maxVariantWeight = 1000
+)
+
+// timeOfDayLayout формат границ окна времени в правилах.
+const timeOfDayLayout = "15:04"
+
+// RequestInfo сведения о запросе перехода, по которым выбирается адрес редиректа.
+type RequestInfo struct {
+	UserAgent      string
+	AcceptLanguage string
+	Query          url.Values
+	Time           time.Time
+	// VisitorKey постоянный идентификатор посетителя, по которому детерминированно выбирается вариант A/B-теста.
+	VisitorKey string
+	// Variant вариант, назначенный посетителю ранее; если он ещё есть у ссылки, выбирается снова.
+	Variant string
+}
+
+// Target выбранный адрес редиректа. Variant заполнен, если адрес выбран из вариантов A/B-теста.
+type Target struct {
+	URL     string
+	Variant string
+}
+
+// RedirectTarget возвращает адрес редиректа для запроса: URL первого совпавшего правила ссылки,
+// если правила не совпали — вариант A/B-теста, а без вариантов — её OriginalURL.
+func (s *URLService) RedirectTarget(link storage.UserURL, info RequestInfo) Target {
+	if target, ok := matchRules(link.Options.Rules, info); ok {
+		return Target{URL: target}
+	}
+	if variant, ok := chooseVariant(link, info); ok {
+		return Target{URL: variant.URL, Variant: variant.Name}
+	}
+	return Target{URL: link.OriginalURL}
+}
+
+// matchRules возвращает URL первого правила, совпавшего с запросом.
+func matchRules(rules []storage.RedirectRule, info RequestInfo) (string, bool) {
+	if len(rules) == 0 {
+		return "", false
+	}
+	device, os := classifyUserAgent(info.UserAgent)
+	lang := preferredLanguage(info.AcceptLanguage)
+	for _, rule := range rules {
+		if rule.Device != "" && rule.Device != device {
+			continue
+		}
+		if rule.OS != "" && rule.OS != os {
+			continue
+		}
+		if rule.Language != "" && !languageMatches(rule.Language, lang) {
+			continue
+		}
+		if rule.TimeFrom != "" && !inTimeWindow(rule, info.Time) {
+			continue
+		}
+		if rule.Param != "" && !paramMatches(rule, info.Query) {
+			continue
+		}
+		return rule.URL, true
+	}
+	return "", false
+}
+
+// chooseVariant выбирает вариант A/B-теста: назначенный ранее или по хешу ссылки и посетителя
+// пропорционально весам. Один и тот же посетитель при тех же вариантах всегда получает один вариант.
+func chooseVariant(link storage.UserURL, info RequestInfo) (storage.Variant, bool) {
+	variants := link.Options.Variants
+	total := 0
+	for _, v := range variants {
+		if info.Variant != "" && v.Name == info.Variant {
+			return v, true
+		}
+		total += v.Weight
+	}
+	if total <= 0 {
+		return storage.Variant{}, false
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(link.ShortURL + "\x00" + info.VisitorKey))
+	point := int(h.Sum64() % uint64(total))
+	for _, v := range variants {
+		if point < v.Weight {
+			return v, true
+		}
+		point -= v.Weight
+	}
+	return variants[len(variants)-1], true
+}
+
+// prepareVariants проверяет варианты A/B-теста и приводит их адреса к виду, в котором сохраняются ссылки.
+func (s *URLService) prepareVariants(variants []storage.Variant) ([]storage.Variant, error) {
+	if len(variants) > maxVariants {
+		return nil, ErrInvalidOptions
+	}
+	seen := make(map[string]bool, len(variants))
+	result := make([]storage.Variant, 0, len(variants))
+	for _, v := range variants {
+		v.Name = strings.TrimSpace(v.Name)
+		if v.Name == "" || seen[v.Name] || v.Weight <= 0 || v.Weight > maxVariantWeight {
+			return nil, ErrInvalidOptions
+		}
+		seen[v.Name] = true
+		original, _, err := s.prepareURL(strings.TrimSpace(v.URL))
+		if err != nil {
+			return nil, err
+		}
+		v.URL = original
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+// prepareRules проверяет правила таргетинга и приводит их адреса к виду, в котором сохраняются ссылки.
+func (s *URLService) prepareRules(rules []storage.RedirectRule) ([]storage.RedirectRule, error) {
+	if len(rules) > maxRedirectRules {
+		return nil, ErrInvalidOptions
+	}
+	result := make([]storage.RedirectRule, 0, len(rules))
+	for _, rule := range rules {
+		rule.Device = strings.ToLower(strings.TrimSpace(rule.Device))
+		rule.OS = strings.ToLower(strings.TrimSpace(rule.OS))
+		rule.Language = strings.ToLower(strings.TrimSpace(rule.Language))
+		switch rule.Device {
+		case "", DeviceMobile, DeviceTablet, DeviceDesktop, DeviceBot:
+		default:
+			return nil, ErrInvalidOptions
+		}
+		switch rule.OS {
+		case "", OSIOS, OSAndroid, OSWindows, OSMacOS, OSLinux:
+		default:
+			return nil, ErrInvalidOptions
+		}
+		if (rule.TimeFrom == "") != (rule.TimeTo == "") {
+			return nil, ErrInvalidOptions
+		}
+		if rule.TimeFrom != "" {
+			if _, err := time.Parse(timeOfDayLayout, rule.TimeFrom); err != nil {
+				return nil, ErrInvalidOptions
+			}
+			if _, err := time.Parse(timeOfDayLayout, rule.TimeTo); err != nil {
+				return nil, ErrInvalidOptions
+			}
+		}
+		if rule.Timezone != "" {
+			if _, err := time.LoadLocation(rule.Timezone); err != nil {
+				return nil, ErrInvalidOptions
+			}
+		}
+		if rule.Param == "" && rule.ParamValue != "" {
+			return nil, ErrInvalidOptions
+		}
+		original, _, err := s.prepareURL(strings.TrimSpace(rule.URL))
+		if err != nil {
+			return nil, err
+		}
+		rule.URL = original
+		result = append(result, rule)
+	}
+	return result, nil
+}
+
+// classifyUserAgent определяет класс устройства и операционную систему по User-Agent.
+// Разбор упрощённый и рассчитан на распространённые браузеры.
+func classifyUserAgent(ua string) (device, os string) {
+	ua = strings.ToLower(ua)
+
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		os = OSIOS
+	case strings.Contains(ua, "android"):
+		os = OSAndroid
+	case strings.Contains(ua, "windows"):
+		os = OSWindows
+	case strings.Contains(ua, "mac os x"), strings.Contains(ua, "macintosh"):
+		os = OSMacOS
+	case strings.Contains(ua, "linux"), strings.Contains(ua, "x11"):
+		os = OSLinux
+	}
+
+	switch {
+	case ua == "", strings.Contains(ua, "bot"), strings.Contains(ua, "crawler"), strings.Contains(ua, "spider"):
+		device = DeviceBot
+	case strings.Contains(ua, "ipad"), strings.Contains(ua, "tablet"),
+		os == OSAndroid && !strings.Contains(ua, "mobile"):
+		device = DeviceTablet
+	case strings.Contains(ua, "mobi"), strings.Contains(ua, "iphone"), strings.Contains(ua, "ipod"):
+		device = DeviceMobile
+	default:
+		device = DeviceDesktop
+	}
+	return device, os
+}
+
+// preferredLanguage возвращает язык с наибольшим весом из Accept-Language в нижнем регистре.
+func preferredLanguage(header string) string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var langs []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > 0 {
+			langs = append(langs, weighted{tag: tag, q: q})
+		}
+	}
+	if len(langs) == 0 {
+		return ""
+	}
+	// при равном весе побеждает язык, указанный раньше
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	return langs[0].tag
+}
+
+// languageMatches проверяет язык запроса по правилу: de совпадает с de и de-at, de-at только с de-at.
+func languageMatches(rule, lang string) bool {
+	return lang == rule || strings.HasPrefix(lang, rule+"-")
+}
+
+// inTimeWindow проверяет, попадает ли время в окно правила. Окно с TimeFrom > TimeTo переходит через полночь.
+func inTimeWindow(rule storage.RedirectRule, now time.Time) bool {
+	loc := time.UTC
+	if rule.Timezone != "" {
+		if l, err := time.LoadLocation(rule.Timezone); err == nil {
+			loc = l
+		}
+	}
+	from, err1 := time.Parse(timeOfDayLayout, rule.TimeFrom)
+	to, err2 := time.Parse(timeOfDayLayout, rule.TimeTo)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	start := from.Hour()*60 + from.Minute()
+	end := to.Hour()*60 + to.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// paramMatches проверяет параметр запроса по правилу.
+func paramMatches(rule storage.RedirectRule, query url.Values) bool {
+	values, ok := query[rule.Param]
+	if !ok {
+		return false
+	}
+	if rule.ParamValue == "" {
+		return true
+	}
+	for _, v := range values {
+		if v == rule.ParamValue {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/divanov-web/shorturl/internal/storage"
+	"github.com/divanov-web/shorturl/internal/storage/memorystorage"
+)
+
+const (
+	uaIPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148"
+	uaAndroid = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36"
+	uaTablet  = "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 Chrome/120.0 Safari/537.36"
+	uaWindows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36"
+	uaBot     = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+)
+
+func TestClassifyUserAgent(t *testing.T) {
+	tests := []struct {
+		ua     string
+		device string
+		os     string
+	}{
+		{ua: uaIPhone, device: DeviceMobile, os: OSIOS},
+		{ua: uaAndroid, device: DeviceMobile, os: OSAndroid},
+		{ua: uaTablet, device: DeviceTablet, os: OSAndroid},
+		{ua: uaWindows, device: DeviceDesktop, os: OSWindows},
+		{ua: uaBot, device: DeviceBot},
+		{ua: "", device: DeviceBot},
+	}
+	for _, tt := range tests {
+		device, os := classifyUserAgent(tt.ua)
+		assert.Equal(t, tt.device, device, tt.ua)
+		assert.Equal(t, tt.os, os, tt.ua)
+	}
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	assert.Equal(t, "de", preferredLanguage("de"))
+	assert.Equal(t, "en-us", preferredLanguage("en-US,en;q=0.9,de;q=0.8"))
+	assert.Equal(t, "de-at", preferredLanguage("en;q=0.5, de-AT"))
+	assert.Equal(t, "", preferredLanguage("*"))
+	assert.True(t, languageMatches("de", "de-at"))
+	assert.False(t, languageMatches("de-at", "de"))
+}
+
+func TestURLService_RedirectTarget(t *testing.T) {
+	svc := NewURLService(context.Background(), "http://localhost:8080", memorystorage.NewTestStorage())
+	link := storage.UserURL{
+		OriginalURL: "https://example.com/",
+		Options: storage.LinkOptions{Rules: []storage.RedirectRule{
+			{Param: "ref", ParamValue: "promo", URL: "https://example.com/promo"},
+			{Device: DeviceMobile, OS: OSIOS, URL: "https://apps.apple.com/app"},
+			{Device: DeviceMobile, URL: "https://play.google.com/app"},
+			{Language: "de", URL: "https://example.com/de"},
+			{TimeFrom: "22:00", TimeTo: "06:00", URL: "https://example.com/night"},
+		}},
+	}
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	night := time.Date(2024, 5, 1, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		info RequestInfo
+		want string
+	}{
+		{name: "default", info: RequestInfo{UserAgent: uaWindows, Time: day}, want: "https://example.com/"},
+		{name: "ios", info: RequestInfo{UserAgent: uaIPhone, Time: day}, want: "https://apps.apple.com/app"},
+		{name: "android", info: RequestInfo{UserAgent: uaAndroid, Time: day}, want: "https://play.google.com/app"},
+		{name: "language", info: RequestInfo{UserAgent: uaWindows, AcceptLanguage: "de-DE,de;q=0.9", Time: day}, want: "https://example.com/de"},
+		{name: "night window", info: RequestInfo{UserAgent: uaWindows, Time: night}, want: "https://example.com/night"},
+		{name: "param first", info: RequestInfo{UserAgent: uaIPhone, Query: url.Values{"ref": {"promo"}}, Time: day}, want: "https://example.com/promo"},
+		{name: "param value mismatch", info: RequestInfo{UserAgent: uaWindows, Query: url.Values{"ref": {"x"}}, Time: day}, want: "https://example.com/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, svc.RedirectTarget(link, tt.info).URL)
+		})
+	}
+}
+
+func TestURLService_SetLinkOptionsRules(t *testing.T) {
+	ctx := context.Background()
+	svc := NewURLService(ctx, "http://localhost:8080", memorystorage.NewTestStorage())
+	shortURL, err := svc.CreateShort(ctx, "owner", "https://example.com/")
+	require.NoError(t, err)
+	id := strings.TrimPrefix(shortURL, "http://localhost:8080/")
+
+	invalid := [][]storage.RedirectRule{
+		{{Device: "phone", URL: "https://example.com/m"}},
+		{{TimeFrom: "10:00", URL: "https://example.com/t"}},
+		{{TimeFrom: "25:00", TimeTo: "26:00", URL: "https://example.com/t"}},
+		{{Timezone: "Mars/Base", TimeFrom: "10:00", TimeTo: "11:00", URL: "https://example.com/t"}},
+		{{ParamValue: "x", URL: "https://example.com/p"}},
+		{{Device: DeviceMobile, URL: "not a url"}},
+	}
+	for _, rules := range invalid {
+		err = svc.SetLinkOptions(ctx, "owner", id, storage.LinkOptions{Rules: rules})
+		assert.Error(t, err, rules)
+	}
+
+	rules := []storage.RedirectRule{{Device: "Mobile", URL: " https://example.com/m "}}
+	require.NoError(t, svc.SetLinkOptions(ctx, "owner", id, storage.LinkOptions{Rules: rules}))
+	link, err := svc.ResolveLink(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.RedirectRule{{Device: DeviceMobile, URL: "https://example.com/m"}}, link.Options.Rules)
+}
+
+func TestChooseVariant(t *testing.T) {
+	link := storage.UserURL{
+		ShortURL:    "abc",
+		OriginalURL: "https://example.com/",
+		Options: storage.LinkOptions{Variants: []storage.Variant{
+			{Name: "a", URL: "https://example.com/a", Weight: 3},
+			{Name: "b", URL: "https://example.com/b", Weight: 1},
+		}},
+	}
+
+	// один посетитель всегда получает один вариант
+	first, ok := chooseVariant(link, RequestInfo{VisitorKey: "visitor-1"})
+	require.True(t, ok)
+	for i := 0; i < 10; i++ {
+		again, _ := chooseVariant(link, RequestInfo{VisitorKey: "visitor-1"})
+		assert.Equal(t, first, again)
+	}
+
+	// назначенный ранее вариант сохраняется, неизвестный игнорируется
+	v, _ := chooseVariant(link, RequestInfo{VisitorKey: "visitor-1", Variant: "b"})
+	assert.Equal(t, "b", v.Name)
+	v, _ = chooseVariant(link, RequestInfo{VisitorKey: "visitor-1", Variant: "gone"})
+	assert.Equal(t, first, v)
+
+	// доли посетителей примерно соответствуют весам
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		v, _ := chooseVariant(link, RequestInfo{VisitorKey: strconv.Itoa(i)})
+		counts[v.Name]++
+	}
+	assert.InDelta(t, 3000, counts["a"], 200)
+	assert.InDelta(t, 1000, counts["b"], 200)
+
+	_, ok = chooseVariant(storage.UserURL{}, RequestInfo{})
+	assert.False(t, ok)
+}
+
+func TestURLService_SetLinkOptionsVariants(t *testing.T) {
+	ctx := context.Background()
+	svc := NewURLService(ctx, "http://localhost:8080", memorystorage.NewTestStorage())
+	shortURL, err := svc.CreateShort(ctx, "owner", "https://example.com/")
+	require.NoError(t, err)
+	id := strings.TrimPrefix(shortURL, "http://localhost:8080/")
+
+	invalid := [][]storage.Variant{
+		{{Name: "", URL: "https://example.com/a", Weight: 1}},
+		{{Name: "a", URL: "https://example.com/a", Weight: 0}},
+		{{Name: "a", URL: "https://example.com/a", Weight: 1}, {Name: "a", URL: "https://example.com/b", Weight: 1}},
+		{{Name: "a", URL: "not a url", Weight: 1}},
+	}
+	for _, variants := range invalid {
+		err = svc.SetLinkOptions(ctx, "owner", id, storage.LinkOptions{Variants: variants})
+		assert.Error(t, err, variants)
+	}
+
+	variants := []storage.Variant{{Name: "a", URL: "https://example.com/a", Weight: 1}}
+	require.NoError(t, svc.SetLinkOptions(ctx, "owner", id, storage.LinkOptions{Variants: variants}))
+	require.NoError(t, svc.RegisterClick(ctx, id, "a"))
+
+	_, err = svc.GetUserLink(ctx, "stranger", id)
+	assert.ErrorIs(t, err, ErrForbidden)
+	link, err := svc.GetUserLink(ctx, "owner", id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), link.Clicks)
+	assert.Equal(t, map[string]int64{"a": 1}, link.VariantClicks)
+}
@@ -0,0 +1,18 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+)
+
+// ErrInvalidURL Ошибка некорректный URL (от уровня сервиса)
+var ErrInvalidURL = errors.New("invalid url (service)")
+
+// ValidateURL проверяет, что URL абсолютный и содержит схему и хост.
+func ValidateURL(raw string) error {
+	u, err := url.ParseRequestURI(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ErrInvalidURL
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/divanov-web/shorturl/internal/storage"
+	"github.com/divanov-web/shorturl/internal/utils/idgen"
+	"github.com/divanov-web/shorturl/internal/webhook"
+)
+
+// maxWebhooks сколько подписок может быть у одного владельца.
+const maxWebhooks = 10
+
+// ErrWebhookLimit Ошибка превышено число подписок владельца (от уровня сервиса)
+var ErrWebhookLimit = errors.New("too many webhooks (service)")
+
+// ErrWebhookNotFound Ошибка подписка или недоставленное событие не найдены (от уровня сервиса)
+var ErrWebhookNotFound = errors.New("webhook not found (service)")
+
+// CreateWebhook подписывает адрес rawURL на события ссылок владельца owner. Пустой events — все события.
+// Адрес проходит ту же политику, что и сокращаемые URL, поэтому локальные адреса по умолчанию запрещены.
+// Секрет подписи генерируется здесь и возвращается вместе с подпиской.
+func (s *URLService) CreateWebhook(ctx context.Context, owner string, rawURL string, events []string) (storage.Webhook, error) {
+	target := strings.TrimSpace(rawURL)
+	if err := s.Policy.Check(target); err != nil {
+		return storage.Webhook{}, err
+	}
+	var filter []string
+	for _, e := range events {
+		if !slices.Contains(webhook.Events, e) {
+			return storage.Webhook{}, ErrInvalidOptions
+		}
+		if !slices.Contains(filter, e) {
+			filter = append(filter, e)
+		}
+	}
+	existing, err := s.Repo.GetWebhooks(ctx, owner)
+	if err != nil {
+		return storage.Webhook{}, err
+	}
+	if len(existing) >= maxWebhooks {
+		return storage.Webhook{}, ErrWebhookLimit
+	}
+
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return storage.Webhook{}, err
+	}
+	hook := storage.Webhook{
+		Owner:     owner,
+		URL:       target,
+		Secret:    hex.EncodeToString(secret),
+		Events:    filter,
+		CreatedAt: time.Now().UTC(),
+	}
+	for {
+		// при коллизии идентификатора генерируем новый
+		hook.ID = idgen.Generate(8)
+		err = s.Repo.SaveWebhook(ctx, hook)
+		if !errors.Is(err, storage.ErrConflict) {
+			return hook, err
+		}
+	}
+}
+
+// GetWebhooks возвращает подписки владельца.
+func (s *URLService) GetWebhooks(ctx context.Context, owner string) ([]storage.Webhook, error) {
+	return s.Repo.GetWebhooks(ctx, owner)
+}
+
+// DeleteWebhook удаляет подписку владельца. Уже поставленные в очередь доставки не отменяются.
+func (s *URLService) DeleteWebhook(ctx context.Context, owner string, id string) error {
+	err := s.Repo.DeleteWebhook(ctx, owner, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrWebhookNotFound
+	}
+	return err
+}
+
+// GetWebhookDeliveries возвращает до limit последних попыток доставки на подписку владельца, 0 — все.
+func (s *URLService) GetWebhookDeliveries(ctx context.Context, owner string, id string, limit int) ([]webhook.Delivery, error) {
+	if err := s.checkWebhook(ctx, owner, id); err != nil {
+		return nil, err
+	}
+	if s.Webhooks == nil {
+		return nil, nil
+	}
+	return s.Webhooks.Deliveries(owner, id, limit), nil
+}
+
+// GetWebhookDeadLetters возвращает события, которые не удалось доставить на подписку владельца.
+func (s *URLService) GetWebhookDeadLetters(ctx context.Context, owner string, id string) ([]webhook.DeadLetter, error) {
+	if err := s.checkWebhook(ctx, owner, id); err != nil {
+		return nil, err
+	}
+	if s.Webhooks == nil {
+		return nil, nil
+	}
+	return s.Webhooks.DeadLetters(owner, id), nil
+}
+
+// RedeliverWebhook снова отправляет недоставленное событие подписки владельца.
+func (s *URLService) RedeliverWebhook(ctx context.Context, owner string, id string, deliveryID string) error {
+	if err := s.checkWebhook(ctx, owner, id); err != nil {
+		return err
+	}
+	if s.Webhooks == nil {
+		return ErrWebhookNotFound
+	}
+	dead := s.Webhooks.DeadLetters(owner, id)
+	if !slices.ContainsFunc(dead, func(dl webhook.DeadLetter) bool { return dl.DeliveryID == deliveryID }) {
+		return ErrWebhookNotFound
+	}
+	if err := s.Webhooks.Redeliver(owner, deliveryID); err != nil {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// checkWebhook проверяет, что у владельца есть подписка id.
+func (s *URLService) checkWebhook(ctx context.Context, owner string, id string) error {
+	hooks, err := s.Repo.GetWebhooks(ctx, owner)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(hooks, func(h storage.Webhook) bool { return h.ID == id }) {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
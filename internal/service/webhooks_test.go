@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/divanov-web/shorturl/internal/storage/memorystorage"
+	"github.com/divanov-web/shorturl/internal/webhook"
+)
+
+func TestURLService_Webhooks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := memorystorage.NewTestStorage()
+	svc := NewURLService(ctx, "http://sho.rt", store)
+
+	var mu sync.Mutex
+	var received []webhook.Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e webhook.Event
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&e))
+		mu.Lock()
+		received = append(received, e)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	// локальные адреса запрещены политикой по умолчанию
+	_, err := svc.CreateWebhook(ctx, "alice", srv.URL, nil)
+	reason, _ := PolicyReason(err)
+	assert.Equal(t, ReasonPrivateHost, reason)
+
+	cfg := DefaultPolicyConfig("http://sho.rt")
+	cfg.AllowPrivateHosts = true
+	svc.Policy, err = NewURLPolicy(cfg)
+	require.NoError(t, err)
+
+	_, err = svc.CreateWebhook(ctx, "alice", srv.URL, []string{"link.renamed"})
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+	hook, err := svc.CreateWebhook(ctx, "alice", srv.URL, []string{webhook.EventLinkCreated, webhook.EventLinkDeleted, webhook.EventLinkCreated})
+	require.NoError(t, err)
+	assert.Len(t, hook.Secret, 64)
+	assert.Equal(t, []string{webhook.EventLinkCreated, webhook.EventLinkDeleted}, hook.Events)
+
+	hooks, err := svc.GetWebhooks(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, hooks, 1)
+	assert.Equal(t, hook.ID, hooks[0].ID)
+
+	// без диспетчера журнал пуст, а чужие подписки не видны
+	deliveries, err := svc.GetWebhookDeliveries(ctx, "alice", hook.ID, 0)
+	require.NoError(t, err)
+	assert.Empty(t, deliveries)
+	_, err = svc.GetWebhookDeliveries(ctx, "bob", hook.ID, 0)
+	assert.ErrorIs(t, err, ErrWebhookNotFound)
+	assert.ErrorIs(t, svc.DeleteWebhook(ctx, "bob", hook.ID), ErrWebhookNotFound)
+
+	hookCfg := webhook.DefaultConfig()
+	hookCfg.AllowPrivateHosts = true // подписчик слушает 127.0.0.1
+	d := webhook.NewDispatcher(store, hookCfg)
+	d.Start(ctx)
+	svc.Webhooks = d
+
+	short, err := svc.CreateShort(ctx, "alice", "https://a.com/")
+	require.NoError(t, err)
+	id := strings.TrimPrefix(short, "http://sho.rt/")
+	require.NoError(t, svc.RegisterClick(ctx, id, ""))
+	require.NoError(t, svc.DeleteUserURLs(ctx, "alice", []string{id}))
+	_, err = svc.CreateShort(ctx, "bob", "https://b.com/")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 2
+	}, 2*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	types := []string{received[0].Type, received[1].Type}
+	mu.Unlock()
+	assert.ElementsMatch(t, []string{webhook.EventLinkCreated, webhook.EventLinkDeleted}, types)
+
+	// попытка попадает в журнал после ответа подписчика
+	require.Eventually(t, func() bool {
+		deliveries, err = svc.GetWebhookDeliveries(ctx, "alice", hook.ID, 0)
+		return err == nil && len(deliveries) == 2
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, webhook.StatusDelivered, deliveries[0].Status)
+	assert.ErrorIs(t, svc.RedeliverWebhook(ctx, "alice", hook.ID, deliveries[0].ID), ErrWebhookNotFound)
+
+	// лимит подписок на владельца
+	for i := 1; i < maxWebhooks; i++ {
+		_, err = svc.CreateWebhook(ctx, "alice", srv.URL, nil)
+		require.NoError(t, err)
+	}
+	_, err = svc.CreateWebhook(ctx, "alice", srv.URL, nil)
+	assert.ErrorIs(t, err, ErrWebhookLimit)
+
+	require.NoError(t, svc.DeleteWebhook(ctx, "alice", hook.ID))
+	assert.ErrorIs(t, svc.DeleteWebhook(ctx, "alice", hook.ID), ErrWebhookNotFound)
+}
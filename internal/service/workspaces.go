@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/divanov-web/shorturl/internal/storage"
+	"github.com/divanov-web/shorturl/internal/utils/idgen"
+)
+
+// Ограничения рабочих пространств.
+const (
+	inviteTTL              = 7 * 24 * time.Hour
+	maxWorkspaceNameLength = 100
+)
+
+// ErrInviteInvalid Ошибка приглашение не найдено, уже использовано или истекло (от уровня сервиса)
+var ErrInviteInvalid = errors.New("workspace invite not found or expired (service)")
+
+// ErrLastOwner Ошибка в рабочем пространстве не останется владельца (от уровня сервиса)
+var ErrLastOwner = errors.New("workspace must keep an owner (service)")
+
+// roleRank старшинство ролей: старшая роль может всё, что может младшая.
+var roleRank = map[storage.WorkspaceRole]int{
+	storage.RoleViewer: 1,
+	storage.RoleEditor: 2,
+	storage.RoleOwner:  3,
+}
+
+// UserWorkspace рабочее пространство вместе с ролью в нём пользователя.
+type UserWorkspace struct {
+	storage.Workspace
+	Role storage.WorkspaceRole
+}
+
+// ValidRole проверяет, что роль участника рабочего пространства известна.
+func ValidRole(role storage.WorkspaceRole) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// CreateWorkspace создаёт рабочее пространство, userID становится его владельцем.
+func (s *URLService) CreateWorkspace(ctx context.Context, userID string, name string) (UserWorkspace, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxWorkspaceNameLength {
+		return UserWorkspace{}, ErrInvalidOptions
+	}
+	ws := storage.Workspace{Name: name, CreatedAt: time.Now().UTC()}
+	for {
+		// при коллизии идентификатора генерируем новый
+		ws.ID = idgen.Generate(8)
+		err := s.Repo.CreateWorkspace(ctx, ws, userID)
+		if errors.Is(err, storage.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return UserWorkspace{}, err
+		}
+		return UserWorkspace{Workspace: ws, Role: storage.RoleOwner}, nil
+	}
+}
+
+// GetUserWorkspaces возвращает рабочие пространства пользователя с его ролями.
+func (s *URLService) GetUserWorkspaces(ctx context.Context, userID string) ([]UserWorkspace, error) {
+	memberships, err := s.Repo.GetUserWorkspaces(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]UserWorkspace, 0, len(memberships))
+	for _, m := range memberships {
+		ws, err := s.Repo.GetWorkspace(ctx, m.WorkspaceID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, UserWorkspace{Workspace: ws, Role: m.Role})
+	}
+	return result, nil
+}
+
+// GetWorkspaceMembers возвращает участников рабочего пространства, доступно любому участнику.
+func (s *URLService) GetWorkspaceMembers(ctx context.Context, userID string, workspaceID string) ([]storage.WorkspaceMember, error) {
+	if _, err := s.authorize(ctx, userID, workspaceID, storage.RoleViewer); err != nil {
+		return nil, err
+	}
+	return s.Repo.GetWorkspaceMembers(ctx, workspaceID)
+}
+
+// SetWorkspaceMemberRole меняет роль участника, доступно владельцу.
+// Последний владелец не может лишиться роли, для этого возвращается ErrLastOwner.
+func (s *URLService) SetWorkspaceMemberRole(ctx context.Context, userID string, workspaceID string, memberID string, role storage.WorkspaceRole) error {
+	if !ValidRole(role) {
+		return ErrInvalidOptions
+	}
+	if _, err := s.authorize(ctx, userID, workspaceID, storage.RoleOwner); err != nil {
+		return err
+	}
+	member, err := s.Repo.GetWorkspaceMember(ctx, workspaceID, memberID)
+	if err != nil {
+		return mapStorageError(err)
+	}
+	if member.Role == storage.RoleOwner && role != storage.RoleOwner {
+		if err = s.keepOwner(ctx, workspaceID); err != nil {
+			return err
+		}
+	}
+	member.Role = role
+	return s.Repo.SetWorkspaceMember(ctx, member)
+}
+
+// RemoveWorkspaceMember убирает участника из рабочего пространства. Владелец убирает любого участника,
+// остальные могут только выйти сами. Последний владелец выйти не может.
+func (s *URLService) RemoveWorkspaceMember(ctx context.Context, userID string, workspaceID string, memberID string) error {
+	need := storage.RoleOwner
+	if memberID == userID {
+		need = storage.RoleViewer
+	}
+	if _, err := s.authorize(ctx, userID, workspaceID, need); err != nil {
+		return err
+	}
+	member, err := s.Repo.GetWorkspaceMember(ctx, workspaceID, memberID)
+	if err != nil {
+		return mapStorageError(err)
+	}
+	if member.Role == storage.RoleOwner {
+		if err = s.keepOwner(ctx, workspaceID); err != nil {
+			return err
+		}
+	}
+	return mapStorageError(s.Repo.RemoveWorkspaceMember(ctx, workspaceID, memberID))
+}
+
+// keepOwner проверяет, что после ухода одного владельца в рабочем пространстве останется другой.
+func (s *URLService) keepOwner(ctx context.Context, workspaceID string) error {
+	members, err := s.Repo.GetWorkspaceMembers(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	owners := 0
+	for _, m := range members {
+		if m.Role == storage.RoleOwner {
+			owners++
+		}
+	}
+	if owners < 2 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// CreateWorkspaceInvite создаёт одноразовое приглашение с ролью role, доступно владельцу.
+func (s *URLService) CreateWorkspaceInvite(ctx context.Context, userID string, workspaceID string, role storage.WorkspaceRole) (storage.WorkspaceInvite, error) {
+	if !ValidRole(role) {
+		return storage.WorkspaceInvite{}, ErrInvalidOptions
+	}
+	if _, err := s.authorize(ctx, userID, workspaceID, storage.RoleOwner); err != nil {
+		return storage.WorkspaceInvite{}, err
+	}
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return storage.WorkspaceInvite{}, err
+	}
+	invite := storage.WorkspaceInvite{
+		Token:       hex.EncodeToString(token),
+		WorkspaceID: workspaceID,
+		Role:        role,
+		CreatedBy:   userID,
+		ExpiresAt:   time.Now().UTC().Add(inviteTTL),
+	}
+	if err := s.Repo.SaveInvite(ctx, invite); err != nil {
+		return storage.WorkspaceInvite{}, mapStorageError(err)
+	}
+	return invite, nil
+}
+
+// AcceptWorkspaceInvite добавляет пользователя в рабочее пространство по приглашению.
+// Участник, у которого роль уже не ниже приглашения, её сохраняет.
+func (s *URLService) AcceptWorkspaceInvite(ctx context.Context, userID string, token string) (UserWorkspace, error) {
+	invite, err := s.Repo.TakeInvite(ctx, token)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && time.Now().After(invite.ExpiresAt)) {
+		return UserWorkspace{}, ErrInviteInvalid
+	}
+	if err != nil {
+		return UserWorkspace{}, err
+	}
+	ws, err := s.Repo.GetWorkspace(ctx, invite.WorkspaceID)
+	if err != nil {
+		return UserWorkspace{}, mapStorageError(err)
+	}
+
+	role := invite.Role
+	if current, err := s.Repo.GetWorkspaceMember(ctx, invite.WorkspaceID, userID); err == nil && roleRank[current.Role] >= roleRank[role] {
+		return UserWorkspace{Workspace: ws, Role: current.Role}, nil
+	}
+	member := storage.WorkspaceMember{WorkspaceID: invite.WorkspaceID, UserID: userID, Role: role}
+	if err = s.Repo.SetWorkspaceMember(ctx, member); err != nil {
+		return UserWorkspace{}, mapStorageError(err)
+	}
+	return UserWorkspace{Workspace: ws, Role: role}, nil
+}
+
+// LinkOwner возвращает владельца ссылок для операций пользователя: сам userID, если рабочее пространство
+// не задано, иначе рабочее пространство, в котором у пользователя роль не ниже need.
+func (s *URLService) LinkOwner(ctx context.Context, userID string, workspaceID string, need storage.WorkspaceRole) (string, error) {
+	if workspaceID == "" {
+		return userID, nil
+	}
+	if _, err := s.authorize(ctx, userID, workspaceID, need); err != nil {
+		return "", err
+	}
+	return storage.WorkspaceOwner(workspaceID), nil
+}
+
+// authorize проверяет, что у пользователя в рабочем пространстве роль не ниже need.
+// Не участнику возвращается ErrForbidden, как и участнику с младшей ролью.
+func (s *URLService) authorize(ctx context.Context, userID string, workspaceID string, need storage.WorkspaceRole) (storage.WorkspaceMember, error) {
+	member, err := s.Repo.GetWorkspaceMember(ctx, workspaceID, userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return storage.WorkspaceMember{}, ErrForbidden
+	}
+	if err != nil {
+		return storage.WorkspaceMember{}, err
+	}
+	if roleRank[member.Role] < roleRank[need] {
+		return storage.WorkspaceMember{}, ErrForbidden
+	}
+	return member, nil
+}
+
+// linkAccess возвращает ссылку и её владельца, если пользователь владеет ссылкой сам или
+// состоит в её рабочем пространстве с ролью не ниже need. Удалённая ссылка считается несуществующей.
+func (s *URLService) linkAccess(ctx context.Context, userID string, id string, need storage.WorkspaceRole) (storage.UserURL, string, error) {
+	link, err := s.Repo.GetLink(ctx, id)
+	if errors.Is(err, storage.ErrDeleted) {
+		return storage.UserURL{}, "", ErrNotFound
+	}
+	if err != nil {
+		return storage.UserURL{}, "", mapStorageError(err)
+	}
+	if link.UserID == userID {
+		return link, userID, nil
+	}
+	workspaceID := storage.WorkspaceOf(link.UserID)
+	if workspaceID == "" {
+		return storage.UserURL{}, "", ErrForbidden
+	}
+	if _, err = s.authorize(ctx, userID, workspaceID, need); err != nil {
+		return storage.UserURL{}, "", err
+	}
+	return link, link.UserID, nil
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/divanov-web/shorturl/internal/storage"
+	"github.com/divanov-web/shorturl/internal/storage/memorystorage"
+)
+
+func TestURLService_Workspaces(t *testing.T) {
+	ctx := context.Background()
+	store := memorystorage.NewTestStorage()
+	svc := NewURLService(ctx, "http://sho.rt", store)
+
+	ws, err := svc.CreateWorkspace(ctx, "alice", "  Маркетинг  ")
+	require.NoError(t, err)
+	assert.Equal(t, "Маркетинг", ws.Name)
+	assert.Equal(t, storage.RoleOwner, ws.Role)
+	_, err = svc.CreateWorkspace(ctx, "alice", " ")
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+
+	// приглашения создаёт только владелец, каждое срабатывает один раз
+	editorInvite, err := svc.CreateWorkspaceInvite(ctx, "alice", ws.ID, storage.RoleEditor)
+	require.NoError(t, err)
+	viewerInvite, err := svc.CreateWorkspaceInvite(ctx, "alice", ws.ID, storage.RoleViewer)
+	require.NoError(t, err)
+	_, err = svc.CreateWorkspaceInvite(ctx, "bob", ws.ID, storage.RoleViewer)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = svc.CreateWorkspaceInvite(ctx, "alice", ws.ID, "admin")
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+
+	joined, err := svc.AcceptWorkspaceInvite(ctx, "bob", editorInvite.Token)
+	require.NoError(t, err)
+	assert.Equal(t, storage.RoleEditor, joined.Role)
+	_, err = svc.AcceptWorkspaceInvite(ctx, "carol", editorInvite.Token)
+	assert.ErrorIs(t, err, ErrInviteInvalid)
+	_, err = svc.AcceptWorkspaceInvite(ctx, "carol", viewerInvite.Token)
+	require.NoError(t, err)
+
+	// ссылки рабочего пространства видны всем участникам, меняют их редакторы и владельцы
+	editorOwner, err := svc.LinkOwner(ctx, "bob", ws.ID, storage.RoleEditor)
+	require.NoError(t, err)
+	short, err := svc.CreateShort(ctx, editorOwner, "https://a.com/")
+	require.NoError(t, err)
+	id := short[len("http://sho.rt/"):]
+
+	_, err = svc.LinkOwner(ctx, "carol", ws.ID, storage.RoleEditor)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = svc.LinkOwner(ctx, "mallory", ws.ID, storage.RoleViewer)
+	assert.ErrorIs(t, err, ErrForbidden)
+	viewerOwner, err := svc.LinkOwner(ctx, "carol", ws.ID, storage.RoleViewer)
+	require.NoError(t, err)
+	urls, err := svc.GetUserURLs(ctx, viewerOwner, URLFilter{})
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	personal, err := svc.GetUserURLs(ctx, "bob", URLFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, personal)
+
+	_, err = svc.GetUserLink(ctx, "carol", id)
+	require.NoError(t, err)
+	assert.ErrorIs(t, svc.UpdateShort(ctx, "carol", id, "https://b.com/"), ErrForbidden)
+	assert.ErrorIs(t, svc.SetLinkMeta(ctx, "mallory", id, storage.LinkMeta{Title: "x"}), ErrForbidden)
+	require.NoError(t, svc.UpdateShort(ctx, "alice", id, "https://b.com/"))
+	history, err := svc.GetShortHistory(ctx, "carol", id)
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+
+	// редактор удаляет ссылки рабочего пространства
+	require.NoError(t, svc.DeleteUserURLs(ctx, editorOwner, []string{id}))
+	_, err = svc.GetUserLink(ctx, "alice", id)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestURLService_WorkspaceMembers(t *testing.T) {
+	ctx := context.Background()
+	store := memorystorage.NewTestStorage()
+	svc := NewURLService(ctx, "http://sho.rt", store)
+
+	ws, err := svc.CreateWorkspace(ctx, "alice", "Team")
+	require.NoError(t, err)
+	invite, err := svc.CreateWorkspaceInvite(ctx, "alice", ws.ID, storage.RoleViewer)
+	require.NoError(t, err)
+	_, err = svc.AcceptWorkspaceInvite(ctx, "bob", invite.Token)
+	require.NoError(t, err)
+
+	// последний владелец не может уйти или понизить себя
+	assert.ErrorIs(t, svc.RemoveWorkspaceMember(ctx, "alice", ws.ID, "alice"), ErrLastOwner)
+	assert.ErrorIs(t, svc.SetWorkspaceMemberRole(ctx, "alice", ws.ID, "alice", storage.RoleEditor), ErrLastOwner)
+	assert.ErrorIs(t, svc.SetWorkspaceMemberRole(ctx, "bob", ws.ID, "bob", storage.RoleOwner), ErrForbidden)
+	assert.ErrorIs(t, svc.SetWorkspaceMemberRole(ctx, "alice", ws.ID, "nobody", storage.RoleEditor), ErrNotFound)
+
+	require.NoError(t, svc.SetWorkspaceMemberRole(ctx, "alice", ws.ID, "bob", storage.RoleOwner))
+	require.NoError(t, svc.RemoveWorkspaceMember(ctx, "alice", ws.ID, "alice"))
+	members, err := svc.GetWorkspaceMembers(ctx, "bob", ws.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.WorkspaceMember{{WorkspaceID: ws.ID, UserID: "bob", Role: storage.RoleOwner}}, members)
+
+	// просроченное приглашение не срабатывает
+	expired := storage.WorkspaceInvite{Token: "expired", WorkspaceID: ws.ID, Role: storage.RoleEditor, ExpiresAt: time.Now().Add(-time.Minute)}
+	require.NoError(t, store.SaveInvite(ctx, expired))
+	_, err = svc.AcceptWorkspaceInvite(ctx, "carol", "expired")
+	assert.ErrorIs(t, err, ErrInviteInvalid)
+
+	workspaces, err := svc.GetUserWorkspaces(ctx, "alice")
+	require.NoError(t, err)
+	assert.Empty(t, workspaces)
+}
@@ -0,0 +1,45 @@
+package storage
+
+import "fmt"
+
+// DedupScope область уникальности оригинальных URL.
+type DedupScope string
+
+const (
+	// DedupGlobal один оригинальный URL может быть сокращён только один раз на весь сервис.
+	DedupGlobal DedupScope = "global"
+	// DedupUser один оригинальный URL может быть сокращён один раз каждым пользователем.
+	DedupUser DedupScope = "user"
+	// DedupNone дедупликация отключена, каждый запрос создаёт новую ссылку.
+	DedupNone DedupScope = "none"
+)
+
+// ParseDedupScope разбирает область дедупликации из конфига.
+func ParseDedupScope(raw string) (DedupScope, error) {
+	switch scope := DedupScope(raw); scope {
+	case DedupGlobal, DedupUser, DedupNone:
+		return scope, nil
+	}
+	return "", fmt.Errorf("unknown dedup scope %q", raw)
+}
+
+// Key возвращает ключ уникальности для пары пользователь/URL.
+// Второе значение false, если дедупликация отключена.
+func (s DedupScope) Key(userID, original string) (string, bool) {
+	switch s {
+	case DedupGlobal:
+		return original, true
+	case DedupUser:
+		return userID + "\x00" + original, true
+	}
+	return "", false
+}
+
+// DedupValue возвращает значение, по которому проверяется уникальность:
+// нормализованный URL, а если он не задан — оригинальный.
+func DedupValue(original, normalized string) string {
+	if normalized != "" {
+		return normalized
+	}
+	return original
+}
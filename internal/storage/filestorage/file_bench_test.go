@@ -14,7 +14,7 @@ func BenchmarkFileStorage_SaveURL(b *testing.B) {
 	dir := b.TempDir()
 	fp := filepath.Join(dir, "data.jsonl")
 
-	s, err := filestorage.NewStorage(fp)
+	s, err := filestorage.NewStorage(fp, storage.DedupGlobal)
 	if err != nil {
 		b.Fatalf("NewStorage: %v", err)
 	}
@@ -24,7 +24,7 @@ func BenchmarkFileStorage_SaveURL(b *testing.B) {
 
 	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
-		_, _ = s.SaveURL(context.Background(), user, base+strconv.Itoa(i))
+		_, _ = s.SaveURL(context.Background(), user, storage.NewLink{OriginalURL: base + strconv.Itoa(i)})
 	}
 }
 
@@ -32,7 +32,7 @@ func BenchmarkFileStorage_GetURL(b *testing.B) {
 	dir := b.TempDir()
 	fp := filepath.Join(dir, "data.jsonl")
 
-	s, err := filestorage.NewStorage(fp)
+	s, err := filestorage.NewStorage(fp, storage.DedupGlobal)
 	if err != nil {
 		b.Fatalf("NewStorage: %v", err)
 	}
@@ -43,7 +43,7 @@ func BenchmarkFileStorage_GetURL(b *testing.B) {
 	const N = 2000
 	ids := make([]string, N)
 	for i := 0; i < N; i++ {
-		id, _ := s.SaveURL(context.Background(), user, "https://example.com/"+strconv.Itoa(i))
+		id, _ := s.SaveURL(context.Background(), user, storage.NewLink{OriginalURL: "https://example.com/" + strconv.Itoa(i)})
 		ids[i] = id
 	}
 
@@ -64,7 +64,7 @@ func BenchmarkFileStorage_BatchSave_NewEntries(b *testing.B) {
 	dir := b.TempDir()
 	fp := filepath.Join(dir, "data.jsonl")
 
-	s, err := filestorage.NewStorage(fp)
+	s, err := filestorage.NewStorage(fp, storage.DedupGlobal)
 	if err != nil {
 		b.Fatalf("NewStorage: %v", err)
 	}
@@ -86,6 +86,6 @@ func BenchmarkFileStorage_BatchSave_NewEntries(b *testing.B) {
 				OriginalURL:   "https://example.com/" + id,
 			}
 		}
-		_ = s.BatchSave(context.Background(), user, entries)
+		_, _ = s.BatchSave(context.Background(), user, entries, false)
 	}
 }
@@ -5,56 +5,180 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
+	"maps"
 	"os"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/divanov-web/shorturl/internal/storage"
 	"github.com/divanov-web/shorturl/internal/utils/idgen"
+	"github.com/google/uuid"
 )
 
+// compactMinStale сколько байт устаревших строк допускается в файле ссылок без сжатия, даже если записей мало.
+const compactMinStale = 1 << 20
+
 // Item описывает ссылку для сохранения в файле.
+// Файл дописывается целиком обновлённой записью, при загрузке побеждает последняя строка по short_url.
+// Устаревшие строки убираются сжатием файла, см. compact. UUID задаётся при создании записи и не меняется.
 type Item struct {
-	UUID        string `json:"uuid"`
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
+	UUID          string              `json:"uuid"`
+	ShortURL      string              `json:"short_url"`
+	OriginalURL   string              `json:"original_url"`
+	NormalizedURL string              `json:"normalized_url,omitempty"`
+	UserID        string              `json:"user_id,omitempty"`
+	DeletedFlag   bool                `json:"is_deleted,omitempty"`
+	Threat        string              `json:"threat,omitempty"`
+	Disabled      bool                `json:"disabled,omitempty"`
+	CreatedAt     time.Time           `json:"created_at,omitzero"`
+	Clicks        int64               `json:"clicks,omitempty"`
+	MaxClicks     int64               `json:"max_clicks,omitempty"`
+	ClicksLeft    int64               `json:"clicks_left,omitempty"`
+	VariantClicks map[string]int64    `json:"variant_clicks,omitempty"`
+	Domain        string              `json:"domain,omitempty"`
+	NoDedup       bool                `json:"no_dedup,omitempty"`
+	Options       storage.LinkOptions `json:"options,omitzero"`
+	Meta          storage.LinkMeta    `json:"meta,omitzero"`
+	History       []RevisionItem      `json:"history,omitempty"`
+
+	size int64 // длина последней строки записи в файле
+}
+
+// exhausted проверяет, исчерпан ли лимит переходов по ссылке.
+func (item *Item) exhausted() bool {
+	return item.MaxClicks > 0 && item.ClicksLeft <= 0
+}
+
+// userURL переводит запись файла в ссылку хранилища.
+func (item *Item) userURL() storage.UserURL {
+	return storage.UserURL{
+		ShortURL:      item.ShortURL,
+		OriginalURL:   item.OriginalURL,
+		NormalizedURL: item.NormalizedURL,
+		UserID:        item.UserID,
+		DeletedFlag:   item.DeletedFlag,
+		Threat:        item.Threat,
+		Disabled:      item.Disabled,
+		CreatedAt:     item.CreatedAt,
+		Clicks:        item.Clicks,
+		MaxClicks:     item.MaxClicks,
+		ClicksLeft:    item.ClicksLeft,
+		VariantClicks: maps.Clone(item.VariantClicks),
+		Domain:        item.Domain,
+		NoDedup:       item.NoDedup,
+		Options:       item.Options,
+		LinkMeta: storage.LinkMeta{
+			Tags:   slices.Clone(item.Meta.Tags),
+			Folder: item.Meta.Folder,
+			Title:  item.Meta.Title,
+			Note:   item.Meta.Note,
+		},
+	}
+}
+
+// UserItem описывает настройки пользователя в файле настроек.
+type UserItem struct {
+	UserID   string               `json:"user_id"`
+	Settings storage.UserSettings `json:"settings"`
+}
+
+// RevisionItem описывает прежнее значение оригинального URL в файле.
+type RevisionItem struct {
+	OriginalURL string    `json:"original_url"`
+	ChangedAt   time.Time `json:"changed_at"`
 }
 
 // Storage описывает сам Storage файлового хранилища.
+// Счётчики переходов не пишутся в файл на каждый переход: изменённые записи дописываются при Shutdown.
+// Настройки пользователей хранятся рядом, в файле с суффиксом .users, тоже построчно.
+// Рабочие пространства, участники и приглашения — в файле с суффиксом .workspaces, построчно изменениями.
+// Подписки на события ссылок — в файле с суффиксом .webhooks, тоже изменениями.
 type Storage struct {
-	data     map[string]string
-	mu       sync.RWMutex
-	filePath string
+	data       map[string]*Item
+	index      map[string]string // ключ дедупликации -> короткий идентификатор
+	users      map[string]storage.UserSettings
+	workspaces map[string]storage.Workspace
+	members    map[string]map[string]storage.WorkspaceRole // рабочее пространство -> пользователь -> роль
+	invites    map[string]storage.WorkspaceInvite
+	webhooks   map[string]storage.Webhook
+	clicked    map[string]bool // записи с несохранёнными переходами
+	fileSize   int64           // байт в файле ссылок, вместе с устаревшими строками
+	liveSize   int64           // байт в последних строках записей
+	scope      storage.DedupScope
+	mu         sync.RWMutex
+	filePath   string
 }
 
 // NewStorage создаёт файловое хранилище и загружает данные из указанного файла.
-func NewStorage(filePath string) (*Storage, error) {
+func NewStorage(filePath string, scope storage.DedupScope) (*Storage, error) {
 	s := &Storage{
-		data:     make(map[string]string),
-		filePath: filePath,
+		data:       make(map[string]*Item),
+		index:      make(map[string]string),
+		users:      make(map[string]storage.UserSettings),
+		workspaces: make(map[string]storage.Workspace),
+		members:    make(map[string]map[string]storage.WorkspaceRole),
+		invites:    make(map[string]storage.WorkspaceInvite),
+		webhooks:   make(map[string]storage.Webhook),
+		clicked:    make(map[string]bool),
+		scope:      scope,
+		filePath:   filePath,
 	}
 
 	// Загружаем данные из файла (если файл существует)
 	if err := s.loadFromFile(); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return nil, err
 	}
+	if err := s.loadUsers(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err := s.loadWorkspaces(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err := s.loadWebhooks(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
 
 	return s, nil
 }
 
 // SaveURL сохраняет оригинальный URL и возвращает его короткий идентификатор.
-func (s *Storage) SaveURL(ctx context.Context, userID string, original string) (string, error) {
+// Если URL уже сокращён в рамках области дедупликации, возвращает ErrConflict
+// и идентификатор существующей ссылки, только если она принадлежит userID.
+// Ссылка, которая не участвует в дедупликации, создаётся всегда.
+func (s *Storage) SaveURL(ctx context.Context, userID string, link storage.NewLink) (string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if !link.NoDedup() {
+		if existing, ok := s.lookup(userID, storage.DedupValue(link.OriginalURL, link.NormalizedURL)); ok {
+			if existing.UserID == userID {
+				return existing.ShortURL, storage.ErrConflict
+			}
+			return "", storage.ErrConflict
+		}
+	}
+
 	id := idgen.Generate(8)
-	s.data[id] = original
+	item := &Item{
+		ShortURL:      id,
+		OriginalURL:   link.OriginalURL,
+		NormalizedURL: link.NormalizedURL,
+		UserID:        userID,
+		UUID:          uuid.NewString(),
+		CreatedAt:     time.Now(),
+		MaxClicks:     link.MaxClicks,
+		ClicksLeft:    link.MaxClicks,
+		Domain:        link.Domain,
+		NoDedup:       link.NoDedup(),
+		Options:       link.Options,
+		Meta:          link.Meta,
+	}
+	s.put(item)
 
-	_ = s.appendToFile(Item{
-		UUID:        time.Now().Format("20060102150405.000000"), // временный uuid
-		ShortURL:    id,
-		OriginalURL: original,
-	})
+	_ = s.appendToFile(item)
 
 	return id, nil
 }
@@ -63,8 +187,210 @@ func (s *Storage) SaveURL(ctx context.Context, userID string, original string) (
 func (s *Storage) GetURL(ctx context.Context, id string) (string, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	url, ok := s.data[id]
-	return url, ok
+	item, ok := s.data[id]
+	if !ok || item.DeletedFlag {
+		return "", false
+	}
+	return item.OriginalURL, true
+}
+
+// GetLink возвращает неудалённую ссылку по короткому идентификатору.
+// Для удалённой ссылки возвращает ErrDeleted, для несуществующей — ErrNotFound.
+func (s *Storage) GetLink(ctx context.Context, id string) (storage.UserURL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	item, ok := s.data[id]
+	if !ok {
+		return storage.UserURL{}, storage.ErrNotFound
+	}
+	if item.DeletedFlag {
+		return storage.UserURL{}, storage.ErrDeleted
+	}
+	return item.userURL(), nil
+}
+
+// ListURLs возвращает до limit неудалённых ссылок с идентификатором больше after в порядке идентификаторов.
+func (s *Storage) ListURLs(ctx context.Context, after string, limit int) ([]storage.UserURL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := make([]string, 0, len(s.data))
+	for id, item := range s.data {
+		if id > after && !item.DeletedFlag {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	result := make([]storage.UserURL, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, s.data[id].userURL())
+	}
+	return result, nil
+}
+
+// SetThreat отмечает ссылку как опасную, пустой threat снимает отметку.
+// В файл дописывается новая версия записи, только если отметка изменилась.
+func (s *Storage) SetThreat(ctx context.Context, id string, threat string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.data[id]
+	if !ok || item.DeletedFlag {
+		return storage.ErrNotFound
+	}
+	if item.Threat == threat {
+		return nil
+	}
+	item.Threat = threat
+	return s.appendToFile(item)
+}
+
+// SetDisabled блокирует ссылку или снимает блокировку и дописывает запись в файл.
+func (s *Storage) SetDisabled(ctx context.Context, id string, disabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.data[id]
+	if !ok || item.DeletedFlag {
+		return storage.ErrNotFound
+	}
+	if item.Disabled == disabled {
+		return nil
+	}
+	item.Disabled = disabled
+	return s.appendToFile(item)
+}
+
+// RecordClick увеличивает счётчик переходов по ссылке и списывает переход из лимита.
+// Непустой variant учитывается в счётчике варианта A/B-теста.
+// Если лимит исчерпан, возвращает ErrExhausted и переход не учитывает.
+// Для ссылок без лимита счётчик попадёт в файл при Shutdown или вместе со следующим изменением записи,
+// ссылки с лимитом дописываются сразу, чтобы остаток не восстановился после перезапуска.
+func (s *Storage) RecordClick(ctx context.Context, id string, variant string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.data[id]
+	if !ok || item.DeletedFlag {
+		return storage.ErrNotFound
+	}
+	if item.exhausted() {
+		return storage.ErrExhausted
+	}
+	item.Clicks++
+	if variant != "" {
+		if item.VariantClicks == nil {
+			item.VariantClicks = make(map[string]int64)
+		}
+		item.VariantClicks[variant]++
+	}
+	if item.MaxClicks > 0 {
+		item.ClicksLeft--
+		delete(s.clicked, id)
+		return s.appendToFile(item)
+	}
+	s.clicked[id] = true
+	return nil
+}
+
+// SetMaxClicks задаёт лимит переходов по ссылке пользователя и сбрасывает остаток, 0 снимает лимит.
+func (s *Storage) SetMaxClicks(ctx context.Context, userID string, id string, maxClicks int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, err := s.ownedItem(userID, id)
+	if err != nil {
+		return err
+	}
+	item.MaxClicks = maxClicks
+	item.ClicksLeft = maxClicks
+	return s.appendToFile(item)
+}
+
+// SetOptions меняет настройки ссылки пользователя.
+func (s *Storage) SetOptions(ctx context.Context, userID string, id string, opts storage.LinkOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, err := s.ownedItem(userID, id)
+	if err != nil {
+		return err
+	}
+	item.Options = opts
+	return s.appendToFile(item)
+}
+
+// SetMeta заменяет теги, папку, заголовок и заметку ссылки пользователя.
+func (s *Storage) SetMeta(ctx context.Context, userID string, id string, meta storage.LinkMeta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, err := s.ownedItem(userID, id)
+	if err != nil {
+		return err
+	}
+	item.Meta = meta
+	return s.appendToFile(item)
+}
+
+// SetDomain привязывает ссылку пользователя к короткому домену.
+func (s *Storage) SetDomain(ctx context.Context, userID string, id string, domain string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, err := s.ownedItem(userID, id)
+	if err != nil {
+		return err
+	}
+	item.Domain = domain
+	return s.appendToFile(item)
+}
+
+// GetUserSettings возвращает настройки пользователя, для нового пользователя — пустые.
+func (s *Storage) GetUserSettings(ctx context.Context, userID string) (storage.UserSettings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.users[userID], nil
+}
+
+// SetUserSettings сохраняет настройки пользователя и дописывает их в файл настроек.
+func (s *Storage) SetUserSettings(ctx context.Context, userID string, settings storage.UserSettings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[userID] = settings
+	if s.filePath == "" {
+		return nil
+	}
+	file, err := os.OpenFile(s.usersPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return json.NewEncoder(file).Encode(UserItem{UserID: userID, Settings: settings})
+}
+
+// usersPath путь к файлу настроек пользователей.
+func (s *Storage) usersPath() string {
+	return s.filePath + ".users"
+}
+
+// loadUsers читает настройки пользователей, более поздние строки перекрывают ранние.
+func (s *Storage) loadUsers() error {
+	if s.filePath == "" {
+		return nil
+	}
+	file, err := os.Open(s.usersPath())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var item UserItem
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			continue
+		}
+		s.users[item.UserID] = item.Settings
+	}
+	return scanner.Err()
 }
 
 // ForceSet добавляет или обновляет запись с указанным идентификатором и URL.
@@ -72,10 +398,36 @@ func (s *Storage) GetURL(ctx context.Context, id string) (string, bool) {
 func (s *Storage) ForceSet(id, url string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.data[id] = url
+	s.put(&Item{UUID: uuid.NewString(), ShortURL: id, OriginalURL: url})
+}
+
+// lookup ищет неудалённую запись с тем же ключом дедупликации. Вызывать под блокировкой.
+func (s *Storage) lookup(userID, value string) (*Item, bool) {
+	key, ok := s.scope.Key(userID, value)
+	if !ok {
+		return nil, false
+	}
+	item, ok := s.data[s.index[key]]
+	return item, ok
 }
 
-func (s *Storage) appendToFile(item Item) error {
+// put сохраняет запись и обновляет индекс дедупликации. Вызывать под блокировкой.
+func (s *Storage) put(item *Item) {
+	s.data[item.ShortURL] = item
+	if key, ok := s.scope.Key(item.UserID, storage.DedupValue(item.OriginalURL, item.NormalizedURL)); ok && !item.DeletedFlag && !item.NoDedup {
+		s.index[key] = item.ShortURL
+	}
+}
+
+// unindex убирает запись из индекса дедупликации. Вызывать под блокировкой.
+func (s *Storage) unindex(item *Item) {
+	if key, ok := s.scope.Key(item.UserID, storage.DedupValue(item.OriginalURL, item.NormalizedURL)); ok && s.index[key] == item.ShortURL {
+		delete(s.index, key)
+	}
+}
+
+// appendToFile дописывает актуальное состояние записи в файл.
+func (s *Storage) appendToFile(item *Item) error {
 	if s.filePath == "" {
 		return nil
 	}
@@ -85,8 +437,100 @@ func (s *Storage) appendToFile(item Item) error {
 	}
 	defer file.Close()
 
-	enc := json.NewEncoder(file)
-	return enc.Encode(item)
+	if err = s.writeItem(file, item); err != nil {
+		return err
+	}
+	s.compactIfBloated()
+	return nil
+}
+
+// appendManyToFile дописывает несколько записей за одно открытие файла.
+func (s *Storage) appendManyToFile(items []*Item) error {
+	if s.filePath == "" || len(items) == 0 {
+		return nil
+	}
+	file, err := os.OpenFile(s.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	for _, item := range items {
+		if err := s.writeItem(w, item); err != nil {
+			return err
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	s.compactIfBloated()
+	return nil
+}
+
+// writeItem пишет строку записи и учитывает её размер. Вызывать под блокировкой.
+func (s *Storage) writeItem(w io.Writer, item *Item) error {
+	b, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if _, err = w.Write(b); err != nil {
+		return err
+	}
+	s.fileSize += int64(len(b))
+	s.liveSize += int64(len(b)) - item.size
+	item.size = int64(len(b))
+	return nil
+}
+
+// compactIfBloated сжимает файл, когда устаревшие строки занимают в нём больше места, чем актуальные.
+// Иначе каждое изменение дописывало бы запись целиком вместе с историей, и файл рос бы квадратично.
+// Ошибка сжатия не мешает работе: файл остаётся корректным, сжатие повторится при следующей записи.
+func (s *Storage) compactIfBloated() {
+	if s.fileSize-s.liveSize > max(s.liveSize, compactMinStale) {
+		_ = s.compact()
+	}
+}
+
+// compact переписывает файл ссылок по одной строке на запись. Новый файл пишется рядом
+// и подменяет старый переименованием, поэтому при сбое остаётся один из двух целых файлов.
+// Несохранённые переходы попадают в новый файл. Вызывать под блокировкой.
+func (s *Storage) compact() error {
+	tmpPath := s.filePath + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath) // после успешного переименования файла уже нет
+
+	fileSize, liveSize := s.fileSize, s.liveSize
+	s.fileSize, s.liveSize = 0, 0
+	w := bufio.NewWriter(file)
+	for _, id := range slices.Sorted(maps.Keys(s.data)) {
+		if err = s.writeItem(w, s.data[id]); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, s.filePath)
+	}
+	if err != nil {
+		// остаётся старый файл, сжатие повторится при следующей записи
+		s.fileSize, s.liveSize = fileSize, liveSize
+		return err
+	}
+	clear(s.clicked)
+	return nil
 }
 
 func (s *Storage) loadFromFile() error {
@@ -99,15 +543,47 @@ func (s *Storage) loadFromFile() error {
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
+	// строка с длинной историей изменений может быть больше буфера bufio.Scanner, поэтому читаем без ограничения
+	reader := bufio.NewReader(file)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+		if len(line) == 0 {
+			break
+		}
+		size := int64(len(line))
+		s.fileSize += size
 		var item Item
-		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+		if err := json.Unmarshal(line, &item); err != nil {
 			continue
 		}
-		s.data[item.ShortURL] = item.OriginalURL
+		if prev, ok := s.data[item.ShortURL]; ok {
+			s.liveSize -= prev.size
+			if item.UUID == "" {
+				item.UUID = prev.UUID
+			}
+		}
+		item.size = size
+		s.liveSize += size
+		s.data[item.ShortURL] = &item
 	}
-	return scanner.Err()
+	// индекс строим после загрузки, так как более поздние строки перекрывают ранние
+	missingUUID := false
+	for _, item := range s.data {
+		if item.UUID == "" {
+			item.UUID = uuid.NewString() // записи, сохранённые без uuid
+			missingUUID = true
+		}
+		s.put(item)
+	}
+	// устаревшие строки убираем и выданные uuid сохраняем сразу; при ошибке продолжаем со старым файлом
+	if s.fileSize > s.liveSize || missingUUID {
+		file.Close()
+		_ = s.compact()
+	}
+	return nil
 }
 
 // Ping проверяет доступность хранилища (заглушка).
@@ -119,44 +595,206 @@ func (s *Storage) Ping() error {
 // Используется в тестах.
 func NewTestStorage() *Storage {
 	return &Storage{
-		data: make(map[string]string),
+		data:       make(map[string]*Item),
+		index:      make(map[string]string),
+		users:      make(map[string]storage.UserSettings),
+		workspaces: make(map[string]storage.Workspace),
+		members:    make(map[string]map[string]storage.WorkspaceRole),
+		invites:    make(map[string]storage.WorkspaceInvite),
+		webhooks:   make(map[string]storage.Webhook),
+		clicked:    make(map[string]bool),
+		scope:      storage.DedupGlobal,
 	}
 }
 
-// BatchSave сохраняет несколько записей за один вызов.
-func (s *Storage) BatchSave(ctx context.Context, userID string, entries []storage.BatchEntry) error {
+// BatchSave сохраняет несколько записей за один вызов и возвращает итог по каждой записи.
+// В атомарном режиме при конфликте с чужой ссылкой ничего не сохраняет и возвращает ErrConflict.
+// В файл записи попадают только после проверки всего батча.
+func (s *Storage) BatchSave(ctx context.Context, userID string, entries []storage.BatchEntry, atomic bool) ([]storage.BatchResult, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	for _, entry := range entries {
-		if _, exists := s.data[entry.ShortURL]; exists {
+	results := make([]storage.BatchResult, len(entries))
+	created := make([]*Item, 0, len(entries))
+	conflict := false
+
+	for i, entry := range entries {
+		results[i] = storage.BatchResult{ShortURL: entry.ShortURL, CorrelationID: entry.CorrelationID}
+
+		if existing, ok := s.lookup(userID, storage.DedupValue(entry.OriginalURL, entry.NormalizedURL)); ok {
+			if existing.UserID == userID {
+				results[i].ShortURL = existing.ShortURL
+				results[i].Status = storage.BatchExisting
+			} else {
+				results[i].ShortURL = ""
+				results[i].Status = storage.BatchConflict
+				conflict = true
+			}
 			continue
 		}
-		s.data[entry.ShortURL] = entry.OriginalURL
 
-		_ = s.appendToFile(Item{
-			UUID:        time.Now().Format("20060102150405.000000"),
-			ShortURL:    entry.ShortURL,
-			OriginalURL: entry.OriginalURL,
-		})
+		// при коллизии идентификатора генерируем новый
+		for {
+			if _, exists := s.data[results[i].ShortURL]; !exists {
+				break
+			}
+			results[i].ShortURL = idgen.Generate(8)
+		}
+
+		item := &Item{
+			UUID:          uuid.NewString(),
+			ShortURL:      results[i].ShortURL,
+			OriginalURL:   entry.OriginalURL,
+			NormalizedURL: entry.NormalizedURL,
+			UserID:        userID,
+			CreatedAt:     time.Now(),
+			Domain:        entry.Domain,
+		}
+		s.put(item)
+		created = append(created, item)
 	}
 
-	return nil
+	if atomic && conflict {
+		for _, item := range created {
+			s.unindex(item)
+			delete(s.data, item.ShortURL)
+		}
+		return results, storage.ErrConflict
+	}
+
+	if err := s.appendManyToFile(created); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// BulkSave сохраняет крупную порцию записей при массовом импорте.
+// Это тот же BatchSave без атомарности: записи дописываются в файл одним открытием.
+func (s *Storage) BulkSave(ctx context.Context, userID string, entries []storage.BatchEntry) ([]storage.BatchResult, error) {
+	return s.BatchSave(ctx, userID, entries, false)
 }
 
-// GetUserURLs - заглушка, отправляем пустой список
+// GetUserURLs возвращает все неудалённые ссылки пользователя.
 func (s *Storage) GetUserURLs(ctx context.Context, userID string) ([]storage.UserURL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	var result []storage.UserURL
+	for _, item := range s.data {
+		if item.UserID == userID && !item.DeletedFlag {
+			result = append(result, item.userURL())
+		}
+	}
+	return result, nil
+}
+
+// MarkAsDeleted помечает ссылки пользователя как удалённые и возвращает те, что были удалены этим вызовом.
+func (s *Storage) MarkAsDeleted(ctx context.Context, userID string, ids []string) ([]storage.UserURL, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted []storage.UserURL
+	for _, id := range ids {
+		item, ok := s.data[id]
+		if !ok || item.UserID != userID || item.DeletedFlag {
+			continue
+		}
+		s.unindex(item)
+		item.DeletedFlag = true
+		if err := s.appendToFile(item); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, item.userURL())
+	}
+	return deleted, nil
+}
+
+// RestoreURL снимает отметку удаления со ссылки пользователя. Неудалённая ссылка не меняется.
+// Если тот же URL уже сокращён заново, возвращает ErrConflict.
+func (s *Storage) RestoreURL(ctx context.Context, userID string, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.data[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	if item.UserID != userID {
+		return storage.ErrForbidden
+	}
+	if !item.DeletedFlag {
+		return nil
+	}
+	if _, exists := s.lookup(userID, storage.DedupValue(item.OriginalURL, item.NormalizedURL)); exists && !item.NoDedup {
+		return storage.ErrConflict
+	}
+	item.DeletedFlag = false
+	s.put(item)
+	return s.appendToFile(item)
+}
+
+// UpdateURL меняет оригинальный URL ссылки пользователя, сохраняя прежнее значение в истории.
+func (s *Storage) UpdateURL(ctx context.Context, userID string, id string, original string, normalized string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, err := s.ownedItem(userID, id)
+	if err != nil {
+		return err
+	}
+	if item.OriginalURL == original {
+		return nil
+	}
+	if existing, exists := s.lookup(userID, storage.DedupValue(original, normalized)); exists && existing != item && !item.NoDedup {
+		return storage.ErrConflict
+	}
+	s.unindex(item)
+	item.History = append(item.History, RevisionItem{OriginalURL: item.OriginalURL, ChangedAt: time.Now()})
+	item.OriginalURL = original
+	item.NormalizedURL = normalized
+	s.put(item)
+	return s.appendToFile(item)
+}
+
+// GetURLHistory возвращает историю изменений ссылки пользователя.
+func (s *Storage) GetURLHistory(ctx context.Context, userID string, id string) ([]storage.URLRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, err := s.ownedItem(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]storage.URLRevision, 0, len(item.History))
+	for _, rev := range item.History {
+		result = append(result, storage.URLRevision{OriginalURL: rev.OriginalURL, ChangedAt: rev.ChangedAt})
+	}
 	return result, nil
 }
 
-// MarkAsDeleted помечает ссылки пользователя как удалённые (заглушка).
-func (s *Storage) MarkAsDeleted(ctx context.Context, userID string, ids []string) error {
-	return storage.ErrNotImplemented
+// ownedItem ищет неудалённую запись и проверяет владельца. Вызывать под блокировкой.
+func (s *Storage) ownedItem(userID string, id string) (*Item, error) {
+	item, ok := s.data[id]
+	if !ok || item.DeletedFlag {
+		return nil, storage.ErrNotFound
+	}
+	if item.UserID != userID {
+		return nil, storage.ErrForbidden
+	}
+	return item, nil
 }
 
-// Shutdown корректно завершает файловое хранилище
+// Shutdown корректно завершает файловое хранилище: дописывает записи с несохранёнными переходами.
 // Вроде как в текущей реализации все файлы закрываются сами
 func (s *Storage) Shutdown(ctx context.Context) error {
-	return nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := make([]*Item, 0, len(s.clicked))
+	for id := range s.clicked {
+		items = append(items, s.data[id])
+	}
+	clear(s.clicked)
+	return s.appendManyToFile(items)
 }
@@ -6,7 +6,9 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/divanov-web/shorturl/internal/storage"
 	"github.com/divanov-web/shorturl/internal/storage/filestorage"
@@ -27,7 +29,7 @@ func TestNewStorage_LoadFromExistingFile(t *testing.T) {
 	_ = enc.Encode(filestorage.Item{UUID: "2", ShortURL: "zzz00000", OriginalURL: "https://b.com"})
 	_ = f.Close()
 
-	s, err := filestorage.NewStorage(fp)
+	s, err := filestorage.NewStorage(fp, storage.DedupGlobal)
 	if err != nil {
 		t.Fatalf("NewStorage: %v", err)
 	}
@@ -45,12 +47,12 @@ func TestSaveURL_WritesToMapAndFile(t *testing.T) {
 	dir := t.TempDir()
 	fp := filepath.Join(dir, "data.jsonl")
 
-	s, err := filestorage.NewStorage(fp)
+	s, err := filestorage.NewStorage(fp, storage.DedupGlobal)
 	if err != nil {
 		t.Fatalf("NewStorage: %v", err)
 	}
 
-	id, err := s.SaveURL(context.Background(), "user1", "https://example.com/one")
+	id, err := s.SaveURL(context.Background(), "user1", storage.NewLink{OriginalURL: "https://example.com/one"})
 	if err != nil {
 		t.Fatalf("SaveURL: %v", err)
 	}
@@ -77,7 +79,7 @@ func TestBatchSave_AddsOnlyNewAndAppendsToFile(t *testing.T) {
 	dir := t.TempDir()
 	fp := filepath.Join(dir, "data.jsonl")
 
-	s, err := filestorage.NewStorage(fp)
+	s, err := filestorage.NewStorage(fp, storage.DedupGlobal)
 	if err != nil {
 		t.Fatalf("NewStorage: %v", err)
 	}
@@ -86,13 +88,19 @@ func TestBatchSave_AddsOnlyNewAndAppendsToFile(t *testing.T) {
 		{ShortURL: "id1", OriginalURL: "https://a.com", CorrelationID: "1"},
 		{ShortURL: "id2", OriginalURL: "https://b.com", CorrelationID: "2"},
 	}
-	if err = s.BatchSave(context.Background(), "user1", batch); err != nil {
+	if _, err = s.BatchSave(context.Background(), "user1", batch, false); err != nil {
 		t.Fatalf("BatchSave first: %v", err)
 	}
 	// повтор — записи уже существуют, в файл не должны добавиться дубликаты
-	if err = s.BatchSave(context.Background(), "user1", batch); err != nil {
+	results, err := s.BatchSave(context.Background(), "user1", batch, false)
+	if err != nil {
 		t.Fatalf("BatchSave second: %v", err)
 	}
+	for _, res := range results {
+		if res.Status != storage.BatchExisting {
+			t.Fatalf("BatchSave second status for %s = %v, want BatchExisting", res.CorrelationID, res.Status)
+		}
+	}
 
 	// карта хранит обе записи
 	if got, ok := s.GetURL(context.Background(), "id1"); !ok || got != "https://a.com" {
@@ -112,6 +120,122 @@ func TestBatchSave_AddsOnlyNewAndAppendsToFile(t *testing.T) {
 	}
 }
 
+// TestUpdateURL_KeepsHistoryAfterReload тест изменения ссылки и загрузки истории из файла
+func TestUpdateURL_KeepsHistoryAfterReload(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "data.jsonl")
+
+	s, err := filestorage.NewStorage(fp, storage.DedupGlobal)
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+
+	id, err := s.SaveURL(context.Background(), "user1", storage.NewLink{OriginalURL: "https://a.com"})
+	if err != nil {
+		t.Fatalf("SaveURL: %v", err)
+	}
+	if err = s.UpdateURL(context.Background(), "user2", id, "https://b.com", ""); !errorsIs(err, storage.ErrForbidden) {
+		t.Fatalf("UpdateURL by stranger err = %v, want ErrForbidden", err)
+	}
+	if err = s.UpdateURL(context.Background(), "user1", id, "https://b.com", ""); err != nil {
+		t.Fatalf("UpdateURL: %v", err)
+	}
+
+	reloaded, err := filestorage.NewStorage(fp, storage.DedupGlobal)
+	if err != nil {
+		t.Fatalf("NewStorage reload: %v", err)
+	}
+	if got, ok := reloaded.GetURL(context.Background(), id); !ok || got != "https://b.com" {
+		t.Fatalf("GetURL after reload = (%q,%v), want (https://b.com,true)", got, ok)
+	}
+	history, err := reloaded.GetURLHistory(context.Background(), "user1", id)
+	if err != nil {
+		t.Fatalf("GetURLHistory: %v", err)
+	}
+	if len(history) != 1 || history[0].OriginalURL != "https://a.com" {
+		t.Fatalf("history = %+v, want one revision with https://a.com", history)
+	}
+}
+
+// TestSaveURL_DedupScope тест областей дедупликации исходных URL
+func TestSaveURL_DedupScope(t *testing.T) {
+	tests := []struct {
+		name           string
+		scope          storage.DedupScope
+		wantOwnErr     error
+		wantForeignErr error
+	}{
+		{name: "global", scope: storage.DedupGlobal, wantOwnErr: storage.ErrConflict, wantForeignErr: storage.ErrConflict},
+		{name: "user", scope: storage.DedupUser, wantOwnErr: storage.ErrConflict, wantForeignErr: nil},
+		{name: "none", scope: storage.DedupNone, wantOwnErr: nil, wantForeignErr: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := filestorage.NewStorage("", tt.scope)
+			if err != nil {
+				t.Fatalf("NewStorage: %v", err)
+			}
+
+			first, err := s.SaveURL(context.Background(), "userA", storage.NewLink{OriginalURL: "https://a.com"})
+			if err != nil {
+				t.Fatalf("SaveURL first: %v", err)
+			}
+
+			own, err := s.SaveURL(context.Background(), "userA", storage.NewLink{OriginalURL: "https://a.com"})
+			if !errorsIs(err, tt.wantOwnErr) {
+				t.Fatalf("SaveURL same user err = %v, want %v", err, tt.wantOwnErr)
+			}
+			if tt.wantOwnErr != nil && own != first {
+				t.Fatalf("SaveURL same user id = %q, want %q", own, first)
+			}
+
+			foreign, err := s.SaveURL(context.Background(), "userB", storage.NewLink{OriginalURL: "https://a.com"})
+			if !errorsIs(err, tt.wantForeignErr) {
+				t.Fatalf("SaveURL other user err = %v, want %v", err, tt.wantForeignErr)
+			}
+			if tt.wantForeignErr != nil && foreign != "" {
+				t.Fatalf("SaveURL other user revealed id %q", foreign)
+			}
+		})
+	}
+}
+
+// TestBatchSave_AtomicConflict тест отката атомарного батча при конфликте с чужой ссылкой
+func TestBatchSave_AtomicConflict(t *testing.T) {
+	s := filestorage.NewTestStorage()
+	if _, err := s.SaveURL(context.Background(), "userA", storage.NewLink{OriginalURL: "https://a.com"}); err != nil {
+		t.Fatalf("SaveURL: %v", err)
+	}
+
+	batch := []storage.BatchEntry{
+		{ShortURL: "id1", OriginalURL: "https://a.com", CorrelationID: "1"},
+		{ShortURL: "id2", OriginalURL: "https://b.com", CorrelationID: "2"},
+	}
+
+	results, err := s.BatchSave(context.Background(), "userB", batch, true)
+	if !errorsIs(err, storage.ErrConflict) {
+		t.Fatalf("BatchSave atomic err = %v, want ErrConflict", err)
+	}
+	if results[0].Status != storage.BatchConflict || results[0].ShortURL != "" {
+		t.Fatalf("BatchSave atomic result[0] = %+v, want hidden conflict", results[0])
+	}
+	if _, ok := s.GetURL(context.Background(), "id2"); ok {
+		t.Fatalf("atomic batch must not save id2")
+	}
+
+	results, err = s.BatchSave(context.Background(), "userB", batch, false)
+	if err != nil {
+		t.Fatalf("BatchSave best-effort: %v", err)
+	}
+	if results[1].Status != storage.BatchCreated {
+		t.Fatalf("BatchSave best-effort result[1] = %+v, want created", results[1])
+	}
+	if _, ok := s.GetURL(context.Background(), "id2"); !ok {
+		t.Fatalf("best-effort batch must save id2")
+	}
+}
+
 // --- helpers ---
 
 func countLines(path string) (int, error) {
@@ -142,3 +266,362 @@ func errorsIs(err, target error) bool {
 	}
 	return false
 }
+
+// TestSetMeta_KeepsAfterReload теги и заметки ссылки сохраняются в файле
+func TestSetMeta_KeepsAfterReload(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "data.jsonl")
+
+	s, err := filestorage.NewStorage(fp, storage.DedupGlobal)
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+
+	id, err := s.SaveURL(context.Background(), "user1", storage.NewLink{OriginalURL: "https://a.com"})
+	if err != nil {
+		t.Fatalf("SaveURL: %v", err)
+	}
+	meta := storage.LinkMeta{Tags: []string{"promo", "q3"}, Folder: "campaigns", Title: "Лендинг", Note: "для рассылки"}
+	if err = s.SetMeta(context.Background(), "user2", id, meta); !errorsIs(err, storage.ErrForbidden) {
+		t.Fatalf("SetMeta by stranger err = %v, want ErrForbidden", err)
+	}
+	if err = s.SetMeta(context.Background(), "user1", id, meta); err != nil {
+		t.Fatalf("SetMeta: %v", err)
+	}
+
+	reloaded, err := filestorage.NewStorage(fp, storage.DedupGlobal)
+	if err != nil {
+		t.Fatalf("NewStorage reload: %v", err)
+	}
+	link, err := reloaded.GetLink(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetLink: %v", err)
+	}
+	if link.Folder != "campaigns" || link.Title != "Лендинг" || link.Note != "для рассылки" ||
+		len(link.Tags) != 2 || link.Tags[0] != "promo" || link.Tags[1] != "q3" {
+		t.Fatalf("meta after reload = %+v, want %+v", link.LinkMeta, meta)
+	}
+}
+
+// TestDomainAndSettings_KeepAfterReload домен ссылки и настройки пользователя переживают перезапуск
+func TestDomainAndSettings_KeepAfterReload(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "data.jsonl")
+
+	s, err := filestorage.NewStorage(fp, storage.DedupGlobal)
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+
+	id, err := s.SaveURL(context.Background(), "user1", storage.NewLink{OriginalURL: "https://a.com"})
+	if err != nil {
+		t.Fatalf("SaveURL: %v", err)
+	}
+	if err = s.SetDisabled(context.Background(), id, true); err != nil {
+		t.Fatalf("SetDisabled: %v", err)
+	}
+	if err = s.SetDomain(context.Background(), "user1", id, "go.example"); err != nil {
+		t.Fatalf("SetDomain: %v", err)
+	}
+	if err = s.SetUserSettings(context.Background(), "user1", storage.UserSettings{DefaultDomain: "go.example", Blocked: true}); err != nil {
+		t.Fatalf("SetUserSettings: %v", err)
+	}
+
+	reloaded, err := filestorage.NewStorage(fp, storage.DedupGlobal)
+	if err != nil {
+		t.Fatalf("NewStorage reload: %v", err)
+	}
+	link, err := reloaded.GetLink(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetLink: %v", err)
+	}
+	if link.Domain != "go.example" || !link.Disabled {
+		t.Fatalf("link after reload = %+v, want domain go.example and disabled", link)
+	}
+	settings, err := reloaded.GetUserSettings(context.Background(), "user1")
+	if err != nil {
+		t.Fatalf("GetUserSettings: %v", err)
+	}
+	if settings.DefaultDomain != "go.example" || !settings.Blocked {
+		t.Fatalf("settings after reload = %+v, want default_domain go.example and blocked", settings)
+	}
+}
+
+// TestWorkspaces_KeepAfterReload участники и приглашения переживают перезапуск, использованное приглашение не возвращается
+func TestWorkspaces_KeepAfterReload(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "data.jsonl")
+	ctx := context.Background()
+
+	s, err := filestorage.NewStorage(fp, storage.DedupGlobal)
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+
+	ws := storage.Workspace{ID: "ws1", Name: "Team", CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	if err = s.CreateWorkspace(ctx, ws, "alice"); err != nil {
+		t.Fatalf("CreateWorkspace: %v", err)
+	}
+	if err = s.CreateWorkspace(ctx, ws, "bob"); !errorsIs(err, storage.ErrConflict) {
+		t.Fatalf("CreateWorkspace duplicate err = %v, want ErrConflict", err)
+	}
+	if err = s.SetWorkspaceMember(ctx, storage.WorkspaceMember{WorkspaceID: "ws1", UserID: "bob", Role: storage.RoleEditor}); err != nil {
+		t.Fatalf("SetWorkspaceMember: %v", err)
+	}
+	if err = s.SetWorkspaceMember(ctx, storage.WorkspaceMember{WorkspaceID: "ws1", UserID: "carol", Role: storage.RoleViewer}); err != nil {
+		t.Fatalf("SetWorkspaceMember: %v", err)
+	}
+	if err = s.RemoveWorkspaceMember(ctx, "ws1", "carol"); err != nil {
+		t.Fatalf("RemoveWorkspaceMember: %v", err)
+	}
+	for _, token := range []string{"used", "open"} {
+		if err = s.SaveInvite(ctx, storage.WorkspaceInvite{Token: token, WorkspaceID: "ws1", Role: storage.RoleViewer}); err != nil {
+			t.Fatalf("SaveInvite: %v", err)
+		}
+	}
+	if _, err = s.TakeInvite(ctx, "used"); err != nil {
+		t.Fatalf("TakeInvite: %v", err)
+	}
+
+	reloaded, err := filestorage.NewStorage(fp, storage.DedupGlobal)
+	if err != nil {
+		t.Fatalf("NewStorage reload: %v", err)
+	}
+	got, err := reloaded.GetWorkspace(ctx, "ws1")
+	if err != nil || !got.CreatedAt.Equal(ws.CreatedAt) || got.Name != ws.Name {
+		t.Fatalf("GetWorkspace = (%+v, %v), want %+v", got, err, ws)
+	}
+	members, err := reloaded.GetWorkspaceMembers(ctx, "ws1")
+	if err != nil {
+		t.Fatalf("GetWorkspaceMembers: %v", err)
+	}
+	want := []storage.WorkspaceMember{
+		{WorkspaceID: "ws1", UserID: "alice", Role: storage.RoleOwner},
+		{WorkspaceID: "ws1", UserID: "bob", Role: storage.RoleEditor},
+	}
+	if len(members) != len(want) || members[0] != want[0] || members[1] != want[1] {
+		t.Fatalf("members after reload = %+v, want %+v", members, want)
+	}
+	if _, err = reloaded.TakeInvite(ctx, "used"); !errorsIs(err, storage.ErrNotFound) {
+		t.Fatalf("TakeInvite used err = %v, want ErrNotFound", err)
+	}
+	if _, err = reloaded.TakeInvite(ctx, "open"); err != nil {
+		t.Fatalf("TakeInvite open: %v", err)
+	}
+}
+
+// TestRestoreURL_KeepAfterReload восстановленная ссылка остаётся восстановленной после перезапуска
+func TestRestoreURL_KeepAfterReload(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "data.jsonl")
+	ctx := context.Background()
+
+	s, err := filestorage.NewStorage(fp, storage.DedupGlobal)
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	id, err := s.SaveURL(ctx, "user1", storage.NewLink{OriginalURL: "https://a.com"})
+	if err != nil {
+		t.Fatalf("SaveURL: %v", err)
+	}
+	if _, err = s.MarkAsDeleted(ctx, "user1", []string{id}); err != nil {
+		t.Fatalf("MarkAsDeleted: %v", err)
+	}
+	if err = s.RestoreURL(ctx, "user2", id); !errorsIs(err, storage.ErrForbidden) {
+		t.Fatalf("RestoreURL by other user = %v, want ErrForbidden", err)
+	}
+	if err = s.RestoreURL(ctx, "user1", id); err != nil {
+		t.Fatalf("RestoreURL: %v", err)
+	}
+
+	reloaded, err := filestorage.NewStorage(fp, storage.DedupGlobal)
+	if err != nil {
+		t.Fatalf("NewStorage reload: %v", err)
+	}
+	if _, err = reloaded.GetLink(ctx, id); err != nil {
+		t.Fatalf("GetLink after reload: %v", err)
+	}
+	// восстановленная ссылка снова участвует в дедупликации
+	if _, err = reloaded.SaveURL(ctx, "user1", storage.NewLink{OriginalURL: "https://a.com"}); !errorsIs(err, storage.ErrConflict) {
+		t.Fatalf("SaveURL duplicate = %v, want ErrConflict", err)
+	}
+}
+
+// TestSaveURL_NoDedupAfterReload ссылка с паролем сохраняется одной записью и после перезапуска
+// не подставляется вместо обычной ссылки на тот же URL
+func TestSaveURL_NoDedupAfterReload(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "data.jsonl")
+	ctx := context.Background()
+
+	s, err := filestorage.NewStorage(fp, storage.DedupGlobal)
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	link := storage.NewLink{OriginalURL: "https://a.com", Options: storage.LinkOptions{PasswordHash: "hash"}}
+	id, err := s.SaveURL(ctx, "user1", link)
+	if err != nil {
+		t.Fatalf("SaveURL: %v", err)
+	}
+	if _, err = s.SaveURL(ctx, "user1", link); err != nil {
+		t.Fatalf("SaveURL second protected = %v, want new link", err)
+	}
+
+	reloaded, err := filestorage.NewStorage(fp, storage.DedupGlobal)
+	if err != nil {
+		t.Fatalf("NewStorage reload: %v", err)
+	}
+	got, err := reloaded.GetLink(ctx, id)
+	if err != nil {
+		t.Fatalf("GetLink after reload: %v", err)
+	}
+	if got.Options.PasswordHash != "hash" || !got.NoDedup {
+		t.Fatalf("GetLink after reload = %+v, want password and NoDedup", got)
+	}
+	plain, err := reloaded.SaveURL(ctx, "user1", storage.NewLink{OriginalURL: "https://a.com"})
+	if err != nil || plain == id {
+		t.Fatalf("SaveURL plain = %q, %v, want new link", plain, err)
+	}
+}
+
+func TestWebhooks_KeepAfterReload(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "data.jsonl")
+	ctx := context.Background()
+
+	s, err := filestorage.NewStorage(fp, storage.DedupGlobal)
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, id := range []string{"h1", "h2"} {
+		hook := storage.Webhook{ID: id, Owner: "user1", URL: "https://hooks.example.com/" + id, Secret: "s", Events: []string{"link.created"}, CreatedAt: now}
+		if err = s.SaveWebhook(ctx, hook); err != nil {
+			t.Fatalf("SaveWebhook %s: %v", id, err)
+		}
+	}
+	if err = s.SaveWebhook(ctx, storage.Webhook{ID: "h1", Owner: "user2"}); !errorsIs(err, storage.ErrConflict) {
+		t.Fatalf("SaveWebhook duplicate = %v, want ErrConflict", err)
+	}
+	if err = s.DeleteWebhook(ctx, "user2", "h1"); !errorsIs(err, storage.ErrNotFound) {
+		t.Fatalf("DeleteWebhook by other user = %v, want ErrNotFound", err)
+	}
+	if err = s.DeleteWebhook(ctx, "user1", "h1"); err != nil {
+		t.Fatalf("DeleteWebhook: %v", err)
+	}
+
+	reloaded, err := filestorage.NewStorage(fp, storage.DedupGlobal)
+	if err != nil {
+		t.Fatalf("NewStorage reload: %v", err)
+	}
+	hooks, err := reloaded.GetWebhooks(ctx, "user1")
+	if err != nil {
+		t.Fatalf("GetWebhooks: %v", err)
+	}
+	if len(hooks) != 1 || hooks[0].ID != "h2" || hooks[0].Secret != "s" || len(hooks[0].Events) != 1 {
+		t.Fatalf("GetWebhooks after reload = %+v, want only h2", hooks)
+	}
+}
+
+// TestFile_UUIDAndCompactOnLoad uuid записи не меняется при перезаписи, устаревшие строки убираются при загрузке
+func TestFile_UUIDAndCompactOnLoad(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "data.jsonl")
+
+	s, err := filestorage.NewStorage(fp, storage.DedupGlobal)
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	id, err := s.SaveURL(context.Background(), "user1", storage.NewLink{OriginalURL: "https://a.com"})
+	if err != nil {
+		t.Fatalf("SaveURL: %v", err)
+	}
+	for _, u := range []string{"https://b.com", "https://c.com"} {
+		if err = s.UpdateURL(context.Background(), "user1", id, u, ""); err != nil {
+			t.Fatalf("UpdateURL: %v", err)
+		}
+	}
+
+	uuids := readUUIDs(t, fp)
+	if len(uuids) != 3 || uuids[0] == "" || uuids[1] != uuids[0] || uuids[2] != uuids[0] {
+		t.Fatalf("uuids = %q, want three equal non-empty values", uuids)
+	}
+
+	reloaded, err := filestorage.NewStorage(fp, storage.DedupGlobal)
+	if err != nil {
+		t.Fatalf("NewStorage reload: %v", err)
+	}
+	if got := readUUIDs(t, fp); len(got) != 1 || got[0] != uuids[0] {
+		t.Fatalf("uuids after reload = %q, want [%q]", got, uuids[0])
+	}
+	history, err := reloaded.GetURLHistory(context.Background(), "user1", id)
+	if err != nil {
+		t.Fatalf("GetURLHistory: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("history = %+v, want 2 revisions", history)
+	}
+}
+
+// TestFile_CompactWhileRunning частые изменения одной ссылки не раздувают файл
+func TestFile_CompactWhileRunning(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "data.jsonl")
+
+	s, err := filestorage.NewStorage(fp, storage.DedupGlobal)
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	id, err := s.SaveURL(context.Background(), "user1", storage.NewLink{OriginalURL: "https://a.com/0"})
+	if err != nil {
+		t.Fatalf("SaveURL: %v", err)
+	}
+	const edits = 1000
+	for i := 1; i <= edits; i++ {
+		if err = s.UpdateURL(context.Background(), "user1", id, "https://a.com/"+strconv.Itoa(i), ""); err != nil {
+			t.Fatalf("UpdateURL: %v", err)
+		}
+	}
+
+	// без сжатия файл занял бы десятки мегабайт: каждая строка несёт всю историю
+	info, err := os.Stat(fp)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size() > 3<<20 {
+		t.Fatalf("file size = %d, want at most 3 MiB", info.Size())
+	}
+
+	reloaded, err := filestorage.NewStorage(fp, storage.DedupGlobal)
+	if err != nil {
+		t.Fatalf("NewStorage reload: %v", err)
+	}
+	history, err := reloaded.GetURLHistory(context.Background(), "user1", id)
+	if err != nil {
+		t.Fatalf("GetURLHistory: %v", err)
+	}
+	if len(history) != edits {
+		t.Fatalf("history length = %d, want %d", len(history), edits)
+	}
+}
+
+func readUUIDs(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+
+	var uuids []string
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var item filestorage.Item
+		if err := json.Unmarshal(sc.Bytes(), &item); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		uuids = append(uuids, item.UUID)
+	}
+	return uuids
+}
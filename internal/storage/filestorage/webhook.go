@@ -0,0 +1,111 @@
+package filestorage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/divanov-web/shorturl/internal/storage"
+)
+
+// WebhookItem описывает одно изменение в файле подписок: новую подписку или её удаление (Removed).
+type WebhookItem struct {
+	Webhook storage.Webhook `json:"webhook"`
+	Removed bool            `json:"removed,omitempty"`
+}
+
+// SaveWebhook сохраняет новую подписку.
+func (s *Storage) SaveWebhook(ctx context.Context, hook storage.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.webhooks[hook.ID]; exists {
+		return storage.ErrConflict
+	}
+	hook.Events = slices.Clone(hook.Events)
+	s.applyWebhookItem(WebhookItem{Webhook: hook})
+	return s.appendWebhookItem(WebhookItem{Webhook: hook})
+}
+
+// GetWebhooks возвращает подписки владельца в порядке создания.
+func (s *Storage) GetWebhooks(ctx context.Context, owner string) ([]storage.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var result []storage.Webhook
+	for _, hook := range s.webhooks {
+		if hook.Owner == owner {
+			hook.Events = slices.Clone(hook.Events)
+			result = append(result, hook)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+// DeleteWebhook удаляет подписку владельца, в файл дописывается отметка об удалении.
+func (s *Storage) DeleteWebhook(ctx context.Context, owner string, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if hook, ok := s.webhooks[id]; !ok || hook.Owner != owner {
+		return storage.ErrNotFound
+	}
+	item := WebhookItem{Webhook: storage.Webhook{ID: id, Owner: owner}, Removed: true}
+	s.applyWebhookItem(item)
+	return s.appendWebhookItem(item)
+}
+
+// applyWebhookItem применяет изменение к данным в памяти. Вызывать под блокировкой.
+func (s *Storage) applyWebhookItem(item WebhookItem) {
+	if item.Removed {
+		delete(s.webhooks, item.Webhook.ID)
+		return
+	}
+	s.webhooks[item.Webhook.ID] = item.Webhook
+}
+
+// webhooksPath путь к файлу подписок.
+func (s *Storage) webhooksPath() string {
+	return s.filePath + ".webhooks"
+}
+
+// appendWebhookItem дописывает изменение в файл подписок. Вызывать под блокировкой.
+func (s *Storage) appendWebhookItem(item WebhookItem) error {
+	if s.filePath == "" {
+		return nil
+	}
+	file, err := os.OpenFile(s.webhooksPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return json.NewEncoder(file).Encode(item)
+}
+
+// loadWebhooks читает файл подписок, применяя изменения по порядку.
+func (s *Storage) loadWebhooks() error {
+	if s.filePath == "" {
+		return nil
+	}
+	file, err := os.Open(s.webhooksPath())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var item WebhookItem
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			continue
+		}
+		s.applyWebhookItem(item)
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,193 @@
+package filestorage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+
+	"github.com/divanov-web/shorturl/internal/storage"
+)
+
+// WorkspaceItem описывает одно изменение в файле рабочих пространств. Заполнено ровно одно из полей
+// Workspace, Member или Invite; Removed отмечает удаление участника или использованное приглашение.
+type WorkspaceItem struct {
+	Workspace *storage.Workspace       `json:"workspace,omitempty"`
+	Member    *storage.WorkspaceMember `json:"member,omitempty"`
+	Invite    *storage.WorkspaceInvite `json:"invite,omitempty"`
+	Removed   bool                     `json:"removed,omitempty"`
+}
+
+// CreateWorkspace создаёт рабочее пространство с владельцем ownerID.
+func (s *Storage) CreateWorkspace(ctx context.Context, ws storage.Workspace, ownerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.workspaces[ws.ID]; exists {
+		return storage.ErrConflict
+	}
+	owner := storage.WorkspaceMember{WorkspaceID: ws.ID, UserID: ownerID, Role: storage.RoleOwner}
+	s.applyWorkspaceItem(WorkspaceItem{Workspace: &ws})
+	s.applyWorkspaceItem(WorkspaceItem{Member: &owner})
+	return s.appendWorkspaceItems(WorkspaceItem{Workspace: &ws}, WorkspaceItem{Member: &owner})
+}
+
+// GetWorkspace возвращает рабочее пространство по идентификатору.
+func (s *Storage) GetWorkspace(ctx context.Context, id string) (storage.Workspace, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ws, ok := s.workspaces[id]
+	if !ok {
+		return storage.Workspace{}, storage.ErrNotFound
+	}
+	return ws, nil
+}
+
+// GetUserWorkspaces возвращает членство пользователя в рабочих пространствах в порядке их идентификаторов.
+func (s *Storage) GetUserWorkspaces(ctx context.Context, userID string) ([]storage.WorkspaceMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var result []storage.WorkspaceMember
+	for workspaceID, roles := range s.members {
+		if role, ok := roles[userID]; ok {
+			result = append(result, storage.WorkspaceMember{WorkspaceID: workspaceID, UserID: userID, Role: role})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].WorkspaceID < result[j].WorkspaceID })
+	return result, nil
+}
+
+// GetWorkspaceMembers возвращает участников рабочего пространства в порядке их идентификаторов.
+func (s *Storage) GetWorkspaceMembers(ctx context.Context, workspaceID string) ([]storage.WorkspaceMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]storage.WorkspaceMember, 0, len(s.members[workspaceID]))
+	for userID, role := range s.members[workspaceID] {
+		result = append(result, storage.WorkspaceMember{WorkspaceID: workspaceID, UserID: userID, Role: role})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].UserID < result[j].UserID })
+	return result, nil
+}
+
+// GetWorkspaceMember возвращает участника рабочего пространства.
+func (s *Storage) GetWorkspaceMember(ctx context.Context, workspaceID string, userID string) (storage.WorkspaceMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	role, ok := s.members[workspaceID][userID]
+	if !ok {
+		return storage.WorkspaceMember{}, storage.ErrNotFound
+	}
+	return storage.WorkspaceMember{WorkspaceID: workspaceID, UserID: userID, Role: role}, nil
+}
+
+// SetWorkspaceMember добавляет участника или меняет его роль.
+func (s *Storage) SetWorkspaceMember(ctx context.Context, member storage.WorkspaceMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.workspaces[member.WorkspaceID]; !ok {
+		return storage.ErrNotFound
+	}
+	s.applyWorkspaceItem(WorkspaceItem{Member: &member})
+	return s.appendWorkspaceItems(WorkspaceItem{Member: &member})
+}
+
+// RemoveWorkspaceMember убирает участника из рабочего пространства.
+func (s *Storage) RemoveWorkspaceMember(ctx context.Context, workspaceID string, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.members[workspaceID][userID]; !ok {
+		return storage.ErrNotFound
+	}
+	item := WorkspaceItem{Member: &storage.WorkspaceMember{WorkspaceID: workspaceID, UserID: userID}, Removed: true}
+	s.applyWorkspaceItem(item)
+	return s.appendWorkspaceItems(item)
+}
+
+// SaveInvite сохраняет приглашение в рабочее пространство.
+func (s *Storage) SaveInvite(ctx context.Context, invite storage.WorkspaceInvite) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.workspaces[invite.WorkspaceID]; !ok {
+		return storage.ErrNotFound
+	}
+	s.applyWorkspaceItem(WorkspaceItem{Invite: &invite})
+	return s.appendWorkspaceItems(WorkspaceItem{Invite: &invite})
+}
+
+// TakeInvite возвращает приглашение и удаляет его, в файл дописывается отметка об использовании.
+func (s *Storage) TakeInvite(ctx context.Context, token string) (storage.WorkspaceInvite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invite, ok := s.invites[token]
+	if !ok {
+		return storage.WorkspaceInvite{}, storage.ErrNotFound
+	}
+	item := WorkspaceItem{Invite: &storage.WorkspaceInvite{Token: token}, Removed: true}
+	s.applyWorkspaceItem(item)
+	return invite, s.appendWorkspaceItems(item)
+}
+
+// applyWorkspaceItem применяет изменение к данным в памяти. Вызывать под блокировкой.
+func (s *Storage) applyWorkspaceItem(item WorkspaceItem) {
+	switch {
+	case item.Workspace != nil:
+		s.workspaces[item.Workspace.ID] = *item.Workspace
+	case item.Member != nil && item.Removed:
+		delete(s.members[item.Member.WorkspaceID], item.Member.UserID)
+	case item.Member != nil:
+		if s.members[item.Member.WorkspaceID] == nil {
+			s.members[item.Member.WorkspaceID] = make(map[string]storage.WorkspaceRole)
+		}
+		s.members[item.Member.WorkspaceID][item.Member.UserID] = item.Member.Role
+	case item.Invite != nil && item.Removed:
+		delete(s.invites, item.Invite.Token)
+	case item.Invite != nil:
+		s.invites[item.Invite.Token] = *item.Invite
+	}
+}
+
+// workspacesPath путь к файлу рабочих пространств.
+func (s *Storage) workspacesPath() string {
+	return s.filePath + ".workspaces"
+}
+
+// appendWorkspaceItems дописывает изменения в файл рабочих пространств. Вызывать под блокировкой.
+func (s *Storage) appendWorkspaceItems(items ...WorkspaceItem) error {
+	if s.filePath == "" {
+		return nil
+	}
+	file, err := os.OpenFile(s.workspacesPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	enc := json.NewEncoder(file)
+	for _, item := range items {
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadWorkspaces читает файл рабочих пространств, применяя изменения по порядку.
+func (s *Storage) loadWorkspaces() error {
+	if s.filePath == "" {
+		return nil
+	}
+	file, err := os.Open(s.workspacesPath())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var item WorkspaceItem
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			continue
+		}
+		s.applyWorkspaceItem(item)
+	}
+	return scanner.Err()
+}
@@ -4,35 +4,194 @@ package storage
 import (
 	"context"
 	"errors"
+	"time"
 )
 
 // BatchEntry структура полученного url для групповых батч записей.
 type BatchEntry struct {
 	ShortURL      string
 	OriginalURL   string
+	NormalizedURL string
 	CorrelationID string
+	Domain        string // короткий домен новой ссылки, пустой — домен по умолчанию
+}
+
+// NewLink новая короткая ссылка. Настройки сохраняются одной записью вместе со ссылкой,
+// чтобы она не была доступна без них даже короткое время.
+type NewLink struct {
+	OriginalURL string
+	// NormalizedURL канонический вид OriginalURL для дедупликации, пустое значение означает OriginalURL.
+	NormalizedURL string
+	Options       LinkOptions
+	// MaxClicks лимит переходов, 0 — без ограничения.
+	MaxClicks int64
+	Meta      LinkMeta
+	// Domain короткий домен ссылки, пустой — домен по умолчанию.
+	Domain string
+}
+
+// NoDedup проверяет, что ссылка не участвует в дедупликации: ссылку с паролем или лимитом переходов
+// нельзя отдать вместо новой или подставить другому, поэтому она всегда создаётся заново.
+func (l NewLink) NoDedup() bool {
+	return l.Options.PasswordHash != "" || l.MaxClicks > 0
+}
+
+// BatchStatus итог сохранения одной записи батча.
+type BatchStatus int
+
+const (
+	// BatchCreated создана новая ссылка.
+	BatchCreated BatchStatus = iota
+	// BatchExisting URL уже сокращён этим пользователем, ShortURL указывает на существующую ссылку.
+	BatchExisting
+	// BatchConflict URL уже сокращён другим пользователем, ShortURL не раскрывается.
+	BatchConflict
+)
+
+// BatchResult результат сохранения записи батча, порядок совпадает с порядком записей.
+type BatchResult struct {
+	ShortURL      string
+	CorrelationID string
+	Status        BatchStatus
 }
 
 // UserURL структура полученного url от пользователя для одиночных записей.
+// NormalizedURL канонический вид OriginalURL, по нему проверяется уникальность.
+// Threat непустой, если сканер нашёл исходный URL в списках угроз.
+// Disabled — ссылка заблокирована администратором и не открывается.
 type UserURL struct {
-	ShortURL    string
+	ShortURL      string
+	OriginalURL   string
+	NormalizedURL string
+	UserID        string
+	DeletedFlag   bool
+	Threat        string
+	Disabled      bool
+	CreatedAt     time.Time
+	Clicks        int64
+	MaxClicks     int64            // 0 — без ограничения
+	ClicksLeft    int64            // сколько переходов осталось, если задан MaxClicks
+	VariantClicks map[string]int64 // переходы по вариантам A/B-теста
+	Domain        string           // короткий домен ссылки, пустой — домен по умолчанию
+	NoDedup       bool             // ссылка создана с паролем или лимитом переходов и не участвует в дедупликации
+	Options       LinkOptions
+	LinkMeta
+}
+
+// LinkMeta сведения, которыми владелец упорядочивает свои ссылки. На поведение ссылки не влияют.
+type LinkMeta struct {
+	Tags   []string `json:"tags,omitempty"`
+	Folder string   `json:"folder,omitempty"`
+	Title  string   `json:"title,omitempty"`
+	Note   string   `json:"note,omitempty"`
+}
+
+// Exhausted проверяет, исчерпан ли лимит переходов по ссылке.
+func (u UserURL) Exhausted() bool {
+	return u.MaxClicks > 0 && u.ClicksLeft <= 0
+}
+
+// LinkOptions настройки поведения короткой ссылки, которые задаёт её владелец.
+type LinkOptions struct {
+	// Interstitial показывать страницу «вы покидаете сайт» перед редиректом.
+	Interstitial bool `json:"interstitial,omitempty"`
+	// RedirectCode код ответа редиректа (301, 302, 307, 308), 0 — значение по умолчанию сервиса.
+	RedirectCode int `json:"redirect_code,omitempty"`
+	// PasswordHash bcrypt-хеш пароля, без которого ссылка не открывается.
+	PasswordHash string `json:"password_hash,omitempty"`
+	// Rules правила выбора адреса редиректа, проверяются по порядку, первое совпавшее побеждает.
+	// Если ни одно не совпало, используется OriginalURL ссылки.
+	Rules []RedirectRule `json:"rules,omitempty"`
+	// Variants адреса A/B-теста, между которыми делятся переходы, не совпавшие ни с одним правилом.
+	Variants []Variant `json:"variants,omitempty"`
+}
+
+// Variant вариант адреса A/B-теста с весом доли переходов.
+type Variant struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// RedirectRule правило таргетинга редиректа. Заданные условия должны выполниться все, пустые не проверяются.
+type RedirectRule struct {
+	// Device класс устройства по User-Agent: mobile, tablet, desktop, bot.
+	Device string `json:"device,omitempty"`
+	// OS операционная система по User-Agent: ios, android, windows, macos, linux.
+	OS string `json:"os,omitempty"`
+	// Language предпочитаемый язык из Accept-Language, например de или de-AT.
+	Language string `json:"language,omitempty"`
+	// TimeFrom и TimeTo окно времени суток в формате 15:04, окно может переходить через полночь.
+	TimeFrom string `json:"time_from,omitempty"`
+	TimeTo   string `json:"time_to,omitempty"`
+	// Timezone часовой пояс окна времени в формате IANA, по умолчанию UTC.
+	Timezone string `json:"timezone,omitempty"`
+	// Param и ParamValue параметр запроса короткой ссылки; пустое значение — достаточно наличия параметра.
+	Param      string `json:"param,omitempty"`
+	ParamValue string `json:"param_value,omitempty"`
+	// URL адрес редиректа при совпадении правила.
+	URL string `json:"url"`
+}
+
+// UserSettings настройки пользователя.
+type UserSettings struct {
+	// DefaultDomain короткий домен новых ссылок пользователя, пустой — домен по умолчанию сервиса.
+	DefaultDomain string `json:"default_domain,omitempty"`
+	// Blocked пользователь заблокирован администратором и не может создавать ссылки.
+	Blocked bool `json:"blocked,omitempty"`
+}
+
+// URLRevision предыдущее значение оригинального URL короткой ссылки.
+type URLRevision struct {
 	OriginalURL string
-	DeletedFlag bool
+	ChangedAt   time.Time
 }
 
 // Storage Интерфейс хранилища.
+// normalized — канонический вид original для дедупликации; пустое значение означает original.
+// userID в методах ссылок — владелец ссылок: пользователь или рабочее пространство (см. WorkspaceOwner).
 type Storage interface {
-	SaveURL(ctx context.Context, userID string, original string) (string, error)
+	SaveURL(ctx context.Context, userID string, link NewLink) (string, error)
 	GetURL(ctx context.Context, id string) (string, bool)
+	GetLink(ctx context.Context, id string) (UserURL, error)
+	ListURLs(ctx context.Context, after string, limit int) ([]UserURL, error)
+	SetThreat(ctx context.Context, id string, threat string) error
+	SetDisabled(ctx context.Context, id string, disabled bool) error
+	RecordClick(ctx context.Context, id string, variant string) error
+	SetOptions(ctx context.Context, userID string, id string, opts LinkOptions) error
+	SetMaxClicks(ctx context.Context, userID string, id string, maxClicks int64) error
+	SetMeta(ctx context.Context, userID string, id string, meta LinkMeta) error
+	SetDomain(ctx context.Context, userID string, id string, domain string) error
+	GetUserSettings(ctx context.Context, userID string) (UserSettings, error)
+	SetUserSettings(ctx context.Context, userID string, settings UserSettings) error
 	Ping() error
-	BatchSave(ctx context.Context, userID string, entries []BatchEntry) error
+	BatchSave(ctx context.Context, userID string, entries []BatchEntry, atomic bool) ([]BatchResult, error)
+	BulkSave(ctx context.Context, userID string, entries []BatchEntry) ([]BatchResult, error)
 	GetUserURLs(ctx context.Context, userID string) ([]UserURL, error)
-	MarkAsDeleted(ctx context.Context, userID string, ids []string) error
+	MarkAsDeleted(ctx context.Context, userID string, ids []string) ([]UserURL, error)
+	RestoreURL(ctx context.Context, userID string, id string) error
+	UpdateURL(ctx context.Context, userID string, id string, original string, normalized string) error
+	GetURLHistory(ctx context.Context, userID string, id string) ([]URLRevision, error)
+	WorkspaceStorage
+	WebhookStorage
 	Shutdown(ctx context.Context) error
 }
 
 // ErrConflict Ошибка Пользователь существует.
+// Для атомарного BatchSave означает, что батч отклонён целиком из-за BatchConflict.
 var ErrConflict = errors.New("url already exists (storage)")
 
+// ErrNotFound Ошибка ссылка не найдена или удалена.
+var ErrNotFound = errors.New("url not found (storage)")
+
+// ErrDeleted Ошибка ссылка существовала, но удалена.
+var ErrDeleted = errors.New("url deleted (storage)")
+
+// ErrExhausted Ошибка лимит переходов по ссылке исчерпан.
+var ErrExhausted = errors.New("url click limit exhausted (storage)")
+
+// ErrForbidden Ошибка ссылка принадлежит другому пользователю.
+var ErrForbidden = errors.New("url belongs to another user (storage)")
+
 // ErrNotImplemented Ошибка для заглушки
 var ErrNotImplemented = errors.New("MarkAsDeleted not implemented in memory storage")
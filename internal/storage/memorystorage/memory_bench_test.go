@@ -18,7 +18,7 @@ func BenchmarkMemoryStorage_SaveURL(b *testing.B) {
 	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		// разные строки, чтобы каждый раз добавлять новый ключ в map
-		_, _ = s.SaveURL(context.Background(), user, base+strconv.Itoa(i))
+		_, _ = s.SaveURL(context.Background(), user, storage.NewLink{OriginalURL: base + strconv.Itoa(i)})
 	}
 }
 
@@ -32,7 +32,7 @@ func BenchmarkMemoryStorage_GetURL(b *testing.B) {
 	const N = 1000
 	ids := make([]string, N)
 	for i := 0; i < N; i++ {
-		id, _ := s.SaveURL(context.Background(), user, "https://example.com/"+strconv.Itoa(i))
+		id, _ := s.SaveURL(context.Background(), user, storage.NewLink{OriginalURL: "https://example.com/" + strconv.Itoa(i)})
 		ids[i] = id
 	}
 
@@ -65,6 +65,6 @@ func BenchmarkMemoryStorage_BatchSave(b *testing.B) {
 
 	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
-		_ = s.BatchSave(context.Background(), user, entries)
+		_, _ = s.BatchSave(context.Background(), user, entries, false)
 	}
 }
@@ -2,42 +2,278 @@ package memorystorage
 
 import (
 	"context"
+	"maps"
+	"slices"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/divanov-web/shorturl/internal/storage"
 	"github.com/divanov-web/shorturl/internal/utils/idgen"
 )
 
+// record описывает ссылку вместе с историей изменений.
+type record struct {
+	storage.UserURL
+	History []storage.URLRevision
+}
+
+// link возвращает копию ссылки, которую можно читать без блокировки.
+func (r *record) link() storage.UserURL {
+	link := r.UserURL
+	link.VariantClicks = maps.Clone(r.VariantClicks)
+	link.Tags = slices.Clone(r.Tags)
+	return link
+}
+
 // Storage описывает хранение в оперативной памяти.
 type Storage struct {
-	data map[string]string
-	mu   sync.RWMutex
+	data       map[string]*record
+	index      map[string]string // ключ дедупликации -> короткий идентификатор
+	users      map[string]storage.UserSettings
+	workspaces map[string]storage.Workspace
+	members    map[string]map[string]storage.WorkspaceRole // рабочее пространство -> пользователь -> роль
+	invites    map[string]storage.WorkspaceInvite
+	webhooks   map[string]storage.Webhook
+	scope      storage.DedupScope
+	mu         sync.RWMutex
 }
 
 // NewStorage создаёт новое хранилище в оперативной памяти.
-func NewStorage() (*Storage, error) {
+func NewStorage(scope storage.DedupScope) (*Storage, error) {
 	return &Storage{
-		data: make(map[string]string),
+		data:       make(map[string]*record),
+		index:      make(map[string]string),
+		users:      make(map[string]storage.UserSettings),
+		workspaces: make(map[string]storage.Workspace),
+		members:    make(map[string]map[string]storage.WorkspaceRole),
+		invites:    make(map[string]storage.WorkspaceInvite),
+		webhooks:   make(map[string]storage.Webhook),
+		scope:      scope,
 	}, nil
 }
 
 // SaveURL сохраняет оригинальный URL и возвращает его короткий идентификатор.
-func (s *Storage) SaveURL(ctx context.Context, userID string, original string) (string, error) {
+// Если URL уже сокращён в рамках области дедупликации, возвращает ErrConflict
+// и идентификатор существующей ссылки, только если она принадлежит userID.
+// Ссылка, которая не участвует в дедупликации, создаётся всегда.
+func (s *Storage) SaveURL(ctx context.Context, userID string, link storage.NewLink) (string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if !link.NoDedup() {
+		if existing, ok := s.lookup(userID, storage.DedupValue(link.OriginalURL, link.NormalizedURL)); ok {
+			if existing.UserID == userID {
+				return existing.ShortURL, storage.ErrConflict
+			}
+			return "", storage.ErrConflict
+		}
+	}
+
 	id := idgen.Generate(8)
-	s.data[id] = original
+	s.put(&record{UserURL: storage.UserURL{
+		ShortURL:      id,
+		OriginalURL:   link.OriginalURL,
+		NormalizedURL: link.NormalizedURL,
+		UserID:        userID,
+		CreatedAt:     time.Now(),
+		MaxClicks:     link.MaxClicks,
+		ClicksLeft:    link.MaxClicks,
+		Domain:        link.Domain,
+		NoDedup:       link.NoDedup(),
+		Options:       link.Options,
+		LinkMeta:      link.Meta,
+	}})
 
 	return id, nil
 }
 
+// lookup ищет неудалённую запись с тем же ключом дедупликации. Вызывать под блокировкой.
+func (s *Storage) lookup(userID, value string) (*record, bool) {
+	key, ok := s.scope.Key(userID, value)
+	if !ok {
+		return nil, false
+	}
+	rec, ok := s.data[s.index[key]]
+	return rec, ok
+}
+
+// put сохраняет запись и обновляет индекс дедупликации. Вызывать под блокировкой.
+func (s *Storage) put(rec *record) {
+	s.data[rec.ShortURL] = rec
+	if key, ok := s.scope.Key(rec.UserID, storage.DedupValue(rec.OriginalURL, rec.NormalizedURL)); ok && !rec.DeletedFlag && !rec.NoDedup {
+		s.index[key] = rec.ShortURL
+	}
+}
+
+// unindex убирает запись из индекса дедупликации. Вызывать под блокировкой.
+func (s *Storage) unindex(rec *record) {
+	if key, ok := s.scope.Key(rec.UserID, storage.DedupValue(rec.OriginalURL, rec.NormalizedURL)); ok && s.index[key] == rec.ShortURL {
+		delete(s.index, key)
+	}
+}
+
 // GetURL возвращает оригинальный URL по его короткому идентификатору.
 func (s *Storage) GetURL(ctx context.Context, id string) (string, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	url, ok := s.data[id]
-	return url, ok
+	rec, ok := s.data[id]
+	if !ok || rec.DeletedFlag {
+		return "", false
+	}
+	return rec.OriginalURL, true
+}
+
+// GetLink возвращает неудалённую ссылку по короткому идентификатору.
+// Для удалённой ссылки возвращает ErrDeleted, для несуществующей — ErrNotFound.
+func (s *Storage) GetLink(ctx context.Context, id string) (storage.UserURL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.data[id]
+	if !ok {
+		return storage.UserURL{}, storage.ErrNotFound
+	}
+	if rec.DeletedFlag {
+		return storage.UserURL{}, storage.ErrDeleted
+	}
+	return rec.link(), nil
+}
+
+// ListURLs возвращает до limit неудалённых ссылок с идентификатором больше after в порядке идентификаторов.
+func (s *Storage) ListURLs(ctx context.Context, after string, limit int) ([]storage.UserURL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := make([]string, 0, len(s.data))
+	for id, rec := range s.data {
+		if id > after && !rec.DeletedFlag {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	result := make([]storage.UserURL, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, s.data[id].link())
+	}
+	return result, nil
+}
+
+// SetThreat отмечает ссылку как опасную, пустой threat снимает отметку.
+func (s *Storage) SetThreat(ctx context.Context, id string, threat string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.data[id]
+	if !ok || rec.DeletedFlag {
+		return storage.ErrNotFound
+	}
+	rec.Threat = threat
+	return nil
+}
+
+// SetDisabled блокирует ссылку или снимает блокировку.
+func (s *Storage) SetDisabled(ctx context.Context, id string, disabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.data[id]
+	if !ok || rec.DeletedFlag {
+		return storage.ErrNotFound
+	}
+	rec.Disabled = disabled
+	return nil
+}
+
+// RecordClick увеличивает счётчик переходов по ссылке и списывает переход из лимита.
+// Непустой variant учитывается в счётчике варианта A/B-теста.
+// Если лимит исчерпан, возвращает ErrExhausted и переход не учитывает.
+func (s *Storage) RecordClick(ctx context.Context, id string, variant string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.data[id]
+	if !ok || rec.DeletedFlag {
+		return storage.ErrNotFound
+	}
+	if rec.Exhausted() {
+		return storage.ErrExhausted
+	}
+	if rec.MaxClicks > 0 {
+		rec.ClicksLeft--
+	}
+	rec.Clicks++
+	if variant != "" {
+		if rec.VariantClicks == nil {
+			rec.VariantClicks = make(map[string]int64)
+		}
+		rec.VariantClicks[variant]++
+	}
+	return nil
+}
+
+// SetMaxClicks задаёт лимит переходов по ссылке пользователя и сбрасывает остаток, 0 снимает лимит.
+func (s *Storage) SetMaxClicks(ctx context.Context, userID string, id string, maxClicks int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, err := s.ownedRecord(userID, id)
+	if err != nil {
+		return err
+	}
+	rec.MaxClicks = maxClicks
+	rec.ClicksLeft = maxClicks
+	return nil
+}
+
+// SetOptions меняет настройки ссылки пользователя.
+func (s *Storage) SetOptions(ctx context.Context, userID string, id string, opts storage.LinkOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, err := s.ownedRecord(userID, id)
+	if err != nil {
+		return err
+	}
+	rec.Options = opts
+	return nil
+}
+
+// SetMeta заменяет теги, папку, заголовок и заметку ссылки пользователя.
+func (s *Storage) SetMeta(ctx context.Context, userID string, id string, meta storage.LinkMeta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, err := s.ownedRecord(userID, id)
+	if err != nil {
+		return err
+	}
+	rec.LinkMeta = meta
+	return nil
+}
+
+// SetDomain привязывает ссылку пользователя к короткому домену.
+func (s *Storage) SetDomain(ctx context.Context, userID string, id string, domain string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, err := s.ownedRecord(userID, id)
+	if err != nil {
+		return err
+	}
+	rec.Domain = domain
+	return nil
+}
+
+// GetUserSettings возвращает настройки пользователя, для нового пользователя — пустые.
+func (s *Storage) GetUserSettings(ctx context.Context, userID string) (storage.UserSettings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.users[userID], nil
+}
+
+// SetUserSettings сохраняет настройки пользователя.
+func (s *Storage) SetUserSettings(ctx context.Context, userID string, settings storage.UserSettings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[userID] = settings
+	return nil
 }
 
 // ForceSet добавляет или обновляет запись с указанным идентификатором и URL.
@@ -45,7 +281,7 @@ func (s *Storage) GetURL(ctx context.Context, id string) (string, bool) {
 func (s *Storage) ForceSet(id, url string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.data[id] = url
+	s.put(&record{UserURL: storage.UserURL{ShortURL: id, OriginalURL: url}})
 }
 
 // Ping проверяет доступность хранилища (заглушка).
@@ -56,35 +292,171 @@ func (s *Storage) Ping() error {
 // NewTestStorage создаёт тестовое хранилище в памяти.
 // Используется в тестах.
 func NewTestStorage() *Storage {
-	return &Storage{
-		data: make(map[string]string),
-	}
+	s, _ := NewStorage(storage.DedupGlobal)
+	return s
 }
 
-// BatchSave сохраняет несколько записей за один вызов.
-func (s *Storage) BatchSave(ctx context.Context, userID string, entries []storage.BatchEntry) error {
+// BatchSave сохраняет несколько записей за один вызов и возвращает итог по каждой записи.
+// В атомарном режиме при конфликте с чужой ссылкой ничего не сохраняет и возвращает ErrConflict.
+func (s *Storage) BatchSave(ctx context.Context, userID string, entries []storage.BatchEntry, atomic bool) ([]storage.BatchResult, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	for _, entry := range entries {
-		// не перезаписываем, если уже существует
-		if _, exists := s.data[entry.ShortURL]; !exists {
-			s.data[entry.ShortURL] = entry.OriginalURL
+	results := make([]storage.BatchResult, len(entries))
+	created := make([]*record, 0, len(entries))
+	conflict := false
+
+	for i, entry := range entries {
+		results[i] = storage.BatchResult{ShortURL: entry.ShortURL, CorrelationID: entry.CorrelationID}
+
+		if existing, ok := s.lookup(userID, storage.DedupValue(entry.OriginalURL, entry.NormalizedURL)); ok {
+			if existing.UserID == userID {
+				results[i].ShortURL = existing.ShortURL
+				results[i].Status = storage.BatchExisting
+			} else {
+				results[i].ShortURL = ""
+				results[i].Status = storage.BatchConflict
+				conflict = true
+			}
+			continue
 		}
+
+		// при коллизии идентификатора генерируем новый
+		for {
+			if _, exists := s.data[results[i].ShortURL]; !exists {
+				break
+			}
+			results[i].ShortURL = idgen.Generate(8)
+		}
+
+		rec := &record{UserURL: storage.UserURL{
+			ShortURL:      results[i].ShortURL,
+			OriginalURL:   entry.OriginalURL,
+			NormalizedURL: entry.NormalizedURL,
+			UserID:        userID,
+			CreatedAt:     time.Now(),
+			Domain:        entry.Domain,
+		}}
+		s.put(rec)
+		created = append(created, rec)
 	}
 
-	return nil
+	if atomic && conflict {
+		for _, rec := range created {
+			s.unindex(rec)
+			delete(s.data, rec.ShortURL)
+		}
+		return results, storage.ErrConflict
+	}
+
+	return results, nil
+}
+
+// BulkSave сохраняет крупную порцию записей при массовом импорте.
+// Для хранилища в памяти это тот же BatchSave без атомарности.
+func (s *Storage) BulkSave(ctx context.Context, userID string, entries []storage.BatchEntry) ([]storage.BatchResult, error) {
+	return s.BatchSave(ctx, userID, entries, false)
 }
 
-// GetUserURLs - заглушка, отправляем пустой список
+// GetUserURLs возвращает все неудалённые ссылки пользователя.
 func (s *Storage) GetUserURLs(ctx context.Context, userID string) ([]storage.UserURL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	var result []storage.UserURL
+	for _, rec := range s.data {
+		if rec.UserID == userID && !rec.DeletedFlag {
+			result = append(result, rec.link())
+		}
+	}
 	return result, nil
 }
 
-// MarkAsDeleted помечает ссылки пользователя как удалённые (заглушка).
-func (s *Storage) MarkAsDeleted(ctx context.Context, userID string, ids []string) error {
-	return storage.ErrNotImplemented
+// MarkAsDeleted помечает ссылки пользователя как удалённые и возвращает те, что были удалены этим вызовом.
+func (s *Storage) MarkAsDeleted(ctx context.Context, userID string, ids []string) ([]storage.UserURL, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted []storage.UserURL
+	for _, id := range ids {
+		if rec, ok := s.data[id]; ok && rec.UserID == userID && !rec.DeletedFlag {
+			s.unindex(rec)
+			rec.DeletedFlag = true
+			deleted = append(deleted, rec.link())
+		}
+	}
+	return deleted, nil
+}
+
+// RestoreURL снимает отметку удаления со ссылки пользователя. Неудалённая ссылка не меняется.
+// Если тот же URL уже сокращён заново, возвращает ErrConflict.
+func (s *Storage) RestoreURL(ctx context.Context, userID string, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.data[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	if rec.UserID != userID {
+		return storage.ErrForbidden
+	}
+	if !rec.DeletedFlag {
+		return nil
+	}
+	if _, exists := s.lookup(userID, storage.DedupValue(rec.OriginalURL, rec.NormalizedURL)); exists && !rec.NoDedup {
+		return storage.ErrConflict
+	}
+	rec.DeletedFlag = false
+	s.put(rec)
+	return nil
+}
+
+// UpdateURL меняет оригинальный URL ссылки пользователя, сохраняя прежнее значение в истории.
+func (s *Storage) UpdateURL(ctx context.Context, userID string, id string, original string, normalized string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, err := s.ownedRecord(userID, id)
+	if err != nil {
+		return err
+	}
+	if rec.OriginalURL == original {
+		return nil
+	}
+	if existing, exists := s.lookup(userID, storage.DedupValue(original, normalized)); exists && existing != rec && !rec.NoDedup {
+		return storage.ErrConflict
+	}
+	s.unindex(rec)
+	rec.History = append(rec.History, storage.URLRevision{OriginalURL: rec.OriginalURL, ChangedAt: time.Now()})
+	rec.OriginalURL = original
+	rec.NormalizedURL = normalized
+	s.put(rec)
+	return nil
+}
+
+// GetURLHistory возвращает историю изменений ссылки пользователя.
+func (s *Storage) GetURLHistory(ctx context.Context, userID string, id string) ([]storage.URLRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rec, err := s.ownedRecord(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return append([]storage.URLRevision(nil), rec.History...), nil
+}
+
+// ownedRecord ищет неудалённую запись и проверяет владельца. Вызывать под блокировкой.
+func (s *Storage) ownedRecord(userID string, id string) (*record, error) {
+	rec, ok := s.data[id]
+	if !ok || rec.DeletedFlag {
+		return nil, storage.ErrNotFound
+	}
+	if rec.UserID != userID {
+		return nil, storage.ErrForbidden
+	}
+	return rec, nil
 }
 
 // Shutdown корректно завершает memorystorage, заглушка
@@ -0,0 +1,52 @@
+package memorystorage
+
+import (
+	"context"
+	"slices"
+	"sort"
+
+	"github.com/divanov-web/shorturl/internal/storage"
+)
+
+// SaveWebhook сохраняет новую подписку.
+func (s *Storage) SaveWebhook(ctx context.Context, hook storage.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.webhooks[hook.ID]; exists {
+		return storage.ErrConflict
+	}
+	hook.Events = slices.Clone(hook.Events)
+	s.webhooks[hook.ID] = hook
+	return nil
+}
+
+// GetWebhooks возвращает подписки владельца в порядке создания.
+func (s *Storage) GetWebhooks(ctx context.Context, owner string) ([]storage.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var result []storage.Webhook
+	for _, hook := range s.webhooks {
+		if hook.Owner == owner {
+			hook.Events = slices.Clone(hook.Events)
+			result = append(result, hook)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+// DeleteWebhook удаляет подписку владельца.
+func (s *Storage) DeleteWebhook(ctx context.Context, owner string, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if hook, ok := s.webhooks[id]; !ok || hook.Owner != owner {
+		return storage.ErrNotFound
+	}
+	delete(s.webhooks, id)
+	return nil
+}
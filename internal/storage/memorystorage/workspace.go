@@ -0,0 +1,114 @@
+package memorystorage
+
+import (
+	"context"
+	"sort"
+
+	"github.com/divanov-web/shorturl/internal/storage"
+)
+
+// CreateWorkspace создаёт рабочее пространство с владельцем ownerID.
+func (s *Storage) CreateWorkspace(ctx context.Context, ws storage.Workspace, ownerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.workspaces[ws.ID]; exists {
+		return storage.ErrConflict
+	}
+	s.workspaces[ws.ID] = ws
+	s.members[ws.ID] = map[string]storage.WorkspaceRole{ownerID: storage.RoleOwner}
+	return nil
+}
+
+// GetWorkspace возвращает рабочее пространство по идентификатору.
+func (s *Storage) GetWorkspace(ctx context.Context, id string) (storage.Workspace, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ws, ok := s.workspaces[id]
+	if !ok {
+		return storage.Workspace{}, storage.ErrNotFound
+	}
+	return ws, nil
+}
+
+// GetUserWorkspaces возвращает членство пользователя в рабочих пространствах в порядке их идентификаторов.
+func (s *Storage) GetUserWorkspaces(ctx context.Context, userID string) ([]storage.WorkspaceMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var result []storage.WorkspaceMember
+	for workspaceID, roles := range s.members {
+		if role, ok := roles[userID]; ok {
+			result = append(result, storage.WorkspaceMember{WorkspaceID: workspaceID, UserID: userID, Role: role})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].WorkspaceID < result[j].WorkspaceID })
+	return result, nil
+}
+
+// GetWorkspaceMembers возвращает участников рабочего пространства в порядке их идентификаторов.
+func (s *Storage) GetWorkspaceMembers(ctx context.Context, workspaceID string) ([]storage.WorkspaceMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]storage.WorkspaceMember, 0, len(s.members[workspaceID]))
+	for userID, role := range s.members[workspaceID] {
+		result = append(result, storage.WorkspaceMember{WorkspaceID: workspaceID, UserID: userID, Role: role})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].UserID < result[j].UserID })
+	return result, nil
+}
+
+// GetWorkspaceMember возвращает участника рабочего пространства.
+func (s *Storage) GetWorkspaceMember(ctx context.Context, workspaceID string, userID string) (storage.WorkspaceMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	role, ok := s.members[workspaceID][userID]
+	if !ok {
+		return storage.WorkspaceMember{}, storage.ErrNotFound
+	}
+	return storage.WorkspaceMember{WorkspaceID: workspaceID, UserID: userID, Role: role}, nil
+}
+
+// SetWorkspaceMember добавляет участника или меняет его роль.
+func (s *Storage) SetWorkspaceMember(ctx context.Context, member storage.WorkspaceMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	roles, ok := s.members[member.WorkspaceID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	roles[member.UserID] = member.Role
+	return nil
+}
+
+// RemoveWorkspaceMember убирает участника из рабочего пространства.
+func (s *Storage) RemoveWorkspaceMember(ctx context.Context, workspaceID string, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.members[workspaceID][userID]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(s.members[workspaceID], userID)
+	return nil
+}
+
+// SaveInvite сохраняет приглашение в рабочее пространство.
+func (s *Storage) SaveInvite(ctx context.Context, invite storage.WorkspaceInvite) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.workspaces[invite.WorkspaceID]; !ok {
+		return storage.ErrNotFound
+	}
+	s.invites[invite.Token] = invite
+	return nil
+}
+
+// TakeInvite возвращает приглашение и удаляет его.
+func (s *Storage) TakeInvite(ctx context.Context, token string) (storage.WorkspaceInvite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invite, ok := s.invites[token]
+	if !ok {
+		return storage.WorkspaceInvite{}, storage.ErrNotFound
+	}
+	delete(s.invites, token)
+	return invite, nil
+}
@@ -8,13 +8,15 @@ import (
 	"github.com/divanov-web/shorturl/internal/storage"
 	"github.com/divanov-web/shorturl/internal/utils/idgen"
 	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // Storage описывает сам Storage хранения в БД.
 type Storage struct {
-	pool *pgxpool.Pool
+	pool  *pgxpool.Pool
+	scope storage.DedupScope
 }
 
 // NewPool создаёт новое подключение к пулу PostgreSQL по переданному DSN.
@@ -31,14 +33,18 @@ func NewPool(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
 }
 
 // NewStorage создаёт хранилище в PostgreSQL и гарантирует наличие таблицы.
-func NewStorage(ctx context.Context, pool *pgxpool.Pool) (*Storage, error) {
+func NewStorage(ctx context.Context, pool *pgxpool.Pool, scope storage.DedupScope) (*Storage, error) {
 	storage := &Storage{
-		pool: pool,
+		pool:  pool,
+		scope: scope,
 	}
 
 	if err := storage.ensureTable(ctx); err != nil {
 		return nil, fmt.Errorf("failed to ensure table: %w", err)
 	}
+	if err := storage.ensureDedupIndex(ctx); err != nil {
+		return nil, fmt.Errorf("failed to ensure dedup index: %w", err)
+	}
 
 	return storage, nil
 }
@@ -48,37 +54,271 @@ func (s *Storage) ensureTable(ctx context.Context) error {
 		CREATE TABLE IF NOT EXISTS short_urls (
 			id SERIAL PRIMARY KEY,
 			short_url TEXT UNIQUE NOT NULL,
-			original_url TEXT UNIQUE NOT NULL,
+			original_url TEXT NOT NULL,
+			normalized_url TEXT,
 			user_guid TEXT NOT NULL,
 			correlation_id TEXT,
 			is_deleted BOOLEAN NOT NULL DEFAULT FALSE
 		);
+		ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS normalized_url TEXT;
+		ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS threat TEXT NOT NULL DEFAULT '';
+		ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+		ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS clicks BIGINT NOT NULL DEFAULT 0;
+		ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS max_clicks BIGINT NOT NULL DEFAULT 0;
+		ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS clicks_left BIGINT NOT NULL DEFAULT 0;
+		ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS options JSONB NOT NULL DEFAULT '{}';
+		ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS variant_clicks JSONB NOT NULL DEFAULT '{}';
+		ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+		ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS folder TEXT NOT NULL DEFAULT '';
+		ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT '';
+		ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS note TEXT NOT NULL DEFAULT '';
+		ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS domain TEXT NOT NULL DEFAULT '';
+		ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE;
+		ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS no_dedup BOOLEAN NOT NULL DEFAULT FALSE;
+
+		CREATE TABLE IF NOT EXISTS user_settings (
+			user_guid TEXT PRIMARY KEY,
+			settings JSONB NOT NULL DEFAULT '{}'
+		);
+
+		CREATE TABLE IF NOT EXISTS workspaces (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		CREATE TABLE IF NOT EXISTS workspace_members (
+			workspace_id TEXT NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+			user_guid TEXT NOT NULL,
+			role TEXT NOT NULL,
+			PRIMARY KEY (workspace_id, user_guid)
+		);
+		CREATE INDEX IF NOT EXISTS workspace_members_user_guid_idx ON workspace_members (user_guid);
+		CREATE TABLE IF NOT EXISTS workspace_invites (
+			token TEXT PRIMARY KEY,
+			workspace_id TEXT NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+			role TEXT NOT NULL,
+			created_by TEXT NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS webhooks (
+			id TEXT PRIMARY KEY,
+			owner TEXT NOT NULL,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			events TEXT[] NOT NULL DEFAULT '{}',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS webhooks_owner_idx ON webhooks (owner);
+
+		CREATE TABLE IF NOT EXISTS short_url_revisions (
+			id SERIAL PRIMARY KEY,
+			short_url TEXT NOT NULL,
+			original_url TEXT NOT NULL,
+			changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS short_url_revisions_short_url_idx ON short_url_revisions (short_url);
 	`)
 	return err
 }
 
-// SaveURL сохраняет оригинальный URL и возвращает его короткий идентификатор.
-// При повторной вставке того же URL возвращает существующий short_url и ErrConflict.
+// dedupIndexes уникальные индексы по нормализованному URL для каждой области дедупликации.
+// Удалённые ссылки и ссылки вне дедупликации (no_dedup) в уникальности не участвуют.
+var dedupIndexes = map[storage.DedupScope]struct{ name, columns string }{
+	storage.DedupGlobal: {"short_urls_dedup_global_idx", "(normalized_url)"},
+	storage.DedupUser:   {"short_urls_dedup_user_idx", "(user_guid, normalized_url)"},
+}
+
+// legacyDedupIndexes индексы прежних версий, которые учитывали и ссылки вне дедупликации.
+var legacyDedupIndexes = []string{"short_urls_normalized_url_global_idx", "short_urls_normalized_url_user_idx"}
+
+// ensureDedupIndex оставляет только уникальный индекс области дедупликации. Существующий валидный
+// индекс не пересоздаётся, а новый строится CONCURRENTLY, чтобы запуск не блокировал запись в таблицу.
+func (s *Storage) ensureDedupIndex(ctx context.Context) error {
+	// индексы по исходному URL из прежних версий; ALTER TABLE блокирует таблицу, поэтому только если ограничение есть
+	_, err := s.pool.Exec(ctx, `
+		DO $$
+		BEGIN
+			IF EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'short_urls_original_url_key') THEN
+				ALTER TABLE short_urls DROP CONSTRAINT short_urls_original_url_key;
+			END IF;
+		END $$;
+		DROP INDEX IF EXISTS short_urls_original_url_global_idx;
+		DROP INDEX IF EXISTS short_urls_original_url_user_idx;
+	`)
+	if err != nil {
+		return err
+	}
+
+	stale := append([]string{}, legacyDedupIndexes...)
+	for scope, idx := range dedupIndexes {
+		if scope != s.scope {
+			stale = append(stale, idx.name)
+		}
+	}
+	for _, name := range stale {
+		if _, err = s.pool.Exec(ctx, `DROP INDEX CONCURRENTLY IF EXISTS `+name); err != nil {
+			return err
+		}
+	}
+
+	idx, ok := dedupIndexes[s.scope]
+	if !ok {
+		return nil
+	}
+	// прерванное построение CONCURRENTLY оставляет невалидный индекс, его нужно построить заново
+	var valid bool
+	err = s.pool.QueryRow(ctx, `
+		SELECT i.indisvalid FROM pg_index i JOIN pg_class c ON c.oid = i.indexrelid WHERE c.relname = $1
+	`, idx.name).Scan(&valid)
+	switch {
+	case err == nil && valid:
+		return nil
+	case err == nil:
+		if _, err = s.pool.Exec(ctx, `DROP INDEX CONCURRENTLY IF EXISTS `+idx.name); err != nil {
+			return err
+		}
+	case !errors.Is(err, pgx.ErrNoRows):
+		return err
+	}
+	_, err = s.pool.Exec(ctx, `
+		CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS `+idx.name+`
+		ON short_urls `+idx.columns+` WHERE is_deleted = FALSE AND no_dedup = FALSE
+	`)
+	return err
+}
+
+// BackfillNormalized заполняет normalized_url у ссылок, сохранённых до появления нормализации.
+// Строки обрабатываются пачками по batchSize, пока не заполнены, они не участвуют в дедупликации.
+// URL, который не удалось нормализовать, сохраняется как есть. Если нормализованный URL уже занят
+// другой ссылкой, у строки остаётся исходный URL, а если занят и он — строка пропускается.
+// Возвращает число заполненных строк.
+func (s *Storage) BackfillNormalized(ctx context.Context, normalize func(string) (string, error), batchSize int) (int, error) {
+	total := 0
+	lastID := 0
+	for {
+		rows, err := s.pool.Query(ctx, `
+			SELECT id, original_url FROM short_urls
+			WHERE normalized_url IS NULL AND id > $1
+			ORDER BY id LIMIT $2
+		`, lastID, batchSize)
+		if err != nil {
+			return total, err
+		}
+		var ids []int
+		var originals, normalized []string
+		for rows.Next() {
+			var id int
+			var original string
+			if err = rows.Scan(&id, &original); err != nil {
+				rows.Close()
+				return total, err
+			}
+			value, normErr := normalize(original)
+			if normErr != nil {
+				value = original
+			}
+			ids = append(ids, id)
+			originals = append(originals, original)
+			normalized = append(normalized, value)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		lastID = ids[len(ids)-1]
+
+		tag, err := s.pool.Exec(ctx, `
+			UPDATE short_urls s SET normalized_url = b.normalized_url
+			FROM unnest($1::int[], $2::text[]) AS b(id, normalized_url)
+			WHERE s.id = b.id AND s.normalized_url IS NULL
+		`, ids, normalized)
+		if err == nil {
+			total += int(tag.RowsAffected())
+			continue
+		}
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || pgErr.Code != pgerrcode.UniqueViolation {
+			return total, err
+		}
+		// в пачке есть совпадения с уже сохранёнными ссылками, разбираем её по одной строке
+		for i, id := range ids {
+			for _, value := range []string{normalized[i], originals[i]} {
+				tag, err = s.pool.Exec(ctx, `
+					UPDATE short_urls SET normalized_url = $2 WHERE id = $1 AND normalized_url IS NULL
+				`, id, value)
+				if err == nil {
+					total += int(tag.RowsAffected())
+					break
+				}
+				if !errors.As(err, &pgErr) || pgErr.Code != pgerrcode.UniqueViolation {
+					return total, err
+				}
+			}
+		}
+	}
+}
+
+// conflictTarget возвращает условие ON CONFLICT для текущей области дедупликации.
+func (s *Storage) conflictTarget() string {
+	switch s.scope {
+	case storage.DedupGlobal:
+		return "(normalized_url) WHERE is_deleted = FALSE AND no_dedup = FALSE"
+	case storage.DedupUser:
+		return "(user_guid, normalized_url) WHERE is_deleted = FALSE AND no_dedup = FALSE"
+	}
+	return ""
+}
+
+// SaveURL сохраняет ссылку со всеми настройками одной вставкой и возвращает её короткий идентификатор.
+// При повторной вставке того же URL возвращает ErrConflict и существующий short_url,
+// если ссылка принадлежит userID, иначе пустой идентификатор.
 // Используется ON CONFLICT только для инкремента с оптимизацией производительности.
-func (s *Storage) SaveURL(ctx context.Context, userID string, original string) (string, error) {
+// Пустое DO UPDATE нужно только для RETURNING: исходный URL существующей ссылки не меняется.
+// Ссылка вне дедупликации вставляется без ON CONFLICT и с существующими не совпадает.
+func (s *Storage) SaveURL(ctx context.Context, userID string, link storage.NewLink) (string, error) {
+	query := `
+		INSERT INTO short_urls (short_url, original_url, user_guid, normalized_url, no_dedup, options, max_clicks, clicks_left,
+			tags, folder, title, note, domain)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7, $8, $9, $10, $11, $12)
+		RETURNING short_url, user_guid
+	`
+	if target := s.conflictTarget(); target != "" && !link.NoDedup() {
+		query = `
+			INSERT INTO short_urls (short_url, original_url, user_guid, normalized_url, no_dedup, options, max_clicks, clicks_left,
+				tags, folder, title, note, domain)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $7, $8, $9, $10, $11, $12)
+			ON CONFLICT ` + target + ` DO UPDATE
+				SET normalized_url = EXCLUDED.normalized_url
+			RETURNING short_url, user_guid
+		`
+	}
+	normalized := storage.DedupValue(link.OriginalURL, link.NormalizedURL)
+	tags := link.Meta.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
 	const maxRetries = 3
 	for i := 0; i < maxRetries; i++ {
 		candidate := idgen.Generate(8)
 
 		// новый short_url, если вставка прошла
 		// существующий short_url, если сработал конфликт по original_url
-		var out string
-		err := s.pool.QueryRow(ctx, `
-			INSERT INTO short_urls (short_url, original_url, user_guid)
-			VALUES ($1, $2, $3)
-			ON CONFLICT (original_url) DO UPDATE
-				SET original_url = EXCLUDED.original_url
-			RETURNING short_url
-		`, candidate, original, userID).Scan(&out)
+		var out, owner string
+		err := s.pool.QueryRow(ctx, query, candidate, link.OriginalURL, userID, normalized,
+			link.NoDedup(), link.Options, link.MaxClicks,
+			tags, link.Meta.Folder, link.Meta.Title, link.Meta.Note, link.Domain).Scan(&out, &owner)
 
 		if err == nil {
 			// если short совпал с существующим для другого original_url
 			if out != candidate {
+				if owner != userID {
+					return "", storage.ErrConflict
+				}
 				return out, storage.ErrConflict
 			}
 			return out, nil
@@ -113,11 +353,224 @@ func (s *Storage) GetURL(ctx context.Context, id string) (string, bool) {
 	return url, true
 }
 
+// linkColumns столбцы ссылки в порядке, который ожидает scanLink.
+const linkColumns = `short_url, original_url, COALESCE(normalized_url, original_url), user_guid, is_deleted,
+	threat, created_at, clicks, max_clicks, clicks_left, variant_clicks, options,
+	tags, folder, title, note, domain, disabled, no_dedup`
+
+// scanLink читает ссылку из строки результата с linkColumns.
+func scanLink(row pgx.Row) (storage.UserURL, error) {
+	var link storage.UserURL
+	err := row.Scan(&link.ShortURL, &link.OriginalURL, &link.NormalizedURL, &link.UserID, &link.DeletedFlag,
+		&link.Threat, &link.CreatedAt, &link.Clicks, &link.MaxClicks, &link.ClicksLeft, &link.VariantClicks, &link.Options,
+		&link.Tags, &link.Folder, &link.Title, &link.Note, &link.Domain, &link.Disabled, &link.NoDedup)
+	return link, err
+}
+
+// GetLink возвращает неудалённую ссылку по короткому идентификатору.
+// Для удалённой ссылки возвращает ErrDeleted, для несуществующей — ErrNotFound.
+func (s *Storage) GetLink(ctx context.Context, id string) (storage.UserURL, error) {
+	link, err := scanLink(s.pool.QueryRow(ctx, `
+		SELECT `+linkColumns+`
+		FROM short_urls
+		WHERE short_url = $1
+	`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storage.UserURL{}, storage.ErrNotFound
+	}
+	if err == nil && link.DeletedFlag {
+		return storage.UserURL{}, storage.ErrDeleted
+	}
+	return link, err
+}
+
+// ListURLs возвращает до limit неудалённых ссылок с идентификатором больше after в порядке идентификаторов.
+func (s *Storage) ListURLs(ctx context.Context, after string, limit int) ([]storage.UserURL, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+linkColumns+`
+		FROM short_urls
+		WHERE short_url > $1 AND is_deleted = FALSE
+		ORDER BY short_url
+		LIMIT $2
+	`, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]storage.UserURL, 0, limit)
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, link)
+	}
+	return result, rows.Err()
+}
+
+// SetThreat отмечает ссылку как опасную, пустой threat снимает отметку.
+func (s *Storage) SetThreat(ctx context.Context, id string, threat string) error {
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE short_urls
+		SET threat = $2
+		WHERE short_url = $1 AND is_deleted = FALSE
+	`, id, threat)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// SetDisabled блокирует ссылку или снимает блокировку.
+func (s *Storage) SetDisabled(ctx context.Context, id string, disabled bool) error {
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE short_urls
+		SET disabled = $2
+		WHERE short_url = $1 AND is_deleted = FALSE
+	`, id, disabled)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// RecordClick увеличивает счётчик переходов по ссылке и списывает переход из лимита
+// одним условным UPDATE, так что параллельные переходы не превысят лимит.
+// Непустой variant учитывается в счётчике варианта A/B-теста.
+// Если лимит исчерпан, возвращает ErrExhausted и переход не учитывает.
+func (s *Storage) RecordClick(ctx context.Context, id string, variant string) error {
+	var left int64
+	err := s.pool.QueryRow(ctx, `
+		UPDATE short_urls
+		SET clicks = clicks + 1,
+			clicks_left = CASE WHEN max_clicks > 0 THEN clicks_left - 1 ELSE clicks_left END,
+			variant_clicks = CASE WHEN $2 = '' THEN variant_clicks
+				ELSE jsonb_set(variant_clicks, ARRAY[$2::text],
+					to_jsonb(COALESCE((variant_clicks ->> $2)::BIGINT, 0) + 1)) END
+		WHERE short_url = $1 AND is_deleted = FALSE AND (max_clicks = 0 OR clicks_left > 0)
+		RETURNING clicks_left
+	`, id, variant).Scan(&left)
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	// строка не обновилась: ссылки нет или лимит исчерпан
+	var exists bool
+	if err = s.pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM short_urls WHERE short_url = $1 AND is_deleted = FALSE)
+	`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return storage.ErrExhausted
+	}
+	return storage.ErrNotFound
+}
+
+// SetMaxClicks задаёт лимит переходов по ссылке пользователя и сбрасывает остаток, 0 снимает лимит.
+func (s *Storage) SetMaxClicks(ctx context.Context, userID string, id string, maxClicks int64) error {
+	if err := s.checkOwner(ctx, userID, id); err != nil {
+		return err
+	}
+	_, err := s.pool.Exec(ctx, `
+		UPDATE short_urls
+		SET max_clicks = $2, clicks_left = $2
+		WHERE short_url = $1
+	`, id, maxClicks)
+	return err
+}
+
+// SetOptions меняет настройки ссылки пользователя.
+func (s *Storage) SetOptions(ctx context.Context, userID string, id string, opts storage.LinkOptions) error {
+	if err := s.checkOwner(ctx, userID, id); err != nil {
+		return err
+	}
+	_, err := s.pool.Exec(ctx, `
+		UPDATE short_urls
+		SET options = $2
+		WHERE short_url = $1
+	`, id, opts)
+	return err
+}
+
+// SetMeta заменяет теги, папку, заголовок и заметку ссылки пользователя.
+func (s *Storage) SetMeta(ctx context.Context, userID string, id string, meta storage.LinkMeta) error {
+	if err := s.checkOwner(ctx, userID, id); err != nil {
+		return err
+	}
+	tags := meta.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	_, err := s.pool.Exec(ctx, `
+		UPDATE short_urls
+		SET tags = $2, folder = $3, title = $4, note = $5
+		WHERE short_url = $1
+	`, id, tags, meta.Folder, meta.Title, meta.Note)
+	return err
+}
+
+// SetDomain привязывает ссылку пользователя к короткому домену.
+func (s *Storage) SetDomain(ctx context.Context, userID string, id string, domain string) error {
+	if err := s.checkOwner(ctx, userID, id); err != nil {
+		return err
+	}
+	_, err := s.pool.Exec(ctx, `UPDATE short_urls SET domain = $2 WHERE short_url = $1`, id, domain)
+	return err
+}
+
+// GetUserSettings возвращает настройки пользователя, для нового пользователя — пустые.
+func (s *Storage) GetUserSettings(ctx context.Context, userID string) (storage.UserSettings, error) {
+	var settings storage.UserSettings
+	err := s.pool.QueryRow(ctx, `
+		SELECT settings FROM user_settings WHERE user_guid = $1
+	`, userID).Scan(&settings)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storage.UserSettings{}, nil
+	}
+	return settings, err
+}
+
+// SetUserSettings сохраняет настройки пользователя.
+func (s *Storage) SetUserSettings(ctx context.Context, userID string, settings storage.UserSettings) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO user_settings (user_guid, settings) VALUES ($1, $2)
+		ON CONFLICT (user_guid) DO UPDATE SET settings = EXCLUDED.settings
+	`, userID, settings)
+	return err
+}
+
+// checkOwner возвращает ErrNotFound для отсутствующей или удалённой ссылки и ErrForbidden для чужой.
+func (s *Storage) checkOwner(ctx context.Context, userID string, id string) error {
+	var owner string
+	var deleted bool
+	err := s.pool.QueryRow(ctx, `
+		SELECT user_guid, is_deleted FROM short_urls WHERE short_url = $1
+	`, id).Scan(&owner, &deleted)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && deleted) {
+		return storage.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if owner != userID {
+		return storage.ErrForbidden
+	}
+	return nil
+}
+
 // ForceSet добавляет или обновляет запись с указанным идентификатором и URL.
 // Используется в тестах.
 func (s *Storage) ForceSet(shortURL, url string) {
 	ctx := context.Background()
-	_, _ = s.pool.Exec(ctx, `INSERT INTO short_urls (short_url, original_url) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING`, shortURL, url)
+	_, _ = s.pool.Exec(ctx, `INSERT INTO short_urls (short_url, original_url, normalized_url) VALUES ($1, $2, $2) ON CONFLICT (id) DO NOTHING`, shortURL, url)
 }
 
 // Ping проверяет доступность хранилища (заглушка).
@@ -130,32 +583,209 @@ func (s *Storage) Close() {
 	s.pool.Close()
 }
 
-// BatchSave сохраняет парные значения id+url в рамках одной транзакции.
-func (s *Storage) BatchSave(ctx context.Context, userID string, entries []storage.BatchEntry) error {
+// BatchSave сохраняет парные значения id+url в рамках одной транзакции и возвращает итог по каждой записи.
+// Каждая запись вставляется в своей точке сохранения, чтобы коллизия short_url не обрывала транзакцию.
+// В атомарном режиме при конфликте с чужой ссылкой транзакция откатывается и возвращается ErrConflict.
+func (s *Storage) BatchSave(ctx context.Context, userID string, entries []storage.BatchEntry, atomic bool) ([]storage.BatchResult, error) {
+	query := `
+		INSERT INTO short_urls (short_url, original_url, correlation_id, user_guid, normalized_url, domain)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING short_url, user_guid
+	`
+	if target := s.conflictTarget(); target != "" {
+		query = `
+			INSERT INTO short_urls (short_url, original_url, correlation_id, user_guid, normalized_url, domain)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT ` + target + ` DO UPDATE
+				SET normalized_url = EXCLUDED.normalized_url
+			RETURNING short_url, user_guid
+		`
+	}
+
 	tx, err := s.pool.Begin(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer tx.Rollback(ctx)
 
-	for _, e := range entries {
-		_, err := tx.Exec(ctx, `
-			INSERT INTO short_urls (short_url, original_url, correlation_id, user_guid)
-			VALUES ($1, $2, $3, $4)
-			ON CONFLICT (short_url) DO NOTHING
-		`, e.ShortURL, e.OriginalURL, e.CorrelationID, userID)
-		if err != nil {
-			return err
+	results := make([]storage.BatchResult, len(entries))
+	conflict := false
+
+	for i, e := range entries {
+		results[i] = storage.BatchResult{CorrelationID: e.CorrelationID}
+
+		candidate := e.ShortURL
+		const maxRetries = 3
+		for attempt := 0; ; attempt++ {
+			var out, owner string
+			out, owner, err = insertWithSavepoint(ctx, tx, query, candidate, e.OriginalURL, e.CorrelationID, userID,
+				storage.DedupValue(e.OriginalURL, e.NormalizedURL), e.Domain)
+			if err == nil {
+				switch {
+				case out == candidate:
+					results[i].ShortURL = out
+					results[i].Status = storage.BatchCreated
+				case owner == userID:
+					results[i].ShortURL = out
+					results[i].Status = storage.BatchExisting
+				default:
+					results[i].Status = storage.BatchConflict
+					conflict = true
+				}
+				break
+			}
+
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation && attempt < maxRetries {
+				candidate = idgen.Generate(8)
+				continue
+			}
+			return nil, fmt.Errorf("batch save failed: %w", err)
 		}
 	}
 
-	return tx.Commit(ctx)
+	if atomic && conflict {
+		return results, storage.ErrConflict
+	}
+
+	return results, tx.Commit(ctx)
+}
+
+// insertWithSavepoint выполняет вставку во вложенной транзакции, откатывая только её при ошибке.
+func insertWithSavepoint(ctx context.Context, tx pgx.Tx, query string, args ...any) (string, string, error) {
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	defer sp.Rollback(ctx)
+
+	var out, owner string
+	if err = sp.QueryRow(ctx, query, args...).Scan(&out, &owner); err != nil {
+		return "", "", err
+	}
+	return out, owner, sp.Commit(ctx)
+}
+
+// BulkSave сохраняет крупную порцию записей при массовом импорте.
+// Записи загружаются через COPY во временную таблицу и переносятся одним INSERT ... SELECT,
+// затем итог по каждой записи определяется одним запросом. Записи, не попавшие в таблицу
+// из-за коллизии short_url, досохраняются обычным BatchSave.
+func (s *Storage) BulkSave(ctx context.Context, userID string, entries []storage.BatchEntry) ([]storage.BatchResult, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, `
+		CREATE TEMP TABLE bulk_import (
+			ord INT NOT NULL,
+			short_url TEXT NOT NULL,
+			original_url TEXT NOT NULL,
+			normalized_url TEXT NOT NULL,
+			correlation_id TEXT,
+			domain TEXT NOT NULL
+		) ON COMMIT DROP
+	`); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"bulk_import"},
+		[]string{"ord", "short_url", "original_url", "normalized_url", "correlation_id", "domain"},
+		pgx.CopyFromSlice(len(entries), func(i int) ([]any, error) {
+			e := entries[i]
+			return []any{i, e.ShortURL, e.OriginalURL, storage.DedupValue(e.OriginalURL, e.NormalizedURL), e.CorrelationID, e.Domain}, nil
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("bulk copy failed: %w", err)
+	}
+
+	// distinct и match описывают, какие строки считаются одной ссылкой в текущей области дедупликации
+	distinct, match := "", "s.short_url = b.short_url AND s.user_guid = $1"
+	switch s.scope {
+	case storage.DedupGlobal:
+		distinct, match = "DISTINCT ON (b.normalized_url)", "s.normalized_url = b.normalized_url"
+	case storage.DedupUser:
+		distinct, match = "DISTINCT ON (b.normalized_url)", "s.normalized_url = b.normalized_url AND s.user_guid = $1"
+	}
+
+	if _, err = tx.Exec(ctx, `
+		INSERT INTO short_urls (short_url, original_url, normalized_url, correlation_id, user_guid, domain)
+		SELECT `+distinct+` b.short_url, b.original_url, b.normalized_url, b.correlation_id, $1, b.domain
+		FROM bulk_import b
+		ORDER BY b.normalized_url, b.ord
+		ON CONFLICT DO NOTHING
+	`, userID); err != nil {
+		return nil, fmt.Errorf("bulk insert failed: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT b.ord, COALESCE(s.short_url, ''), COALESCE(s.user_guid, '')
+		FROM bulk_import b
+		LEFT JOIN short_urls s ON s.is_deleted = FALSE AND s.no_dedup = FALSE AND `+match+`
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]storage.BatchResult, len(entries))
+	var missed []int
+	for rows.Next() {
+		var ord int
+		var short, owner string
+		if err = rows.Scan(&ord, &short, &owner); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		results[ord].CorrelationID = entries[ord].CorrelationID
+		switch {
+		case short == "":
+			missed = append(missed, ord)
+		case short == entries[ord].ShortURL:
+			results[ord].ShortURL = short
+			results[ord].Status = storage.BatchCreated
+		case owner == userID:
+			results[ord].ShortURL = short
+			results[ord].Status = storage.BatchExisting
+		default:
+			results[ord].Status = storage.BatchConflict
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	if len(missed) == 0 {
+		return results, nil
+	}
+
+	retry := make([]storage.BatchEntry, 0, len(missed))
+	for _, ord := range missed {
+		e := entries[ord]
+		e.ShortURL = idgen.Generate(8)
+		retry = append(retry, e)
+	}
+	retried, err := s.BatchSave(ctx, userID, retry, false)
+	if err != nil {
+		return nil, err
+	}
+	for j, ord := range missed {
+		results[ord] = retried[j]
+	}
+
+	return results, nil
 }
 
 // GetUserURLs возвращает все ссылки пользователя, которые не помечены удалёнными.
 func (s *Storage) GetUserURLs(ctx context.Context, userID string) ([]storage.UserURL, error) {
 	rows, err := s.pool.Query(ctx, `
-		SELECT short_url, original_url
+		SELECT `+linkColumns+`
 		FROM short_urls
 		WHERE user_guid = $1 AND is_deleted = FALSE
 	`, userID)
@@ -166,37 +796,155 @@ func (s *Storage) GetUserURLs(ctx context.Context, userID string) ([]storage.Use
 
 	var result []storage.UserURL
 	for rows.Next() {
-		var item storage.UserURL
-		if err := rows.Scan(&item.ShortURL, &item.OriginalURL); err != nil {
+		item, err := scanLink(rows)
+		if err != nil {
 			return nil, err
 		}
 		result = append(result, item)
 	}
 
-	return result, nil
+	return result, rows.Err()
 }
 
-// MarkAsDeleted помечает указанные короткие ссылки пользователя как удалённые.
-func (s *Storage) MarkAsDeleted(ctx context.Context, userID string, ids []string) error {
+// MarkAsDeleted помечает указанные короткие ссылки пользователя как удалённые
+// и одним запросом возвращает те, что были удалены этим вызовом.
+func (s *Storage) MarkAsDeleted(ctx context.Context, userID string, ids []string) ([]storage.UserURL, error) {
 	if len(ids) == 0 {
-		return nil
+		return nil, nil
 	}
 
-	// Преобразуем []string в интерфейсный срез для передачи как $2
-	rows := make([]interface{}, len(ids))
-	for i, v := range ids {
-		rows[i] = v
-	}
-
-	_, err := s.pool.Exec(ctx, `
+	rows, err := s.pool.Query(ctx, `
 		UPDATE short_urls
 		SET is_deleted = TRUE
-		WHERE user_guid = $1 AND short_url = ANY($2)
+		WHERE user_guid = $1 AND short_url = ANY($2) AND is_deleted = FALSE
+		RETURNING `+linkColumns+`
 	`, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deleted []storage.UserURL
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, link)
+	}
+	return deleted, rows.Err()
+}
+
+// RestoreURL снимает отметку удаления со ссылки пользователя. Неудалённая ссылка не меняется.
+// Если тот же URL уже сокращён заново, уникальный индекс не даст восстановить ссылку и вернётся ErrConflict.
+func (s *Storage) RestoreURL(ctx context.Context, userID string, id string) error {
+	var owner string
+	err := s.pool.QueryRow(ctx, `
+		SELECT user_guid FROM short_urls WHERE short_url = $1
+	`, id).Scan(&owner)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storage.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if owner != userID {
+		return storage.ErrForbidden
+	}
 
+	_, err = s.pool.Exec(ctx, `
+		UPDATE short_urls
+		SET is_deleted = FALSE
+		WHERE short_url = $1 AND user_guid = $2 AND is_deleted = TRUE
+	`, id, userID)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+		return storage.ErrConflict
+	}
 	return err
 }
 
+// UpdateURL меняет оригинальный URL ссылки пользователя, сохраняя прежнее значение в short_url_revisions.
+func (s *Storage) UpdateURL(ctx context.Context, userID string, id string, original string, normalized string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var owner, current string
+	var deleted bool
+	err = tx.QueryRow(ctx, `
+		SELECT user_guid, original_url, is_deleted
+		FROM short_urls
+		WHERE short_url = $1
+		FOR UPDATE
+	`, id).Scan(&owner, &current, &deleted)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && deleted) {
+		return storage.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if owner != userID {
+		return storage.ErrForbidden
+	}
+	if current == original {
+		return nil
+	}
+
+	if _, err = tx.Exec(ctx, `
+		INSERT INTO short_url_revisions (short_url, original_url)
+		VALUES ($1, $2)
+	`, id, current); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE short_urls
+		SET original_url = $2, normalized_url = $3
+		WHERE short_url = $1
+	`, id, original, storage.DedupValue(original, normalized))
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+		return storage.ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetURLHistory возвращает историю изменений ссылки пользователя в порядке изменения.
+func (s *Storage) GetURLHistory(ctx context.Context, userID string, id string) ([]storage.URLRevision, error) {
+	if err := s.checkOwner(ctx, userID, id); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT original_url, changed_at
+		FROM short_url_revisions
+		WHERE short_url = $1
+		ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]storage.URLRevision, 0)
+	for rows.Next() {
+		var rev storage.URLRevision
+		if err := rows.Scan(&rev.OriginalURL, &rev.ChangedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, rev)
+	}
+
+	return result, rows.Err()
+}
+
 // Shutdown корректно завершает пул соединений с базой данных
 func (s *Storage) Shutdown(ctx context.Context) error {
 	if s.pool != nil {
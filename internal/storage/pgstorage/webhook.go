@@ -0,0 +1,65 @@
+package pgstorage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/divanov-web/shorturl/internal/storage"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SaveWebhook сохраняет новую подписку.
+func (s *Storage) SaveWebhook(ctx context.Context, hook storage.Webhook) error {
+	events := hook.Events
+	if events == nil {
+		events = []string{}
+	}
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO webhooks (id, owner, url, secret, events, created_at) VALUES ($1, $2, $3, $4, $5, $6)
+	`, hook.ID, hook.Owner, hook.URL, hook.Secret, events, hook.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+		return storage.ErrConflict
+	}
+	return err
+}
+
+// GetWebhooks возвращает подписки владельца в порядке создания.
+func (s *Storage) GetWebhooks(ctx context.Context, owner string) ([]storage.Webhook, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, owner, url, secret, events, created_at FROM webhooks
+		WHERE owner = $1 ORDER BY created_at, id
+	`, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []storage.Webhook
+	for rows.Next() {
+		var hook storage.Webhook
+		if err := rows.Scan(&hook.ID, &hook.Owner, &hook.URL, &hook.Secret, &hook.Events, &hook.CreatedAt); err != nil {
+			return nil, err
+		}
+		if len(hook.Events) == 0 {
+			hook.Events = nil
+		}
+		result = append(result, hook)
+	}
+	return result, rows.Err()
+}
+
+// DeleteWebhook удаляет подписку владельца.
+func (s *Storage) DeleteWebhook(ctx context.Context, owner string, id string) error {
+	tag, err := s.pool.Exec(ctx, `
+		DELETE FROM webhooks WHERE id = $1 AND owner = $2
+	`, id, owner)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package pgstorage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/divanov-web/shorturl/internal/storage"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// CreateWorkspace создаёт рабочее пространство и его владельца в одной транзакции.
+func (s *Storage) CreateWorkspace(ctx context.Context, ws storage.Workspace, ownerID string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO workspaces (id, name, created_at) VALUES ($1, $2, $3)
+	`, ws.ID, ws.Name, ws.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+		return storage.ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, `
+		INSERT INTO workspace_members (workspace_id, user_guid, role) VALUES ($1, $2, $3)
+	`, ws.ID, ownerID, storage.RoleOwner); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// GetWorkspace возвращает рабочее пространство по идентификатору.
+func (s *Storage) GetWorkspace(ctx context.Context, id string) (storage.Workspace, error) {
+	var ws storage.Workspace
+	err := s.pool.QueryRow(ctx, `
+		SELECT id, name, created_at FROM workspaces WHERE id = $1
+	`, id).Scan(&ws.ID, &ws.Name, &ws.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storage.Workspace{}, storage.ErrNotFound
+	}
+	return ws, err
+}
+
+// GetUserWorkspaces возвращает членство пользователя в рабочих пространствах в порядке их идентификаторов.
+func (s *Storage) GetUserWorkspaces(ctx context.Context, userID string) ([]storage.WorkspaceMember, error) {
+	return s.queryMembers(ctx, `
+		SELECT workspace_id, user_guid, role FROM workspace_members
+		WHERE user_guid = $1 ORDER BY workspace_id
+	`, userID)
+}
+
+// GetWorkspaceMembers возвращает участников рабочего пространства в порядке их идентификаторов.
+func (s *Storage) GetWorkspaceMembers(ctx context.Context, workspaceID string) ([]storage.WorkspaceMember, error) {
+	return s.queryMembers(ctx, `
+		SELECT workspace_id, user_guid, role FROM workspace_members
+		WHERE workspace_id = $1 ORDER BY user_guid
+	`, workspaceID)
+}
+
+// queryMembers читает участников, выбранных запросом.
+func (s *Storage) queryMembers(ctx context.Context, query string, args ...any) ([]storage.WorkspaceMember, error) {
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []storage.WorkspaceMember
+	for rows.Next() {
+		var m storage.WorkspaceMember
+		if err := rows.Scan(&m.WorkspaceID, &m.UserID, &m.Role); err != nil {
+			return nil, err
+		}
+		result = append(result, m)
+	}
+	return result, rows.Err()
+}
+
+// GetWorkspaceMember возвращает участника рабочего пространства.
+func (s *Storage) GetWorkspaceMember(ctx context.Context, workspaceID string, userID string) (storage.WorkspaceMember, error) {
+	m := storage.WorkspaceMember{WorkspaceID: workspaceID, UserID: userID}
+	err := s.pool.QueryRow(ctx, `
+		SELECT role FROM workspace_members WHERE workspace_id = $1 AND user_guid = $2
+	`, workspaceID, userID).Scan(&m.Role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storage.WorkspaceMember{}, storage.ErrNotFound
+	}
+	return m, err
+}
+
+// SetWorkspaceMember добавляет участника или меняет его роль.
+func (s *Storage) SetWorkspaceMember(ctx context.Context, member storage.WorkspaceMember) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO workspace_members (workspace_id, user_guid, role) VALUES ($1, $2, $3)
+		ON CONFLICT (workspace_id, user_guid) DO UPDATE SET role = EXCLUDED.role
+	`, member.WorkspaceID, member.UserID, member.Role)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ForeignKeyViolation {
+		return storage.ErrNotFound
+	}
+	return err
+}
+
+// RemoveWorkspaceMember убирает участника из рабочего пространства.
+func (s *Storage) RemoveWorkspaceMember(ctx context.Context, workspaceID string, userID string) error {
+	tag, err := s.pool.Exec(ctx, `
+		DELETE FROM workspace_members WHERE workspace_id = $1 AND user_guid = $2
+	`, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// SaveInvite сохраняет приглашение в рабочее пространство.
+func (s *Storage) SaveInvite(ctx context.Context, invite storage.WorkspaceInvite) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO workspace_invites (token, workspace_id, role, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, invite.Token, invite.WorkspaceID, invite.Role, invite.CreatedBy, invite.ExpiresAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ForeignKeyViolation {
+		return storage.ErrNotFound
+	}
+	return err
+}
+
+// TakeInvite удаляет приглашение и возвращает его. Параллельный запрос с тем же токеном получит ErrNotFound.
+func (s *Storage) TakeInvite(ctx context.Context, token string) (storage.WorkspaceInvite, error) {
+	var invite storage.WorkspaceInvite
+	err := s.pool.QueryRow(ctx, `
+		DELETE FROM workspace_invites WHERE token = $1
+		RETURNING token, workspace_id, role, created_by, expires_at
+	`, token).Scan(&invite.Token, &invite.WorkspaceID, &invite.Role, &invite.CreatedBy, &invite.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storage.WorkspaceInvite{}, storage.ErrNotFound
+	}
+	return invite, err
+}
@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Webhook адрес, на который отправляются события ссылок владельца.
+// Owner — владелец ссылок: пользователь или рабочее пространство (см. WorkspaceOwner).
+// Secret подписывает тело запроса HMAC-SHA256. Пустой Events — подписка на все события.
+type Webhook struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret"`
+	Events    []string  `json:"events,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookStorage хранение подписок на события ссылок.
+// SaveWebhook возвращает ErrConflict, если подписка с таким идентификатором уже есть,
+// DeleteWebhook — ErrNotFound, если у владельца нет такой подписки.
+type WebhookStorage interface {
+	SaveWebhook(ctx context.Context, hook Webhook) error
+	GetWebhooks(ctx context.Context, owner string) ([]Webhook, error)
+	DeleteWebhook(ctx context.Context, owner string, id string) error
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// WorkspaceRole роль участника рабочего пространства.
+type WorkspaceRole string
+
+const (
+	// RoleOwner управляет участниками и приглашениями, может всё, что может редактор.
+	RoleOwner WorkspaceRole = "owner"
+	// RoleEditor создаёт, меняет и удаляет ссылки рабочего пространства.
+	RoleEditor WorkspaceRole = "editor"
+	// RoleViewer только просматривает ссылки и их статистику.
+	RoleViewer WorkspaceRole = "viewer"
+)
+
+// workspaceOwnerPrefix префикс владельца ссылок рабочего пространства.
+// Идентификаторы пользователей — UUID, поэтому пересечься с ним не могут.
+const workspaceOwnerPrefix = "workspace:"
+
+// WorkspaceOwner возвращает владельца, от имени которого хранятся ссылки рабочего пространства.
+// Его можно передавать во все методы Storage вместо userID: ссылки, список и удаление работают так же, как у пользователя.
+func WorkspaceOwner(workspaceID string) string {
+	return workspaceOwnerPrefix + workspaceID
+}
+
+// WorkspaceOf возвращает рабочее пространство владельца ссылки, для ссылки пользователя — пустую строку.
+func WorkspaceOf(owner string) string {
+	workspaceID, _ := strings.CutPrefix(owner, workspaceOwnerPrefix)
+	if workspaceID == owner {
+		return ""
+	}
+	return workspaceID
+}
+
+// Workspace рабочее пространство, в котором ссылками управляют несколько пользователей.
+type Workspace struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WorkspaceMember участник рабочего пространства.
+type WorkspaceMember struct {
+	WorkspaceID string        `json:"workspace_id"`
+	UserID      string        `json:"user_id"`
+	Role        WorkspaceRole `json:"role"`
+}
+
+// WorkspaceInvite приглашение в рабочее пространство, используется один раз.
+type WorkspaceInvite struct {
+	Token       string        `json:"token"`
+	WorkspaceID string        `json:"workspace_id"`
+	Role        WorkspaceRole `json:"role"`
+	CreatedBy   string        `json:"created_by"`
+	ExpiresAt   time.Time     `json:"expires_at"`
+}
+
+// WorkspaceStorage хранение рабочих пространств, участников и приглашений.
+// Для отсутствующих записей методы возвращают ErrNotFound.
+type WorkspaceStorage interface {
+	// CreateWorkspace создаёт рабочее пространство, ownerID становится его владельцем.
+	CreateWorkspace(ctx context.Context, ws Workspace, ownerID string) error
+	GetWorkspace(ctx context.Context, id string) (Workspace, error)
+	// GetUserWorkspaces возвращает членство пользователя во всех его рабочих пространствах.
+	GetUserWorkspaces(ctx context.Context, userID string) ([]WorkspaceMember, error)
+	GetWorkspaceMembers(ctx context.Context, workspaceID string) ([]WorkspaceMember, error)
+	GetWorkspaceMember(ctx context.Context, workspaceID string, userID string) (WorkspaceMember, error)
+	// SetWorkspaceMember добавляет участника или меняет его роль.
+	SetWorkspaceMember(ctx context.Context, member WorkspaceMember) error
+	RemoveWorkspaceMember(ctx context.Context, workspaceID string, userID string) error
+	SaveInvite(ctx context.Context, invite WorkspaceInvite) error
+	// TakeInvite возвращает приглашение и удаляет его, так что воспользоваться им можно только один раз.
+	TakeInvite(ctx context.Context, token string) (WorkspaceInvite, error)
+}
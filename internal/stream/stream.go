@@ -0,0 +1,158 @@
+// Package stream рассылает события ссылок подключённым клиентам в реальном времени.
+package stream
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/divanov-web/shorturl/internal/storage"
+	"github.com/divanov-web/shorturl/internal/webhook"
+)
+
+// Source откуда шина берёт владельца ссылки, если он не указан в событии.
+type Source interface {
+	GetLink(ctx context.Context, id string) (storage.UserURL, error)
+}
+
+// Hub шина событий ссылок. Публикация никогда не блокирует: при переполнении очереди шины
+// событие отбрасывается, а медленный подписчик теряет события, не переполнившие только его буфер.
+type Hub struct {
+	src    Source
+	events chan webhook.Event
+	buffer int
+
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// Subscription подписка на события ссылок одного владельца.
+type Subscription struct {
+	hub     *Hub
+	owner   string
+	ch      chan webhook.Event
+	dropped atomic.Int64
+}
+
+// NewHub создаёт шину с очередью queueSize событий и буфером buffer событий на подписчика.
+// Рассылка начинается после Start.
+func NewHub(src Source, queueSize int, buffer int) *Hub {
+	return &Hub{
+		src:    src,
+		events: make(chan webhook.Event, queueSize),
+		buffer: buffer,
+		subs:   make(map[*Subscription]struct{}),
+	}
+}
+
+// Start запускает рассылку до отмены ctx, после чего шина закрывается.
+func (h *Hub) Start(ctx context.Context) {
+	go h.run(ctx)
+}
+
+// Publish ставит событие в очередь рассылки. Если очередь переполнена, событие отбрасывается и возвращается false.
+func (h *Hub) Publish(e webhook.Event) bool {
+	select {
+	case h.events <- webhook.Stamp(e):
+		return true
+	default:
+		return false
+	}
+}
+
+// Subscribe подписывает на события ссылок владельца owner. Подписку нужно закрыть через Close.
+// У закрытой шины канал подписки сразу закрыт.
+func (h *Hub) Subscribe(owner string) *Subscription {
+	sub := &Subscription{hub: h, owner: owner, ch: make(chan webhook.Event, h.buffer)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(sub.ch)
+		return sub
+	}
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+// Close закрывает шину и каналы всех подписок, чтобы открытые потоки завершились.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for sub := range h.subs {
+		close(sub.ch)
+	}
+	h.subs = nil
+}
+
+// run разбирает очередь и раздаёт события подписчикам владельца.
+func (h *Hub) run(ctx context.Context) {
+	defer h.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-h.events:
+			if !h.hasSubscribers() {
+				continue
+			}
+			if e.Owner == "" {
+				link, err := h.src.GetLink(ctx, e.ShortURL)
+				if err != nil {
+					continue
+				}
+				e.Owner, e.OriginalURL = link.UserID, link.OriginalURL
+			}
+			h.broadcast(e)
+		}
+	}
+}
+
+// hasSubscribers проверяет, есть ли кому рассылать, чтобы без подписчиков не искать владельцев ссылок.
+func (h *Hub) hasSubscribers() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs) > 0
+}
+
+// broadcast отправляет событие подписчикам владельца, не дожидаясь медленных.
+func (h *Hub) broadcast(e webhook.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		if sub.owner != e.Owner {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// Events канал событий подписки. Закрывается вместе с подпиской или шиной.
+func (s *Subscription) Events() <-chan webhook.Event {
+	return s.ch
+}
+
+// Dropped возвращает число событий, потерянных из-за переполнения буфера с прошлого вызова, и обнуляет его.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Swap(0)
+}
+
+// Close отписывает от событий. Повторный вызов ничего не делает.
+func (s *Subscription) Close() {
+	h := s.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[s]; !ok {
+		return
+	}
+	delete(h.subs, s)
+	close(s.ch)
+}
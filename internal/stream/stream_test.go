@@ -0,0 +1,84 @@
+package stream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/divanov-web/shorturl/internal/storage"
+	"github.com/divanov-web/shorturl/internal/storage/memorystorage"
+	"github.com/divanov-web/shorturl/internal/webhook"
+)
+
+func receive(t *testing.T, sub *Subscription) webhook.Event {
+	t.Helper()
+	select {
+	case e := <-sub.Events():
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event")
+		return webhook.Event{}
+	}
+}
+
+func TestHub(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := memorystorage.NewTestStorage()
+	id, err := store.SaveURL(ctx, "alice", storage.NewLink{OriginalURL: "https://a.com/"})
+	require.NoError(t, err)
+
+	hub := NewHub(store, 10, 2)
+	hub.Start(ctx)
+	alice := hub.Subscribe("alice")
+	defer alice.Close()
+	bob := hub.Subscribe("bob")
+
+	// владельца перехода шина находит по ссылке, чужие события не приходят
+	require.True(t, hub.Publish(webhook.Event{Type: webhook.EventLinkCreated, Owner: "bob", ShortURL: "b"}))
+	require.True(t, hub.Publish(webhook.Event{Type: webhook.EventLinkClicked, ShortURL: id}))
+	e := receive(t, alice)
+	assert.Equal(t, webhook.EventLinkClicked, e.Type)
+	assert.Equal(t, "alice", e.Owner)
+	assert.Equal(t, "https://a.com/", e.OriginalURL)
+	assert.NotEmpty(t, e.ID)
+	assert.False(t, e.Time.IsZero())
+	assert.Equal(t, webhook.EventLinkCreated, receive(t, bob).Type)
+
+	// медленный подписчик теряет события сверх буфера, но шина не ждёт его
+	for range 5 {
+		require.True(t, hub.Publish(webhook.Event{Type: webhook.EventLinkCreated, Owner: "alice", ShortURL: id}))
+	}
+	require.Eventually(t, func() bool { return alice.dropped.Load() == 3 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(3), alice.Dropped())
+	assert.Equal(t, int64(0), alice.Dropped())
+	receive(t, alice)
+	receive(t, alice)
+
+	bob.Close()
+	bob.Close()
+	_, open := <-bob.Events()
+	assert.False(t, open)
+
+	// после остановки шины каналы подписок закрыты
+	cancel()
+	require.Eventually(t, func() bool {
+		select {
+		case _, open := <-alice.Events():
+			return !open
+		default:
+			return false
+		}
+	}, 2*time.Second, 10*time.Millisecond)
+	_, open = <-hub.Subscribe("carol").Events()
+	assert.False(t, open)
+}
+
+func TestHub_PublishDoesNotBlock(t *testing.T) {
+	hub := NewHub(nil, 1, 1)
+	assert.True(t, hub.Publish(webhook.Event{Owner: "alice"}))
+	assert.False(t, hub.Publish(webhook.Event{Owner: "alice"}))
+}
@@ -0,0 +1,72 @@
+// Package netguard распознаёт адреса loopback, частных и служебных сетей,
+// на которые сервис не должен обращаться по адресам от пользователей.
+package netguard
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// cgnat сеть операторского NAT (RFC 6598), снаружи она недоступна так же, как частные сети.
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0).To4(), Mask: net.CIDRMask(10, 32)}
+
+// thisNetwork сеть 0.0.0.0/8 «этот хост», в Linux подключение к ней доходит до локальных сервисов.
+var thisNetwork = &net.IPNet{IP: net.IPv4(0, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)}
+
+// IsPrivateIP проверяет адреса loopback, частных сетей, CGNAT, 0.0.0.0/8, link-local и неуказанный адрес.
+func IsPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		cgnat.Contains(ip) || thisNetwork.Contains(ip)
+}
+
+// ParseIP разбирает IP-литерал хоста, в том числе числовые формы IPv4, которые понимают
+// браузеры и системный resolver: 2130706433, 0x7f.1, 127.1, 0177.0.0.1. Для имён возвращает nil.
+func ParseIP(host string) net.IP {
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		host = host[:i] // зона IPv6 на адрес не влияет
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip
+	}
+
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+	var addr uint64
+	for i, part := range parts {
+		n, ok := parseIPv4Part(part)
+		if !ok {
+			return nil
+		}
+		if i < len(parts)-1 {
+			if n > 0xff {
+				return nil
+			}
+			addr |= n << (8 * (3 - i))
+			continue
+		}
+		// последняя часть занимает все оставшиеся байты адреса
+		if n >= 1<<(8*(4-i)) {
+			return nil
+		}
+		addr |= n
+	}
+	return net.IPv4(byte(addr>>24), byte(addr>>16), byte(addr>>8), byte(addr))
+}
+
+// parseIPv4Part разбирает часть адреса IPv4: десятичную, восьмеричную с ведущим 0 или шестнадцатеричную с 0x.
+func parseIPv4Part(s string) (uint64, bool) {
+	base := 10
+	switch {
+	case len(s) > 2 && (s[:2] == "0x" || s[:2] == "0X"):
+		s, base = s[2:], 16
+	case len(s) > 1 && s[0] == '0':
+		s, base = s[1:], 8
+	}
+	n, err := strconv.ParseUint(s, base, 32)
+	return n, err == nil
+}
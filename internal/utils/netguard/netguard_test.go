@@ -0,0 +1,75 @@
+package netguard
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIP(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "127.0.0.1", want: "127.0.0.1"},
+		{host: "2130706433", want: "127.0.0.1"},
+		{host: "0x7f.1", want: "127.0.0.1"},
+		{host: "127.1", want: "127.0.0.1"},
+		{host: "0177.0.0.1", want: "127.0.0.1"},
+		{host: "10.1.257", want: "10.1.1.1"},
+		{host: "::1", want: "::1"},
+		{host: "[fe80::1%eth0]", want: "fe80::1"},
+		{host: "example.com", want: ""},
+		{host: "1.2.3.com", want: ""},
+		{host: "256.0.0.1", want: ""},
+		{host: "1.2.3.4.5", want: ""},
+		{host: "4294967296", want: ""},
+		{host: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			ip := ParseIP(tt.host)
+			if tt.want == "" {
+				assert.Nil(t, ip)
+				return
+			}
+			assert.True(t, net.ParseIP(tt.want).Equal(ip), "got %v", ip)
+		})
+	}
+}
+
+func TestIsPrivateIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "127.0.0.1", want: true},
+		{ip: "10.0.0.1", want: true},
+		{ip: "172.16.0.1", want: true},
+		{ip: "192.168.1.1", want: true},
+		{ip: "100.64.0.1", want: true},
+		{ip: "100.127.255.255", want: true},
+		{ip: "169.254.169.254", want: true},
+		{ip: "0.0.0.0", want: true},
+		{ip: "0.1.2.3", want: true},
+		{ip: "0.255.255.255", want: true},
+		{ip: "::ffff:0.1.2.3", want: true},
+		{ip: "1.0.0.1", want: false},
+		{ip: "::1", want: true},
+		{ip: "::", want: true},
+		{ip: "fe80::1", want: true},
+		{ip: "fd00::1", want: true},
+		{ip: "::ffff:127.0.0.1", want: true},
+		{ip: "100.128.0.1", want: false},
+		{ip: "93.184.216.34", want: false},
+		{ip: "2606:4700::1111", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsPrivateIP(net.ParseIP(tt.ip)))
+		})
+	}
+}
@@ -0,0 +1,452 @@
+// Package webhook доставка событий ссылок на адреса подписчиков.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/divanov-web/shorturl/internal/storage"
+	"github.com/divanov-web/shorturl/internal/utils/netguard"
+)
+
+// События, на которые можно подписаться.
+const (
+	EventLinkCreated = "link.created"
+	EventLinkDeleted = "link.deleted"
+	EventLinkClicked = "link.clicked"
+)
+
+// Events все известные события.
+var Events = []string{EventLinkCreated, EventLinkDeleted, EventLinkClicked}
+
+// Заголовки запроса доставки. Подпись считается от "<timestamp>.<тело>", см. Sign.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Статусы попыток доставки в журнале.
+const (
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed" // попытка не удалась, будет повтор
+	StatusDead      = "dead"   // попытки кончились, доставка ушла в список недоставленных
+)
+
+// ErrNotFound Ошибка недоставленное событие не найдено
+var ErrNotFound = errors.New("dead letter not found")
+
+// ErrPrivateAddress Ошибка адрес подписчика ведёт в loopback, частную или служебную сеть
+var ErrPrivateAddress = errors.New("webhook address is private")
+
+// Event событие ссылки, тело запроса доставки.
+type Event struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Time        time.Time `json:"time"`
+	Owner       string    `json:"owner"`
+	ShortURL    string    `json:"short_url"`
+	OriginalURL string    `json:"original_url,omitempty"`
+}
+
+// Delivery запись журнала о попытке доставки. Повторные попытки одной доставки имеют общий ID.
+type Delivery struct {
+	ID          string    `json:"id"`
+	WebhookID   string    `json:"webhook_id"`
+	Owner       string    `json:"-"`
+	EventID     string    `json:"event_id"`
+	Event       string    `json:"event"`
+	Attempt     int       `json:"attempt"`
+	Status      string    `json:"status"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Time        time.Time `json:"time"`
+	NextAttempt time.Time `json:"next_attempt,omitzero"`
+}
+
+// DeadLetter доставка, для которой исчерпаны все попытки. Её можно отправить заново через Redeliver.
+type DeadLetter struct {
+	DeliveryID string    `json:"delivery_id"`
+	WebhookID  string    `json:"webhook_id"`
+	Event      Event     `json:"event"`
+	Attempts   int       `json:"attempts"`
+	LastError  string    `json:"last_error"`
+	FailedAt   time.Time `json:"failed_at"`
+	hook       storage.Webhook
+}
+
+// Source откуда диспетчер берёт подписки владельца и владельца ссылки, если он не указан в событии.
+type Source interface {
+	GetLink(ctx context.Context, id string) (storage.UserURL, error)
+	GetWebhooks(ctx context.Context, owner string) ([]storage.Webhook, error)
+}
+
+// Config настройки диспетчера.
+type Config struct {
+	// Workers сколько доставок выполняется одновременно.
+	Workers int
+	// QueueSize сколько событий ждут разбора; при переполнении новые события отбрасываются.
+	QueueSize int
+	// MaxAttempts сколько раз пытаться доставить событие, прежде чем отправить его в недоставленные.
+	MaxAttempts int
+	// InitialBackoff пауза перед первым повтором, каждая следующая вдвое больше, но не больше MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Timeout время ожидания ответа подписчика.
+	Timeout time.Duration
+	// LogSize сколько последних попыток и недоставленных событий хранится в памяти.
+	LogSize int
+	// AllowPrivateHosts разрешает доставку на loopback, частные и служебные адреса.
+	AllowPrivateHosts bool
+}
+
+// DefaultConfig настройки диспетчера по умолчанию.
+func DefaultConfig() Config {
+	return Config{
+		Workers:        4,
+		QueueSize:      1000,
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Minute,
+		Timeout:        10 * time.Second,
+		LogSize:        1000,
+	}
+}
+
+// job одна доставка события на одну подписку.
+type job struct {
+	id      string
+	hook    storage.Webhook
+	event   Event
+	body    []byte
+	attempt int
+}
+
+// Dispatcher разбирает события по подпискам в фоне и доставляет их с повторами.
+// Журнал попыток и недоставленные события хранятся в памяти и не переживают перезапуск.
+type Dispatcher struct {
+	src    Source
+	cfg    Config
+	client *http.Client
+	events chan Event
+	jobs   chan job
+	// ctx время жизни диспетчера, задаётся в Start; по нему повторные доставки прекращаются
+	ctx context.Context
+
+	mu         sync.Mutex
+	deliveries []Delivery
+	dead       []DeadLetter
+}
+
+// NewDispatcher создаёт диспетчер. Доставка начинается после Start.
+// Редиректы подписчиков не выполняются: ответ 3xx считается неудачной попыткой.
+// Без AllowPrivateHosts адрес проверяется после разрешения имени при каждом соединении,
+// поэтому DNS-имя не может указать на внутреннюю сеть.
+func NewDispatcher(src Source, cfg Config) *Dispatcher {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !cfg.AllowPrivateHosts {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: rejectPrivate}
+		transport.DialContext = dialer.DialContext
+		// через прокси проверялся бы только адрес самого прокси
+		transport.Proxy = nil
+	}
+	return &Dispatcher{
+		src: src,
+		cfg: cfg,
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		events: make(chan Event, cfg.QueueSize),
+		jobs:   make(chan job, cfg.Workers),
+		ctx:    context.Background(),
+	}
+}
+
+// rejectPrivate запрещает соединение с loopback, частными и служебными адресами.
+// Вызывается для уже разрешённого адреса, перед подключением.
+func rejectPrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || netguard.IsPrivateIP(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+// Start запускает разбор событий и доставку до отмены ctx.
+func (d *Dispatcher) Start(ctx context.Context) {
+	d.ctx = ctx
+	go d.fanout(ctx)
+	for range d.cfg.Workers {
+		go d.work(ctx)
+	}
+}
+
+// Publish ставит событие в очередь, не дожидаясь доставки. Пустые ID и Time заполняются.
+// Если очередь переполнена, событие отбрасывается и возвращается false.
+func (d *Dispatcher) Publish(e Event) bool {
+	e = Stamp(e)
+	select {
+	case d.events <- e:
+		return true
+	default:
+		return false
+	}
+}
+
+// fanout находит подписки на каждое событие и ставит доставки в очередь воркеров.
+func (d *Dispatcher) fanout(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-d.events:
+			if e.Owner == "" {
+				link, err := d.src.GetLink(ctx, e.ShortURL)
+				if err != nil {
+					continue
+				}
+				e.Owner, e.OriginalURL = link.UserID, link.OriginalURL
+			}
+			hooks, err := d.src.GetWebhooks(ctx, e.Owner)
+			if err != nil || len(hooks) == 0 {
+				continue
+			}
+			body, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			for _, hook := range hooks {
+				if len(hook.Events) > 0 && !slices.Contains(hook.Events, e.Type) {
+					continue
+				}
+				d.enqueue(ctx, job{id: newID(), hook: hook, event: e, body: body})
+			}
+		}
+	}
+}
+
+// enqueue передаёт доставку воркерам, ожидая свободного места.
+func (d *Dispatcher) enqueue(ctx context.Context, j job) {
+	select {
+	case d.jobs <- j:
+	case <-ctx.Done():
+	}
+}
+
+// work выполняет доставки из очереди.
+func (d *Dispatcher) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-d.jobs:
+			d.deliver(ctx, j)
+		}
+	}
+}
+
+// deliver делает очередную попытку доставки и по её итогу планирует повтор или отправляет доставку в недоставленные.
+func (d *Dispatcher) deliver(ctx context.Context, j job) {
+	j.attempt++
+	code, err := d.send(ctx, j)
+	rec := Delivery{
+		ID:         j.id,
+		WebhookID:  j.hook.ID,
+		Owner:      j.hook.Owner,
+		EventID:    j.event.ID,
+		Event:      j.event.Type,
+		Attempt:    j.attempt,
+		Status:     StatusDelivered,
+		StatusCode: code,
+		Time:       time.Now().UTC(),
+	}
+	if err == nil {
+		d.record(rec)
+		return
+	}
+	rec.Error = err.Error()
+
+	if j.attempt >= d.cfg.MaxAttempts {
+		rec.Status = StatusDead
+		d.record(rec)
+		d.bury(DeadLetter{
+			DeliveryID: j.id,
+			WebhookID:  j.hook.ID,
+			Event:      j.event,
+			Attempts:   j.attempt,
+			LastError:  rec.Error,
+			FailedAt:   rec.Time,
+			hook:       j.hook,
+		})
+		return
+	}
+
+	delay := d.backoff(j.attempt)
+	rec.Status = StatusFailed
+	rec.NextAttempt = rec.Time.Add(delay)
+	d.record(rec)
+	time.AfterFunc(delay, func() { d.enqueue(ctx, j) })
+}
+
+// send отправляет подписанное событие. Успехом считается только ответ 2xx.
+func (d *Dispatcher) send(ctx context.Context, j job) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.hook.URL, bytes.NewReader(j.body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, j.event.Type)
+	req.Header.Set(HeaderDelivery, j.id)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(j.hook.Secret, timestamp, j.body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// дочитываем немного тела, чтобы соединение вернулось в пул
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff пауза перед повтором после попытки attempt.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.cfg.InitialBackoff
+	for i := 1; i < attempt && delay < d.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, d.cfg.MaxBackoff)
+}
+
+// record добавляет попытку в журнал, самые старые записи сверх LogSize отбрасываются.
+func (d *Dispatcher) record(rec Delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deliveries = append(d.deliveries, rec)
+	if extra := len(d.deliveries) - d.cfg.LogSize; extra > 0 {
+		d.deliveries = append(d.deliveries[:0], d.deliveries[extra:]...)
+	}
+}
+
+// bury добавляет доставку в недоставленные, самые старые сверх LogSize отбрасываются.
+func (d *Dispatcher) bury(dl DeadLetter) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dead = append(d.dead, dl)
+	if extra := len(d.dead) - d.cfg.LogSize; extra > 0 {
+		d.dead = append(d.dead[:0], d.dead[extra:]...)
+	}
+}
+
+// Deliveries возвращает до limit последних попыток доставки подписки от новых к старым, 0 — все.
+func (d *Dispatcher) Deliveries(owner string, webhookID string, limit int) []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var result []Delivery
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		rec := d.deliveries[i]
+		if rec.Owner != owner || rec.WebhookID != webhookID {
+			continue
+		}
+		result = append(result, rec)
+		if limit > 0 && len(result) == limit {
+			break
+		}
+	}
+	return result
+}
+
+// DeadLetters возвращает недоставленные события подписки от новых к старым.
+func (d *Dispatcher) DeadLetters(owner string, webhookID string) []DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var result []DeadLetter
+	for i := len(d.dead) - 1; i >= 0; i-- {
+		if dl := d.dead[i]; dl.hook.Owner == owner && dl.WebhookID == webhookID {
+			result = append(result, dl)
+		}
+	}
+	return result
+}
+
+// Redeliver убирает событие из недоставленных и снова ставит его в доставку с полным числом попыток.
+func (d *Dispatcher) Redeliver(owner string, deliveryID string) error {
+	d.mu.Lock()
+	i := slices.IndexFunc(d.dead, func(dl DeadLetter) bool {
+		return dl.DeliveryID == deliveryID && dl.hook.Owner == owner
+	})
+	if i < 0 {
+		d.mu.Unlock()
+		return ErrNotFound
+	}
+	dl := d.dead[i]
+	d.dead = slices.Delete(d.dead, i, i+1)
+	d.mu.Unlock()
+
+	body, err := json.Marshal(dl.Event)
+	if err != nil {
+		return err
+	}
+	go d.enqueue(d.ctx, job{id: dl.DeliveryID, hook: dl.hook, event: dl.Event, body: body})
+	return nil
+}
+
+// Sign возвращает подпись тела запроса: sha256= и hex HMAC-SHA256 от "<timestamp>.<body>" на секрете подписки.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверяет подпись за постоянное время. Подписчику стоит также отклонять слишком старый timestamp.
+func Verify(secret string, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Stamp заполняет пустые ID и Time события, чтобы все получатели видели одно и то же событие.
+func Stamp(e Event) Event {
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	return e
+}
+
+// newID случайный идентификатор события или доставки.
+func newID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,179 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/divanov-web/shorturl/internal/storage"
+	"github.com/divanov-web/shorturl/internal/storage/memorystorage"
+)
+
+// receiver тестовый подписчик: отвечает кодами из очереди, потом 200, и запоминает доставки.
+type receiver struct {
+	mu       sync.Mutex
+	codes    []int
+	received []Event
+	headers  []http.Header
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	code := http.StatusOK
+	if len(rc.codes) > 0 {
+		code, rc.codes = rc.codes[0], rc.codes[1:]
+	}
+	if code == http.StatusOK {
+		var e Event
+		_ = json.Unmarshal(body, &e)
+		rc.received = append(rc.received, e)
+		rc.headers = append(rc.headers, r.Header.Clone())
+		rc.bodies = append(rc.bodies, body)
+	}
+	w.WriteHeader(code)
+}
+
+func (rc *receiver) count() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.received)
+}
+
+func TestDispatcher(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := memorystorage.NewTestStorage()
+	id, err := store.SaveURL(ctx, "alice", storage.NewLink{OriginalURL: "https://a.com/"})
+	require.NoError(t, err)
+
+	flaky := &receiver{codes: []int{http.StatusInternalServerError, http.StatusBadGateway}}
+	flakySrv := httptest.NewServer(flaky)
+	defer flakySrv.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	require.NoError(t, store.SaveWebhook(ctx, storage.Webhook{ID: "flaky", Owner: "alice", URL: flakySrv.URL, Secret: "s1", CreatedAt: time.Now()}))
+	require.NoError(t, store.SaveWebhook(ctx, storage.Webhook{ID: "broken", Owner: "alice", URL: broken.URL, Secret: "s2",
+		Events: []string{EventLinkCreated}, CreatedAt: time.Now().Add(time.Second)}))
+
+	d := NewDispatcher(store, Config{
+		Workers:        2,
+		QueueSize:      10,
+		MaxAttempts:    3,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     20 * time.Millisecond,
+		Timeout:        time.Second,
+		LogSize:        100,
+		// тестовые подписчики слушают 127.0.0.1
+		AllowPrivateHosts: true,
+	})
+	d.Start(ctx)
+
+	require.True(t, d.Publish(Event{Type: EventLinkCreated, Owner: "alice", ShortURL: id, OriginalURL: "https://a.com/"}))
+	// владельца перехода диспетчер находит по ссылке
+	require.True(t, d.Publish(Event{Type: EventLinkClicked, ShortURL: id}))
+	// события ссылок других владельцев подписчикам alice не приходят
+	require.True(t, d.Publish(Event{Type: EventLinkCreated, Owner: "bob", ShortURL: "other"}))
+
+	require.Eventually(t, func() bool { return flaky.count() == 2 }, 2*time.Second, 10*time.Millisecond)
+	// попытка попадает в журнал после ответа подписчика
+	require.Eventually(t, func() bool { return len(d.Deliveries("alice", "flaky", 0)) == 4 }, 2*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool { return len(d.DeadLetters("alice", "broken")) == 1 }, 2*time.Second, 10*time.Millisecond)
+
+	flaky.mu.Lock()
+	types := map[string]Event{}
+	for i, e := range flaky.received {
+		types[e.Type] = e
+		h := flaky.headers[i]
+		assert.Equal(t, e.Type, h.Get(HeaderEvent))
+		assert.NotEmpty(t, h.Get(HeaderDelivery))
+		assert.True(t, Verify("s1", h.Get(HeaderTimestamp), flaky.bodies[i], h.Get(HeaderSignature)))
+		assert.False(t, Verify("s2", h.Get(HeaderTimestamp), flaky.bodies[i], h.Get(HeaderSignature)))
+	}
+	flaky.mu.Unlock()
+	require.Contains(t, types, EventLinkClicked)
+	assert.Equal(t, "alice", types[EventLinkClicked].Owner)
+	assert.Equal(t, "https://a.com/", types[EventLinkClicked].OriginalURL)
+
+	// неудачные попытки видны в журнале вместе с плановым временем повтора
+	var failed, delivered int
+	for _, rec := range d.Deliveries("alice", "flaky", 0) {
+		switch rec.Status {
+		case StatusFailed:
+			failed++
+			assert.False(t, rec.NextAttempt.IsZero())
+		case StatusDelivered:
+			delivered++
+		}
+	}
+	assert.Equal(t, 2, failed)
+	assert.Equal(t, 2, delivered)
+
+	// подписка только на создание не получает переходы, а после трёх неудач событие уходит в недоставленные
+	dead := d.DeadLetters("alice", "broken")[0]
+	assert.Equal(t, EventLinkCreated, dead.Event.Type)
+	assert.Equal(t, 3, dead.Attempts)
+	assert.Contains(t, dead.LastError, "503")
+	history := d.Deliveries("alice", "broken", 0)
+	require.Len(t, history, 3)
+	assert.Equal(t, StatusDead, history[0].Status)
+	assert.Empty(t, d.DeadLetters("bob", "broken"))
+
+	assert.ErrorIs(t, d.Redeliver("bob", dead.DeliveryID), ErrNotFound)
+	require.NoError(t, d.Redeliver("alice", dead.DeliveryID))
+	assert.Empty(t, d.DeadLetters("alice", "broken"))
+	require.Eventually(t, func() bool { return len(d.DeadLetters("alice", "broken")) == 1 }, 2*time.Second, 10*time.Millisecond)
+	assert.Len(t, d.Deliveries("alice", "broken", 0), 6)
+	assert.Len(t, d.Deliveries("alice", "broken", 2), 2)
+}
+
+func TestDispatcher_Backoff(t *testing.T) {
+	d := NewDispatcher(nil, Config{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second})
+	assert.Equal(t, time.Second, d.backoff(1))
+	assert.Equal(t, 2*time.Second, d.backoff(2))
+	assert.Equal(t, 4*time.Second, d.backoff(3))
+	assert.Equal(t, 5*time.Second, d.backoff(4))
+	assert.Equal(t, 5*time.Second, d.backoff(10))
+}
+
+func TestDispatcher_PrivateAddress(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rc := &receiver{}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	store := memorystorage.NewTestStorage()
+	require.NoError(t, store.SaveWebhook(ctx, storage.Webhook{ID: "local", Owner: "alice", URL: srv.URL, Secret: "s", CreatedAt: time.Now()}))
+
+	cfg := DefaultConfig()
+	cfg.MaxAttempts = 1
+	d := NewDispatcher(store, cfg)
+	d.Start(ctx)
+
+	// loopback отклоняется при соединении, запрос до подписчика не доходит
+	require.True(t, d.Publish(Event{Type: EventLinkCreated, Owner: "alice", ShortURL: "abc"}))
+	require.Eventually(t, func() bool { return len(d.DeadLetters("alice", "local")) == 1 }, 2*time.Second, 10*time.Millisecond)
+	assert.Contains(t, d.DeadLetters("alice", "local")[0].LastError, ErrPrivateAddress.Error())
+	assert.Zero(t, rc.count())
+
+	for _, addr := range []string{"127.0.0.1:80", "[::1]:443", "10.1.2.3:80", "169.254.169.254:80", "100.64.0.1:80", "0.0.0.0:80", "0.1.2.3:80", "[::ffff:192.168.0.1]:80"} {
+		assert.ErrorIs(t, rejectPrivate("tcp", addr, nil), ErrPrivateAddress, addr)
+	}
+	assert.NoError(t, rejectPrivate("tcp", "93.184.216.34:443", nil))
+}